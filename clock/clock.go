@@ -0,0 +1,186 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clock corrects the local clock using roughtime, without changing the
+// system clock.
+//
+// A Clock combines repeated samples of the offset of the local clock into an
+// estimate of the offset and of the frequency error (skew) of the local clock,
+// by fitting a line through the most recent samples, weighted by their
+// uncertainty. Its Now method returns the local time corrected by that
+// estimate.
+package clock // import "github.com/Merovius/notary/clock"
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// DefaultWindow is the number of samples used by a Clock with no Window set.
+const DefaultWindow = 8
+
+// MaxSkew is the largest frequency error assumed for the local clock. Larger
+// estimates are clamped, so that a few noisy samples can not make the clock
+// run away. It is the same as the maximum frequency error tolerated by NTP.
+const MaxSkew = 500e-6
+
+// Sample is a single measurement of the offset of the local clock.
+type Sample struct {
+	// Local is the local time the measurement was made at.
+	Local time.Time
+	// Offset is how far the local clock is behind: the true time at Local
+	// is Local.Add(Offset).
+	Offset time.Duration
+	// Uncertainty is how far the true offset can be from Offset.
+	Uncertainty time.Duration
+}
+
+// SampleOf returns the sample measured by a successful query. The local time
+// is the middle of the round trip and the uncertainty is the radius of the
+// server plus half the round-trip time.
+func SampleOf(r *roughtime.QueryResult) Sample {
+	return Sample{
+		Local:       r.Sent.Add(r.RTT / 2),
+		Offset:      r.Offset(),
+		Uncertainty: r.Uncertainty(),
+	}
+}
+
+// Clock is a corrected local clock. The zero value is ready to use and
+// returns the uncorrected local time until a sample is added. A Clock is safe
+// for concurrent use.
+type Clock struct {
+	// Window is the number of most recent samples the estimate is based
+	// on. If zero, DefaultWindow is used.
+	Window int
+
+	mu      sync.Mutex
+	samples []Sample
+	// The estimate is offset + skew*(t-ref) at local time t.
+	ref    time.Time
+	offset time.Duration
+	skew   float64
+
+	// now returns the local time. It is replaced in tests.
+	now func() time.Time
+}
+
+// Add adds a sample and updates the estimate.
+func (c *Clock) Add(s Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.Window
+	if w <= 0 {
+		w = DefaultWindow
+	}
+	c.samples = append(c.samples, s)
+	if len(c.samples) > w {
+		c.samples = slices.Delete(c.samples, 0, len(c.samples)-w)
+	}
+	c.fit()
+}
+
+// fit sets the estimate to the weighted least-squares line through the
+// samples, with weights inversely proportional to their squared uncertainty.
+func (c *Clock) fit() {
+	c.ref = c.samples[len(c.samples)-1].Local
+	var sw, sx, sy, sxx, sxy float64
+	for _, s := range c.samples {
+		u := max(s.Uncertainty, time.Microsecond).Seconds()
+		w := 1 / (u * u)
+		x := s.Local.Sub(c.ref).Seconds()
+		y := s.Offset.Seconds()
+		sw += w
+		sx += w * x
+		sy += w * y
+		sxx += w * x * x
+		sxy += w * x * y
+	}
+	mx, my := sx/sw, sy/sw
+	c.skew = 0
+	// With fewer than two distinct sample times, there is no slope.
+	if d := sxx - sx*mx; d > 1e-12*sw {
+		c.skew = min(max((sxy-sx*my)/d, -MaxSkew), MaxSkew)
+	}
+	c.offset = seconds(my - c.skew*mx)
+}
+
+// Estimate returns the current estimate of the offset of the local clock and
+// its frequency error, in seconds per second. ok is false if no sample has been
+// added yet.
+func (c *Clock) Estimate() (offset time.Duration, skew float64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.samples) == 0 {
+		return 0, 0, false
+	}
+	return c.offsetAt(c.localNow()), c.skew, true
+}
+
+// Now returns the local time, corrected by the current estimate.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.localNow()
+	if len(c.samples) == 0 {
+		return t
+	}
+	return t.Add(c.offsetAt(t))
+}
+
+func (c *Clock) offsetAt(t time.Time) time.Duration {
+	return c.offset + seconds(c.skew*t.Sub(c.ref).Seconds())
+}
+
+func (c *Clock) localNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Update queries the servers with rc and adds a sample, taken from the server
+// with the median offset, so that a minority of servers with wrong clocks can
+// not move the estimate arbitrarily. It returns the samples of all servers
+// that responded.
+func (c *Clock) Update(rc *roughtime.Client, servers []*roughtime.Server) ([]Sample, error) {
+	var samples []Sample
+	var err error
+	for _, r := range rc.Query(servers) {
+		if r.Err != nil {
+			err = r.Err
+			continue
+		}
+		samples = append(samples, SampleOf(&r))
+	}
+	if len(samples) == 0 {
+		if err == nil {
+			err = errors.New("no servers")
+		}
+		return nil, err
+	}
+	sorted := slices.Clone(samples)
+	slices.SortFunc(sorted, func(a, b Sample) int { return cmp.Compare(a.Offset, b.Offset) })
+	c.Add(sorted[len(sorted)/2])
+	return samples, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
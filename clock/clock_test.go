@@ -0,0 +1,87 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestClock(t *testing.T) {
+	var local time.Time
+	c := &Clock{now: func() time.Time { return local }}
+	local = epoch
+	if _, _, ok := c.Estimate(); ok {
+		t.Error("Estimate() without samples is ok")
+	}
+	if got := c.Now(); !got.Equal(epoch) {
+		t.Errorf("Now() without samples = %v, want %v", got, epoch)
+	}
+
+	// The local clock is 2s behind and loses 100µs per second. The noise
+	// alternates around the true offset.
+	const skew = 100e-6
+	for i := range 16 {
+		local = epoch.Add(time.Duration(i) * time.Minute)
+		offset := 2*time.Second + seconds(skew*local.Sub(epoch).Seconds())
+		noise := time.Millisecond
+		if i%2 == 1 {
+			noise = -noise
+		}
+		c.Add(Sample{Local: local, Offset: offset + noise, Uncertainty: 10 * time.Millisecond})
+	}
+	local = local.Add(time.Minute)
+	want := 2*time.Second + seconds(skew*local.Sub(epoch).Seconds())
+	offset, gotSkew, ok := c.Estimate()
+	if !ok || (offset-want).Abs() > 2*time.Millisecond || math.Abs(gotSkew-skew) > 5e-6 {
+		t.Errorf("Estimate() = %v, %g, %v, want %v, %g, true", offset, gotSkew, ok, want, skew)
+	}
+	if got := c.Now(); got.Sub(local.Add(want)).Abs() > 2*time.Millisecond {
+		t.Errorf("Now() = %v, want %v", got, local.Add(want))
+	}
+}
+
+func TestClockWeights(t *testing.T) {
+	c := &Clock{now: func() time.Time { return epoch }}
+	// Two samples at the same time: the precise one dominates and there
+	// is no skew.
+	c.Add(Sample{Local: epoch, Offset: time.Second, Uncertainty: time.Millisecond})
+	c.Add(Sample{Local: epoch, Offset: 2 * time.Second, Uncertainty: time.Second})
+	offset, skew, _ := c.Estimate()
+	if (offset-time.Second).Abs() > time.Millisecond || skew != 0 {
+		t.Errorf("Estimate() = %v, %g, want about 1s, 0", offset, skew)
+	}
+
+	// Wildly inconsistent samples are clamped to MaxSkew.
+	c = &Clock{now: func() time.Time { return epoch.Add(time.Second) }}
+	c.Add(Sample{Local: epoch, Offset: 0, Uncertainty: time.Millisecond})
+	c.Add(Sample{Local: epoch.Add(time.Second), Offset: time.Second, Uncertainty: time.Millisecond})
+	if _, skew, _ := c.Estimate(); skew != MaxSkew {
+		t.Errorf("Estimate() has skew %g, want %g", skew, MaxSkew)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	c := &Clock{Window: 2, now: func() time.Time { return epoch.Add(2 * time.Second) }}
+	c.Add(Sample{Local: epoch, Offset: time.Hour, Uncertainty: time.Millisecond})
+	c.Add(Sample{Local: epoch.Add(time.Second), Offset: time.Second, Uncertainty: time.Millisecond})
+	c.Add(Sample{Local: epoch.Add(2 * time.Second), Offset: time.Second, Uncertainty: time.Millisecond})
+	if offset, _, _ := c.Estimate(); offset != time.Second {
+		t.Errorf("Estimate() = %v, want 1s (first sample outside window)", offset)
+	}
+}
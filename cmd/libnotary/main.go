@@ -0,0 +1,148 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command libnotary is a C library to create and verify attestations, for
+// programs in other languages. Build it with
+//
+//	go build -buildmode=c-shared -o libnotary.so ./cmd/libnotary
+//
+// which also writes the header libnotary.h. All functions return one of the
+// NOTARY_* status codes, which are those of notary.Status and the exit codes of
+// the notary command. On failure, if errOut is not NULL, *errOut is set to an
+// error message. Strings returned by the library must be freed with
+// notary_free.
+//
+// Attestations are passed as NUL-terminated strings in the JSON format of
+// chains. The server list is either NULL, to use the built-in list, or a
+// NUL-terminated string in the JSON format of server lists.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+enum {
+	NOTARY_OK = 0,
+	NOTARY_FAILURE = 1,
+	NOTARY_NETWORK = 2,
+	NOTARY_VERIFY = 3,
+	NOTARY_MISMATCH = 4,
+};
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"unsafe"
+
+	"github.com/Merovius/notary"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func main() {}
+
+// notary_attest obtains an attestation for the n bytes at data, hashed with
+// hashAlg (NULL for sha512), and stores it in *out.
+//
+//export notary_attest
+func notary_attest(data *C.char, n C.size_t, hashAlg, servers *C.char, out, errOut **C.char) C.int {
+	o := notary.Options{HashAlgorithm: goString(hashAlg)}
+	var err error
+	if o.Servers, err = serverList(servers); err != nil {
+		return fail(err, errOut)
+	}
+	a, err := notary.Attest(context.Background(), bytes.NewReader(goBytes(data, n)), o)
+	if err != nil {
+		return fail(err, errOut)
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return fail(err, errOut)
+	}
+	*out = C.CString(string(b))
+	return C.NOTARY_OK
+}
+
+// notary_verify verifies that attestation is valid for the n bytes at data. On
+// success, if they are not NULL, *earliest and *latest are set to the bounds of
+// the time the attestation was created at, in nanoseconds since the Unix
+// epoch. The data existed no later than *latest.
+//
+//export notary_verify
+func notary_verify(attestation, data *C.char, n C.size_t, servers *C.char, earliest, latest *C.int64_t, errOut **C.char) C.int {
+	p := notary.Policy{}
+	var err error
+	if p.Servers, err = serverList(servers); err != nil {
+		return fail(err, errOut)
+	}
+	a := new(notary.Attestation)
+	if err := json.Unmarshal([]byte(C.GoString(attestation)), a); err != nil {
+		return fail(err, errOut)
+	}
+	rep, err := notary.Verify(context.Background(), a, bytes.NewReader(goBytes(data, n)), p)
+	if err != nil {
+		return fail(err, errOut)
+	}
+	if earliest != nil {
+		*earliest = C.int64_t(rep.Earliest.UnixNano())
+	}
+	if latest != nil {
+		*latest = C.int64_t(rep.Latest.UnixNano())
+	}
+	return C.NOTARY_OK
+}
+
+// notary_free frees a string returned by the library.
+//
+//export notary_free
+func notary_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// goBytes returns the n bytes at p, without copying them. The result must not
+// be used after the exported function returns.
+func goBytes(p *C.char, n C.size_t) []byte {
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), n)
+}
+
+// goString is like C.GoString, but returns "" for NULL.
+func goString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+func serverList(s *C.char) (*config.ServersJSON, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return roughtime.ReadServersJSON(strings.NewReader(C.GoString(s)))
+}
+
+// fail stores the message of err in *errOut and returns its status code.
+func fail(err error, errOut **C.char) C.int {
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+	return C.int(notary.Status(err))
+}
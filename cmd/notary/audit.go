@@ -0,0 +1,61 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// writeAudit writes the values used to verify each link of a chain to w, so
+// that a reviewer can check them by hand. rep is the report of verifying the
+// chain.
+func writeAudit(w io.Writer, rep *roughtime.Report, audits []*roughtime.LinkAudit) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	for i, a := range audits {
+		l := rep.Links[i]
+		server := l.Server
+		if server == "" {
+			server = "unknown server"
+		}
+		if l.Address != "" {
+			server += " (" + l.Address + ")"
+		}
+		root := "matches signed root"
+		if !a.RootMatches() {
+			root = fmt.Sprintf("does NOT match signed root %x", a.SignedRoot)
+		}
+		fmt.Fprintf(tw, "link %d:\t%s\n", i, server)
+		fmt.Fprintf(tw, "  time:\t%s ± %v\n", l.Midpoint.UTC().Format(time.RFC3339Nano), l.Radius)
+		fmt.Fprintf(tw, "  nonce:\t%x\n", a.Nonce)
+		fmt.Fprintf(tw, "  leaf hash:\t%x\n", a.Leaf)
+		fmt.Fprintf(tw, "  merkle index:\t%d\n", a.Index)
+		fmt.Fprintf(tw, "  path length:\t%d\n", a.PathLength)
+		fmt.Fprintf(tw, "  merkle root:\t%x (%s)\n", a.Root, root)
+		fmt.Fprintf(tw, "  delegation:\t%s to %s\n", a.NotBefore.UTC().Format(time.RFC3339), a.NotAfter.UTC().Format(time.RFC3339))
+		fmt.Fprintf(tw, "  server key:\t%s (%s)\n", roughtime.Fingerprint(a.ServerKey), base64.StdEncoding.EncodeToString(a.ServerKey))
+		fmt.Fprintf(tw, "  delegated key:\t%s\n", roughtime.Fingerprint(a.DelegatedKey))
+		if a.Version != 0 {
+			fmt.Fprintf(tw, "  version:\t%#x\n", a.Version)
+		}
+	}
+	fmt.Fprintf(tw, "chain:\t%s to %s\n", rep.Earliest.UTC().Format(time.RFC3339Nano), rep.Latest.UTC().Format(time.RFC3339Nano))
+	return tw.Flush()
+}
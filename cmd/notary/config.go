@@ -0,0 +1,192 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/Merovius/notary/internal/statefile"
+)
+
+// parseFlags parses args into flags, filling flags that are not given with the
+// values from the environment or, failing that, the config file. It registers
+// the -config flag and exits on failure. flags must use flag.ContinueOnError,
+// so invalid flags exit with exitFailure instead of the status 2 of the flag
+// package, which notary uses for network failures.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	err := loadFlags(flags, args)
+	if errors.Is(err, flag.ErrHelp) {
+		exit(exitOK)
+	}
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		// The flag package already reported the error.
+		exit(exitFailure)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// usageError is an error parsing the command line.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// loadFlags is like parseFlags, but returns an error instead of exiting, so
+// long-running subcommands can reload their configuration.
+func loadFlags(flags *flag.FlagSet, args []string) error {
+	path := flags.String("config", defaultConfigPath(), "file to read default values of flags from (empty to disable, see README)")
+	if err := flags.Parse(args); err != nil {
+		return usageError{err}
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if err := applyEnv(flags, set); err != nil {
+		return err
+	}
+	if *path == "" {
+		return nil
+	}
+	if err := applyConfig(flags, *path, set); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !set["config"] {
+			return nil
+		}
+		return fmt.Errorf("loading config: %w", err)
+	}
+	return nil
+}
+
+// envAliases maps environment variables to the flags they set, in addition to
+// the variable derived from the name of each flag by envName.
+var envAliases = map[string][]string{
+	"NOTARY_MIN_SERVERS":   {"min-links"},
+	"NOTARY_OUTPUT_FORMAT": {"format", "to"},
+}
+
+// envName returns the environment variable for the flag name, like
+// NOTARY_MAX_RADIUS for max-radius.
+func envName(name string) string {
+	return "NOTARY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets the flags which are not in set to the values of the
+// corresponding environment variables, adding them to set.
+func applyEnv(flags *flag.FlagSet, set map[string]bool) error {
+	apply := func(env, name string) error {
+		v, ok := os.LookupEnv(env)
+		if !ok || set[name] || flags.Lookup(name) == nil {
+			return nil
+		}
+		if err := flags.Set(name, v); err != nil {
+			return fmt.Errorf("invalid value %q for $%s: %w", v, env, err)
+		}
+		set[name] = true
+		return nil
+	}
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err == nil {
+			err = apply(envName(f.Name), f.Name)
+		}
+	})
+	for env, names := range envAliases {
+		for _, name := range names {
+			if err == nil {
+				err = apply(env, name)
+			}
+		}
+	}
+	return err
+}
+
+// defaultConfigPath returns the path of the config file,
+// $XDG_CONFIG_HOME/notary/config. If it can not be determined, it returns
+// the empty string.
+func defaultConfigPath() string {
+	path, _ := statefile.ConfigPath("config")
+	return path
+}
+
+// applyConfig sets the flags which are not in set to the values in the
+// config file name.
+//
+// The config file consists of lines of the form "flag = value". Empty lines and
+// lines starting with # are ignored. Lines before the first section apply to
+// every subcommand and are ignored by subcommands without the flag. A line
+// "[name]" starts a section, which only applies to the subcommand name, like
+// "ping" or "git stamp" (or "git", for all git subcommands). Flags in a section
+// must exist.
+func applyConfig(flags *flag.FlagSet, name string, set map[string]bool) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cmd := flags.Name()
+	if flags == flag.CommandLine {
+		cmd = ""
+	}
+	var (
+		section string
+		sc      = bufio.NewScanner(f)
+	)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected \"flag = value\"", name, n)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		inSection := section != ""
+		if inSection && section != cmd && !strings.HasPrefix(cmd, section+" ") {
+			continue
+		}
+		if flags.Lookup(k) == nil {
+			if inSection {
+				return fmt.Errorf("%s:%d: unknown flag %q for %s", name, n, k, section)
+			}
+			continue
+		}
+		if k == "config" {
+			return fmt.Errorf("%s:%d: config can not be set in the config file", name, n)
+		}
+		if set[k] {
+			continue
+		}
+		if err := flags.Set(k, v); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["convert"] = convertMain
+}
+
+// convertMain reads a chain in any format and writes it to stdout in the
+// format given by -to.
+func convertMain(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := fs.String("to", "json", "format to convert to (json, binary or google, the format of the reference implementation)")
+	parseFlags(fs, args)
+	if fs.NArg() > 1 {
+		fatalf("usage: %s convert [-to json|binary|google] [<chain>]", os.Args[0])
+	}
+	switch *to {
+	case "json", "binary", "google":
+	default:
+		fatalf("invalid format %q", *to)
+	}
+	log, err := newLogger("text", false, false)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	r := io.Reader(os.Stdin)
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		fatal(log, "loading chain", err)
+	}
+	ch := loadAnyChain(log, b)
+
+	switch *to {
+	case "json":
+		err = roughtime.SaveChain(os.Stdout, ch)
+	case "binary":
+		err = roughtime.SaveChainBinary(os.Stdout, ch)
+	case "google":
+		if ch.HashAlgorithm != "" {
+			log.Warn("the reference format can not record the hash algorithm; pass it with -hash when verifying the converted chain", "hash", ch.HashAlgorithm)
+		}
+		err = roughtime.SaveChainGoogle(os.Stdout, ch)
+	}
+	if err != nil {
+		fatal(log, "writing chain", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/Merovius/notary/wire"
+)
+
+func init() {
+	commands["debug"] = debugMain
+}
+
+func debugMain(args []string) {
+	if len(args) < 1 || args[0] != "dump" {
+		fatalf("usage: %s debug dump [-hex] [<file>]", os.Args[0])
+	}
+	fs := flag.NewFlagSet("debug dump", flag.ContinueOnError)
+	isHex := fs.Bool("hex", false, "input is hex-encoded (detected automatically, if not set)")
+	parseFlags(fs, args[1:])
+
+	r := io.Reader(os.Stdin)
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if s := bytes.Join(bytes.Fields(msg), nil); *isHex || isHexString(s) {
+		if msg, err = hex.DecodeString(string(s)); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if err := wire.Dump(os.Stdout, msg); err != nil {
+		fatalf("invalid message: %v", err)
+	}
+}
+
+func isHexString(b []byte) bool {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return false
+	}
+	for _, c := range b {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
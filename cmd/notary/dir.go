@@ -0,0 +1,142 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Merovius/notary/manifest"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["dir"] = dirMain
+}
+
+var errManifestMismatch = errors.New("chain nonce does not match manifest")
+
+// dirMain notarizes a directory, writing a chain over its manifest and the
+// manifest next to it, or verifies a directory against them.
+func dirMain(args []string) {
+	fs := flag.NewFlagSet("dir", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	verify := fs.Bool("verify", false, "verify the directory against the chain and its manifest")
+	hashAlg := fs.String("hash", roughtime.SHA512, "hash algorithm used for the files and the manifest (sha512, sha256 or blake2b); ignored when verifying")
+	workers := fs.Int("workers", 0, "number of files to hash concurrently (0 for the number of CPUs)")
+	parseFlags(fs, args)
+	if fs.NArg() != 2 {
+		fatalf("usage: %s dir [-v|-quiet] [-servers <servers.json>] [-hash <alg>] [-workers <n>] [-verify] <dir> <chain>", os.Args[0])
+	}
+	dir, chain := fs.Arg(0), fs.Arg(1)
+	manifestFile := chain + ".manifest"
+
+	log := cf.logger()
+	servers := cf.serverList(log)
+	c := cf.client(log)
+	skip := skipFiles(log, dir, chain, manifestFile)
+
+	if *verify {
+		b, err := os.ReadFile(chain)
+		if err != nil {
+			fatal(log, "loading chain", err)
+		}
+		ch := loadAnyChain(log, b)
+		rep, err := c.VerifyChain(ch, servers)
+		if err != nil {
+			fatal(log, "verifying chain", err)
+		}
+		b, err = os.ReadFile(manifestFile)
+		if err != nil {
+			fatal(log, "loading manifest", err)
+		}
+		want, err := manifest.Parse(b)
+		if err != nil {
+			fatal(log, "loading manifest", err)
+		}
+		nonce, err := want.Nonce()
+		if err != nil {
+			fatal(log, "hashing manifest", err)
+		}
+		if len(ch.Links) == 0 || (ch.HashAlgorithm != "" && ch.HashAlgorithm != want.HashAlgorithm) || !bytes.Equal(ch.Nonce(), nonce) {
+			fatal(log, "verifying chain", errManifestMismatch)
+		}
+		got := buildManifest(log, dir, want.HashAlgorithm, *workers, skip)
+		if err := manifest.Compare(want, got); err != nil {
+			fatal(log, "verifying directory", err)
+		}
+		log.Info("directory verified", "files", len(got.Entries), "links", len(ch.Links), "earliest", rep.Earliest, "latest", rep.Latest)
+		progress.done(len(ch.Links), rep)
+		return
+	}
+
+	m := buildManifest(log, dir, *hashAlg, *workers, skip)
+	nonce, err := m.Nonce()
+	if err != nil {
+		fatal(log, "hashing manifest", err)
+	}
+	ch, _, err := c.BuildChain(servers, m.HashAlgorithm, nonce)
+	if err != nil {
+		fatal(log, "building chain", err)
+	}
+	if err := os.WriteFile(manifestFile, m.Encode(), 0o644); err != nil {
+		fatal(log, "writing manifest", err)
+	}
+	if err := writeChain(chain, ch, false); err != nil {
+		fatal(log, "writing chain", err)
+	}
+	log.Info("directory notarized", "files", len(m.Entries), "links", len(ch.Links), "manifest", manifestFile)
+	progress.done(len(ch.Links), nil)
+}
+
+// buildManifest builds the manifest of dir, exiting on failure.
+func buildManifest(log *slog.Logger, dir, alg string, workers int, skip func(string) bool) *manifest.Manifest {
+	h := &roughtime.Hasher{Algorithm: alg, ReadAhead: true}
+	var done func()
+	h.Progress, done = hashProgress(dir, 0)
+	m, err := manifest.Build(dir, h, workers, skip)
+	done()
+	if err != nil {
+		fatal(log, "hashing directory", err)
+	}
+	log.Debug("built manifest", "directory", dir, "files", len(m.Entries))
+	return m
+}
+
+// skipFiles returns a function reporting whether a slash-separated path in dir
+// is one of files, so chains and manifests stored in the directory they
+// describe are left out of it.
+func skipFiles(log *slog.Logger, dir string, files ...string) func(string) bool {
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		fatal(log, "resolving directory", err)
+	}
+	skip := make(map[string]bool)
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			fatal(log, "resolving file", err)
+		}
+		if rel, err := filepath.Rel(base, abs); err == nil && filepath.IsLocal(rel) {
+			skip[filepath.ToSlash(rel)] = true
+		}
+	}
+	return func(p string) bool { return skip[p] }
+}
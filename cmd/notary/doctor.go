@@ -0,0 +1,364 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+func init() {
+	commands["doctor"] = doctorMain
+}
+
+// doctorMain checks the server list, DNS resolution and UDP reachability of
+// every server and the local clock, printing hints for any problems found.
+func doctorMain(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	parseFlags(fs, args)
+	if fs.NArg() != 0 {
+		fatalf("usage: %s doctor [-servers <servers.json>] [-timeout <d>]", os.Args[0])
+	}
+	log := cf.logger()
+	d := &doctor{w: os.Stdout, client: cf.client(log)}
+	if d.run(cf.servers, cf.serversKey) > 0 {
+		exit(exitFailure)
+	}
+}
+
+// doctor runs diagnostics and prints the results.
+type doctor struct {
+	w      io.Writer
+	client *roughtime.Client
+	// failures counts the failed checks.
+	failures int
+}
+
+// run runs all checks and returns the number of failures.
+func (d *doctor) run(servers, serversKey string) int {
+	d.checkLocalClock()
+	list := d.checkServerList(servers, serversKey)
+	if list == nil {
+		return d.failures
+	}
+	var offsets []time.Duration
+	for _, s := range list.Servers {
+		fmt.Fprintf(d.w, "\n%s:\n", s.Name)
+		if exp := s.Expiry(); !exp.IsZero() && time.Now().After(exp) {
+			d.warn("server is no longer operated since %v", exp.Format(time.DateOnly))
+		}
+		for _, a := range s.Addresses {
+			if !d.checkDNS(a.Address) {
+				continue
+			}
+			if off, ok := d.checkUDP(&roughtime.Server{Name: s.Name, Address: a.Address, PublicKey: s.PublicKey}); ok {
+				offsets = append(offsets, off)
+			}
+		}
+	}
+	fmt.Fprintln(d.w)
+	d.checkOffsets(offsets)
+	return d.failures
+}
+
+func (d *doctor) ok(format string, v ...any) {
+	fmt.Fprintf(d.w, "  ok    %s\n", fmt.Sprintf(format, v...))
+}
+
+func (d *doctor) warn(format string, v ...any) {
+	fmt.Fprintf(d.w, "  WARN  %s\n", fmt.Sprintf(format, v...))
+}
+
+func (d *doctor) fail(format string, v ...any) {
+	d.failures++
+	fmt.Fprintf(d.w, "  FAIL  %s\n", fmt.Sprintf(format, v...))
+}
+
+func (d *doctor) hint(format string, v ...any) {
+	fmt.Fprintf(d.w, "        hint: %s\n", fmt.Sprintf(format, v...))
+}
+
+// checkLocalClock checks that the local clock is not obviously wrong, as
+// happens on machines without a battery-backed clock.
+func (d *doctor) checkLocalClock() {
+	fmt.Fprintln(d.w, "local clock:")
+	now := time.Now()
+	if built, ok := buildTime(); ok && now.Before(built) {
+		d.fail("local time %v is before notary was built (%v)", now.Format(time.DateTime), built.Format(time.DateTime))
+		d.hint("the clock was probably reset; TLS and DNSSEC will fail as well, set it or enable NTP")
+		return
+	}
+	d.ok("local time %v", now.Format(time.DateTime))
+}
+
+// buildTime returns the time of the commit notary was built from or, if that
+// is not recorded, the modification time of the executable.
+func buildTime() (time.Time, bool) {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key != "vcs.time" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				return t, true
+			}
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return time.Time{}, false
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
+
+// checkServerList loads and validates the server list. It returns nil if it
+// can not be used.
+func (d *doctor) checkServerList(name, key string) *config.ServersJSON {
+	fmt.Fprintln(d.w, "\nserver list:")
+	list, err := serverList(name, key)
+	var (
+		verr  config.ValidationError
+		vferr *roughtime.VerifyError
+	)
+	switch {
+	case errors.As(err, &verr):
+		for _, p := range verr {
+			d.fail("%v", p)
+		}
+		d.hint("fix the server list or use the built-in one, by not passing -servers or $NOTARY_SERVERS")
+		return nil
+	case errors.As(err, &vferr):
+		d.fail("%v", err)
+		d.hint("the server list or its signature was modified, or -servers-key is not the key of its publisher")
+		return nil
+	case err != nil:
+		d.fail("loading server list: %v", err)
+		return nil
+	}
+	d.ok("%d servers", len(list.Servers))
+	return list
+}
+
+// checkDNS resolves the host of address and reports whether it succeeded.
+func (d *doctor) checkDNS(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		d.fail("%s: %v", address, err)
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	var derr *net.DNSError
+	switch {
+	case errors.As(err, &derr) && derr.IsNotFound:
+		d.fail("%s: resolving %s: no such host", address, host)
+		d.hint("the server may have been shut down or renamed; check for an updated server list")
+		return false
+	case errors.As(err, &derr) && derr.IsTimeout:
+		d.fail("%s: resolving %s: timeout", address, host)
+		d.hint("your DNS resolver does not respond; check /etc/resolv.conf or the network connection")
+		return false
+	case err != nil:
+		d.fail("%s: resolving %s: %v", address, host, err)
+		return false
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.Unmap().String()
+	}
+	d.ok("%s resolves to %s", address, strings.Join(addrs, ", "))
+	return true
+}
+
+// checkUDP queries s and returns the offset of the local clock from it, if
+// it succeeds.
+func (d *doctor) checkUDP(s *roughtime.Server) (time.Duration, bool) {
+	next := d.client.Transport
+	t := &ttlTransport{next: next}
+	d.client.Transport = t
+	defer func() { d.client.Transport = next }()
+	res, err := d.client.FetchRoughtime(s, nil)
+	var verr *roughtime.VerifyError
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded) && !t.udp():
+		d.fail("%s: no response within %v", s.Address, d.client.Timeout)
+		d.hint("the relay or Tor proxy did not answer in time; check that it is running and can reach UDP port %s", port(s.Address))
+		return 0, false
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		d.fail("%s: no response within %v", s.Address, d.client.Timeout)
+		d.hint("UDP port %s is probably blocked by a firewall or NAT. Allow outgoing UDP to it, try a longer -timeout, or use -relay or -tor", port(s.Address))
+		return 0, false
+	case errors.Is(err, syscall.ECONNREFUSED) && t.udp():
+		d.fail("%s: connection refused", s.Address)
+		d.hint("nothing listens on the port; the server list may be outdated")
+		return 0, false
+	case errors.As(err, &verr):
+		d.fail("%s: invalid response: %v", s.Address, err)
+		d.hint("the server answered, but with a response that does not verify; the key in the server list may be outdated")
+		return 0, false
+	case err != nil:
+		d.fail("%s: %v", s.Address, err)
+		return 0, false
+	}
+	off := res.Midpoint.Sub(res.Sent.Add(res.RTT / 2))
+	ttl := "unknown"
+	if t.ttl > 0 {
+		ttl = fmt.Sprintf("%d (about %d hops)", t.ttl, hops(t.ttl))
+	}
+	d.ok("%s responds: rtt %v, ttl %s, radius %v, offset %v", s.Address, res.RTT.Round(time.Millisecond), ttl, res.Radius, off.Round(time.Millisecond))
+	return off, true
+}
+
+// checkOffsets compares the local clock to the servers.
+func (d *doctor) checkOffsets(offsets []time.Duration) {
+	fmt.Fprintln(d.w, "clock offset:")
+	if len(offsets) == 0 {
+		d.fail("no server responded, the local clock can not be checked")
+		return
+	}
+	slices.Sort(offsets)
+	median := offsets[len(offsets)/2]
+	switch a := median.Abs(); {
+	case a > 10*time.Second:
+		d.fail("local clock is off by %v", median.Round(time.Millisecond))
+		d.hint("enable time synchronization, for example with timedatectl set-ntp true")
+	case a > time.Second:
+		d.warn("local clock is off by %v", median.Round(time.Millisecond))
+		d.hint("check that time synchronization is working")
+	default:
+		d.ok("local clock is off by %v", median.Round(time.Millisecond))
+	}
+	if spread := offsets[len(offsets)-1] - offsets[0]; spread > 10*time.Second {
+		d.warn("servers disagree by %v", spread.Round(time.Millisecond))
+		d.hint("one of the servers is wrong; chains with it will fail verification")
+	}
+}
+
+// port returns the port of address.
+func port(address string) string {
+	_, p, _ := net.SplitHostPort(address)
+	return p
+}
+
+// hops estimates the number of hops a packet took from its TTL, assuming it
+// started with one of the common initial values.
+func hops(ttl int) int {
+	for _, initial := range []int{64, 128, 255} {
+		if ttl <= initial {
+			return initial - ttl
+		}
+	}
+	return 0
+}
+
+// ttlTransport wraps the transport of the client. If it is plain UDP, requests
+// are sent from a connected socket instead, which records the TTL (or hop
+// limit) of the last response received, if the platform supports it, and
+// reports ICMP port unreachable messages as ECONNREFUSED.
+type ttlTransport struct {
+	next roughtime.Transport
+	ttl  int
+}
+
+// udp reports whether t sends requests itself, because next is a UDP transport
+// without options it would need to honor.
+func (t *ttlTransport) udp() bool {
+	switch next := t.next.(type) {
+	case nil:
+		return true
+	case roughtime.UDPTransport:
+		return next.LocalAddr == "" && next.Device == "" && next.DSCP == 0 && next.Capture == nil
+	default:
+		return false
+	}
+}
+
+func (t *ttlTransport) RoundTrip(address string, req []byte, timeout time.Duration) ([]byte, error) {
+	t.ttl = 0
+	if !t.udp() {
+		return t.next.RoundTrip(address, req, timeout)
+	}
+	ua, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	network := "udp6"
+	if ua.IP.To4() != nil {
+		network = "udp4"
+	}
+	conn, err := net.DialUDP(network, nil, ua)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, roughtime.MaxResponseSize+1)
+	var n int
+	if network == "udp4" {
+		p := ipv4.NewPacketConn(conn)
+		p.SetControlMessage(ipv4.FlagTTL, true)
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		var cm *ipv4.ControlMessage
+		if n, cm, _, err = p.ReadFrom(buf); err != nil {
+			return nil, err
+		}
+		if cm != nil {
+			t.ttl = cm.TTL
+		}
+	} else {
+		p := ipv6.NewPacketConn(conn)
+		p.SetControlMessage(ipv6.FlagHopLimit, true)
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		var cm *ipv6.ControlMessage
+		if n, cm, _, err = p.ReadFrom(buf); err != nil {
+			return nil, err
+		}
+		if cm != nil {
+			t.ttl = cm.HopLimit
+		}
+	}
+	if n > roughtime.MaxResponseSize {
+		return nil, roughtime.ErrResponseTooLarge
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["extend"] = extendMain
+}
+
+// extendMain verifies an existing chain and appends a new link from every
+// usable server to it, replacing the chain file.
+func extendMain(args []string) {
+	fs := flag.NewFlagSet("extend", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fatalf("usage: %s extend [-v|-quiet] [-servers <servers.json>] [-timeout <d>] [-min-links <n>] <chain>", os.Args[0])
+	}
+	name := fs.Arg(0)
+
+	log := cf.logger()
+	servers := cf.serverList(log)
+	c := cf.client(log)
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		fatal(log, "loading chain", err)
+	}
+	ch, err := roughtime.LoadChain(bytes.NewReader(b))
+	if err != nil {
+		fatal(log, "loading chain", err)
+	}
+	if _, err := c.VerifyChain(ch, servers); err != nil {
+		fatal(log, "verifying chain", err)
+	}
+	res, err := c.ExtendChain(ch, servers)
+	if err != nil {
+		fatal(log, "extending chain", err)
+	}
+	if err := writeChain(name, ch, roughtime.IsBinaryChain(b)); err != nil {
+		fatal(log, "writing chain", err)
+	}
+	log.Info("chain extended", "links", len(ch.Links), "new", len(res))
+	progress.done(len(ch.Links), nil)
+}
+
+// writeChain atomically replaces the file name with ch, in the binary or JSON
+// format.
+func writeChain(name string, ch *roughtime.Chain, binary bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := saveChain(tmp, ch, binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
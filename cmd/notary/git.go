@@ -0,0 +1,138 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["git"] = gitMain
+}
+
+// gitMain notarizes git objects, storing the chains in git notes.
+//
+// The notarized data is the hex-encoded object name, as printed by git
+// rev-parse, so a chain can be verified with only the object name.
+func gitMain(args []string) {
+	if len(args) < 1 || (args[0] != "stamp" && args[0] != "verify" && args[0] != "show") {
+		gitUsage()
+	}
+	fs := flag.NewFlagSet("git "+args[0], flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	notesRef := fs.String("notes-ref", "notary", "git notes ref to store chains in")
+	parseFlags(fs, args[1:])
+	ref := "HEAD"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		ref = fs.Arg(0)
+	default:
+		gitUsage()
+	}
+
+	log := cf.logger()
+	oid, err := git(nil, "rev-parse", "--verify", "--end-of-options", ref)
+	if err != nil {
+		fatal(log, "resolving "+ref, err)
+	}
+	log = log.With("object", oid)
+
+	switch args[0] {
+	case "stamp":
+		servers := cf.serverList(log)
+		nonce, err := roughtime.HashNonce(roughtime.SHA512, strings.NewReader(oid))
+		if err != nil {
+			fatal(log, "hashing object name", err)
+		}
+		ch, _, err := cf.client(log).BuildChain(servers, roughtime.SHA512, nonce)
+		if err != nil {
+			fatal(log, "building chain", err)
+		}
+		b, err := roughtime.MarshalChain(ch)
+		if err != nil {
+			fatal(log, "writing chain", err)
+		}
+		if _, err := git(b, "notes", "--ref", *notesRef, "add", "-f", "-F", "-", oid); err != nil {
+			fatal(log, "writing git note", err)
+		}
+		log.Info("object notarized", "links", len(ch.Links), "notes", "refs/notes/"+*notesRef)
+	case "verify":
+		servers := cf.serverList(log)
+		ch := gitChain(oid, *notesRef)
+		rep, err := cf.client(log).VerifyChain(ch, servers)
+		if err != nil {
+			fatal(log, "verifying chain", err)
+		}
+		nonce, err := roughtime.HashNonce(ch.HashAlgorithm, strings.NewReader(oid))
+		if err != nil {
+			fatal(log, "hashing object name", err)
+		}
+		if len(ch.Links) == 0 || !bytes.Equal(ch.Nonce(), nonce) {
+			fatal(log, "verifying chain", errMismatch)
+		}
+		log.Info("chain verified", "links", len(ch.Links), "earliest", rep.Earliest, "latest", rep.Latest)
+	case "show":
+		if err := roughtime.SaveChain(os.Stdout, gitChain(oid, *notesRef)); err != nil {
+			fatal(log, "writing chain", err)
+		}
+	}
+}
+
+func gitUsage() {
+	fatalf("usage: %s git stamp|verify|show [-v|-quiet] [-servers <servers.json>] [-notes-ref <ref>] [<rev>]", os.Args[0])
+}
+
+// gitChain loads the chain for the object oid from git notes, exiting on
+// failure.
+func gitChain(oid, notesRef string) *roughtime.Chain {
+	b, err := git(nil, "notes", "--ref", notesRef, "show", oid)
+	if err != nil {
+		fatalf("no chain for %s in refs/notes/%s: %v", oid, notesRef, err)
+	}
+	ch, err := roughtime.LoadChain(strings.NewReader(b))
+	if err != nil {
+		fatalf("loading chain from git notes: %v", err)
+	}
+	return ch
+}
+
+// git runs git with the given arguments and stdin and returns its trimmed
+// output.
+func git(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -12,111 +12,804 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Command notary uses the roughtime protocol to obtain a proof that a file
+// existed at a given time, or verifies such a proof.
+//
+// Subcommands:
+//
+//	convert     convert a chain between the JSON, binary and reference formats
+//	dir         notarize a directory, or verify it, using a manifest of its files
+//	extend      append links to an existing chain
+//	git         notarize git commits and tags, storing chains in git notes
+//	doctor      diagnose problems with the server list, network and clock
+//	monitor     periodically compare the local clock to the servers
+//	ping        check that the servers respond correctly and measure loss
+//	reverify    verify captured exchanges with servers again, offline
+//	serve       run a roughtime server
+//	serve-http  serve an HTTP API to create and verify chains
+//	serve-grpc  serve a gRPC API to create and verify chains
+//	debug dump  print the fields of a roughtime message
+//
+// Exit codes:
+//
+//	0  success
+//	1  usage error or other failure
+//	2  network failure while querying a server
+//	3  a server response or chain failed cryptographic verification
+//	4  the verified chain does not match the given file or directory
 package main
 
 import (
 	"bytes"
-	"crypto/sha512"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net/netip"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	config "github.com/Merovius/notary/internal/config"
+	"github.com/Merovius/notary"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/cwt"
+	"github.com/Merovius/notary/internal/pcap"
+	"github.com/Merovius/notary/intoto"
+	"github.com/Merovius/notary/jws"
+	"github.com/Merovius/notary/manifest"
+	"github.com/Merovius/notary/metrics"
+	"github.com/Merovius/notary/rekor"
+	"github.com/Merovius/notary/rfc3161"
 	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/stats"
+	"github.com/Merovius/notary/tofu"
 )
 
+const (
+	exitOK       = notary.StatusOK
+	exitFailure  = notary.StatusFailure
+	exitNetwork  = notary.StatusNetwork
+	exitVerify   = notary.StatusInvalid
+	exitMismatch = notary.StatusMismatch
+)
+
+var errMismatch = errors.New("chain nonce does not match file")
+
+// commands contains the subcommands of notary. They are passed the arguments
+// following the subcommand name.
+var commands = make(map[string]func(args []string))
+
 func main() {
+	defer runExitHooks()
+	if len(os.Args) > 1 {
+		if cmd := commands[os.Args[1]]; cmd != nil {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(flag.CommandLine)
 	verify := flag.Bool("verify", false, "verify a given chain")
-	serversJSON := flag.String("servers", "", "server-list to use")
-	flag.Parse()
+	trustBundle := flag.Bool("trust-bundle", false, "with -verify, verify bundles against the servers they contain instead of the server list, for chains whose servers are gone (only for bundles from a trusted source)")
+	audit := flag.Bool("audit", false, "with -verify, print the Merkle path, delegation and keys of every link, to check the verification by hand")
+	checkServers := flag.Bool("check-servers", false, "validate the server-list and exit")
+	printStats := flag.Bool("print-stats", false, "print the statistics in -stats-file and exit")
+	single := flag.Bool("single", false, "create or verify an attestation from a single server instead of a chain")
+	format := flag.String("format", "json", "format of created chains (json, binary, bundle, rfc3161, cwt, jws or in-toto)")
+	tsaKey := flag.String("tsa-key", "", "with -format rfc3161, PEM file containing the key to sign timestamp tokens with")
+	tsaCert := flag.String("tsa-cert", "", "with -format rfc3161, PEM file containing the certificate of -tsa-key")
+	cwtKey := flag.String("cwt-key", "", "with -format cwt, PEM file containing the key to sign CBOR web tokens with; with -verify, PEM file containing the public key to verify them with")
+	jwsKey := flag.String("jws-key", "", "with -format jws, PEM file containing the key to sign JSON web tokens with; with -verify, PEM file containing the public key to verify them with")
+	rekorURL := flag.String("rekor", "", "URL of a Rekor transparency log to submit created chains to, or to check the entries of verified chains against")
+	sigFile := flag.String("signature", "", "notarize this detached signature of <file> together with it, proving the signature existed")
+	hashAlg := flag.String("hash", roughtime.SHA512, "hash algorithm used to derive the nonce (sha512, sha256 or blake2b); when verifying, only used if the chain does not name one")
+	parseFlags(flag.CommandLine, os.Args[1:])
+
+	log := cf.logger()
+	switch *format {
+	case "json", "binary", "bundle", "rfc3161", "cwt", "jws", "in-toto":
+	default:
+		fatalf("invalid format %q", *format)
+	}
+	if *sigFile != "" && (*format == "rfc3161" || *format == "cwt" || *format == "jws" || *format == "in-toto") {
+		fatalf("-signature can not be used with -format %s", *format)
+	}
+
+	if *checkServers {
+		_, err := serverList(cf.servers, cf.serversKey)
+		var verr config.ValidationError
+		if errors.As(err, &verr) {
+			for _, p := range verr {
+				fmt.Println(p)
+			}
+			exit(exitFailure)
+		}
+		if err != nil {
+			fatal(log, "loading server list", err)
+		}
+		log.Info("server list is valid")
+		return
+	}
+
+	if *printStats {
+		if err := writeStats(os.Stdout, cf.statsFile); err != nil {
+			fatal(log, "printing statistics", err)
+		}
+		return
+	}
 
 	if flag.NArg() < 1 {
-		log.Fatalf("usage: %s [-servers <servers.json>] [-verify] <file>", os.Args[0])
+		fatalf("usage: %s [-v|-quiet] [-log-format text|json] [-servers <servers.json>] [-hash <alg>] [-max-radius <d>] [-timeout <d>] [-min-links <n>] [-format json|binary|bundle|in-toto|rfc3161|cwt|jws [-tsa-key <key.pem> -tsa-cert <cert.pem>] [-cwt-key <key.pem>] [-jws-key <key.pem>]] [-rekor <url>] [-signature <sig>] [-single] [-verify [-allow-unknown-servers] [-trust-bundle] [-cwt-key <key.pem>] [-jws-key <key.pem>] [-audit]] <file>\n       %s [-servers <servers.json>] -check-servers\n       %s [-stats-file <file>] -print-stats", os.Args[0], os.Args[0], os.Args[0])
+	}
+
+	servers := cf.serverList(log)
+	c := cf.client(log)
+
+	if *verify && *single {
+		a, err := roughtime.LoadAttestation(os.Stdin)
+		if err != nil {
+			fatal(log, "loading attestation", err)
+		}
+		res, err := c.VerifyAttestation(a, servers)
+		if err != nil {
+			fatal(log, "verifying attestation", err)
+		}
+		nonce, err := fileNonce(a.HashAlgorithm, flag.Arg(0), *sigFile)
+		if err != nil {
+			fatal(log, "hashing file", err)
+		}
+		if bytes.Compare(a.Nonce, nonce) != 0 {
+			fatal(log, "verifying attestation", errMismatch)
+		}
+		log.Info("attestation verified", "server", res.Server, "midpoint", res.Midpoint, "radius", res.Radius)
+		progress.done(1, &roughtime.Report{Links: []roughtime.LinkResult{res}, Earliest: res.Earliest(), Latest: res.Latest()})
 		return
 	}
 
-	servers, err := serverList(*serversJSON)
+	if *verify {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatal(log, "loading chain", err)
+		}
+		var (
+			ch  *roughtime.Chain
+			rep *roughtime.Report
+		)
+		if roughtime.IsBundle(b) {
+			bundle, lerr := roughtime.LoadBundle(bytes.NewReader(b))
+			if lerr != nil {
+				fatal(log, "loading bundle", lerr)
+			}
+			list := servers
+			if *trustBundle {
+				log.Warn("trusting the servers listed in the bundle")
+				list = nil
+			}
+			ch, rep, err = c.VerifyBundle(bundle, list)
+		} else if cwt.IsToken(b) {
+			ch = loadWebToken(log, cwtFormat, b, *cwtKey)
+			rep, err = c.VerifyChain(ch, servers)
+		} else if jws.IsToken(b) {
+			ch = loadWebToken(log, jwsFormat, b, *jwsKey)
+			rep, err = c.VerifyChain(ch, servers)
+		} else {
+			ch = loadAnyChain(log, b)
+			rep, err = c.VerifyChain(ch, servers)
+		}
+		if err != nil {
+			fatal(log, "verifying chain", err)
+		}
+		alg := ch.HashAlgorithm
+		if alg == "" {
+			// Chains in the reference format do not record the
+			// algorithm.
+			alg = *hashAlg
+		}
+		nonce, err := fileNonce(alg, flag.Arg(0), *sigFile)
+		if err != nil {
+			fatal(log, "hashing file", err)
+		}
+		if len(ch.Links) == 0 || bytes.Compare(ch.Nonce(), nonce) != 0 {
+			fatal(log, "verifying chain", errMismatch)
+		}
+		if *rekorURL != "" {
+			verifyTransparency(log, *rekorURL, ch)
+		}
+		if *audit {
+			audits, err := roughtime.AuditChain(ch)
+			if err != nil {
+				fatal(log, "auditing chain", err)
+			}
+			if err := writeAudit(os.Stdout, rep, audits); err != nil {
+				fatal(log, "writing audit", err)
+			}
+		}
+		log.Info("chain verified", "links", len(ch.Links), "earliest", rep.Earliest, "latest", rep.Latest)
+		progress.done(len(ch.Links), rep)
+		return
+	}
+
+	var (
+		digest, nonce []byte
+		err           error
+	)
+	if *sigFile != "" {
+		nonce, err = fileNonce(*hashAlg, flag.Arg(0), *sigFile)
+	} else if digest, err = digestFile(*hashAlg, flag.Arg(0)); err == nil {
+		nonce, err = roughtime.DigestNonce(*hashAlg, digest)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal(log, "hashing file", err)
 	}
 
-	nonce, err := hashFile(flag.Arg(0))
+	if *single {
+		a, _, err := c.Attest(servers, *hashAlg, nonce)
+		if err != nil {
+			fatal(log, "requesting attestation", err)
+		}
+		if err := roughtime.SaveAttestation(os.Stdout, a); err != nil {
+			fatal(log, "writing attestation", err)
+		}
+		progress.done(1, nil)
+		return
+	}
+
+	var (
+		signer    *rfc3161.Signer
+		cwtSigner *cwt.Signer
+		jwsSigner *jws.Signer
+	)
+	switch *format {
+	case "rfc3161":
+		if signer, err = loadTSASigner(*tsaKey, *tsaCert); err != nil {
+			fatal(log, "loading TSA key", err)
+		}
+	case "cwt":
+		key, err := loadTokenKey(cwtFormat, *cwtKey)
+		if err != nil {
+			fatal(log, "loading CWT key", err)
+		}
+		cwtSigner = &cwt.Signer{Key: key}
+	case "jws":
+		key, err := loadTokenKey(jwsFormat, *jwsKey)
+		if err != nil {
+			fatal(log, "loading JWS key", err)
+		}
+		jwsSigner = &jws.Signer{Key: key}
+	}
+	ch, _, err := c.BuildChain(servers, *hashAlg, nonce)
 	if err != nil {
-		log.Fatal(err)
+		fatal(log, "building chain", err)
+	}
+	if *rekorURL != "" {
+		e, err := (&rekor.Client{URL: *rekorURL}).Upload(context.Background(), ch)
+		if err != nil {
+			fatal(log, "submitting chain to transparency log", err)
+		}
+		log.Info("submitted chain to transparency log", "uuid", e.UUID, "index", e.LogIndex)
+		ch.Transparency = append(ch.Transparency, e)
+	}
+	switch *format {
+	case "in-toto":
+		st, err := intoto.NewStatement(filepath.Base(flag.Arg(0)), ch, verifyReport(log, c, ch, servers), digest)
+		if err != nil {
+			fatal(log, "creating in-toto statement", err)
+		}
+		if err := intoto.Save(os.Stdout, st); err != nil {
+			fatal(log, "writing in-toto statement", err)
+		}
+	case "rfc3161":
+		tok, err := rfc3161.NewToken(ch, verifyReport(log, c, ch, servers), digest)
+		if err != nil {
+			fatal(log, "creating timestamp token", err)
+		}
+		b, err := signer.Sign(tok)
+		if err != nil {
+			fatal(log, "signing timestamp token", err)
+		}
+		if _, err := os.Stdout.Write(b); err != nil {
+			fatal(log, "writing timestamp token", err)
+		}
+	case "cwt":
+		tok, err := cwt.NewToken(ch, verifyReport(log, c, ch, servers), digest)
+		if err != nil {
+			fatal(log, "creating CBOR web token", err)
+		}
+		b, err := cwtSigner.Sign(tok)
+		if err != nil {
+			fatal(log, "signing CBOR web token", err)
+		}
+		if _, err := os.Stdout.Write(b); err != nil {
+			fatal(log, "writing CBOR web token", err)
+		}
+	case "jws":
+		tok, err := jws.NewToken(ch, verifyReport(log, c, ch, servers), digest)
+		if err != nil {
+			fatal(log, "creating JSON web token", err)
+		}
+		s, err := jwsSigner.Sign(tok)
+		if err != nil {
+			fatal(log, "signing JSON web token", err)
+		}
+		if _, err := fmt.Println(s); err != nil {
+			fatal(log, "writing JSON web token", err)
+		}
+	case "bundle":
+		if err := roughtime.SaveBundle(os.Stdout, roughtime.NewBundle(ch, servers)); err != nil {
+			fatal(log, "writing bundle", err)
+		}
+	default:
+		if err := saveChain(os.Stdout, ch, *format == "binary"); err != nil {
+			fatal(log, "writing chain", err)
+		}
 	}
+	progress.done(len(ch.Links), nil)
+}
 
-	if *verify {
-		c, err := roughtime.LoadChain(os.Stdin)
+// loadAnyChain loads the chain in b, which can be in any format written by
+// notary, including bundles, timestamp tokens, CBOR and JSON web tokens and
+// in-toto statements. The signatures of web tokens are not checked. It exits on
+// failure.
+func loadAnyChain(log *slog.Logger, b []byte) *roughtime.Chain {
+	switch {
+	case roughtime.IsBundle(b):
+		bundle, err := roughtime.LoadBundle(bytes.NewReader(b))
 		if err != nil {
-			log.Fatal(err)
+			fatal(log, "loading bundle", err)
 		}
-		if err := roughtime.VerifyChain(c, servers); err != nil {
-			log.Fatal(err)
+		return &roughtime.Chain{Chain: *bundle.Chain}
+	case cwt.IsToken(b):
+		return loadWebToken(log, cwtFormat, b, "")
+	case jws.IsToken(b):
+		return loadWebToken(log, jwsFormat, b, "")
+	case isToken(b):
+		tok, ch, err := loadToken(b)
+		if err != nil {
+			fatal(log, "loading timestamp token", err)
+		}
+		log.Info("timestamp token signature verified", "signer", tok.Certificate.Subject.String(), "time", tok.GenTime, "accuracy", tok.Accuracy)
+		return ch
+	case intoto.IsStatement(b):
+		st, err := intoto.Load(bytes.NewReader(b))
+		if err != nil {
+			fatal(log, "loading in-toto statement", err)
 		}
-		if len(c.Links) == 0 || bytes.Compare(c.Links[0].NonceOrBlind, nonce) != 0 {
-			log.Fatal("chain nonce does not match file")
+		ch, err := st.Chain()
+		if err != nil {
+			fatal(log, "loading in-toto statement", err)
+		}
+		return ch
+	default:
+		ch, err := roughtime.LoadChain(bytes.NewReader(b))
+		if err != nil {
+			fatal(log, "loading chain", err)
 		}
+		return ch
+	}
+}
 
-		return
+// verifyReport verifies a newly created chain, to report the time bounds it
+// proves. It exits on failure.
+func verifyReport(log *slog.Logger, c *roughtime.Client, ch *roughtime.Chain, servers *config.ServersJSON) *roughtime.Report {
+	rep, err := c.VerifyChain(ch, servers)
+	if err != nil {
+		fatal(log, "verifying chain", err)
+	}
+	return rep
+}
+
+// backoff is shared by all clients of the process, so that long-running
+// subcommands do not hammer servers that rate-limit us.
+var backoff roughtime.Backoff
+
+// clientFlags are the flags common to all modes that query servers or verify
+// responses.
+type clientFlags struct {
+	servers      string
+	serversKey   string
+	verbose      bool
+	quiet        bool
+	logFormat    string
+	allowUnknown bool
+	keyArchive   string
+	policy       string
+	tofu         bool
+	pinsFile     string
+	timeout      time.Duration
+	minLinks     int
+	maxRadius    time.Duration
+	maxRTT       time.Duration
+	deleWarnDays int
+	blindSeed    string
+	doubleCheck  bool
+	relay        string
+	tor          string
+	preferIPv4   bool
+	fallback     time.Duration
+	localAddr    string
+	device       string
+	dscp         int
+	capture      string
+	statsFile    string
+	progress     string
+	backoff      time.Duration
+
+	// metricsListen is only registered by long-running subcommands, see
+	// registerMetrics.
+	metricsListen string
+	// collector is set by client if metrics are enabled.
+	collector *metrics.Collector
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.servers, "servers", "", "server-list to use (a file, a directory of *.json files or an http(s) URL; default the built-in list)")
+	fs.StringVar(&f.serversKey, "servers-key", "", "public key (base64 ed25519 or minisign) or file containing it, to require a valid signature <file>.sig for every server-list file or URL loaded")
+	fs.BoolVar(&f.verbose, "v", false, "log queries and verification steps")
+	fs.BoolVar(&f.quiet, "quiet", false, "only log errors")
+	fs.StringVar(&f.logFormat, "log-format", "text", "log format (text or json)")
+	fs.BoolVar(&f.allowUnknown, "allow-unknown-servers", false, "when verifying, accept servers not in the server-list")
+	fs.StringVar(&f.keyArchive, "key-archive", "", "when verifying, also accept former server keys listed in this file, if they were in use at the time of the response")
+	fs.StringVar(&f.policy, "policy", "", "when verifying, require chains to satisfy the policy in this JSON file (see README)")
+	fs.BoolVar(&f.tofu, "tofu", false, "when verifying, trust servers not in the server-list on first use, pinning their keys in -pins-file, and fail if a pinned key changes")
+	defaultPins, _ := tofu.DefaultPath()
+	fs.StringVar(&f.pinsFile, "pins-file", defaultPins, "file to keep the keys pinned by -tofu in")
+	fs.DurationVar(&f.timeout, "timeout", roughtime.DefaultTimeout, "how long to wait for each server")
+	fs.IntVar(&f.minLinks, "min-links", 0, "skip failing servers, as long as at least this many links are created (0 to fail on any error)")
+	fs.DurationVar(&f.maxRadius, "max-radius", roughtime.DefaultMaxRadius, "reject responses with a larger uncertainty radius (negative to disable)")
+	fs.DurationVar(&f.maxRTT, "max-rtt", 0, "reject responses with a longer round-trip time (0 to disable)")
+	fs.IntVar(&f.deleWarnDays, "delegation-warn-days", 7, "warn when the delegation of a server expires within this many days (0 to disable)")
+	fs.StringVar(&f.blindSeed, "blind-seed", "", "file containing a secret seed to derive blinds from, making chains reproducible")
+	fs.BoolVar(&f.doubleCheck, "double-check", false, "query every server twice and reject servers giving inconsistent answers")
+	fs.StringVar(&f.relay, "relay", "", "send requests through the HTTP relay at this URL (see serve-http), instead of over UDP")
+	fs.StringVar(&f.tor, "tor", "", "send each request over TCP through the Tor SOCKS proxy at this address (like 127.0.0.1:9050), on a separate circuit")
+	fs.BoolVar(&f.preferIPv4, "prefer-ipv4", false, "try IPv4 addresses of servers before IPv6 addresses")
+	fs.DurationVar(&f.fallback, "fallback-delay", roughtime.DefaultFallbackDelay, "how long to wait for a response before also trying the next address of a server (negative to only try the first)")
+	fs.StringVar(&f.localAddr, "local-addr", "", "local address (ip or ip:port) to send requests from")
+	fs.StringVar(&f.device, "bind-device", "", "network interface or VRF to send requests through (Linux only)")
+	fs.StringVar(&f.capture, "capture", "", "write all datagrams exchanged with servers to this pcap file, for reporting protocol problems")
+	fs.IntVar(&f.dscp, "dscp", 0, "DSCP value (0-63) to mark requests with, like 46 for expedited forwarding")
+	defaultStats, _ := stats.DefaultPath()
+	fs.StringVar(&f.progress, "progress", "", "report progress on stderr in this format (ndjson: one JSON object per event and line), for wrapper programs; by default, a bar shows the progress of hashing large files on terminals")
+	fs.DurationVar(&f.backoff, "backoff", roughtime.DefaultBackoffBase, "pause querying a server that did not respond for this long, doubling with every further timeout, as it might be rate-limiting us (0 to disable)")
+	fs.StringVar(&f.statsFile, "stats-file", defaultStats, "file to keep per-server statistics in, used to query reliable and fast servers first (empty to disable)")
+}
+
+// registerMetrics registers the -metrics-listen flag. It should only be used by
+// long-running subcommands.
+func (f *clientFlags) registerMetrics(fs *flag.FlagSet) {
+	fs.StringVar(&f.metricsListen, "metrics-listen", "", "address to serve Prometheus metrics on, under /metrics (empty to disable)")
+}
+
+// logger returns the logger configured by f, exiting on invalid flags.
+func (f *clientFlags) logger() *slog.Logger {
+	log, err := newLogger(f.logFormat, f.verbose, f.quiet)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return log
+}
+
+// serverList loads the server list configured by f, exiting on failure.
+func (f *clientFlags) serverList(log *slog.Logger) *config.ServersJSON {
+	servers, err := serverList(f.servers, f.serversKey)
+	if err != nil {
+		fatal(log, "loading server list", err)
+	}
+	log.Debug("loaded server list", "servers", len(servers.Servers))
+	return servers
+}
+
+// client returns the client configured by f, exiting on failure.
+func (f *clientFlags) client(log *slog.Logger) *roughtime.Client {
+	c := &roughtime.Client{
+		Logger:            log,
+		MaxRadius:         f.maxRadius,
+		MaxRTT:            f.maxRTT,
+		DelegationWarning: time.Duration(f.deleWarnDays) * 24 * time.Hour,
+		AllowUnknownKeys:  f.allowUnknown,
+		Timeout:           f.timeout,
+		MinLinks:          f.minLinks,
+		DoubleCheck:       f.doubleCheck,
+	}
+	if f.keyArchive != "" {
+		a, err := roughtime.LoadKeyArchive(f.keyArchive)
+		if err != nil {
+			fatal(log, "loading key archive", err)
+		}
+		c.KeyArchive = a
+	}
+	if f.policy != "" {
+		p, err := roughtime.LoadPolicy(f.policy)
+		if err != nil {
+			fatal(log, "loading policy", err)
+		}
+		c.Policy = p
+	}
+	if f.tofu {
+		if f.pinsFile == "" {
+			fatalf("-tofu needs a -pins-file")
+		}
+		pins, err := tofu.Load(f.pinsFile)
+		if err != nil {
+			fatal(log, "loading pinned keys", err)
+		}
+		pins.OnPin = func(p tofu.Pin) {
+			log.Warn("trusting unknown server key on first use", "address", p.Address, "publicKey", fmt.Sprintf("%x", p.PublicKey))
+			if err := pins.Save(f.pinsFile); err != nil {
+				log.Error("saving pinned keys failed", "file", f.pinsFile, "error", err)
+			}
+		}
+		c.TrustUnknownKey = pins.Trust
+	}
+	if f.blindSeed != "" {
+		seed, err := os.ReadFile(f.blindSeed)
+		if err != nil {
+			fatal(log, "reading blind seed", err)
+		}
+		if len(seed) < 32 {
+			fatalf("blind seed must be at least 32 bytes")
+		}
+		c.BlindSeed = seed
+	}
+	switch {
+	case f.relay != "" && f.tor != "":
+		fatalf("-relay and -tor are mutually exclusive")
+	case f.relay != "":
+		c.Transport = &roughtime.HTTPTransport{URL: f.relay}
+	case f.tor != "":
+		c.Transport = roughtime.TorTransport(f.tor)
+	default:
+		c.Transport = roughtime.UDPTransport{
+			PreferIPv4:    f.preferIPv4,
+			FallbackDelay: f.fallback,
+			LocalAddr:     f.localAddr,
+			Device:        f.device,
+			DSCP:          f.dscp,
+			Capture:       f.captureFunc(log),
+		}
+	}
+	if f.capture != "" && (f.relay != "" || f.tor != "") {
+		fatalf("-capture only works over UDP, not with -relay or -tor")
+	}
+	switch f.progress {
+	case "":
+		progressBar = !f.quiet && isTerminal(os.Stderr)
+	case "ndjson":
+		progress = newProgressWriter(os.Stderr)
+		c.Progress = progress.event
+	default:
+		fatalf("invalid progress format %q", f.progress)
+	}
+	if f.backoff > 0 {
+		backoff.Base = f.backoff
+		c.Backoff = &backoff
+	}
+	var recs recorders
+	if f.metricsListen != "" {
+		f.collector = serveMetrics(log, f.metricsListen, c.Backoff)
+		recs = append(recs, f.collector)
+	}
+	if f.statsFile != "" {
+		st, err := stats.Load(f.statsFile)
+		if err != nil {
+			log.Warn("loading statistics failed, starting over", "file", f.statsFile, "error", err)
+			st = stats.New()
+		}
+		st.Timeout = f.timeout
+		c.Order = st.Order
+		recs = append(recs, st)
+		saveStats(log, st, f.statsFile)
+	}
+	switch len(recs) {
+	case 0:
+	case 1:
+		c.Recorder = recs[0]
+	default:
+		c.Recorder = recs
+	}
+	return c
+}
+
+// captureFunc returns a function writing datagrams to the pcap file given by
+// -capture, or nil if it is not set.
+func (f *clientFlags) captureFunc(log *slog.Logger) func(time.Time, netip.AddrPort, netip.AddrPort, []byte) {
+	if f.capture == "" {
+		return nil
+	}
+	file, err := os.Create(f.capture)
+	if err != nil {
+		fatal(log, "creating capture file", err)
+	}
+	w, err := pcap.NewWriter(file)
+	if err != nil {
+		fatal(log, "writing capture file", err)
+	}
+	return func(t time.Time, src, dst netip.AddrPort, b []byte) {
+		if err := w.WriteUDP(t, src, dst, b); err != nil {
+			log.Warn("capturing datagram failed", "file", f.capture, "error", err)
+		}
+	}
+}
+
+func newLogger(format string, verbose, quiet bool) (*slog.Logger, error) {
+	if verbose && quiet {
+		return nil, errors.New("-v and -quiet are mutually exclusive")
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if verbose {
+		opts.Level = slog.LevelDebug
+	} else if quiet {
+		opts.Level = slog.LevelError
+	}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+func fatal(log *slog.Logger, msg string, err error) {
+	log.Error(msg+" failed", "error", err)
+	progress.fail(msg+" failed", err)
+	exit(exitCode(err))
+}
+
+func exitCode(err error) int {
+	var mismatchErr *manifest.MismatchError
+	if errors.Is(err, errMismatch) || errors.Is(err, errManifestMismatch) || errors.As(err, &mismatchErr) {
+		return exitMismatch
+	}
+	return notary.Status(err)
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+	exit(exitFailure)
+}
+
+var (
+	exitMu     sync.Mutex
+	exitHooks  []func()
+	exitSignal sync.Once
+)
+
+// atExit registers f to be run when the command exits: when main returns, exit
+// is called or the process is interrupted.
+func atExit(f func()) {
+	exitSignal.Do(func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			s := <-sig
+			exit(128 + int(s.(syscall.Signal)))
+		}()
+	})
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, f)
+}
+
+// exit runs the functions registered with atExit and exits with code.
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// runExitHooks runs the functions registered with atExit, each at most once.
+func runExitHooks() {
+	exitMu.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// verifyTransparency checks the entries of ch in the transparency log at url,
+// exiting on failure. Entries in other logs are ignored.
+func verifyTransparency(log *slog.Logger, url string, ch *roughtime.Chain) {
+	c := &rekor.Client{URL: url}
+	var n int
+	for _, e := range ch.Transparency {
+		if strings.TrimSuffix(e.URL, "/") != strings.TrimSuffix(url, "/") {
+			log.Debug("skipping entry in other transparency log", "url", e.URL, "uuid", e.UUID)
+			continue
+		}
+		if err := c.Verify(context.Background(), ch, e); err != nil {
+			fatal(log, "verifying transparency log entry", err)
+		}
+		log.Info("transparency log entry verified", "uuid", e.UUID, "integrated", time.Unix(e.IntegratedTime, 0).UTC())
+		n++
 	}
+	if n == 0 {
+		fatalf("chain has no entry in transparency log %s", url)
+	}
+}
 
-	if err := roughtime.Chain(os.Stdout, servers, nonce); err != nil {
-		log.Fatal(err)
+// saveChain writes ch to w, in the binary or JSON format.
+func saveChain(w io.Writer, ch *roughtime.Chain, binary bool) error {
+	if binary {
+		return roughtime.SaveChainBinary(w, ch)
 	}
+	return roughtime.SaveChain(w, ch)
 }
 
-func hashFile(name string) ([]byte, error) {
-	f, err := os.Open(flag.Arg(0))
+// fileNonce derives the nonce for the file name. If sig is not empty, it names a
+// detached signature of the file, which is notarized together with it.
+func fileNonce(alg, name, sig string) ([]byte, error) {
+	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	if sig == "" {
+		h, done := fileHasher(alg, name, f)
+		defer done()
+		return h.Nonce(f)
+	}
+	s, err := os.Open(sig)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	h, done := fileHasher(alg, name, f, s)
+	defer done()
+	return h.CountersignNonce(f, s)
+}
 
-	h := sha512.New()
-	if _, err = io.Copy(h, f); err != nil {
+func digestFile(alg, name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
 		return nil, err
 	}
-	return h.Sum(nil), nil
-}
-
-func serverList(name string) (*config.ServersJSON, error) {
-	r := io.Reader(strings.NewReader(defaultServers))
-	if name != "" {
-		f, err := os.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		r = f
-	}
-	return roughtime.ReadServersJSON(r)
-}
-
-var defaultServers = `{
-	"servers": [
-		{
-			"name": "Google",
-			"publicKeyType": "ed25519",
-			"publicKey": "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ=",
-			"addresses": [
-				{
-					"protocol": "udp",
-					"address": "roughtime.sandbox.google.com:2002"
-				}
-			]
-		},
-		{
-			"name": "Cloudflare",
-			"publicKeyType": "ed25519",
-			"publicKey": "gD63hSj3ScS+wuOeGrubXlq35N1c5Lby/S+T7MNTjxo=",
-			"addresses": [
-				{
-					"protocol": "udp",
-					"address": "roughtime.cloudflare.com:2002"
-				}
-			]
-		}
-	]
-}`
+	defer f.Close()
+	h, done := fileHasher(alg, name, f)
+	defer done()
+	return h.Digest(f)
+}
+
+// errServersKeyWithoutList is returned by serverList if a key is given for the
+// built-in list, which is not signed.
+var errServersKeyWithoutList = errors.New("-servers-key requires -servers, the built-in server list is not signed")
+
+// serverList loads the server list name, checking its signature if key is not
+// empty. If name is empty, it returns the built-in list.
+func serverList(name, key string) (*config.ServersJSON, error) {
+	switch {
+	case name == "" && key != "":
+		return nil, errServersKeyWithoutList
+	case name == "":
+		return roughtime.DefaultServers(), nil
+	case key == "":
+		return roughtime.LoadServers(name)
+	}
+	k, err := listKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return roughtime.LoadSignedServers(name, k)
+}
+
+// listKey parses a server list key, given directly or as a file.
+func listKey(s string) (*roughtime.ListKey, error) {
+	if k, err := roughtime.ParseListKey(s); err == nil {
+		return k, nil
+	}
+	b, err := os.ReadFile(s)
+	if err != nil {
+		return nil, err
+	}
+	return roughtime.ParseListKey(string(b))
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestMain runs notary instead of the tests if the test binary is executed by
+// runNotary.
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_TEST_RUN_NOTARY") == "1" {
+		os.Args = append([]string{"notary"}, os.Args[1:]...)
+		main()
+		exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+// runNotary runs notary with args and returns its exit status.
+func runNotary(t *testing.T, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GO_TEST_RUN_NOTARY=1", "XDG_CONFIG_HOME="+t.TempDir(), "XDG_STATE_HOME="+t.TempDir())
+	err := cmd.Run()
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) {
+		return eerr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+func TestFlagExitCodes(t *testing.T) {
+	tcs := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-bogus", "file"}, exitFailure},
+		{[]string{"-max-radius", "bogus", "file"}, exitFailure},
+		{[]string{"-h"}, exitOK},
+		{[]string{"ping", "-bogus"}, exitFailure},
+		{[]string{"ping", "-h"}, exitOK},
+		{[]string{"dir", "-workers", "bogus", "a", "b"}, exitFailure},
+		{[]string{"serve", "-bogus"}, exitFailure},
+		{[]string{"serve", "-h"}, exitOK},
+	}
+	for _, tc := range tcs {
+		if got := runNotary(t, tc.args...); got != tc.want {
+			t.Errorf("notary %q exited with %d, want %d", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestServerListKeyWithoutList(t *testing.T) {
+	key := "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+	if _, err := serverList("", key); !errors.Is(err, errServersKeyWithoutList) {
+		t.Errorf("serverList(\"\", %q) = %v, want %v", key, err, errServersKeyWithoutList)
+	}
+	if runNotary(t, "-servers-key", key, "file") != exitFailure {
+		t.Errorf("notary -servers-key without -servers did not exit with %d", exitFailure)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/Merovius/notary/metrics"
+	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics serves metrics about the queries of a client and the cool-downs
+// in b, if not nil, on addr, in the background. It exits if addr can not be
+// listened on.
+func serveMetrics(log *slog.Logger, addr string, b *roughtime.Backoff) *metrics.Collector {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal(log, "listening for metrics", err)
+	}
+	c := metrics.New()
+	if b != nil {
+		c.WatchBackoff(b)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	go func() {
+		err := http.Serve(l, mux)
+		log.Error("serving metrics failed", "error", err)
+	}()
+	log.Info("serving metrics", "address", l.Addr().String())
+	return c
+}
+
+// serveServerMetrics serves metrics about s on addr, in the background, and
+// health checks under /healthz. The returned collector must be set as the
+// Recorder of s. It exits if addr can not be listened on.
+func serveServerMetrics(log *slog.Logger, addr string, s *server.Server) *metrics.ServerCollector {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal(log, "listening for metrics", err)
+	}
+	c := metrics.NewServer()
+	c.WatchServer(s)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle("GET /healthz", s.HealthHandler())
+	go func() {
+		err := http.Serve(l, mux)
+		log.Error("serving metrics failed", "error", err)
+	}()
+	log.Info("serving metrics", "address", l.Addr().String())
+	return c
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Merovius/notary/clock"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/metrics"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["monitor"] = monitorMain
+}
+
+// monitorMain periodically compares the local clock to the servers and
+// reports when it drifts.
+func monitorMain(args []string) {
+	fs := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	cf.registerMetrics(fs)
+	interval := fs.Duration("interval", time.Minute, "how often to query the servers")
+	threshold := fs.Duration("threshold", time.Second, "report a drift if the local clock is off by more than this")
+	hook := fs.String("hook", "", "command to run when the clock starts or stops drifting (see README)")
+	parseFlags(fs, args)
+	if fs.NArg() != 0 || *interval <= 0 || *threshold <= 0 {
+		fatalf("usage: %s monitor [-v|-quiet] [-servers <servers.json>] [-interval <duration>] [-threshold <duration>] [-hook <command>] [-metrics-listen <addr>]", os.Args[0])
+	}
+
+	log := cf.logger()
+	m := &monitor{
+		log:       log,
+		client:    cf.client(log),
+		servers:   monitorServers(cf.serverList(log)),
+		threshold: *threshold,
+		hook:      *hook,
+	}
+	if len(m.servers) == 0 {
+		fatalf("no servers to monitor")
+	}
+	m.collector = cf.collector
+	log.Info("monitoring clock", "servers", len(m.servers), "interval", *interval, "threshold", *threshold)
+	for t := time.NewTicker(*interval); ; <-t.C {
+		m.poll()
+	}
+}
+
+// monitor keeps track of the offset of the local clock.
+type monitor struct {
+	log       *slog.Logger
+	client    *roughtime.Client
+	servers   []*roughtime.Server
+	collector *metrics.Collector
+	threshold time.Duration
+	hook      string
+
+	clock    clock.Clock
+	estimate time.Duration
+	drifting bool
+}
+
+// monitorServers returns the servers in list, using their first address.
+func monitorServers(list *config.ServersJSON) []*roughtime.Server {
+	var servers []*roughtime.Server
+	for _, s := range list.Servers {
+		if len(s.Addresses) == 0 {
+			continue
+		}
+		servers = append(servers, &roughtime.Server{Name: s.Name, Address: s.Addresses[0].Address, PublicKey: s.PublicKey})
+	}
+	return servers
+}
+
+// poll queries all servers and updates the estimate, see clock.Clock.Update.
+func (m *monitor) poll() {
+	samples, err := m.clock.Update(m.client, m.servers)
+	if err != nil {
+		m.log.Error("no server responded, keeping previous estimate", "offset", m.estimate, "error", err)
+		return
+	}
+	offset, skew, _ := m.clock.Estimate()
+	m.estimate = offset
+	if m.collector != nil {
+		m.collector.RecordEstimate(m.estimate)
+	}
+	n := len(samples)
+
+	drifting := m.estimate.Abs() > m.threshold
+	switch {
+	case drifting && !m.drifting:
+		m.log.Warn("clock is drifting", "offset", m.estimate, "skew", skew, "threshold", m.threshold, "servers", n)
+	case !drifting && m.drifting:
+		m.log.Info("clock is back in sync", "offset", m.estimate, "skew", skew, "servers", n)
+	default:
+		m.log.Debug("estimated offset", "offset", m.estimate, "skew", skew, "servers", n)
+		return
+	}
+	m.drifting = drifting
+	m.runHook()
+}
+
+// runHook runs the hook command, if any, passing the state of the clock in the
+// environment.
+func (m *monitor) runHook() {
+	if m.hook == "" {
+		return
+	}
+	state := "ok"
+	if m.drifting {
+		state = "drift"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, m.hook)
+	cmd.Env = append(os.Environ(),
+		"NOTARY_STATE="+state,
+		fmt.Sprintf("NOTARY_OFFSET=%.6f", m.estimate.Seconds()),
+		fmt.Sprintf("NOTARY_THRESHOLD=%.6f", m.threshold.Seconds()),
+	)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		m.log.Error("running hook failed", "hook", m.hook, "error", err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["ping"] = pingMain
+}
+
+// pingMain queries every address of every server and prints whether it
+// responded correctly the last time, and how many queries were lost. It exits
+// with a non-zero code if any address failed the last time.
+func pingMain(args []string) {
+	fs := flag.NewFlagSet("ping", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	count := fs.Int("count", 1, "query every address this many times, to measure packet loss")
+	interval := fs.Duration("interval", time.Second, "with -count, how long to wait between queries")
+	parseFlags(fs, args)
+	if fs.NArg() != 0 || *count < 1 {
+		fatalf("usage: %s ping [-v|-quiet] [-servers <servers.json>] [-timeout <d>] [-count <n> [-interval <d>]]", os.Args[0])
+	}
+
+	log := cf.logger()
+	servers := pingServers(cf.serverList(log))
+	if len(servers) == 0 {
+		fatalf("no servers to ping")
+	}
+	c := cf.client(log)
+	// Lost queries are what ping measures, so servers that did not
+	// respond must not be skipped.
+	c.Backoff = nil
+	var results []roughtime.QueryResult
+	for i := range *count {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+		results = c.Query(servers)
+	}
+	if err := writePing(os.Stdout, results); err != nil {
+		fatal(log, "writing results", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			exit(exitCode(r.Err))
+		}
+	}
+}
+
+// pingServers returns every address of the servers in list as a separate
+// server.
+func pingServers(list *config.ServersJSON) []*roughtime.Server {
+	var servers []*roughtime.Server
+	for _, s := range list.Servers {
+		for _, a := range s.Addresses {
+			servers = append(servers, &roughtime.Server{Name: s.Name, Address: a.Address, PublicKey: s.PublicKey})
+		}
+	}
+	return servers
+}
+
+// writePing writes results as a table to w.
+func writePing(w io.Writer, results []roughtime.QueryResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tADDRESS\tRTT\tOFFSET\tRADIUS\tDELEGATION EXPIRES\tLOST\tRETRANSMITS\tSTREAK\tSTATUS")
+	for _, r := range results {
+		l := r.Loss
+		loss := fmt.Sprintf("%d/%d\t%d\t%d", l.Lost(), l.Sent, l.Retransmits, l.Streak)
+		if l.Sent == 0 {
+			loss = "-\t-\t-"
+		}
+		if r.Err != nil {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\t%s\t%v\n", r.Server.Name, r.Server.Address, loss, r.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%v\t%s\t%s\tok\n", r.Server.Name, r.Server.Address, r.RTT.Round(time.Millisecond), r.Offset().Round(time.Millisecond), r.Radius, r.Delegation.NotAfter.UTC().Format(time.DateTime), loss)
+	}
+	return tw.Flush()
+}
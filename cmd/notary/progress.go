@@ -0,0 +1,199 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// progress is set by clientFlags.client if -progress is given. It is global,
+// so that fatal can report errors.
+var progress *progressWriter
+
+// progressBar is set by clientFlags.client if the progress of hashing files is
+// shown as a bar on standard error.
+var progressBar bool
+
+// progressWriter writes progress events as newline-delimited JSON, one object
+// per line. All methods can be called on a nil *progressWriter, which does
+// nothing.
+type progressWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newProgressWriter(w io.Writer) *progressWriter {
+	return &progressWriter{enc: json.NewEncoder(w)}
+}
+
+// progressEvent is the JSON form of a progress event. Besides the events of
+// roughtime.Event, there are "hash", written periodically while hashing a
+// file, "done", written when an operation succeeded, and "error", written
+// before exiting because of an error.
+type progressEvent struct {
+	Event        string    `json:"event"`
+	Time         time.Time `json:"time"`
+	Server       string    `json:"server,omitempty"`
+	Address      string    `json:"address,omitempty"`
+	Midpoint     time.Time `json:"midpoint,omitzero"`
+	RadiusMicros int64     `json:"radiusMicros,omitempty"`
+	RTTMicros    int64     `json:"rttMicros,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	File         string    `json:"file,omitempty"`
+	Hashed       int64     `json:"hashed,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	Links        int       `json:"links,omitempty"`
+	Earliest     time.Time `json:"earliest,omitzero"`
+	Latest       time.Time `json:"latest,omitzero"`
+}
+
+func (p *progressWriter) write(e progressEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enc.Encode(e)
+}
+
+// event writes e. It is used as roughtime.Client.Progress.
+func (p *progressWriter) event(e roughtime.Event) {
+	pe := progressEvent{
+		Event:        string(e.Type),
+		Time:         e.Time,
+		Server:       e.Server,
+		Address:      e.Address,
+		Midpoint:     e.Midpoint,
+		RadiusMicros: e.Radius.Microseconds(),
+		RTTMicros:    e.RTT.Microseconds(),
+	}
+	if e.Err != nil {
+		pe.Error = e.Err.Error()
+	}
+	p.write(pe)
+}
+
+// done writes a "done" event for a chain with the given number of links. If
+// rep is not nil, it adds the bounds of the verified chain.
+func (p *progressWriter) done(links int, rep *roughtime.Report) {
+	e := progressEvent{Event: "done", Time: time.Now(), Links: links}
+	if rep != nil {
+		e.Earliest, e.Latest = rep.Earliest, rep.Latest
+	}
+	p.write(e)
+}
+
+// fail writes an "error" event.
+func (p *progressWriter) fail(msg string, err error) {
+	p.write(progressEvent{Event: "error", Time: time.Now(), Error: msg + ": " + err.Error()})
+}
+
+// hashed writes a "hash" event, reporting that n of size bytes of file were
+// hashed.
+func (p *progressWriter) hashed(file string, n, size int64) {
+	p.write(progressEvent{Event: "hash", Time: time.Now(), File: file, Hashed: n, Size: size})
+}
+
+// progressInterval is how often the progress of hashing a file is reported.
+const progressInterval = 200 * time.Millisecond
+
+// fileHasher returns a Hasher for the given files of the file name, reporting
+// progress as by hashProgress. The returned function must be called after
+// hashing.
+func fileHasher(alg, name string, files ...*os.File) (*roughtime.Hasher, func()) {
+	var size int64
+	for _, f := range files {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+	}
+	h := &roughtime.Hasher{Algorithm: alg, ReadAhead: true}
+	var done func()
+	h.Progress, done = hashProgress(name, size)
+	return h, done
+}
+
+// hashProgress returns a function reporting the progress of hashing name, of
+// size bytes or an unknown size if zero, as "hash" events and, if progressBar
+// is set, as a bar on standard error. It returns nil if progress is not
+// reported. The returned done function must be called after hashing.
+func hashProgress(name string, size int64) (report func(hashed int64), done func()) {
+	if progress == nil && !progressBar {
+		return nil, func() {}
+	}
+	// Nothing is reported for files hashed within progressInterval.
+	last, drawn := time.Now(), false
+	report = func(n int64) {
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		progress.hashed(name, n, size)
+		if progressBar {
+			fmt.Fprintf(os.Stderr, "\r\x1b[Khashing %s: %s", name, formatProgress(n, size))
+			drawn = true
+		}
+	}
+	return report, func() {
+		if drawn {
+			fmt.Fprint(os.Stderr, "\r\x1b[K")
+		}
+	}
+}
+
+// formatProgress formats n of size bytes for a progress bar. size is zero if
+// it is not known.
+func formatProgress(n, size int64) string {
+	if size <= 0 {
+		return formatBytes(n)
+	}
+	pct := min(100, n*100/size)
+	const width = 30
+	bar := make([]byte, width)
+	for i := range bar {
+		bar[i] = ' '
+		if int64(i) < pct*width/100 {
+			bar[i] = '='
+		}
+	}
+	return fmt.Sprintf("[%s] %3d%% (%s of %s)", bar, pct, formatBytes(n), formatBytes(size))
+}
+
+// formatBytes formats n bytes with a binary prefix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
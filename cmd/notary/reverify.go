@@ -0,0 +1,118 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["reverify"] = reverifyMain
+}
+
+// reverifyMain verifies captured exchanges with servers again, without network
+// access. It reads a pcap file, like one written with -capture, or a JSON dump
+// written with -dump.
+func reverifyMain(args []string) {
+	fs := flag.NewFlagSet("reverify", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	dump := fs.String("dump", "", "also write the exchanges as JSON to this file, to verify them again later")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fatalf("usage: %s reverify [-servers <servers.json>] [-key-archive <keys.json>] [-dump <exchanges.json>] <capture.pcap|exchanges.json>", os.Args[0])
+	}
+
+	log := cf.logger()
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatal(log, "reading exchanges", err)
+	}
+	var exchanges []*roughtime.Exchange
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '[' {
+		exchanges, err = roughtime.LoadExchanges(bytes.NewReader(b))
+	} else {
+		exchanges, err = roughtime.ReadPCAP(bytes.NewReader(b))
+	}
+	if err != nil {
+		fatal(log, "reading exchanges", err)
+	}
+	if len(exchanges) == 0 {
+		fatalf("no exchanges found in %s", fs.Arg(0))
+	}
+	if *dump != "" {
+		if err := writeExchanges(*dump, exchanges); err != nil {
+			fatal(log, "writing exchanges", err)
+		}
+	}
+
+	servers := cf.serverList(log)
+	c := cf.client(log)
+	results := make([]roughtime.LinkResult, len(exchanges))
+	errs := make([]error, len(exchanges))
+	for i, e := range exchanges {
+		results[i], errs[i] = c.VerifyExchange(e, servers)
+	}
+	if err := writeReverify(os.Stdout, results, errs); err != nil {
+		fatal(log, "writing results", err)
+	}
+	for _, err := range errs {
+		if err != nil {
+			exit(exitCode(err))
+		}
+	}
+}
+
+// writeExchanges writes exchanges to the file name, as JSON.
+func writeExchanges(name string, exchanges []*roughtime.Exchange) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := roughtime.SaveExchanges(f, exchanges); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeReverify writes the results of verifying exchanges as a table to w.
+func writeReverify(w io.Writer, results []roughtime.LinkResult, errs []error) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SENT\tSERVER\tADDRESS\tMIDPOINT\tRADIUS\tSTATUS")
+	for i, r := range results {
+		sent, server := "-", r.Server
+		if !r.Sent.IsZero() {
+			sent = r.Sent.UTC().Format(time.RFC3339Nano)
+		}
+		if server == "" {
+			server = "-"
+		}
+		if errs[i] != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t-\t-\t%v\n", sent, server, r.Address, errs[i])
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\tok\n", sent, server, r.Address, r.Midpoint.UTC().Format(time.RFC3339Nano), r.Radius)
+	}
+	return tw.Flush()
+}
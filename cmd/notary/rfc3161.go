@@ -0,0 +1,130 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Merovius/notary/rfc3161"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// loadTSASigner loads a PEM-encoded private key and certificate to sign
+// timestamp tokens with.
+func loadTSASigner(keyFile, certFile string) (*rfc3161.Signer, error) {
+	if keyFile == "" || certFile == "" {
+		return nil, errors.New("-format rfc3161 requires -tsa-key and -tsa-cert")
+	}
+	signer, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	certDER, err := readPEM(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	return &rfc3161.Signer{Key: signer, Certificate: cert}, nil
+}
+
+// loadPrivateKey loads a PEM-encoded PKCS #8, SEC 1 or PKCS #1 private key.
+func loadPrivateKey(name string) (crypto.Signer, error) {
+	der, err := readPEM(name)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParseECPrivateKey(der); err != nil {
+			if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+				return nil, fmt.Errorf("%s: unsupported private key", name)
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key", name)
+	}
+	return signer, nil
+}
+
+// loadPublicKey loads a PEM-encoded PKIX public key. For convenience, private
+// keys are also accepted.
+func loadPublicKey(keyFile string) (crypto.PublicKey, error) {
+	der, err := readPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return pub, nil
+	}
+	key, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public(), nil
+}
+
+// readPEM returns the contents of the first PEM block in a file.
+func readPEM(name string) ([]byte, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", name)
+	}
+	return p.Bytes, nil
+}
+
+// isToken reports whether b looks like a DER-encoded timestamp token, as
+// opposed to a chain.
+func isToken(b []byte) bool {
+	return len(b) > 0 && b[0] == 0x30
+}
+
+// loadToken parses a timestamp token and returns it together with the chain
+// embedded in it.
+func loadToken(b []byte) (*rfc3161.Token, *roughtime.Chain, error) {
+	tok, err := rfc3161.Parse(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok.Chain == nil {
+		return nil, nil, errors.New("timestamp token does not contain a roughtime chain")
+	}
+	ch, err := roughtime.LoadChain(bytes.NewReader(tok.Chain))
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := roughtime.DigestNonce(tok.HashAlgorithm, tok.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(ch.Nonce(), nonce) {
+		return nil, nil, errMismatch
+	}
+	return tok, ch, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func init() {
+	commands["serve-http"] = serveHTTPMain
+}
+
+// maxRequestSize limits the size of request bodies accepted by serve-http.
+const maxRequestSize = 1 << 20
+
+// serveHTTPMain serves an HTTP API to create and verify chains.
+func serveHTTPMain(args []string) {
+	fs := flag.NewFlagSet("serve-http", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	cf.registerMetrics(fs)
+	listen := fs.String("listen", "localhost:8080", "address to serve the API on")
+	parseFlags(fs, args)
+	if fs.NArg() != 0 {
+		fatalf("usage: %s serve-http [-v|-quiet] [-servers <servers.json>] [-listen <addr>] [-metrics-listen <addr>]", os.Args[0])
+	}
+
+	log := cf.logger()
+	h := &apiHandler{
+		log:     log,
+		servers: cf.serverList(log),
+		client:  cf.client(log),
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatal(log, "listening", err)
+	}
+	srv := &http.Server{
+		Handler:           h.mux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Info("serving API", "address", l.Addr().String())
+	fatal(log, "serving API", srv.Serve(l))
+}
+
+// apiHandler implements the HTTP API of serve-http.
+type apiHandler struct {
+	log     *slog.Logger
+	servers *config.ServersJSON
+	client  *roughtime.Client
+}
+
+// chainRequest is the body of a request to create a chain.
+type chainRequest struct {
+	// HashAlgorithm is the algorithm Digest was calculated with. The
+	// default is sha512.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	Digest        []byte `json:"digest"`
+	// Format is the format of the returned chain, json (the default) or
+	// binary.
+	Format string `json:"format,omitempty"`
+}
+
+// verifyRequest is the body of a request to verify a chain.
+type verifyRequest struct {
+	Digest []byte        `json:"digest"`
+	Chain  *config.Chain `json:"chain"`
+}
+
+// verifyResponse is returned for a successfully verified chain.
+type verifyResponse struct {
+	Links    []linkReport `json:"links"`
+	Earliest time.Time    `json:"earliest"`
+	Latest   time.Time    `json:"latest"`
+}
+
+type linkReport struct {
+	Server   string    `json:"server,omitempty"`
+	Midpoint time.Time `json:"midpoint"`
+	// RadiusMicros is the uncertainty radius of the link, in microseconds.
+	RadiusMicros int64 `json:"radiusMicros"`
+}
+
+// errorResponse is returned for failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (h *apiHandler) mux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chain", h.chain)
+	mux.HandleFunc("POST /v1/verify", h.verify)
+	mux.Handle("/v1/relay", roughtime.NewRelay(h.servers, nil, h.client.Timeout))
+	return mux
+}
+
+func (h *apiHandler) chain(w http.ResponseWriter, r *http.Request) {
+	var req chainRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "binary" {
+		h.error(w, http.StatusBadRequest, errors.New("invalid format "+req.Format))
+		return
+	}
+	nonce, err := roughtime.DigestNonce(req.HashAlgorithm, req.Digest)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	alg := req.HashAlgorithm
+	if alg == "" {
+		alg = roughtime.SHA512
+	}
+	ch, _, err := h.client.BuildChain(h.servers, alg, nonce)
+	if err != nil {
+		h.error(w, statusCode(err), err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := saveChain(buf, ch, req.Format == "binary"); err != nil {
+		h.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Format == "binary" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(buf.Bytes())
+	h.log.Info("created chain", "remote", r.RemoteAddr, "links", len(ch.Links))
+}
+
+func (h *apiHandler) verify(w http.ResponseWriter, r *http.Request) {
+	var req verifyRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if req.Chain == nil {
+		h.error(w, http.StatusBadRequest, errors.New("missing chain"))
+		return
+	}
+	ch := &roughtime.Chain{Chain: *req.Chain}
+	nonce, err := roughtime.DigestNonce(ch.HashAlgorithm, req.Digest)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	rep, err := h.client.VerifyChain(ch, h.servers)
+	if err == nil && (len(ch.Links) == 0 || !bytes.Equal(ch.Nonce(), nonce)) {
+		err = errMismatch
+	}
+	if err != nil {
+		h.error(w, statusCode(err), err)
+		return
+	}
+	resp := verifyResponse{Earliest: rep.Earliest, Latest: rep.Latest}
+	for _, l := range rep.Links {
+		resp.Links = append(resp.Links, linkReport{Server: l.Server, Midpoint: l.Midpoint, RadiusMicros: l.Radius.Microseconds()})
+	}
+	h.reply(w, http.StatusOK, resp)
+	h.log.Info("verified chain", "remote", r.RemoteAddr, "links", len(ch.Links))
+}
+
+// decode decodes the JSON body of r into v. If that fails, it replies with an
+// error and returns false.
+func (h *apiHandler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func (h *apiHandler) error(w http.ResponseWriter, code int, err error) {
+	h.log.Debug("request failed", "status", code, "error", err)
+	h.reply(w, code, errorResponse{err.Error()})
+}
+
+func (h *apiHandler) reply(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// statusCode returns the HTTP status code for an error, analogous to exitCode.
+func statusCode(err error) int {
+	switch exitCode(err) {
+	case exitMismatch, exitVerify:
+		return http.StatusUnprocessableEntity
+	case exitNetwork:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
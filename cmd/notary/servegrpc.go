@@ -0,0 +1,96 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"net"
+	"os"
+
+	"github.com/Merovius/notary/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func init() {
+	commands["serve-grpc"] = serveGRPCMain
+}
+
+// serveGRPCMain serves the gRPC API defined in package rpc.
+func serveGRPCMain(args []string) {
+	fs := flag.NewFlagSet("serve-grpc", flag.ContinueOnError)
+	var cf clientFlags
+	cf.register(fs)
+	cf.registerMetrics(fs)
+	listen := fs.String("listen", "localhost:8443", "address to serve the API on")
+	certFile := fs.String("tls-cert", "", "file containing the TLS certificate of the server")
+	keyFile := fs.String("tls-key", "", "file containing the TLS key of the server")
+	clientCA := fs.String("tls-client-ca", "", "file containing CA certificates to verify clients with (enables mutual TLS)")
+	insecure := fs.Bool("insecure", false, "serve without TLS")
+	parseFlags(fs, args)
+	if fs.NArg() != 0 || (*insecure == (*certFile != "")) {
+		fatalf("usage: %s serve-grpc [-v|-quiet] [-servers <servers.json>] [-listen <addr>] [-metrics-listen <addr>] (-tls-cert <file> -tls-key <file> [-tls-client-ca <file>] | -insecure)", os.Args[0])
+	}
+
+	log := cf.logger()
+	var opts []grpc.ServerOption
+	if !*insecure {
+		cfg, err := serverTLSConfig(*certFile, *keyFile, *clientCA)
+		if err != nil {
+			fatal(log, "loading TLS configuration", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg)))
+	}
+	srv := grpc.NewServer(opts...)
+	rpc.RegisterNotaryServer(srv, &rpc.Server{
+		Client:  cf.client(log),
+		Servers: cf.serverList(log),
+	})
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatal(log, "listening", err)
+	}
+	log.Info("serving gRPC API", "address", l.Addr().String(), "mtls", *clientCA != "")
+	fatal(log, "serving gRPC API", srv.Serve(l))
+}
+
+// serverTLSConfig returns the TLS configuration for a server. If clientCA is
+// not empty, clients must present a certificate signed by one of the CAs in it.
+func serverTLSConfig(certFile, keyFile, clientCA string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCA != "" {
+		b, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificates in " + clientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Merovius/notary/server"
+)
+
+func init() {
+	commands["serve"] = serveMain
+}
+
+const serveUsage = "usage: %s serve [-v|-quiet] [-log-format text|json] -key <key.pem> [-listen <addr>,...] [-radius <d>] [-time-source system|kernel] [-rate <n>] [-burst <n>] [-metrics-listen <addr>]"
+
+// serveConfig is the configuration of the serve subcommand.
+type serveConfig struct {
+	root          crypto.Signer
+	listen        []string
+	radius        time.Duration
+	timeSource    server.TimeSource
+	rate          float64
+	burst         int
+	metricsListen string
+	verbose       bool
+	log           *slog.Logger
+}
+
+// loadServeConfig reads the configuration of serve from args, the environment
+// and the config file.
+func loadServeConfig(args []string) (*serveConfig, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		cfg                                   serveConfig
+		quiet                                 bool
+		logFormat, keyFile, addrs, timeSource string
+	)
+	fs.BoolVar(&cfg.verbose, "v", false, "log every request")
+	fs.BoolVar(&quiet, "quiet", false, "only log errors")
+	fs.StringVar(&logFormat, "log-format", "text", "log format (text or json)")
+	fs.StringVar(&keyFile, "key", "", "file containing the PEM-encoded Ed25519 long-term key of the server")
+	fs.StringVar(&addrs, "listen", ":2002", "comma-separated UDP addresses to serve on (ignored with systemd socket activation)")
+	fs.DurationVar(&cfg.radius, "radius", server.DefaultRadius, "smallest uncertainty radius to claim in responses")
+	fs.StringVar(&timeSource, "time-source", "system", "clock to claim the time of: system, or kernel to claim the maximum error of the disciplined clock and stop answering while it is unsynchronized (Linux only)")
+	fs.Float64Var(&cfg.rate, "rate", server.DefaultRate, "requests per second to allow from each source network (0 to disable rate limiting)")
+	fs.IntVar(&cfg.burst, "burst", server.DefaultBurst, "requests to allow from a source network at once")
+	fs.StringVar(&cfg.metricsListen, "metrics-listen", "", "address to serve Prometheus metrics on, under /metrics, and health checks, under /healthz (empty to disable)")
+	if err := loadFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 || keyFile == "" {
+		return nil, errors.New("missing -key or extra arguments")
+	}
+	if cfg.rate < 0 || cfg.burst < 1 {
+		return nil, errors.New("-rate must not be negative and -burst must be positive")
+	}
+	log, err := newLogger(logFormat, cfg.verbose, quiet)
+	if err != nil {
+		return nil, err
+	}
+	cfg.log = log
+	if cfg.timeSource, err = parseTimeSource(timeSource); err != nil {
+		return nil, err
+	}
+	if cfg.root, err = loadPrivateKey(keyFile); err != nil {
+		return nil, err
+	}
+	if _, ok := cfg.root.Public().(ed25519.PublicKey); !ok {
+		return nil, fmt.Errorf("%s: long-term key must be an Ed25519 key", keyFile)
+	}
+	for a := range strings.SplitSeq(addrs, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.listen = append(cfg.listen, a)
+		}
+	}
+	return &cfg, nil
+}
+
+// parseTimeSource returns the TimeSource named by the -time-source flag.
+func parseTimeSource(name string) (server.TimeSource, error) {
+	switch name {
+	case "system":
+		return server.SystemClock{}, nil
+	case "kernel":
+		// Fail early on systems without kernel error estimates, but not
+		// if the clock is merely unsynchronized yet.
+		if _, err := (server.KernelClock{}).Now(); err != nil && !errors.Is(err, server.ErrUnsynchronized) {
+			return nil, err
+		}
+		return server.KernelClock{}, nil
+	default:
+		return nil, fmt.Errorf("invalid -time-source %q", name)
+	}
+}
+
+// limiter returns the rate limiter configured by c, or nil if rate limiting is
+// disabled.
+func (c *serveConfig) limiter() *server.RateLimiter {
+	if c.rate == 0 {
+		return nil
+	}
+	return &server.RateLimiter{Rate: c.rate, Burst: c.burst}
+}
+
+// serveMain runs a roughtime server until it receives SIGTERM or SIGINT. On
+// SIGHUP, it reloads the key, radius, time source, rate limits and logging.
+func serveMain(args []string) {
+	cfg, err := loadServeConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, serveUsage+"\n", os.Args[0])
+		exit(exitOK)
+	}
+	if err != nil {
+		fatalf("%v\n"+serveUsage, err, os.Args[0])
+	}
+	log := cfg.log
+
+	s := &server.Server{
+		Root:       cfg.root,
+		Radius:     cfg.radius,
+		TimeSource: cfg.timeSource,
+		Limiter:    cfg.limiter(),
+		Logger:     log,
+	}
+	if cfg.verbose {
+		s.RequestLog = log
+	}
+	if cfg.metricsListen != "" {
+		s.Recorder = serveServerMetrics(log, cfg.metricsListen, s)
+	}
+
+	conns, err := server.SystemdConns()
+	if err != nil {
+		fatal(log, "using systemd sockets", err)
+	}
+	if len(conns) == 0 {
+		if conns, err = server.Listen(cfg.listen...); err != nil {
+			fatal(log, "listening", err)
+		}
+	}
+	for _, c := range conns {
+		log.Info("serving roughtime", "address", c.LocalAddr().String())
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.ServeConns(conns...) }()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for {
+		select {
+		case err := <-done:
+			fatal(log, "serving", err)
+		case sg := <-sig:
+			if sg != syscall.SIGHUP {
+				log.Info("shutting down", "signal", sg.String())
+				for _, c := range conns {
+					c.Close()
+				}
+				if err := <-done; err != nil && !errors.Is(err, net.ErrClosed) {
+					fatal(log, "serving", err)
+				}
+				return
+			}
+			log = reloadServer(log, s, cfg, args)
+		}
+	}
+}
+
+// reloadServer reloads the configuration of s from args and returns the logger
+// to use from now on. On failure, the current configuration is kept. Addresses
+// and the metrics listener, including the logger of the latter, can not be
+// changed without a restart.
+func reloadServer(log *slog.Logger, s *server.Server, cfg *serveConfig, args []string) *slog.Logger {
+	next, err := loadServeConfig(args)
+	if err != nil {
+		log.Error("reloading configuration failed", "error", err)
+		return log
+	}
+	log = next.log
+	if !slices.Equal(next.listen, cfg.listen) || next.metricsListen != cfg.metricsListen {
+		log.Warn("changed addresses take effect after a restart")
+	}
+	s.Configure(func(s *server.Server) {
+		s.Root = next.root
+		s.Radius = next.radius
+		s.TimeSource = next.timeSource
+		// Replacing the limiter forgets all buckets, so it is kept if
+		// the limits did not change.
+		if next.rate != cfg.rate || next.burst != cfg.burst {
+			s.Limiter = next.limiter()
+		}
+		s.Logger = log
+		s.RequestLog = nil
+		if next.verbose {
+			s.RequestLog = log
+		}
+	})
+	cfg.root, cfg.radius, cfg.timeSource, cfg.rate, cfg.burst = next.root, next.radius, next.timeSource, next.rate, next.burst
+	cfg.verbose, cfg.log = next.verbose, next.log
+	log.Info("reloaded configuration", "radius", next.radius, "rate", next.rate, "burst", next.burst)
+	return log
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/stats"
+)
+
+// saveStats saves st to the file name when the command exits.
+func saveStats(log *slog.Logger, st *stats.Stats, name string) {
+	atExit(func() {
+		if err := st.Save(name); err != nil {
+			log.Warn("saving statistics failed", "file", name, "error", err)
+		}
+	})
+}
+
+// recorders informs multiple recorders about queries.
+type recorders []roughtime.Recorder
+
+func (rs recorders) RecordQuery(address string, rtt time.Duration, err error) {
+	for _, r := range rs {
+		r.RecordQuery(address, rtt, err)
+	}
+}
+
+func (rs recorders) RecordOffset(address string, offset time.Duration) {
+	for _, r := range rs {
+		r.RecordOffset(address, offset)
+	}
+}
+
+// writeStats writes the statistics in the file name as a table to w.
+func writeStats(w io.Writer, name string) error {
+	if name == "" {
+		return errors.New("no -stats-file given")
+	}
+	st, err := stats.Load(name)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tQUERIES\tFAILURES\tRELIABILITY\tRTT\tLAST SUCCESS\tLAST FAILURE")
+	for _, a := range st.Addresses() {
+		s, _ := st.Get(a)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f%%\t%v\t%s\t%s\n", a, s.Queries, s.Failures, 100*s.Reliability, s.RTT.Round(time.Millisecond), formatTime(s.LastSuccess), formatTime(s.LastFailure))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.DateTime)
+}
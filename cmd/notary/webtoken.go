@@ -0,0 +1,134 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Merovius/notary/cwt"
+	"github.com/Merovius/notary/jws"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// webToken contains the claims of a CBOR or JSON web token needed to verify
+// it.
+type webToken struct {
+	issuer        string
+	issuedAt      time.Time
+	hashAlgorithm string
+	digest        []byte
+	chain         []byte
+}
+
+// webTokenFormat describes a format of web tokens.
+type webTokenFormat struct {
+	// name is the name of the format in messages and format the value of
+	// -format creating it, which is also the prefix of its key flag.
+	name, format string
+	// parse parses a token and verifies its signature with pub, unless pub
+	// is nil.
+	parse func(b []byte, pub crypto.PublicKey) (webToken, error)
+}
+
+var (
+	cwtFormat = webTokenFormat{"CBOR web token", "cwt", parseCWT}
+	jwsFormat = webTokenFormat{"JSON web token", "jws", parseJWS}
+)
+
+func parseCWT(b []byte, pub crypto.PublicKey) (webToken, error) {
+	var (
+		tok *cwt.Token
+		err error
+	)
+	if pub == nil {
+		tok, err = cwt.ParseUnverified(b)
+	} else {
+		tok, err = cwt.Parse(b, pub)
+	}
+	if err != nil {
+		return webToken{}, err
+	}
+	return webToken{tok.Issuer, tok.IssuedAt, tok.HashAlgorithm, tok.Digest, tok.Chain}, nil
+}
+
+func parseJWS(b []byte, pub crypto.PublicKey) (webToken, error) {
+	var (
+		tok *jws.Token
+		err error
+	)
+	if pub == nil {
+		tok, err = jws.ParseUnverified(string(b))
+	} else {
+		tok, err = jws.Parse(string(b), pub)
+	}
+	if err != nil {
+		return webToken{}, err
+	}
+	return webToken{tok.Issuer, tok.IssuedAt, tok.HashAlgorithm, tok.Digest, tok.Chain}, nil
+}
+
+// loadTokenKey loads the PEM-encoded private key to sign web tokens of format f
+// with.
+func loadTokenKey(f webTokenFormat, keyFile string) (crypto.Signer, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("-format %s requires -%[1]s-key", f.format)
+	}
+	return loadPrivateKey(keyFile)
+}
+
+// loadWebToken parses a web token of format f and returns the chain embedded in
+// it. If keyFile is empty, the signature of the token is not verified. It exits
+// on failure.
+func loadWebToken(log *slog.Logger, f webTokenFormat, b []byte, keyFile string) *roughtime.Chain {
+	var pub crypto.PublicKey
+	if keyFile != "" {
+		var err error
+		if pub, err = loadPublicKey(keyFile); err != nil {
+			fatal(log, "loading "+f.name+" key", err)
+		}
+	}
+	tok, err := f.parse(b, pub)
+	if err != nil {
+		fatal(log, "loading "+f.name, err)
+	}
+	if pub == nil {
+		log.Info(f.name+" signature not checked, relying on its chain", "issuer", tok.issuer)
+	} else {
+		log.Info(f.name+" signature verified", "issuer", tok.issuer, "issued", tok.issuedAt)
+	}
+	if tok.chain == nil {
+		fatal(log, "loading "+f.name, errors.New("token does not embed its chain"))
+	}
+	ch, err := roughtime.LoadChain(bytes.NewReader(tok.chain))
+	if err != nil {
+		fatal(log, "loading "+f.name, err)
+	}
+	if ch.HashAlgorithm == "" {
+		ch.HashAlgorithm = tok.hashAlgorithm
+	}
+	nonce, err := roughtime.DigestNonce(tok.hashAlgorithm, tok.digest)
+	if err != nil {
+		fatal(log, "loading "+f.name, err)
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(ch.Nonce(), nonce) {
+		fatal(log, "loading "+f.name, errMismatch)
+	}
+	return ch
+}
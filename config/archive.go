@@ -0,0 +1,96 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KeyArchive lists keys servers used in the past, with the periods they were
+// in use. Servers rotate their keys, so chains created before a rotation can
+// only be verified with the key valid at the time.
+type KeyArchive struct {
+	Keys []*ArchivedKey `json:"keys,omitempty"`
+}
+
+// ArchivedKey is a key a server used in the past.
+type ArchivedKey struct {
+	// Name is the name of the server.
+	Name string `json:"name,omitempty"`
+	// PublicKeyType and PublicKey are as in Server.
+	PublicKeyType string `json:"publicKeyType,omitempty"`
+	PublicKey     []byte `json:"publicKey,omitempty"`
+	// ValidFrom optionally contains the RFC3339 time the server started
+	// using the key.
+	ValidFrom string `json:"validFrom,omitempty"`
+	// ValidUntil contains the RFC3339 time the server stopped using the
+	// key. Responses claiming a later time are not accepted.
+	ValidUntil string `json:"validUntil,omitempty"`
+}
+
+// Period returns the times given by ValidFrom and ValidUntil. from is the zero
+// time if ValidFrom is unset or invalid, and so is until.
+func (k *ArchivedKey) Period() (from, until time.Time) {
+	from, _ = time.Parse(time.RFC3339, k.ValidFrom)
+	until, _ = time.Parse(time.RFC3339, k.ValidUntil)
+	return from, until
+}
+
+// Validate checks a for problems that would prevent it from being used to
+// verify chains.
+func (a *KeyArchive) Validate() error {
+	var errs []error
+	for i, k := range a.Keys {
+		entry := func(field, msg string, v ...any) {
+			errs = append(errs, fmt.Errorf("keys[%d] (%q): %s: %s", i, k.Name, field, fmt.Sprintf(msg, v...)))
+		}
+		if k == nil {
+			errs = append(errs, fmt.Errorf("keys[%d]: missing", i))
+			continue
+		}
+		if k.Name == "" {
+			entry("name", "missing")
+		}
+		switch k.PublicKeyType {
+		case "ed25519":
+			if len(k.PublicKey) != 32 {
+				entry("publicKey", "ed25519 key must have 32 bytes, has %d", len(k.PublicKey))
+			}
+		case "":
+			entry("publicKeyType", "missing")
+		default:
+			entry("publicKeyType", "unsupported key type %q", k.PublicKeyType)
+		}
+		if k.ValidFrom != "" {
+			if _, err := time.Parse(time.RFC3339, k.ValidFrom); err != nil {
+				entry("validFrom", "not an RFC3339 time: %q", k.ValidFrom)
+			}
+		}
+		if k.ValidUntil == "" {
+			entry("validUntil", "missing")
+		} else if _, err := time.Parse(time.RFC3339, k.ValidUntil); err != nil {
+			entry("validUntil", "not an RFC3339 time: %q", k.ValidUntil)
+		}
+		if from, until := k.Period(); !from.IsZero() && until.Before(from) {
+			entry("validUntil", "before validFrom")
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid key archive: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Bundle is a chain together with the entries of the servers that signed it,
+// as they were in the server list used to create it. Servers rotate their keys
+// and leave server lists, so the snapshot records which keys were trusted when
+// the chain was created.
+type Bundle struct {
+	// HashAlgorithm names the algorithm used to derive the nonce of the
+	// chain from the notarized data. An empty value means sha512. It is the
+	// same as that of Chain, for readers only looking at the bundle.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	Chain         *Chain `json:"chain"`
+	// Servers contains the entries of the servers that signed links of
+	// Chain, in the order of their first link.
+	Servers []*Server `json:"servers"`
+	// Created contains the RFC3339 time the bundle was created.
+	Created string `json:"created,omitempty"`
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config contains the types describing server lists and request
+// chains, as used by the roughtime ecosystem. They can be used to construct
+// server lists and chains for the roughtime package.
+//
+// The types marshal to and from the same JSON as the protobuf messages in the
+// roughtime project's config.proto.
+package config // import "github.com/Merovius/notary/config"
+
+import "time"
+
+// ServersJSON represents a JSON format for distributing information about
+// Roughtime servers.
+type ServersJSON struct {
+	// Created contains the RFC3339 time when the JSON file was created.
+	Created string `json:"created,omitempty"`
+	// Expires contains the RFC3339 time when the information in this JSON
+	// file expires.
+	Expires string    `json:"expires,omitempty"`
+	Servers []*Server `json:"servers,omitempty"`
+	// Bad lists servers which are known to misbehave, as in the roughtime
+	// ecosystem.json. Clients must not use them.
+	Bad []*Server `json:"bad,omitempty"`
+}
+
+// Server represents a Roughtime server in a JSON configuration.
+type Server struct {
+	Name string `json:"name,omitempty"`
+	// PublicKeyType specifies the type of the public key contained in
+	// PublicKey. Normally this will be "ed25519" but implementations should
+	// ignore entries with unknown key types.
+	PublicKeyType string           `json:"publicKeyType,omitempty"`
+	PublicKey     []byte           `json:"publicKey,omitempty"`
+	Addresses     []*ServerAddress `json:"addresses,omitempty"`
+	// ValidUntil optionally contains the RFC3339 time after which the
+	// server is no longer operated. It must not be queried afterwards.
+	ValidUntil string `json:"validUntil,omitempty"`
+	// Deprecated is set if the server is scheduled to be shut down and
+	// should be phased out.
+	Deprecated bool `json:"deprecated,omitempty"`
+}
+
+// Expiry returns the time given by ValidUntil, or the zero time if it is unset
+// or invalid.
+func (s *Server) Expiry() time.Time {
+	t, _ := time.Parse(time.RFC3339, s.ValidUntil)
+	return t
+}
+
+// ServerAddress represents the address of a Roughtime server in a JSON
+// configuration.
+type ServerAddress struct {
+	Protocol string `json:"protocol,omitempty"`
+	// Address contains a protocol specific address. For the protocol "udp",
+	// the address has the form "host:port" where host is either a DNS name,
+	// an IPv4 literal, or an IPv6 literal in square brackets.
+	Address string `json:"address,omitempty"`
+}
+
+// Chain represents a history of Roughtime queries where each provably follows
+// the previous one.
+type Chain struct {
+	Links []*Link `json:"links,omitempty"`
+	// HashAlgorithm names the algorithm used to derive the initial nonce
+	// from the notarized data. An empty value means sha512.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	// Skipped lists servers that could not be used while creating the
+	// chain. It is informational only and not covered by any signature.
+	Skipped []*SkippedServer `json:"skipped,omitempty"`
+	// Transparency lists entries of the chain in transparency logs.
+	Transparency []*TransparencyEntry `json:"transparency,omitempty"`
+}
+
+// TransparencyEntry records that a chain was submitted to a transparency log.
+// The logged artifact is the SHA-256 digest of the reply of the last link
+// covered, which depends on all earlier links.
+type TransparencyEntry struct {
+	// URL is the base URL of the log.
+	URL string `json:"url,omitempty"`
+	// UUID identifies the entry in the log.
+	UUID     string `json:"uuid,omitempty"`
+	LogIndex int64  `json:"logIndex,omitempty"`
+	// IntegratedTime is the time the log claims to have added the entry, in
+	// seconds since the Unix epoch.
+	IntegratedTime int64 `json:"integratedTime,omitempty"`
+	// Links is the number of links of the chain at the time of submission.
+	Links int `json:"links,omitempty"`
+}
+
+// Attestation is a single server response for a nonce, without a chain.
+type Attestation struct {
+	// PublicKeyType specifies the type of public key contained in
+	// ServerPublicKey. See the same field in Server for details.
+	PublicKeyType   string `json:"publicKeyType,omitempty"`
+	ServerPublicKey []byte `json:"serverPublicKey,omitempty"`
+	// Nonce is the nonce the response was requested for.
+	Nonce []byte `json:"nonce,omitempty"`
+	// Reply contains the reply from the server.
+	Reply []byte `json:"reply,omitempty"`
+	// HashAlgorithm names the algorithm used to derive Nonce from the
+	// notarized data. An empty value means sha512.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+}
+
+// SkippedServer records a server that was skipped while creating a Chain.
+type SkippedServer struct {
+	Name      string `json:"name,omitempty"`
+	PublicKey []byte `json:"publicKey,omitempty"`
+	// Error describes why the server was skipped.
+	Error string `json:"error,omitempty"`
+}
+
+// Link represents an entry in a Chain.
+type Link struct {
+	// PublicKeyType specifies the type of public key contained in
+	// ServerPublicKey. See the same field in Server for details.
+	PublicKeyType   string `json:"publicKeyType,omitempty"`
+	ServerPublicKey []byte `json:"serverPublicKey,omitempty"`
+	// NonceOrBlind contains either the full nonce (only for the first Link
+	// in a Chain) or else contains a blind value that is combined with the
+	// previous reply to make the next nonce. In either case, the value is
+	// 64 bytes long.
+	NonceOrBlind []byte `json:"nonceOrBlind,omitempty"`
+	// Reply contains the reply from the server.
+	Reply []byte `json:"reply,omitempty"`
+	// Metadata optionally contains information about how the reply was
+	// obtained. It is not covered by any signature and ignored during
+	// verification.
+	Metadata *LinkMetadata `json:"metadata,omitempty"`
+}
+
+// LinkMetadata contains unauthenticated information about how the reply of a
+// Link was obtained, for debugging and latency analysis.
+type LinkMetadata struct {
+	// ServerName is the name of the server in the server list used.
+	ServerName string `json:"serverName,omitempty"`
+	// Address is the address the server was queried at.
+	Address string `json:"address,omitempty"`
+	// SendTime and ReceiveTime contain the RFC3339 local times when the
+	// request was sent and the reply was received.
+	SendTime    string `json:"sendTime,omitempty"`
+	ReceiveTime string `json:"receiveTime,omitempty"`
+	// RTTMicros is the round-trip time of the query in microseconds.
+	RTTMicros int64 `json:"rttMicros,omitempty"`
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tcs := []struct {
+		in   string
+		want []string
+	}{
+		{`{"servers": [{"name": "Test", "publicKeyType": "ed25519", "publicKey": "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ=", "addresses": [{"protocol": "udp", "address": "localhost:2002"}]}]}`, nil},
+		{`{}`, []string{"servers: no servers"}},
+		{`{"created": "yesterday", "servers": [{"name": "Test", "publicKeyType": "ed25519", "publicKey": "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ=", "addresses": [{"protocol": "udp", "address": "localhost:2002"}]}]}`, []string{`created: not an RFC3339 time: "yesterday"`}},
+		{`{"servers": [{"publicKeyType": "rsa", "addresses": [{"protocol": "tcp", "address": "localhost"}]}]}`, []string{
+			`servers[0] (""): name: missing`,
+			`servers[0] (""): publicKeyType: unsupported key type "rsa"`,
+			`servers[0] (""): addresses[0].protocol: unsupported protocol "tcp"`,
+			`servers[0] (""): addresses[0].address: address localhost: missing port in address`,
+		}},
+		{`{"servers": [{"name": "Test", "publicKeyType": "ed25519", "publicKey": "AAAA"}]}`, []string{
+			`servers[0] ("Test"): publicKey: ed25519 key must have 32 bytes, has 3`,
+			`servers[0] ("Test"): addresses: no addresses`,
+		}},
+	}
+	for _, tc := range tcs {
+		var s ServersJSON
+		if err := json.Unmarshal([]byte(tc.in), &s); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		if err := s.Validate(); err != nil {
+			for _, p := range err.(ValidationError) {
+				got = append(got, p.String())
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Validate(%s) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestEcosystem(t *testing.T) {
+	in := `{
+		"servers": [
+			{"name": "Hex", "publicKeyType": "ed25519", "publicKey": "7ad3da688c5c04c635a14786a70bcf30224cc25455371bf9d4a2bfb64b682534"},
+			{"name": "Base64", "publicKeyType": "ed25519", "publicKey": "gD63hSj3ScS+wuOeGrubXlq35N1c5Lby/S+T7MNTjxo="}
+		],
+		"bad": [
+			{"name": "Base64", "publicKeyType": "ed25519", "publicKey": "803eb78528f749c4bec2e39e1abb9b5e5ab7e4dd5ce4b6f2fd2f93ecc3538f1a"}
+		]
+	}`
+	var s ServersJSON
+	if err := json.Unmarshal([]byte(in), &s); err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveBad()
+	if len(s.Servers) != 1 || s.Servers[0].Name != "Hex" || len(s.Bad) != 0 {
+		t.Fatalf("RemoveBad() left %d servers and %d bad entries, want only Hex", len(s.Servers), len(s.Bad))
+	}
+	if want := "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ="; base64.StdEncoding.EncodeToString(s.Servers[0].PublicKey) != want {
+		t.Errorf("hex key decoded to %x, want %s", s.Servers[0].PublicKey, want)
+	}
+}
+
+func TestValidateKeyArchive(t *testing.T) {
+	tcs := []struct {
+		in   string
+		want []string
+	}{
+		{`{"keys": [{"name": "Test", "publicKeyType": "ed25519", "publicKey": "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ=", "validFrom": "2018-01-01T00:00:00Z", "validUntil": "2019-01-01T00:00:00Z"}]}`, nil},
+		{`{"keys": [{"publicKeyType": "ed25519", "publicKey": "AAAA"}]}`, []string{
+			`keys[0] (""): name: missing`,
+			`keys[0] (""): publicKey: ed25519 key must have 32 bytes, has 3`,
+			`keys[0] (""): validUntil: missing`,
+		}},
+		{`{"keys": [{"name": "Test", "publicKeyType": "ed25519", "publicKey": "etPaaIxcBMY1oUeGpwvPMCJMwlRVNxv51KK/tktoJTQ=", "validFrom": "2019-01-01T00:00:00Z", "validUntil": "2018-01-01T00:00:00Z"}]}`, []string{
+			`keys[0] ("Test"): validUntil: before validFrom`,
+		}},
+	}
+	for _, tc := range tcs {
+		var a KeyArchive
+		if err := json.Unmarshal([]byte(tc.in), &a); err != nil {
+			t.Fatal(err)
+		}
+		err := a.Validate()
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("Validate(%s) = %v, want <nil>", tc.in, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Validate(%s) = <nil>, want %q", tc.in, tc.want)
+			continue
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("Validate(%s) = %v, want %q", tc.in, err, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// UnmarshalJSON implements json.Unmarshaler. In addition to base64, it accepts
+// hex-encoded public keys, as used by the roughtime ecosystem.json.
+func (s *Server) UnmarshalJSON(b []byte) error {
+	type server Server
+	v := struct {
+		*server
+		PublicKey string `json:"publicKey"`
+	}{server: (*server)(s)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	k, err := decodeKey(v.PublicKey)
+	if err != nil {
+		return fmt.Errorf("server %q: invalid publicKey: %v", s.Name, err)
+	}
+	s.PublicKey = k
+	return nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	if len(s) == 2*32 {
+		if k, err := hex.DecodeString(s); err == nil {
+			return k, nil
+		}
+	}
+	if s == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// RemoveBad removes all servers from s.Servers, which have the public key of
+// an entry in s.Bad, and clears s.Bad.
+func (s *ServersJSON) RemoveBad() {
+	bad := make(map[string]bool)
+	for _, b := range s.Bad {
+		if b != nil {
+			bad[string(b.PublicKey)] = true
+		}
+	}
+	var servers []*Server
+	for _, srv := range s.Servers {
+		if srv == nil || !bad[string(srv.PublicKey)] {
+			servers = append(servers, srv)
+		}
+	}
+	s.Servers, s.Bad = servers, nil
+}
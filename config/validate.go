@@ -0,0 +1,125 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// A Problem describes an invalid field in a server list.
+type Problem struct {
+	// Index is the index of the offending server entry, or -1 if the
+	// problem is with the list itself.
+	Index int
+	// Name is the name of the offending server, if any.
+	Name string
+	// Field is the name of the offending field.
+	Field string
+	// Msg describes the problem.
+	Msg string
+}
+
+func (p Problem) String() string {
+	if p.Index < 0 {
+		return fmt.Sprintf("%s: %s", p.Field, p.Msg)
+	}
+	return fmt.Sprintf("servers[%d] (%q): %s: %s", p.Index, p.Name, p.Field, p.Msg)
+}
+
+// ValidationError is returned by Validate and lists all problems found.
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	if len(e) == 1 {
+		return "invalid server list: " + e[0].String()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid server list (%d problems):", len(e))
+	for _, p := range e {
+		b.WriteString("\n\t")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// Validate checks s for problems that would prevent it from being used to
+// query servers. If any are found, it returns a ValidationError.
+func (s *ServersJSON) Validate() error {
+	var errs ValidationError
+	list := func(field, msg string, v ...interface{}) {
+		errs = append(errs, Problem{-1, "", field, fmt.Sprintf(msg, v...)})
+	}
+	for _, f := range []struct{ name, v string }{{"created", s.Created}, {"expires", s.Expires}} {
+		if f.v == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, f.v); err != nil {
+			list(f.name, "not an RFC3339 time: %q", f.v)
+		}
+	}
+	if len(s.Servers) == 0 {
+		list("servers", "no servers")
+	}
+	for i, srv := range s.Servers {
+		if srv == nil {
+			errs = append(errs, Problem{i, "", "server", "missing"})
+			continue
+		}
+		entry := func(field, msg string, v ...interface{}) {
+			errs = append(errs, Problem{i, srv.Name, field, fmt.Sprintf(msg, v...)})
+		}
+		if srv.Name == "" {
+			entry("name", "missing")
+		}
+		switch srv.PublicKeyType {
+		case "ed25519":
+			if len(srv.PublicKey) != 32 {
+				entry("publicKey", "ed25519 key must have 32 bytes, has %d", len(srv.PublicKey))
+			}
+		case "":
+			entry("publicKeyType", "missing")
+		default:
+			entry("publicKeyType", "unsupported key type %q", srv.PublicKeyType)
+		}
+		if srv.ValidUntil != "" {
+			if _, err := time.Parse(time.RFC3339, srv.ValidUntil); err != nil {
+				entry("validUntil", "not an RFC3339 time: %q", srv.ValidUntil)
+			}
+		}
+		if len(srv.Addresses) == 0 {
+			entry("addresses", "no addresses")
+		}
+		for j, a := range srv.Addresses {
+			field := fmt.Sprintf("addresses[%d]", j)
+			if a == nil {
+				entry(field, "missing")
+				continue
+			}
+			if a.Protocol != "udp" {
+				entry(field+".protocol", "unsupported protocol %q", a.Protocol)
+			}
+			if _, _, err := net.SplitHostPort(a.Address); err != nil {
+				entry(field+".address", "%v", err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
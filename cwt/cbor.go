@@ -0,0 +1,220 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cwt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// This file implements the subset of CBOR (RFC 8949) needed for COSE and CWT:
+// integers, byte and text strings, arrays, maps and tags, all with definite
+// lengths. Maps are encoded in the deterministic order of RFC 8949, section
+// 4.2.1.
+
+const (
+	majorUint  = 0
+	majorNint  = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+)
+
+// maxDepth limits the nesting of decoded values.
+const maxDepth = 16
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, majorNint, uint64(-1-v))
+	}
+	return appendHead(b, majorUint, uint64(v))
+}
+
+func appendBytes(b, v []byte) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(v))), v...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, majorText, uint64(len(s))), s...)
+}
+
+// entry is an encoded key and value of a map.
+type entry struct {
+	key, value []byte
+}
+
+// appendMap appends a map of the given entries, sorted by their encoded keys.
+func appendMap(b []byte, entries []entry) []byte {
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b entry) int { return bytes.Compare(a.key, b.key) })
+	b = appendHead(b, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		b = append(append(b, e.key...), e.value...)
+	}
+	return b
+}
+
+// A tag is a decoded tagged value.
+type tag struct {
+	number  uint64
+	content any
+}
+
+var errTruncated = errors.New("cbor: truncated input")
+
+// decode decodes the single CBOR value in b. Integers are returned as int64,
+// byte strings as []byte, text strings as string, arrays as []any, maps as
+// map[any]any and tags as tag. Map keys must be integers or text strings.
+func decode(b []byte) (any, error) {
+	d := &decoder{b: b}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.b) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) head() (major byte, n uint64, err error) {
+	if len(d.b) == 0 {
+		return 0, 0, errTruncated
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+	if len(d.b) < size {
+		return 0, 0, errTruncated
+	}
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return major, n, nil
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint, majorNint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer out of range")
+		}
+		if major == majorNint {
+			return -1 - int64(n), nil
+		}
+		return int64(n), nil
+	case majorBytes, majorText:
+		if n > uint64(len(d.b)) {
+			return nil, errTruncated
+		}
+		v := d.b[:n:n]
+		d.b = d.b[n:]
+		if major == majorText {
+			return string(v), nil
+		}
+		return v, nil
+	case majorArray:
+		// Every element takes at least one byte.
+		if n > uint64(len(d.b)) {
+			return nil, errTruncated
+		}
+		a := make([]any, n)
+		for i := range a {
+			if a[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case majorMap:
+		if n > uint64(len(d.b))/2 {
+			return nil, errTruncated
+		}
+		m := make(map[any]any, n)
+		for range n {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key")
+			}
+			if _, ok := m[k]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", k)
+			}
+			if m[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return tag{n, v}, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
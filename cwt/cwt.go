@@ -0,0 +1,288 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cwt creates CBOR Web Tokens (RFC 8392) from roughtime chains, signed
+// as COSE_Sign1 messages (RFC 9052), for verifiers that do not understand
+// roughtime.
+//
+// The time bounds proven by the chain and the digest of the notarized data are
+// claims of the token, which constrained devices can check with the COSE
+// signature alone. The chain itself is included in the payload, for verifiers
+// that do not want to trust the signer.
+package cwt // import "github.com/Merovius/notary/cwt"
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Merovius/notary/internal/evidence"
+	"github.com/Merovius/notary/internal/rawsig"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// Claim keys of the CWT claims set. Besides the registered claims iss and iat,
+// tokens contain the following private claims.
+const (
+	// ClaimHashAlgorithm is the hash algorithm of ClaimDigest, as a text
+	// string like "sha256".
+	ClaimHashAlgorithm = "notary-hash-alg"
+	// ClaimDigest is the digest of the notarized data, as a byte string.
+	ClaimDigest = "notary-digest"
+	// ClaimEarliest and ClaimLatest are the bounds of the time the chain
+	// was created at, as NumericDates. The data existed no later than
+	// ClaimLatest.
+	ClaimEarliest = "notary-earliest"
+	ClaimLatest   = "notary-latest"
+	// ClaimChain is the roughtime chain, in the binary chain format, as a
+	// byte string.
+	ClaimChain = "notary-chain"
+)
+
+const (
+	claimIssuer   = 1
+	claimIssuedAt = 6
+
+	headerAlgorithm = 1
+	headerKeyID     = 4
+
+	tagCOSESign1 = 18
+	tagCWT       = 61
+
+	algEdDSA = -8
+	algES256 = -7
+	algES384 = -35
+)
+
+// A Token is the content of a CWT.
+type Token struct {
+	// Issuer is the optional issuer of the token.
+	Issuer string
+	// IssuedAt is the time the token was signed, in seconds.
+	IssuedAt time.Time
+	// HashAlgorithm is the algorithm Digest was calculated with.
+	HashAlgorithm string
+	Digest        []byte
+	// Earliest and Latest are the bounds of the time the chain was created
+	// at, in seconds, rounded outwards.
+	Earliest, Latest time.Time
+	// Chain is the roughtime chain the token was created from, in the
+	// binary chain format.
+	Chain []byte
+}
+
+// NewToken returns a token for digest, created from a verified chain. The
+// digest must match the nonce of ch. Earliest and Latest are the time bounds
+// proven by the chain according to rep, widened to whole seconds, the
+// resolution of CWT dates.
+func NewToken(ch *roughtime.Chain, rep *roughtime.Report, digest []byte) (*Token, error) {
+	ev, err := evidence.New(ch, rep, digest)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := ev.Seconds()
+	return &Token{
+		HashAlgorithm: ev.HashAlgorithm,
+		Digest:        ev.Digest,
+		Earliest:      lo,
+		Latest:        hi,
+		Chain:         ev.Chain,
+	}, nil
+}
+
+// A Signer creates tokens.
+type Signer struct {
+	// Key is used to sign tokens. It must be an Ed25519 key or an ECDSA key
+	// on P-256 or P-384.
+	Key crypto.Signer
+	// KeyID, if set, is put into the unprotected header, to help verifiers
+	// find the key.
+	KeyID []byte
+}
+
+// Sign returns t as a CWT, signed as a tagged COSE_Sign1 message. IssuedAt is
+// set to the current time.
+func (s *Signer) Sign(t *Token) ([]byte, error) {
+	alg, err := rawsig.For(s.Key.Public())
+	if err != nil {
+		return nil, err
+	}
+	t.IssuedAt = time.Now().Truncate(time.Second)
+	payload := t.claims()
+	protected := appendMap(nil, []entry{{appendInt(nil, headerAlgorithm), appendInt(nil, coseAlgorithms[alg])}})
+	var unprotected []entry
+	if s.KeyID != nil {
+		unprotected = append(unprotected, entry{appendInt(nil, headerKeyID), appendBytes(nil, s.KeyID)})
+	}
+	sig, err := rawsig.Sign(s.Key, sigStructure(protected, payload))
+	if err != nil {
+		return nil, err
+	}
+	b := appendHead(nil, majorTag, tagCOSESign1)
+	b = appendHead(b, majorArray, 4)
+	b = appendBytes(b, protected)
+	b = appendMap(b, unprotected)
+	b = appendBytes(b, payload)
+	return appendBytes(b, sig), nil
+}
+
+// claims encodes the claims set of t.
+func (t *Token) claims() []byte {
+	entries := []entry{
+		{appendInt(nil, claimIssuedAt), appendInt(nil, t.IssuedAt.Unix())},
+		{appendText(nil, ClaimHashAlgorithm), appendText(nil, t.HashAlgorithm)},
+		{appendText(nil, ClaimDigest), appendBytes(nil, t.Digest)},
+		{appendText(nil, ClaimEarliest), appendInt(nil, t.Earliest.Unix())},
+		{appendText(nil, ClaimLatest), appendInt(nil, t.Latest.Unix())},
+		{appendText(nil, ClaimChain), appendBytes(nil, t.Chain)},
+	}
+	if t.Issuer != "" {
+		entries = append(entries, entry{appendInt(nil, claimIssuer), appendText(nil, t.Issuer)})
+	}
+	return appendMap(nil, entries)
+}
+
+// sigStructure returns the Sig_structure signed for a COSE_Sign1 message,
+// without external data.
+func sigStructure(protected, payload []byte) []byte {
+	b := appendHead(nil, majorArray, 4)
+	b = appendText(b, "Signature1")
+	b = appendBytes(b, protected)
+	b = appendBytes(b, nil)
+	return appendBytes(b, payload)
+}
+
+// coseAlgorithms maps signature algorithms to their COSE identifiers.
+var coseAlgorithms = map[rawsig.Algorithm]int64{
+	rawsig.EdDSA: algEdDSA,
+	rawsig.ES256: algES256,
+	rawsig.ES384: algES384,
+}
+
+// IsToken reports whether b looks like a tagged CWT or COSE_Sign1 message, as
+// opposed to a chain.
+func IsToken(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0xd2}) || bytes.HasPrefix(b, []byte{0xd8, tagCWT})
+}
+
+// Parse parses a CWT signed as a COSE_Sign1 message and verifies its signature
+// with pub. It does not verify the chain of the token.
+func Parse(b []byte, pub crypto.PublicKey) (*Token, error) {
+	return parse(b, pub, true)
+}
+
+// ParseUnverified is like Parse, but does not verify the signature of the
+// token. The chain of the token is still evidence for its claims, if it is
+// verified.
+func ParseUnverified(b []byte) (*Token, error) {
+	return parse(b, nil, false)
+}
+
+func parse(b []byte, pub crypto.PublicKey, check bool) (*Token, error) {
+	v, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(tag); ok && t.number == tagCWT {
+		v = t.content
+	}
+	if t, ok := v.(tag); ok {
+		if t.number != tagCOSESign1 {
+			return nil, fmt.Errorf("unexpected CBOR tag %d", t.number)
+		}
+		v = t.content
+	}
+	msg, ok := v.([]any)
+	if !ok || len(msg) != 4 {
+		return nil, errors.New("not a COSE_Sign1 message")
+	}
+	protected, ok1 := msg[0].([]byte)
+	payload, ok2 := msg[2].([]byte)
+	sig, ok3 := msg[3].([]byte)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("not a COSE_Sign1 message")
+	}
+	if check {
+		hdr, err := decode(protected)
+		if err != nil {
+			return nil, fmt.Errorf("protected header: %w", err)
+		}
+		m, _ := hdr.(map[any]any)
+		alg, ok := m[int64(headerAlgorithm)].(int64)
+		if !ok {
+			return nil, errors.New("protected header has no algorithm")
+		}
+		if !verifySignature(pub, alg, sigStructure(protected, payload), sig) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	return parseClaims(payload)
+}
+
+// verifySignature verifies a signature made with the COSE algorithm alg.
+func verifySignature(pub crypto.PublicKey, alg int64, msg, sig []byte) bool {
+	for a, id := range coseAlgorithms {
+		if id == alg {
+			return rawsig.Verify(pub, a, msg, sig)
+		}
+	}
+	return false
+}
+
+func parseClaims(payload []byte) (*Token, error) {
+	v, err := decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("claims are not a map")
+	}
+	t := new(Token)
+	var errs []error
+	text := func(k any, dst *string, required bool) {
+		s, ok := m[k].(string)
+		if !ok && (required || m[k] != nil) {
+			errs = append(errs, fmt.Errorf("claim %v is missing or not a text string", k))
+		}
+		*dst = s
+	}
+	bytes := func(k any, dst *[]byte) {
+		b, ok := m[k].([]byte)
+		if !ok {
+			errs = append(errs, fmt.Errorf("claim %v is missing or not a byte string", k))
+		}
+		*dst = b
+	}
+	date := func(k any, dst *time.Time) {
+		n, ok := m[k].(int64)
+		if !ok {
+			errs = append(errs, fmt.Errorf("claim %v is missing or not an integer", k))
+		}
+		*dst = time.Unix(n, 0)
+	}
+	text(int64(claimIssuer), &t.Issuer, false)
+	date(int64(claimIssuedAt), &t.IssuedAt)
+	text(ClaimHashAlgorithm, &t.HashAlgorithm, true)
+	bytes(ClaimDigest, &t.Digest)
+	date(ClaimEarliest, &t.Earliest)
+	date(ClaimLatest, &t.Latest)
+	bytes(ClaimChain, &t.Chain)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestSign(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	tok := &Token{
+		Issuer:        "notary test",
+		HashAlgorithm: roughtime.SHA256,
+		Digest:        digest[:],
+		Earliest:      time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+		Latest:        time.Date(2018, 10, 1, 12, 0, 2, 0, time.UTC),
+		Chain:         []byte("notary\x00\x01chain"),
+	}
+	keys := []crypto.Signer{p256, p384, edKey}
+	for i, key := range keys {
+		s := &Signer{Key: key, KeyID: []byte("test")}
+		b, err := s.Sign(tok)
+		if err != nil {
+			t.Fatalf("Sign(%T) = %v", key, err)
+		}
+		if !IsToken(b) {
+			t.Errorf("IsToken(Sign(%T)) = false, want true", key)
+		}
+		got, err := Parse(b, key.Public())
+		if err != nil {
+			t.Fatalf("Parse(Sign(%T)) = %v", key, err)
+		}
+		if got.Issuer != tok.Issuer || !got.IssuedAt.Equal(tok.IssuedAt) || got.HashAlgorithm != tok.HashAlgorithm || !bytes.Equal(got.Digest, tok.Digest) || !got.Earliest.Equal(tok.Earliest) || !got.Latest.Equal(tok.Latest) || !bytes.Equal(got.Chain, tok.Chain) {
+			t.Errorf("Parse(Sign(%T)) = %+v, want %+v", key, got, tok)
+		}
+
+		other := keys[(i+1)%len(keys)]
+		if _, err := Parse(b, other.Public()); err == nil {
+			t.Errorf("Parse(token signed by %T) with %T key succeeded", key, other)
+		}
+
+		j := bytes.Index(b, tok.Digest)
+		b[j] ^= 1
+		if _, err := Parse(b, key.Public()); err == nil {
+			t.Errorf("Parse(tampered token signed by %T) succeeded", key)
+		}
+		if _, err := ParseUnverified(b); err != nil {
+			t.Errorf("ParseUnverified(tampered token signed by %T) = %v", key, err)
+		}
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Signer{Key: rsaKey}).Sign(tok); err == nil {
+		t.Error("Sign(RSA key) succeeded")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tcs := []struct {
+		in   []byte
+		want any
+	}{
+		{[]byte{0x17}, int64(23)},
+		{[]byte{0x38, 0x18}, int64(-25)},
+		{[]byte{0x43, 1, 2, 3}, []byte{1, 2, 3}},
+		{[]byte{0x62, 'h', 'i'}, "hi"},
+		{[]byte{0xd8, 0x3d, 0x01}, tag{61, int64(1)}},
+	}
+	for _, tc := range tcs {
+		got, err := decode(tc.in)
+		if err != nil {
+			t.Errorf("decode(%x) = %v", tc.in, err)
+			continue
+		}
+		if b, ok := tc.want.([]byte); ok {
+			if g, _ := got.([]byte); !bytes.Equal(g, b) {
+				t.Errorf("decode(%x) = %#v, want %#v", tc.in, got, tc.want)
+			}
+		} else if got != tc.want {
+			t.Errorf("decode(%x) = %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+
+	bad := [][]byte{
+		{},
+		{0x43, 1, 2},                   // truncated byte string
+		{0x5f, 0xff},                   // indefinite length
+		{0xa2, 1, 1, 1, 2},             // duplicate key
+		{0x01, 0x02},                   // trailing data
+		bytes.Repeat([]byte{0x81}, 32), // too deeply nested
+	}
+	for _, b := range bad {
+		if v, err := decode(b); err == nil {
+			t.Errorf("decode(%x) = %#v, want error", b, v)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package await makes blocking roughtime queries, which can not be cancelled,
+// return early when a context is done.
+package await
+
+import "context"
+
+// Call calls f in a new goroutine and returns its results, or ctx.Err() if ctx
+// is done first.
+//
+// f is abandoned, not stopped: the queries it makes keep running until the
+// timeout of the roughtime.Client they use, and their results are discarded.
+func Call[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := f()
+		done <- result{v, err}
+	}()
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case r := <-done:
+		return r.v, r.err
+	}
+}
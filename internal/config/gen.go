@@ -1,3 +0,0 @@
-package roughtime_config
-
-//go:generate protoc --go_out=. -I$GOPATH/src/roughtime.googlesource.com config.proto
@@ -0,0 +1,75 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package evidence extracts what a verified roughtime chain proves about a
+// digest, for the token formats which embed chains as evidence of their
+// claims.
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// Evidence is what a chain proves about a digest.
+type Evidence struct {
+	// HashAlgorithm is the algorithm the digest was calculated with. It is
+	// never empty.
+	HashAlgorithm string
+	Digest        []byte
+	// Earliest and Latest bound the time the chain was created.
+	Earliest, Latest time.Time
+	// Chain is the chain in the binary chain format.
+	Chain []byte
+}
+
+// New returns the evidence ch gives for digest, which must match its nonce. rep
+// is the result of verifying ch. If the links of the chain do not overlap, the
+// interval of the first link is used as the bounds.
+func New(ch *roughtime.Chain, rep *roughtime.Report, digest []byte) (*Evidence, error) {
+	nonce, err := roughtime.DigestNonce(ch.HashAlgorithm, digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(nonce, ch.Nonce()) {
+		return nil, errors.New("digest does not match chain")
+	}
+	b, err := roughtime.MarshalChainBinary(ch)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := rep.Earliest, rep.Latest
+	if lo.After(hi) {
+		lo, hi = rep.Links[0].Earliest(), rep.Links[0].Latest()
+	}
+	alg := ch.HashAlgorithm
+	if alg == "" {
+		alg = roughtime.SHA512
+	}
+	return &Evidence{
+		HashAlgorithm: alg,
+		Digest:        digest,
+		Earliest:      lo,
+		Latest:        hi,
+		Chain:         b,
+	}, nil
+}
+
+// Seconds returns the bounds of e, widened to whole seconds.
+func (e *Evidence) Seconds() (earliest, latest time.Time) {
+	return e.Earliest.Truncate(time.Second), e.Latest.Add(time.Second - 1).Truncate(time.Second)
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pcap writes UDP datagrams to pcap files, which can be read by tools
+// like Wireshark and tcpdump, and reads them back.
+//
+// Only the payload of datagrams is known when writing, so IP and UDP headers
+// are synthesized from their addresses.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// magicNanos and magicMicros are the magic numbers of pcap files with
+	// nanosecond and microsecond timestamps.
+	magicNanos  = 0xa1b23c4d
+	magicMicros = 0xa1b2c3d4
+	// linkTypeRaw is the link type of packets starting with an IPv4 or IPv6
+	// header.
+	linkTypeRaw = 101
+	snapLen     = 262144
+
+	protoUDP = 17
+	ttl      = 64
+)
+
+// Writer writes UDP datagrams to a pcap file. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes the pcap file header to w and returns a Writer writing
+// datagrams to it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	var h [24]byte
+	binary.LittleEndian.PutUint32(h[0:], magicNanos)
+	binary.LittleEndian.PutUint16(h[4:], 2)
+	binary.LittleEndian.PutUint16(h[6:], 4)
+	binary.LittleEndian.PutUint32(h[16:], snapLen)
+	binary.LittleEndian.PutUint32(h[20:], linkTypeRaw)
+	if _, err := w.Write(h[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteUDP writes a datagram with the given payload, sent from src to dst at
+// time t. If one address is IPv4 and the other IPv6, the IPv4 address is
+// written as an IPv4-mapped IPv6 address.
+func (w *Writer) WriteUDP(t time.Time, src, dst netip.AddrPort, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, d := src.Addr().Unmap(), dst.Addr().Unmap()
+	v4 := s.Is4() && d.Is4()
+	if !v4 {
+		s, d = netip.AddrFrom16(s.As16()), netip.AddrFrom16(d.As16())
+	}
+	ipLen := 40
+	if v4 {
+		ipLen = 20
+	}
+	n := ipLen + 8 + len(payload)
+
+	b := w.buf[:0]
+	b = binary.LittleEndian.AppendUint32(b, uint32(t.Unix()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n))
+
+	ip := len(b)
+	if v4 {
+		b = append(b, 0x45, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+		b = append(b, 0, 0, 0x40, 0, ttl, protoUDP, 0, 0)
+		b = append(b, s.AsSlice()...)
+		b = append(b, d.AsSlice()...)
+		binary.BigEndian.PutUint16(b[ip+10:], checksum(0, b[ip:]))
+	} else {
+		b = append(b, 0x60, 0, 0, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(8+len(payload)))
+		b = append(b, protoUDP, ttl)
+		b = append(b, s.AsSlice()...)
+		b = append(b, d.AsSlice()...)
+	}
+
+	udp := len(b)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	b = binary.BigEndian.AppendUint16(b, dst.Port())
+	b = binary.BigEndian.AppendUint16(b, uint16(8+len(payload)))
+	b = append(b, 0, 0)
+	b = append(b, payload...)
+
+	// The UDP checksum covers a pseudo-header of the addresses, protocol
+	// and length.
+	var sum uint32
+	sum = sumWords(sum, s.AsSlice())
+	sum = sumWords(sum, d.AsSlice())
+	sum += protoUDP + uint32(8+len(payload))
+	c := checksum(sum, b[udp:])
+	if c == 0 {
+		c = 0xffff
+	}
+	binary.BigEndian.PutUint16(b[udp+6:], c)
+
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// sumWords adds the big-endian 16 bit words of b to sum.
+func sumWords(sum uint32, b []byte) uint32 {
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+// checksum returns the internet checksum of b, starting from sum.
+func checksum(sum uint32, b []byte) uint16 {
+	sum = sumWords(sum, b)
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Datagram is a UDP datagram read from a pcap file.
+type Datagram struct {
+	Time     time.Time
+	Src, Dst netip.AddrPort
+	Payload  []byte
+}
+
+// Link types supported by Reader, in addition to linkTypeRaw.
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeLinuxSLL = 113
+)
+
+// Reader reads UDP datagrams from a pcap file.
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+}
+
+// NewReader reads the pcap file header from r and returns a Reader reading
+// datagrams from it. Files with raw IP, Ethernet, BSD loopback and Linux
+// cooked captures are supported.
+func NewReader(r io.Reader) (*Reader, error) {
+	var h [24]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+	pr := &Reader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(h[:]) {
+		case magicNanos:
+			pr.order, pr.nanos = order, true
+		case magicMicros:
+			pr.order = order
+		}
+	}
+	if pr.order == nil {
+		return nil, errors.New("not a pcap file")
+	}
+	pr.linkType = pr.order.Uint32(h[20:]) & 0xffff
+	switch pr.linkType {
+	case linkTypeRaw, linkTypeNull, linkTypeEthernet, linkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("unsupported pcap link type %d", pr.linkType)
+	}
+	return pr, nil
+}
+
+// ReadUDP returns the next UDP datagram. Packets that are not complete UDP
+// datagrams over IPv4 or IPv6 are skipped. At the end of the file, it returns
+// io.EOF.
+func (r *Reader) ReadUDP() (Datagram, error) {
+	for {
+		var h [16]byte
+		if _, err := io.ReadFull(r.r, h[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = errors.New("pcap file truncated")
+			}
+			return Datagram{}, err
+		}
+		incl, orig := r.order.Uint32(h[8:]), r.order.Uint32(h[12:])
+		if incl > snapLen {
+			return Datagram{}, fmt.Errorf("invalid pcap packet length %d", incl)
+		}
+		pkt := make([]byte, incl)
+		if _, err := io.ReadFull(r.r, pkt); err != nil {
+			return Datagram{}, errors.New("pcap file truncated")
+		}
+		if incl != orig {
+			continue
+		}
+		sub := time.Duration(r.order.Uint32(h[4:]))
+		if !r.nanos {
+			sub *= time.Microsecond
+		}
+		d, ok := r.parse(pkt)
+		if !ok {
+			continue
+		}
+		d.Time = time.Unix(int64(r.order.Uint32(h[:])), int64(sub))
+		return d, nil
+	}
+}
+
+// parse parses a packet of the link type of r.
+func (r *Reader) parse(pkt []byte) (Datagram, bool) {
+	switch r.linkType {
+	case linkTypeNull:
+		if len(pkt) < 4 {
+			return Datagram{}, false
+		}
+		pkt = pkt[4:]
+	case linkTypeEthernet:
+		if len(pkt) < 14 {
+			return Datagram{}, false
+		}
+		switch binary.BigEndian.Uint16(pkt[12:]) {
+		case 0x0800, 0x86dd:
+		default:
+			return Datagram{}, false
+		}
+		pkt = pkt[14:]
+	case linkTypeLinuxSLL:
+		if len(pkt) < 16 {
+			return Datagram{}, false
+		}
+		pkt = pkt[16:]
+	}
+	return parseIP(pkt)
+}
+
+// parseIP parses an IPv4 or IPv6 packet containing a UDP datagram.
+func parseIP(pkt []byte) (Datagram, bool) {
+	var (
+		d   Datagram
+		udp []byte
+	)
+	switch {
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		ihl := int(pkt[0]&0xf) * 4
+		total := int(binary.BigEndian.Uint16(pkt[2:]))
+		// Fragments are not reassembled.
+		fragmented := binary.BigEndian.Uint16(pkt[6:])&0x3fff != 0
+		if ihl < 20 || total < ihl || total > len(pkt) || pkt[9] != protoUDP || fragmented {
+			return Datagram{}, false
+		}
+		d.Src = netip.AddrPortFrom(netip.AddrFrom4([4]byte(pkt[12:16])), 0)
+		d.Dst = netip.AddrPortFrom(netip.AddrFrom4([4]byte(pkt[16:20])), 0)
+		udp = pkt[ihl:total]
+	case len(pkt) >= 40 && pkt[0]>>4 == 6:
+		n := int(binary.BigEndian.Uint16(pkt[4:]))
+		if pkt[6] != protoUDP || 40+n > len(pkt) {
+			return Datagram{}, false
+		}
+		d.Src = netip.AddrPortFrom(netip.AddrFrom16([16]byte(pkt[8:24])), 0)
+		d.Dst = netip.AddrPortFrom(netip.AddrFrom16([16]byte(pkt[24:40])), 0)
+		udp = pkt[40 : 40+n]
+	default:
+		return Datagram{}, false
+	}
+	if len(udp) < 8 || int(binary.BigEndian.Uint16(udp[4:])) != len(udp) {
+		return Datagram{}, false
+	}
+	d.Src = netip.AddrPortFrom(d.Src.Addr(), binary.BigEndian.Uint16(udp))
+	d.Dst = netip.AddrPortFrom(d.Dst.Addr(), binary.BigEndian.Uint16(udp[2:]))
+	d.Payload = udp[8:]
+	return d, true
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestWriteUDP(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1500000000, 123456789)
+	payload := []byte("ROUGHTIM payload")
+	tests := []struct {
+		src, dst netip.AddrPort
+		v4       bool
+	}{
+		{netip.MustParseAddrPort("192.0.2.1:40000"), netip.MustParseAddrPort("198.51.100.7:2002"), true},
+		{netip.MustParseAddrPort("[2001:db8::1]:40000"), netip.MustParseAddrPort("[2001:db8::2]:2002"), false},
+		{netip.MustParseAddrPort("[::ffff:192.0.2.1]:40000"), netip.MustParseAddrPort("198.51.100.7:2002"), true},
+		{netip.MustParseAddrPort("[::]:40000"), netip.MustParseAddrPort("198.51.100.7:2002"), false},
+	}
+	for _, tc := range tests {
+		if err := w.WriteUDP(ts, tc.src, tc.dst, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := buf.Bytes()
+	if got := binary.LittleEndian.Uint32(b); got != magicNanos {
+		t.Fatalf("magic = %#x, want %#x", got, magicNanos)
+	}
+	if got := binary.LittleEndian.Uint32(b[20:]); got != linkTypeRaw {
+		t.Fatalf("link type = %d, want %d", got, linkTypeRaw)
+	}
+	b = b[24:]
+	for i, tc := range tests {
+		if len(b) < 16 {
+			t.Fatalf("packet %d: file truncated", i)
+		}
+		sec, nsec := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if !time.Unix(int64(sec), int64(nsec)).Equal(ts) {
+			t.Errorf("packet %d: time = %d.%09d, want %v", i, sec, nsec, ts)
+		}
+		incl, orig := binary.LittleEndian.Uint32(b[8:]), binary.LittleEndian.Uint32(b[12:])
+		pkt := b[16 : 16+incl]
+		b = b[16+incl:]
+		if incl != orig {
+			t.Errorf("packet %d: included length %d != original length %d", i, incl, orig)
+		}
+
+		var (
+			udp      []byte
+			src, dst netip.Addr
+		)
+		if tc.v4 {
+			if pkt[0] != 0x45 || pkt[9] != protoUDP || int(binary.BigEndian.Uint16(pkt[2:])) != len(pkt) {
+				t.Errorf("packet %d: invalid IPv4 header % x", i, pkt[:20])
+			}
+			if checksum(0, pkt[:20]) != 0 {
+				t.Errorf("packet %d: invalid IPv4 header checksum", i)
+			}
+			src, dst, udp = netip.AddrFrom4([4]byte(pkt[12:16])), netip.AddrFrom4([4]byte(pkt[16:20])), pkt[20:]
+		} else {
+			if pkt[0]>>4 != 6 || pkt[6] != protoUDP || int(binary.BigEndian.Uint16(pkt[4:])) != len(pkt)-40 {
+				t.Errorf("packet %d: invalid IPv6 header % x", i, pkt[:40])
+			}
+			src, dst, udp = netip.AddrFrom16([16]byte(pkt[8:24])), netip.AddrFrom16([16]byte(pkt[24:40])), pkt[40:]
+		}
+		if src.Unmap() != tc.src.Addr().Unmap() || dst.Unmap() != tc.dst.Addr().Unmap() {
+			t.Errorf("packet %d: addresses %v -> %v, want %v -> %v", i, src, dst, tc.src.Addr(), tc.dst.Addr())
+		}
+		if sp, dp := binary.BigEndian.Uint16(udp), binary.BigEndian.Uint16(udp[2:]); sp != tc.src.Port() || dp != tc.dst.Port() {
+			t.Errorf("packet %d: ports %d -> %d, want %d -> %d", i, sp, dp, tc.src.Port(), tc.dst.Port())
+		}
+		if int(binary.BigEndian.Uint16(udp[4:])) != len(udp) || !bytes.Equal(udp[8:], payload) {
+			t.Errorf("packet %d: invalid UDP datagram % x", i, udp)
+		}
+		sum := sumWords(sumWords(0, src.AsSlice()), dst.AsSlice()) + protoUDP + uint32(len(udp))
+		if checksum(sum, udp) != 0 {
+			t.Errorf("packet %d: invalid UDP checksum", i)
+		}
+	}
+	if len(b) != 0 {
+		t.Errorf("%d bytes of trailing data", len(b))
+	}
+}
+
+func TestReadUDP(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Datagram{
+		{time.Unix(1500000000, 123456789), netip.MustParseAddrPort("192.0.2.1:40000"), netip.MustParseAddrPort("198.51.100.7:2002"), []byte("request")},
+		{time.Unix(1500000001, 0), netip.MustParseAddrPort("[2001:db8::2]:2002"), netip.MustParseAddrPort("[2001:db8::1]:40000"), []byte("response")},
+	}
+	for _, d := range want {
+		if err := w.WriteUDP(d.Time, d.Src, d.Dst, d.Payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range want {
+		d, err := r.ReadUDP()
+		if err != nil {
+			t.Fatalf("ReadUDP() = %v", err)
+		}
+		if !d.Time.Equal(w.Time) || d.Src != w.Src || d.Dst != w.Dst || !bytes.Equal(d.Payload, w.Payload) {
+			t.Errorf("datagram %d = %+v, want %+v", i, d, w)
+		}
+	}
+	if _, err := r.ReadUDP(); err != io.EOF {
+		t.Errorf("ReadUDP() at end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadEthernet(t *testing.T) {
+	// A big-endian file with microsecond timestamps, as written by tcpdump on
+	// some systems, containing an ARP packet and a UDP datagram.
+	var buf bytes.Buffer
+	be := binary.BigEndian
+	h := make([]byte, 24)
+	be.PutUint32(h, magicMicros)
+	be.PutUint16(h[4:], 2)
+	be.PutUint16(h[6:], 4)
+	be.PutUint32(h[16:], 65535)
+	be.PutUint32(h[20:], linkTypeEthernet)
+	buf.Write(h)
+	packet := func(sec, usec uint32, pkt []byte) {
+		rec := make([]byte, 16)
+		be.PutUint32(rec, sec)
+		be.PutUint32(rec[4:], usec)
+		be.PutUint32(rec[8:], uint32(len(pkt)))
+		be.PutUint32(rec[12:], uint32(len(pkt)))
+		buf.Write(rec)
+		buf.Write(pkt)
+	}
+	eth := func(typ uint16, payload []byte) []byte {
+		return append(be.AppendUint16(make([]byte, 12), typ), payload...)
+	}
+	packet(1, 0, eth(0x0806, make([]byte, 28)))
+
+	var raw bytes.Buffer
+	rw, _ := NewWriter(&raw)
+	rw.WriteUDP(time.Time{}, netip.MustParseAddrPort("192.0.2.1:40000"), netip.MustParseAddrPort("198.51.100.7:2002"), []byte("hello"))
+	packet(1500000000, 250000, eth(0x0800, raw.Bytes()[24+16:]))
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := r.ReadUDP()
+	if err != nil {
+		t.Fatalf("ReadUDP() = %v", err)
+	}
+	if want := time.Unix(1500000000, 250000000); !d.Time.Equal(want) || d.Dst.Port() != 2002 || string(d.Payload) != "hello" {
+		t.Errorf("ReadUDP() = %+v, want datagram to port 2002 at %v", d, want)
+	}
+	if _, err := r.ReadUDP(); err != io.EOF {
+		t.Errorf("ReadUDP() at end = %v, want io.EOF", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("NewReader(zeros) succeeded")
+	}
+}
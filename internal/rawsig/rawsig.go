@@ -0,0 +1,119 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rawsig creates and verifies signatures in the encoding used by JOSE
+// (RFC 7518) and COSE (RFC 9053): Ed25519 signatures as is and ECDSA signatures
+// as the concatenation of r and s, instead of ASN.1.
+package rawsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// An Algorithm is a signature algorithm.
+type Algorithm int
+
+// Supported algorithms.
+const (
+	EdDSA Algorithm = iota + 1 // Ed25519
+	ES256                      // ECDSA on P-256 with SHA-256
+	ES384                      // ECDSA on P-384 with SHA-384
+)
+
+// For returns the algorithm used with the public key pub.
+func For(pub crypto.PublicKey) (Algorithm, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return ES256, nil
+		case elliptic.P384():
+			return ES384, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported key type %T", pub)
+}
+
+// ecdsaParams returns the hash and the size of the coordinates of an ECDSA
+// algorithm.
+func (a Algorithm) ecdsaParams() (crypto.Hash, int) {
+	if a == ES384 {
+		return crypto.SHA384, 48
+	}
+	return crypto.SHA256, 32
+}
+
+func digest(h crypto.Hash, b []byte) []byte {
+	if h == crypto.SHA384 {
+		d := sha512.Sum384(b)
+		return d[:]
+	}
+	d := sha256.Sum256(b)
+	return d[:]
+}
+
+// Sign signs msg with key, using the algorithm returned by For.
+func Sign(key crypto.Signer, msg []byte) ([]byte, error) {
+	alg, err := For(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if alg == EdDSA {
+		return key.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+	h, size := alg.ecdsaParams()
+	der, err := key.Sign(rand.Reader, digest(h, msg), h)
+	if err != nil {
+		return nil, err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 2*size)
+	rs.R.FillBytes(sig[:size])
+	rs.S.FillBytes(sig[size:])
+	return sig, nil
+}
+
+// Verify reports whether sig is a valid signature of msg by pub. It fails if
+// alg is not the algorithm used with pub, to prevent algorithm confusion.
+func Verify(pub crypto.PublicKey, alg Algorithm, msg, sig []byte) bool {
+	if want, err := For(pub); err != nil || alg != want {
+		return false
+	}
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, msg, sig)
+	case *ecdsa.PublicKey:
+		h, size := alg.ecdsaParams()
+		if len(sig) != 2*size {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest(h, msg), r, s)
+	}
+	return false
+}
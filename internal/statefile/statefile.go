@@ -0,0 +1,98 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statefile locates the files notary keeps its configuration and state
+// in and reads and writes them as JSON.
+//
+// Paths follow the XDG base directory specification, falling back to the
+// default directories in the home directory of the user.
+package statefile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StatePath returns the path of the state file name,
+// $XDG_STATE_HOME/notary/name or ~/.local/state/notary/name.
+func StatePath(name string) (string, error) {
+	return path("XDG_STATE_HOME", filepath.Join(".local", "state"), name)
+}
+
+// ConfigPath returns the path of the configuration file name,
+// $XDG_CONFIG_HOME/notary/name or ~/.config/notary/name.
+func ConfigPath(name string) (string, error) {
+	return path("XDG_CONFIG_HOME", ".config", name)
+}
+
+// path returns the file name in the notary directory of the base directory
+// given by the environment variable env, or home relative to the home
+// directory.
+func path(env, home, name string) (string, error) {
+	dir := os.Getenv(env)
+	if dir == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(h, home)
+	}
+	return filepath.Join(dir, "notary", name), nil
+}
+
+// Load unmarshals the JSON file name into v. If the file does not exist, v is
+// left unmodified.
+func Load(name string, v any) error {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Save writes v as JSON to the file name, creating its directory if needed.
+// The file is replaced atomically.
+func Save(name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -12,20 +12,28 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package wire aliases github.com/Merovius/notary/wire.
+//
+// Deprecated: Use github.com/Merovius/notary/wire instead.
 package wire
 
-import (
-	"encoding/binary"
-	"strconv"
+import "github.com/Merovius/notary/wire"
+
+type (
+	// Tag is an alias for wire.Tag.
+	Tag = wire.Tag
+	// EncodeState is an alias for wire.EncodeState.
+	EncodeState = wire.EncodeState
+	// DecodeState is an alias for wire.DecodeState.
+	DecodeState = wire.DecodeState
 )
 
-// Tag represents a wire-format tag.
-type Tag uint32
+// Encode calls wire.Encode.
+func Encode(f func(st *EncodeState)) []byte {
+	return wire.Encode(f)
+}
 
-// String implements fmt.Stringer
-func (t Tag) String() string {
-	var b [4]byte
-	binary.LittleEndian.PutUint32(b[:], uint32(t))
-	s := strconv.Quote(string(b[:]))
-	return s[1 : len(s)-1]
+// Decode calls wire.Decode.
+func Decode(msg []byte, f func(st *DecodeState)) error {
+	return wire.Decode(msg, f)
 }
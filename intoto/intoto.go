@@ -0,0 +1,152 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package intoto wraps roughtime chains into in-toto attestation statements.
+//
+// The statement has the notarized file as its subject and a predicate
+// containing the chain and the time bounds it proves. It is not signed; it can
+// be wrapped into an envelope by tools like cosign, to be attached to artifacts
+// alongside other attestations, like SLSA provenance.
+package intoto // import "github.com/Merovius/notary/intoto"
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+const (
+	// StatementType is the type of in-toto statements.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType identifies predicates containing a roughtime chain.
+	PredicateType = "https://github.com/Merovius/notary/chain/v1"
+)
+
+// Statement is an in-toto statement about a file notarized by a chain.
+type Statement struct {
+	Type          string     `json:"_type"`
+	Subject       []Subject  `json:"subject"`
+	PredicateType string     `json:"predicateType"`
+	Predicate     *Predicate `json:"predicate"`
+}
+
+// Subject identifies an artifact by its name and digests.
+type Subject struct {
+	Name string `json:"name"`
+	// Digest maps hash algorithms to hex-encoded digests.
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate contains the chain for a subject.
+type Predicate struct {
+	// Earliest and Latest are the time bounds of the chain, as given by
+	// roughtime.Report. The subject existed no later than Latest.
+	Earliest time.Time    `json:"earliest"`
+	Latest   time.Time    `json:"latest"`
+	Chain    config.Chain `json:"chain"`
+}
+
+// NewStatement returns a statement about the file name with the given digest,
+// notarized by a verified chain. The digest must match the nonce of ch.
+func NewStatement(name string, ch *roughtime.Chain, rep *roughtime.Report, digest []byte) (*Statement, error) {
+	nonce, err := roughtime.DigestNonce(ch.HashAlgorithm, digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(nonce, ch.Nonce()) {
+		return nil, errors.New("digest does not match chain")
+	}
+	return &Statement{
+		Type: StatementType,
+		Subject: []Subject{{
+			Name:   name,
+			Digest: map[string]string{hashAlgorithm(ch): hex.EncodeToString(digest)},
+		}},
+		PredicateType: PredicateType,
+		Predicate: &Predicate{
+			Earliest: rep.Earliest,
+			Latest:   rep.Latest,
+			Chain:    ch.Chain,
+		},
+	}, nil
+}
+
+// Chain returns the chain contained in s, after checking that its nonce
+// matches the digest of the subject. It does not verify the chain.
+func (s *Statement) Chain() (*roughtime.Chain, error) {
+	if s.Type != StatementType || s.PredicateType != PredicateType || s.Predicate == nil {
+		return nil, errors.New("not a notary in-toto statement")
+	}
+	if len(s.Subject) != 1 {
+		return nil, fmt.Errorf("statement has %d subjects, want 1", len(s.Subject))
+	}
+	ch := &roughtime.Chain{Chain: s.Predicate.Chain}
+	alg := hashAlgorithm(ch)
+	digest, err := hex.DecodeString(s.Subject[0].Digest[alg])
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := roughtime.DigestNonce(alg, digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(nonce, ch.Nonce()) {
+		return nil, errors.New("subject digest does not match chain")
+	}
+	return ch, nil
+}
+
+// IsStatement reports whether b looks like an in-toto statement, as opposed to
+// a chain.
+func IsStatement(b []byte) bool {
+	var v struct {
+		Type string `json:"_type"`
+	}
+	return json.Unmarshal(b, &v) == nil && v.Type == StatementType
+}
+
+// Save writes s to w.
+func Save(w io.Writer, s *Statement) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Load reads a statement from r.
+func Load(r io.Reader) (*Statement, error) {
+	s := new(Statement)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hashAlgorithm returns the name of the hash algorithm of ch, as used in
+// in-toto digest sets.
+func hashAlgorithm(ch *roughtime.Chain) string {
+	if ch.HashAlgorithm == "" {
+		return roughtime.SHA512
+	}
+	return ch.HashAlgorithm
+}
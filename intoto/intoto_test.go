@@ -0,0 +1,80 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package intoto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestStatement(t *testing.T) {
+	digest := sha256.Sum256([]byte("hello"))
+	nonce, err := roughtime.DigestNonce(roughtime.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &roughtime.Chain{Chain: config.Chain{
+		HashAlgorithm: roughtime.SHA256,
+		Links:         []*config.Link{{NonceOrBlind: nonce, Reply: []byte("reply")}},
+	}}
+	epoch := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	rep := &roughtime.Report{Earliest: epoch, Latest: epoch.Add(time.Second)}
+
+	s, err := NewStatement("hello.txt", ch, rep, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Save(buf, s); err != nil {
+		t.Fatal(err)
+	}
+	if !IsStatement(buf.Bytes()) {
+		t.Errorf("IsStatement(%s) = false, want true", buf)
+	}
+	if IsStatement([]byte(`{"links": []}`)) {
+		t.Error("IsStatement(chain) = true, want false")
+	}
+	s, err = Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Subject[0].Digest["sha256"]; s.Subject[0].Name != "hello.txt" || got != hex.EncodeToString(digest[:]) {
+		t.Errorf("subject = %+v, want hello.txt with sha256 digest %x", s.Subject[0], digest)
+	}
+	if !s.Predicate.Earliest.Equal(rep.Earliest) || !s.Predicate.Latest.Equal(rep.Latest) {
+		t.Errorf("predicate has bounds [%v, %v], want [%v, %v]", s.Predicate.Earliest, s.Predicate.Latest, rep.Earliest, rep.Latest)
+	}
+	got, err := s.Chain()
+	if err != nil {
+		t.Fatalf("Chain() = %v, want <nil>", err)
+	}
+	if !bytes.Equal(got.Nonce(), nonce) {
+		t.Errorf("Chain().Nonce() = %x, want %x", got.Nonce(), nonce)
+	}
+
+	s.Subject[0].Digest["sha256"] = hex.EncodeToString(make([]byte, 32))
+	if _, err := s.Chain(); err == nil {
+		t.Error("Chain() with wrong subject digest succeeded")
+	}
+	if _, err := NewStatement("hello.txt", ch, rep, make([]byte, 32)); err == nil {
+		t.Error("NewStatement(wrong digest) succeeded")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jws creates JSON Web Tokens (RFC 7519) from roughtime chains, signed
+// as compact JSON Web Signatures (RFC 7515), so that web services can check
+// them with existing JOSE libraries.
+//
+// A verifier trusting the signing key can rely on the notary claim alone: it
+// carries the time bounds proven by the chain, the digest of the notarized data
+// and a reference to the chain. The chain is usually embedded as well, so
+// verifiers that do not trust the key can check it independently.
+package jws // import "github.com/Merovius/notary/jws"
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Merovius/notary/internal/evidence"
+	"github.com/Merovius/notary/internal/rawsig"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// A Token is the content of a JWT.
+type Token struct {
+	// Issuer is the optional issuer of the token.
+	Issuer string
+	// IssuedAt is the time the token was signed, in seconds.
+	IssuedAt time.Time
+	// HashAlgorithm is the algorithm Digest was calculated with.
+	HashAlgorithm string
+	Digest        []byte
+	// Earliest and Latest are the bounds of the time the chain was created
+	// at, in seconds, rounded outwards.
+	Earliest, Latest time.Time
+	// ChainDigest references the chain the token was created from, as the
+	// SHA-256 digest of its binary format.
+	ChainDigest []byte
+	// Chain is the chain in the binary chain format. It can be set to nil
+	// before signing, to keep tokens small if the chain is stored
+	// elsewhere.
+	Chain []byte
+}
+
+// claims is the JSON encoding of a Token.
+type claims struct {
+	Issuer   string       `json:"iss,omitempty"`
+	IssuedAt int64        `json:"iat"`
+	Notary   *notaryClaim `json:"notary"`
+}
+
+// notaryClaim is the private claim containing the attestation. Digests are
+// hex-encoded, times are NumericDates.
+type notaryClaim struct {
+	HashAlgorithm string `json:"hashAlgorithm"`
+	Digest        string `json:"digest"`
+	Earliest      int64  `json:"earliest"`
+	Latest        int64  `json:"latest"`
+	ChainDigest   string `json:"chainDigest"`
+	Chain         []byte `json:"chain,omitempty"`
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// joseAlgorithms maps signature algorithms to their JOSE names.
+var joseAlgorithms = map[rawsig.Algorithm]string{
+	rawsig.EdDSA: "EdDSA",
+	rawsig.ES256: "ES256",
+	rawsig.ES384: "ES384",
+}
+
+// NewToken returns a token for digest, created from a verified chain. The
+// digest must match the nonce of ch. Earliest and Latest are the time bounds
+// proven by the chain according to rep, widened to whole seconds, as JWT dates
+// have no fractional part.
+func NewToken(ch *roughtime.Chain, rep *roughtime.Report, digest []byte) (*Token, error) {
+	ev, err := evidence.New(ch, rep, digest)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := ev.Seconds()
+	sum := sha256.Sum256(ev.Chain)
+	return &Token{
+		HashAlgorithm: ev.HashAlgorithm,
+		Digest:        ev.Digest,
+		Earliest:      lo,
+		Latest:        hi,
+		ChainDigest:   sum[:],
+		Chain:         ev.Chain,
+	}, nil
+}
+
+// A Signer creates tokens.
+type Signer struct {
+	// Key is used to sign tokens. It must be an Ed25519 key or an ECDSA key
+	// on P-256 or P-384.
+	Key crypto.Signer
+	// KeyID, if set, is put into the header, to help verifiers find the
+	// key.
+	KeyID string
+}
+
+// Sign returns t as a JWT in the compact serialization. IssuedAt is set to the
+// current time.
+func (s *Signer) Sign(t *Token) (string, error) {
+	alg, err := rawsig.For(s.Key.Public())
+	if err != nil {
+		return "", err
+	}
+	if t.ChainDigest == nil {
+		return "", errors.New("token does not reference a chain")
+	}
+	t.IssuedAt = time.Now().Truncate(time.Second)
+	hdr, err := json.Marshal(header{Algorithm: joseAlgorithms[alg], Type: "JWT", KeyID: s.KeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims{
+		Issuer:   t.Issuer,
+		IssuedAt: t.IssuedAt.Unix(),
+		Notary: &notaryClaim{
+			HashAlgorithm: t.HashAlgorithm,
+			Digest:        hex.EncodeToString(t.Digest),
+			Earliest:      t.Earliest.Unix(),
+			Latest:        t.Latest.Unix(),
+			ChainDigest:   "sha256:" + hex.EncodeToString(t.ChainDigest),
+			Chain:         t.Chain,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := encode(hdr) + "." + encode(payload)
+	sig, err := rawsig.Sign(s.Key, []byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encode(sig), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// IsToken reports whether b looks like a JWT in the compact serialization, as
+// opposed to a chain.
+func IsToken(b []byte) bool {
+	// A base64url-encoded JSON object starts with "eyJ" ("{\"").
+	return bytes.HasPrefix(b, []byte("eyJ")) && bytes.Count(b, []byte(".")) == 2
+}
+
+// Parse parses a JWT in the compact serialization and verifies its signature
+// with pub. Surrounding whitespace is ignored. It does not verify the chain of
+// the token.
+func Parse(s string, pub crypto.PublicKey) (*Token, error) {
+	return parse(s, pub, true)
+}
+
+// ParseUnverified is like Parse, but does not verify the signature of the
+// token. The chain of the token is still evidence for its claims, if it is
+// verified.
+func ParseUnverified(s string) (*Token, error) {
+	return parse(s, nil, false)
+}
+
+func parse(s string, pub crypto.PublicKey, check bool) (*Token, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a compact JWS")
+	}
+	var raw [3][]byte
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		if err != nil {
+			return nil, fmt.Errorf("not a compact JWS: %w", err)
+		}
+		raw[i] = b
+	}
+	var hdr header
+	if err := json.Unmarshal(raw[0], &hdr); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if check {
+		alg, ok := algorithm(hdr.Algorithm)
+		if !ok {
+			return nil, fmt.Errorf("unsupported algorithm %q", hdr.Algorithm)
+		}
+		if !rawsig.Verify(pub, alg, []byte(parts[0]+"."+parts[1]), raw[2]) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	var c claims
+	if err := json.Unmarshal(raw[1], &c); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	n := c.Notary
+	if n == nil {
+		return nil, errors.New("token has no notary claim")
+	}
+	digest, err := hex.DecodeString(n.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("digest: %w", err)
+	}
+	hexChain, ok := strings.CutPrefix(n.ChainDigest, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain digest %q", n.ChainDigest)
+	}
+	chainDigest, err := hex.DecodeString(hexChain)
+	if err != nil {
+		return nil, fmt.Errorf("chain digest: %w", err)
+	}
+	if n.Chain != nil {
+		if sum := sha256.Sum256(n.Chain); !bytes.Equal(sum[:], chainDigest) {
+			return nil, errors.New("chain does not match chain digest")
+		}
+	}
+	return &Token{
+		Issuer:        c.Issuer,
+		IssuedAt:      time.Unix(c.IssuedAt, 0),
+		HashAlgorithm: n.HashAlgorithm,
+		Digest:        digest,
+		Earliest:      time.Unix(n.Earliest, 0),
+		Latest:        time.Unix(n.Latest, 0),
+		ChainDigest:   chainDigest,
+		Chain:         n.Chain,
+	}, nil
+}
+
+// algorithm returns the signature algorithm with the given JOSE name. "none"
+// is not supported.
+func algorithm(name string) (rawsig.Algorithm, bool) {
+	for a, n := range joseAlgorithms {
+		if n == name {
+			return a, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jws
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestSign(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	chain := []byte("notary\x00\x01chain")
+	chainDigest := sha256.Sum256(chain)
+	tok := &Token{
+		Issuer:        "notary test",
+		HashAlgorithm: roughtime.SHA256,
+		Digest:        digest[:],
+		Earliest:      time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+		Latest:        time.Date(2018, 10, 1, 12, 0, 2, 0, time.UTC),
+		ChainDigest:   chainDigest[:],
+		Chain:         chain,
+	}
+	keys := []crypto.Signer{p256, p384, edKey}
+	for i, key := range keys {
+		s := &Signer{Key: key, KeyID: "test"}
+		jwt, err := s.Sign(tok)
+		if err != nil {
+			t.Fatalf("Sign(%T) = %v", key, err)
+		}
+		if !IsToken([]byte(jwt)) {
+			t.Errorf("IsToken(Sign(%T)) = false, want true", key)
+		}
+		got, err := Parse(jwt+"\n", key.Public())
+		if err != nil {
+			t.Fatalf("Parse(Sign(%T)) = %v", key, err)
+		}
+		if got.Issuer != tok.Issuer || !got.IssuedAt.Equal(tok.IssuedAt) || got.HashAlgorithm != tok.HashAlgorithm || !bytes.Equal(got.Digest, tok.Digest) || !got.Earliest.Equal(tok.Earliest) || !got.Latest.Equal(tok.Latest) || !bytes.Equal(got.ChainDigest, tok.ChainDigest) || !bytes.Equal(got.Chain, tok.Chain) {
+			t.Errorf("Parse(Sign(%T)) = %+v, want %+v", key, got, tok)
+		}
+
+		other := keys[(i+1)%len(keys)]
+		if _, err := Parse(jwt, other.Public()); err == nil {
+			t.Errorf("Parse(token signed by %T) with %T key succeeded", key, other)
+		}
+
+		parts := strings.Split(jwt, ".")
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		tampered := parts[0] + "." + encode(bytes.Replace(payload, []byte("notary test"), []byte("notary tesT"), 1)) + "." + parts[2]
+		if _, err := Parse(tampered, key.Public()); err == nil {
+			t.Errorf("Parse(tampered token signed by %T) succeeded", key)
+		}
+		if _, err := ParseUnverified(tampered); err != nil {
+			t.Errorf("ParseUnverified(tampered token signed by %T) = %v", key, err)
+		}
+		none := encode([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+		if _, err := Parse(none, key.Public()); err == nil {
+			t.Errorf("Parse(unsigned token) with %T key succeeded", key)
+		}
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Signer{Key: rsaKey}).Sign(tok); err == nil {
+		t.Error("Sign(RSA key) succeeded")
+	}
+
+	tok.Chain = []byte("another chain")
+	jwt, err := (&Signer{Key: edKey}).Sign(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseUnverified(jwt); err == nil {
+		t.Error("ParseUnverified(token with wrong chain digest) succeeded")
+	}
+}
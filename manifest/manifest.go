@@ -0,0 +1,259 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest describes the files in a directory canonically, so a single
+// roughtime chain can notarize a whole directory.
+//
+// A manifest lists the path, permissions, size and digest of every regular
+// file, sorted by path. Its canonical encoding is text, starting with a header
+// naming the hash algorithm, followed by one line per file:
+//
+//	notary manifest v1 sha512
+//	<hex digest> <octal permissions> <size> <path>
+//
+// Paths are slash-separated and relative to the directory. They are quoted
+// like Go string literals if they contain spaces, quotes or characters that
+// are not printable. The chain is built over the nonce of the encoded
+// manifest, so it proves the existence of every file in it.
+package manifest // import "github.com/Merovius/notary/manifest"
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// header starts the encoding of a manifest, followed by the hash algorithm.
+const header = "notary manifest v1 "
+
+// Entry describes a file in a manifest.
+type Entry struct {
+	// Path is the slash-separated path of the file, relative to the
+	// directory.
+	Path string
+	// Mode contains the permission bits of the file.
+	Mode fs.FileMode
+	// Size is the size of the file in bytes.
+	Size int64
+	// Digest is the digest of the contents of the file.
+	Digest []byte
+}
+
+// A Manifest lists the regular files in a directory.
+type Manifest struct {
+	// HashAlgorithm is the algorithm the digests were calculated with, as
+	// accepted by roughtime.HashDigest.
+	HashAlgorithm string
+	// Entries are sorted by Path.
+	Entries []Entry
+}
+
+// Build walks the directory dir and returns a manifest of the regular files in
+// it, hashed with h. Up to workers files are hashed concurrently, as by
+// roughtime.Hasher.DigestFiles. Files for which skip returns true are left out;
+// skip is called with the slash-separated path and may be nil. Build fails if
+// dir contains symbolic links or other files that are neither regular nor
+// directories.
+func Build(dir string, h *roughtime.Hasher, workers int, skip func(path string) bool) (*Manifest, error) {
+	alg := h.Algorithm
+	if alg == "" {
+		alg = roughtime.SHA512
+	}
+	m := &Manifest{HashAlgorithm: alg}
+	var names []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (skip != nil && skip(p)) {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s: not a regular file", filepath.Join(dir, p))
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, Entry{Path: p, Mode: fi.Mode().Perm(), Size: fi.Size()})
+		names = append(names, filepath.Join(dir, filepath.FromSlash(p)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	digests, err := h.DigestFiles(names, workers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range m.Entries {
+		m.Entries[i].Digest = digests[i]
+	}
+	// WalkDir visits entries in lexical order per directory, which is not
+	// the order of full paths ("a-b" sorts before "a/b").
+	slices.SortFunc(m.Entries, func(a, b Entry) int { return strings.Compare(a.Path, b.Path) })
+	return m, nil
+}
+
+// Encode returns the canonical encoding of m.
+func (m *Manifest) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteString(header + m.HashAlgorithm + "\n")
+	for _, e := range m.Entries {
+		fmt.Fprintf(&b, "%x %04o %d %s\n", e.Digest, uint32(e.Mode.Perm()), e.Size, quotePath(e.Path))
+	}
+	return b.Bytes()
+}
+
+// quotePath quotes p, if it can not be written as is.
+func quotePath(p string) string {
+	if q := strconv.Quote(p); q[1:len(q)-1] != p || strings.Contains(p, " ") {
+		return q
+	}
+	return p
+}
+
+// Nonce derives the nonce of m, to build a chain over.
+func (m *Manifest) Nonce() ([]byte, error) {
+	return roughtime.HashNonce(m.HashAlgorithm, bytes.NewReader(m.Encode()))
+}
+
+// Parse parses the canonical encoding of a manifest. Encodings that are not
+// canonical, like ones with unsorted entries, are rejected.
+func Parse(b []byte) (*Manifest, error) {
+	s, ok := strings.CutPrefix(string(b), header)
+	if !ok {
+		return nil, errors.New("not a manifest")
+	}
+	alg, s, ok := strings.Cut(s, "\n")
+	if !ok {
+		return nil, errors.New("truncated manifest")
+	}
+	empty, err := roughtime.HashDigest(alg, strings.NewReader(""))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{HashAlgorithm: alg}
+	for n := 2; s != ""; n++ {
+		var line string
+		if line, s, ok = strings.Cut(s, "\n"); !ok {
+			return nil, fmt.Errorf("line %d: missing newline", n)
+		}
+		e, err := parseEntry(line, len(empty))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if len(m.Entries) > 0 && m.Entries[len(m.Entries)-1].Path >= e.Path {
+			return nil, fmt.Errorf("line %d: %q is out of order", n, e.Path)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	if !bytes.Equal(m.Encode(), b) {
+		return nil, errors.New("manifest is not canonical")
+	}
+	return m, nil
+}
+
+// parseEntry parses a line of a manifest, with a digest of size bytes.
+func parseEntry(line string, size int) (Entry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return Entry{}, errors.New("invalid entry")
+	}
+	var (
+		e   Entry
+		err error
+	)
+	if e.Digest, err = hex.DecodeString(fields[0]); err != nil || len(e.Digest) != size {
+		return Entry{}, errors.New("invalid digest")
+	}
+	mode, err := strconv.ParseUint(fields[1], 8, 32)
+	if err != nil || fs.FileMode(mode) != fs.FileMode(mode).Perm() {
+		return Entry{}, errors.New("invalid mode")
+	}
+	e.Mode = fs.FileMode(mode)
+	if e.Size, err = strconv.ParseInt(fields[2], 10, 64); err != nil || e.Size < 0 {
+		return Entry{}, errors.New("invalid size")
+	}
+	e.Path = fields[3]
+	if strings.HasPrefix(e.Path, `"`) {
+		if e.Path, err = strconv.Unquote(e.Path); err != nil {
+			return Entry{}, errors.New("invalid path")
+		}
+	}
+	if !fs.ValidPath(e.Path) || e.Path == "." {
+		return Entry{}, fmt.Errorf("invalid path %q", e.Path)
+	}
+	return e, nil
+}
+
+// A MismatchError is returned by Compare if a directory does not match its
+// manifest. It lists the paths of the differing files.
+type MismatchError struct {
+	// Added are files missing from the manifest, Removed are files missing
+	// from the directory and Changed are files whose mode, size or digest
+	// changed.
+	Added, Removed, Changed []string
+}
+
+func (e *MismatchError) Error() string {
+	var parts []string
+	for _, l := range []struct {
+		what  string
+		paths []string
+	}{{"added", e.Added}, {"removed", e.Removed}, {"changed", e.Changed}} {
+		if len(l.paths) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", l.what, strings.Join(l.paths, ", ")))
+		}
+	}
+	return "directory does not match manifest: " + strings.Join(parts, "; ")
+}
+
+// Compare checks that the manifest got, built from a directory, matches want.
+// If not, it returns a *MismatchError.
+func Compare(want, got *Manifest) error {
+	if want.HashAlgorithm != got.HashAlgorithm {
+		return fmt.Errorf("manifest uses %s, not %s", want.HashAlgorithm, got.HashAlgorithm)
+	}
+	var (
+		e    MismatchError
+		w, g = want.Entries, got.Entries
+	)
+	for len(w) > 0 || len(g) > 0 {
+		switch {
+		case len(g) == 0 || (len(w) > 0 && w[0].Path < g[0].Path):
+			e.Removed, w = append(e.Removed, w[0].Path), w[1:]
+		case len(w) == 0 || g[0].Path < w[0].Path:
+			e.Added, g = append(e.Added, g[0].Path), g[1:]
+		default:
+			if w[0].Mode != g[0].Mode || w[0].Size != g[0].Size || !bytes.Equal(w[0].Digest, g[0].Digest) {
+				e.Changed = append(e.Changed, w[0].Path)
+			}
+			w, g = w[1:], g[1:]
+		}
+	}
+	if e.Added != nil || e.Removed != nil || e.Changed != nil {
+		return &e
+	}
+	return nil
+}
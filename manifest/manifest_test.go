@@ -0,0 +1,147 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for p, content := range files {
+		name := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a/b":        "nested",
+		"a-b":        "sorts before a/b",
+		"with space": "quoted",
+		"run.sh":     "#!/bin/sh",
+		"chain.json": "skipped",
+	})
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	skip := func(p string) bool { return p == "chain.json" }
+	m, err := Build(dir, &roughtime.Hasher{Algorithm: roughtime.SHA256}, 2, skip)
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	if want := []string{"a-b", "a/b", "run.sh", "with space"}; !slices.Equal(paths, want) {
+		t.Errorf("Build() has paths %q, want %q", paths, want)
+	}
+	if e := m.Entries[2]; e.Mode != 0o755 || e.Size != int64(len("#!/bin/sh")) {
+		t.Errorf("Build() entry %q has mode %o and size %d, want 755 and %d", e.Path, e.Mode, e.Size, len("#!/bin/sh"))
+	}
+
+	enc := m.Encode()
+	if !strings.HasPrefix(string(enc), "notary manifest v1 sha256\n") || !strings.Contains(string(enc), ` "with space"`+"\n") {
+		t.Errorf("Encode() =\n%s", enc)
+	}
+	got, err := Parse(enc)
+	if err != nil {
+		t.Fatalf("Parse(Encode()) = %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("Parse(Encode()) = %v, want %v", got, m)
+	}
+	if err := Compare(m, got); err != nil {
+		t.Errorf("Compare(m, Parse(Encode())) = %v", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"a/b": "changed", "new": "added"})
+	if err := os.Remove(filepath.Join(dir, "a-b")); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Build(dir, &roughtime.Hasher{Algorithm: roughtime.SHA256}, 0, skip)
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	err = Compare(m, changed)
+	var merr *MismatchError
+	if !errors.As(err, &merr) {
+		t.Fatalf("Compare(changed directory) = %v, want *MismatchError", err)
+	}
+	if want := (&MismatchError{Added: []string{"new"}, Removed: []string{"a-b"}, Changed: []string{"a/b"}}); !reflect.DeepEqual(merr, want) {
+		t.Errorf("Compare(changed directory) = %+v, want %+v", merr, want)
+	}
+}
+
+func TestBuildSymlink(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"file": "content"})
+	if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	if _, err := Build(dir, new(roughtime.Hasher), 0, nil); err == nil {
+		t.Error("Build(directory with symlink) succeeded")
+	}
+}
+
+func TestParse(t *testing.T) {
+	m := &Manifest{HashAlgorithm: roughtime.SHA256, Entries: []Entry{
+		{Path: "a", Mode: 0o644, Size: 1, Digest: make([]byte, 32)},
+		{Path: "b", Mode: 0o600, Size: 2, Digest: bytes.Repeat([]byte{0xab}, 32)},
+	}}
+	good := string(m.Encode())
+	lines := strings.SplitAfter(good, "\n")
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{"header", strings.Replace(good, "v1", "v2", 1)},
+		{"algorithm", strings.Replace(good, "sha256", "md5", 1)},
+		{"unsorted", lines[0] + lines[2] + lines[1]},
+		{"duplicate", lines[0] + lines[1] + lines[1]},
+		{"uppercase digest", strings.Replace(good, "abab", "ABAB", 1)},
+		{"short digest", strings.Replace(good, "00 ", " ", 1)},
+		{"mode", strings.Replace(good, " 0644 ", " 644 ", 1)},
+		{"type bits", strings.Replace(good, " 0644 ", " 4000000644 ", 1)},
+		{"size", strings.Replace(good, " 1 a", " -1 a", 1)},
+		{"absolute path", strings.Replace(good, " a\n", " /a\n", 1)},
+		{"dot path", strings.Replace(good, " a\n", " ../a\n", 1)},
+		{"needless quotes", strings.Replace(good, " a\n", ` "a"`+"\n", 1)},
+		{"missing newline", strings.TrimSuffix(good, "\n")},
+	} {
+		if _, err := Parse([]byte(tc.in)); err == nil {
+			t.Errorf("Parse(%s) succeeded", tc.name)
+		}
+	}
+	if got, err := Parse([]byte(good)); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("Parse() = %v, %v, want %v, <nil>", got, err, m)
+	}
+}
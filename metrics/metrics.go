@@ -0,0 +1,145 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics collects Prometheus metrics about roughtime queries and the
+// roughtime server.
+package metrics // import "github.com/Merovius/notary/metrics"
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Failure causes, used as the cause label of notary_query_failures_total.
+const (
+	CauseTimeout = "timeout"
+	CauseNetwork = "network"
+	CauseVerify  = "verify"
+	CauseOther   = "other"
+)
+
+// Collector implements roughtime.Recorder and prometheus.Collector. It must be
+// created with New.
+type Collector struct {
+	duration *prometheus.HistogramVec
+	failures *prometheus.CounterVec
+	offset   *prometheus.GaugeVec
+	estimate prometheus.Gauge
+
+	backoff     *roughtime.Backoff
+	backoffDesc *prometheus.Desc
+}
+
+var (
+	_ roughtime.Recorder   = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// New returns a new Collector.
+func New() *Collector {
+	return &Collector{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "notary_query_duration_seconds",
+			Help:    "Round trip time of successful roughtime queries.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"server"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notary_query_failures_total",
+			Help: "Failed roughtime queries, by cause.",
+		}, []string{"server", "cause"}),
+		offset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "notary_clock_offset_seconds",
+			Help: "Offset of the last verified midpoint of a server from the local clock.",
+		}, []string{"server"}),
+		estimate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "notary_clock_offset_estimate_seconds",
+			Help: "Estimated offset of the local clock, combined from all servers.",
+		}),
+		backoffDesc: prometheus.NewDesc("notary_server_backoff_seconds", "Remaining cool-down of servers that did not respond.", []string{"server"}, nil),
+	}
+}
+
+// RecordQuery implements roughtime.Recorder.
+func (c *Collector) RecordQuery(address string, rtt time.Duration, err error) {
+	if err != nil {
+		c.failures.WithLabelValues(address, Cause(err)).Inc()
+		return
+	}
+	c.duration.WithLabelValues(address).Observe(rtt.Seconds())
+}
+
+// RecordOffset implements roughtime.Recorder.
+func (c *Collector) RecordOffset(address string, offset time.Duration) {
+	c.offset.WithLabelValues(address).Set(offset.Seconds())
+}
+
+// RecordEstimate records the estimated offset of the local clock, as
+// maintained by notary monitor.
+func (c *Collector) RecordEstimate(offset time.Duration) {
+	c.estimate.Set(offset.Seconds())
+}
+
+// WatchBackoff makes c export the cool-downs in b. It must be called before c
+// is registered.
+func (c *Collector) WatchBackoff(b *roughtime.Backoff) {
+	c.backoff = b
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.duration.Describe(ch)
+	c.failures.Describe(ch)
+	c.offset.Describe(ch)
+	c.estimate.Describe(ch)
+	ch <- c.backoffDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.duration.Collect(ch)
+	c.failures.Collect(ch)
+	c.offset.Collect(ch)
+	c.estimate.Collect(ch)
+	if c.backoff == nil {
+		return
+	}
+	for _, s := range c.backoff.State() {
+		if d := time.Until(s.Until); d > 0 {
+			ch <- prometheus.MustNewConstMetric(c.backoffDesc, prometheus.GaugeValue, d.Seconds(), s.Address)
+		}
+	}
+}
+
+// Cause classifies an error returned by the roughtime package.
+func Cause(err error) string {
+	var (
+		netErr    *roughtime.NetError
+		verifyErr *roughtime.VerifyError
+		timeout   net.Error
+	)
+	switch {
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return CauseTimeout
+	case errors.As(err, &netErr):
+		return CauseNetwork
+	case errors.As(err, &verifyErr):
+		return CauseVerify
+	default:
+		return CauseOther
+	}
+}
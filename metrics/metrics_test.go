@@ -0,0 +1,143 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := New()
+	c.RecordQuery("a:2002", 30*time.Millisecond, nil)
+	c.RecordOffset("a:2002", -1500*time.Millisecond)
+	c.RecordQuery("a:2002", 2*time.Second, nil)
+	c.RecordQuery("b:2002", time.Second, &roughtime.NetError{Address: "b:2002", Err: os.ErrDeadlineExceeded})
+	c.RecordQuery("b:2002", time.Second, &roughtime.VerifyError{Err: errors.New("bad signature")})
+	c.RecordQuery("c:2002", time.Second, errors.New("other"))
+	c.RecordEstimate(250 * time.Millisecond)
+
+	want := `
+# HELP notary_clock_offset_estimate_seconds Estimated offset of the local clock, combined from all servers.
+# TYPE notary_clock_offset_estimate_seconds gauge
+notary_clock_offset_estimate_seconds 0.25
+# HELP notary_clock_offset_seconds Offset of the last verified midpoint of a server from the local clock.
+# TYPE notary_clock_offset_seconds gauge
+notary_clock_offset_seconds{server="a:2002"} -1.5
+# HELP notary_query_duration_seconds Round trip time of successful roughtime queries.
+# TYPE notary_query_duration_seconds histogram
+notary_query_duration_seconds_bucket{server="a:2002",le="0.005"} 0
+notary_query_duration_seconds_bucket{server="a:2002",le="0.01"} 0
+notary_query_duration_seconds_bucket{server="a:2002",le="0.025"} 0
+notary_query_duration_seconds_bucket{server="a:2002",le="0.05"} 1
+notary_query_duration_seconds_bucket{server="a:2002",le="0.1"} 1
+notary_query_duration_seconds_bucket{server="a:2002",le="0.25"} 1
+notary_query_duration_seconds_bucket{server="a:2002",le="0.5"} 1
+notary_query_duration_seconds_bucket{server="a:2002",le="1"} 1
+notary_query_duration_seconds_bucket{server="a:2002",le="2.5"} 2
+notary_query_duration_seconds_bucket{server="a:2002",le="5"} 2
+notary_query_duration_seconds_bucket{server="a:2002",le="10"} 2
+notary_query_duration_seconds_bucket{server="a:2002",le="+Inf"} 2
+notary_query_duration_seconds_sum{server="a:2002"} 2.03
+notary_query_duration_seconds_count{server="a:2002"} 2
+# HELP notary_query_failures_total Failed roughtime queries, by cause.
+# TYPE notary_query_failures_total counter
+notary_query_failures_total{cause="other",server="c:2002"} 1
+notary_query_failures_total{cause="timeout",server="b:2002"} 1
+notary_query_failures_total{cause="verify",server="b:2002"} 1
+`
+	names := []string{"notary_clock_offset_estimate_seconds", "notary_clock_offset_seconds", "notary_query_duration_seconds", "notary_query_failures_total"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	// A server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	b := &roughtime.Backoff{Base: time.Hour}
+	c := &roughtime.Client{Timeout: 10 * time.Millisecond, Backoff: b}
+	c.FetchRoughtime(&roughtime.Server{Address: conn.LocalAddr().String(), PublicKey: make([]byte, 32)}, nil)
+
+	m := New()
+	m.WatchBackoff(b)
+	if n := testutil.CollectAndCount(m, "notary_server_backoff_seconds"); n != 1 {
+		t.Errorf("collected %d cool-downs, want 1", n)
+	}
+}
+
+func TestServerCollector(t *testing.T) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Unix(1700000000, 0)
+	k, err := roughtime.NewOnlineKey(root, notAfter.Add(-time.Hour), notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewServer()
+	c.WatchServer(&server.Server{Key: k})
+	c.RecordBatch(10, 8, time.Millisecond)
+	c.RecordBatch(2, 0, 0)
+	c.RecordDrop(server.DropTooSmall)
+	c.RecordDrop(server.DropRateLimited)
+	c.RecordDrop(server.DropRateLimited)
+
+	want := `
+# HELP notary_serve_dropped_requests_total Requests that were not answered, by reason.
+# TYPE notary_serve_dropped_requests_total counter
+notary_serve_dropped_requests_total{reason="amplifying"} 0
+notary_serve_dropped_requests_total{reason="invalid"} 0
+notary_serve_dropped_requests_total{reason="rate_limited"} 2
+notary_serve_dropped_requests_total{reason="too_small"} 1
+notary_serve_dropped_requests_total{reason="unavailable"} 0
+# HELP notary_serve_healthy Whether the server can answer requests.
+# TYPE notary_serve_healthy gauge
+notary_serve_healthy 0
+# HELP notary_serve_online_key_expiry_timestamp_seconds End of the validity of the current online key.
+# TYPE notary_serve_online_key_expiry_timestamp_seconds gauge
+notary_serve_online_key_expiry_timestamp_seconds 1.7e+09
+# HELP notary_serve_requests_total Datagrams received by the roughtime server.
+# TYPE notary_serve_requests_total counter
+notary_serve_requests_total 12
+# HELP notary_serve_responses_total Responses sent by the roughtime server.
+# TYPE notary_serve_responses_total counter
+notary_serve_responses_total 8
+`
+	names := []string{"notary_serve_dropped_requests_total", "notary_serve_healthy", "notary_serve_online_key_expiry_timestamp_seconds", "notary_serve_requests_total", "notary_serve_responses_total"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{"notary_serve_batch_size", "notary_serve_signing_duration_seconds"} {
+		if n := testutil.CollectAndCount(c, name); n != 1 {
+			t.Errorf("collected %d %s histograms, want 1", n, name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/Merovius/notary/server"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerCollector implements server.Recorder and prometheus.Collector. It must
+// be created with NewServer.
+type ServerCollector struct {
+	requests  prometheus.Counter
+	responses prometheus.Counter
+	batchSize prometheus.Histogram
+	signing   prometheus.Histogram
+	dropped   *prometheus.CounterVec
+
+	server     *server.Server
+	expiryDesc *prometheus.Desc
+	healthDesc *prometheus.Desc
+}
+
+var (
+	_ server.Recorder      = (*ServerCollector)(nil)
+	_ prometheus.Collector = (*ServerCollector)(nil)
+)
+
+// NewServer returns a new ServerCollector.
+func NewServer() *ServerCollector {
+	c := &ServerCollector{
+		requests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "notary_serve_requests_total",
+			Help: "Datagrams received by the roughtime server.",
+		}),
+		responses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "notary_serve_responses_total",
+			Help: "Responses sent by the roughtime server.",
+		}),
+		batchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "notary_serve_batch_size",
+			Help:    "Responses signed with a single signature.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+		}),
+		signing: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "notary_serve_signing_duration_seconds",
+			Help:    "Time to sign a batch of responses.",
+			Buckets: prometheus.ExponentialBuckets(1e-5, 4, 10),
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notary_serve_dropped_requests_total",
+			Help: "Requests that were not answered, by reason.",
+		}, []string{"reason"}),
+		expiryDesc: prometheus.NewDesc("notary_serve_online_key_expiry_timestamp_seconds", "End of the validity of the current online key.", nil, nil),
+		healthDesc: prometheus.NewDesc("notary_serve_healthy", "Whether the server can answer requests.", nil, nil),
+	}
+	// Export all reasons, so rates can be computed from the start.
+	for _, r := range []string{server.DropTooSmall, server.DropRateLimited, server.DropInvalid, server.DropAmplifying, server.DropUnavailable} {
+		c.dropped.WithLabelValues(r)
+	}
+	return c
+}
+
+// WatchServer makes c export the expiry of the online key and the health of s.
+// It must be called before c is registered.
+func (c *ServerCollector) WatchServer(s *server.Server) {
+	c.server = s
+}
+
+// RecordBatch implements server.Recorder.
+func (c *ServerCollector) RecordBatch(requests, responses int, signing time.Duration) {
+	c.requests.Add(float64(requests))
+	if responses == 0 {
+		return
+	}
+	c.responses.Add(float64(responses))
+	c.batchSize.Observe(float64(responses))
+	c.signing.Observe(signing.Seconds())
+}
+
+// RecordDrop implements server.Recorder.
+func (c *ServerCollector) RecordDrop(reason string) {
+	c.dropped.WithLabelValues(reason).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (c *ServerCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.responses.Describe(ch)
+	c.batchSize.Describe(ch)
+	c.signing.Describe(ch)
+	c.dropped.Describe(ch)
+	ch <- c.expiryDesc
+	ch <- c.healthDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ServerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.responses.Collect(ch)
+	c.batchSize.Collect(ch)
+	c.signing.Collect(ch)
+	c.dropped.Collect(ch)
+	if c.server == nil {
+		return
+	}
+	if k := c.server.OnlineKey(); k != nil {
+		ch <- prometheus.MustNewConstMetric(c.expiryDesc, prometheus.GaugeValue, float64(k.Delegation.NotAfter.Unix()))
+	}
+	healthy := 0.0
+	if c.server.Health() == nil {
+		healthy = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.healthDesc, prometheus.GaugeValue, healthy)
+}
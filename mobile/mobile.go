@@ -0,0 +1,123 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mobile is the subset of the notary API that can be used from Android
+// and iOS apps, with bindings generated by gomobile:
+//
+//	gomobile bind -target android -o notary.aar github.com/Merovius/notary/mobile
+//	gomobile bind -target ios -o Notary.xcframework github.com/Merovius/notary/mobile
+//
+// It only uses types gomobile supports: attestations are byte slices in the
+// JSON format of chains, server lists are strings in the JSON format of server
+// lists (empty for the built-in list) and times are milliseconds since the Unix
+// epoch.
+package mobile // import "github.com/Merovius/notary/mobile"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Merovius/notary"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// Status codes of a Result. They are those of notary.Status, repeated here to
+// be part of the bindings.
+const (
+	StatusOK       = notary.StatusOK
+	StatusFailure  = notary.StatusFailure
+	StatusNetwork  = notary.StatusNetwork
+	StatusInvalid  = notary.StatusInvalid
+	StatusMismatch = notary.StatusMismatch
+)
+
+// Result is the result of verifying an attestation.
+type Result struct {
+	// Status is StatusOK if the attestation is valid for the data.
+	// Otherwise, Error describes the problem.
+	Status int
+	Error  string
+	// Earliest and Latest are the bounds of the time the attestation was
+	// created at, in milliseconds since the Unix epoch. The data existed
+	// no later than Latest.
+	Earliest, Latest int64
+	// Links is the number of servers that signed the attestation.
+	Links int
+}
+
+// Attest obtains an attestation for data from the servers in the given list.
+func Attest(data []byte, servers string) ([]byte, error) {
+	s, err := serverList(servers)
+	if err != nil {
+		return nil, err
+	}
+	a, err := notary.Attest(context.Background(), bytes.NewReader(data), notary.Options{Servers: s})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(a)
+}
+
+// Verify verifies that attestation is valid for data and signed by servers
+// in the given list. It does not access the network.
+func Verify(attestation, data []byte, servers string) *Result {
+	return verify(attestation, bytes.NewReader(data), servers)
+}
+
+// VerifyFile is like Verify, but reads the data from the named file, which
+// avoids copying large documents between the app and Go.
+func VerifyFile(attestation []byte, name, servers string) *Result {
+	f, err := os.Open(name)
+	if err != nil {
+		return result(nil, err)
+	}
+	defer f.Close()
+	return verify(attestation, f, servers)
+}
+
+func verify(attestation []byte, r io.Reader, servers string) *Result {
+	s, err := serverList(servers)
+	if err != nil {
+		return result(nil, err)
+	}
+	a := new(notary.Attestation)
+	if err := json.Unmarshal(attestation, a); err != nil {
+		return result(nil, err)
+	}
+	return result(notary.Verify(context.Background(), a, r, notary.Policy{Servers: s}))
+}
+
+func result(rep *notary.Report, err error) *Result {
+	if err != nil {
+		return &Result{Status: notary.Status(err), Error: err.Error()}
+	}
+	return &Result{
+		Status:   StatusOK,
+		Earliest: rep.Earliest.UnixMilli(),
+		Latest:   rep.Latest.UnixMilli(),
+		Links:    len(rep.Links),
+	}
+}
+
+func serverList(s string) (*config.ServersJSON, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return roughtime.ReadServersJSON(strings.NewReader(s))
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Merovius/notary"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestVerify(t *testing.T) {
+	nonce, err := roughtime.HashNonce(roughtime.SHA256, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := roughtime.NewChain(roughtime.SHA256, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Links = []*config.Link{{PublicKeyType: "ed25519", ServerPublicKey: make([]byte, 32), NonceOrBlind: nonce, Reply: []byte("not a reply")}}
+	a, err := json.Marshal(&notary.Attestation{Chain: ch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		desc string
+		res  *Result
+		want int
+	}{
+		{"invalid", Verify(a, []byte("hello"), ""), StatusInvalid},
+		{"invalid file", VerifyFile(a, name, ""), StatusInvalid},
+		{"mismatch", Verify(a, []byte("goodbye"), ""), StatusMismatch},
+		{"missing file", VerifyFile(a, name+".missing", ""), StatusFailure},
+		{"bad attestation", Verify([]byte("{"), []byte("hello"), ""), StatusFailure},
+		{"bad server list", Verify(a, []byte("hello"), "{"), StatusFailure},
+	}
+	for _, tc := range tcs {
+		if tc.res.Status != tc.want || tc.res.Error == "" {
+			t.Errorf("%s: Verify(…) = %+v, want status %d and an error", tc.desc, tc.res, tc.want)
+		}
+	}
+}
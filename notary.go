@@ -0,0 +1,204 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notary creates and verifies proofs that data existed at a given
+// time, using roughtime. It bundles hashing the data, building a chain of
+// roughtime responses over the hash and verifying it, which the roughtime
+// package provides separately:
+//
+//	a, err := notary.Attest(ctx, f, notary.Options{})
+//	// Store a, e.g. with json.Marshal, together with the data.
+//	rep, err := notary.Verify(ctx, a, f, notary.Policy{})
+//	// The data existed no later than rep.Latest.
+package notary // import "github.com/Merovius/notary"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/internal/await"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// ErrMismatch is returned by Verify if an attestation is valid, but for
+// different data.
+var ErrMismatch = errors.New("attestation does not match the data")
+
+// Status codes returned by Status. They are the exit codes of the notary
+// command.
+const (
+	StatusOK       = 0
+	StatusFailure  = 1
+	StatusNetwork  = 2
+	StatusInvalid  = 3
+	StatusMismatch = 4
+)
+
+// Status classifies an error returned by this package or the roughtime package
+// as one of the Status codes, for callers that can only pass on a number.
+func Status(err error) int {
+	var (
+		netErr    *roughtime.NetError
+		verifyErr *roughtime.VerifyError
+	)
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.Is(err, ErrMismatch):
+		return StatusMismatch
+	case errors.As(err, &verifyErr):
+		return StatusInvalid
+	case errors.As(err, &netErr):
+		return StatusNetwork
+	default:
+		return StatusFailure
+	}
+}
+
+// An Attestation proves that some data existed at a given time. It is a
+// roughtime chain, whose first nonce is derived from the data. It is
+// serialized as the JSON format of chains.
+type Attestation struct {
+	Chain *roughtime.Chain
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a *Attestation) MarshalJSON() ([]byte, error) {
+	return roughtime.MarshalChain(a.Chain)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Attestation) UnmarshalJSON(b []byte) error {
+	ch, err := roughtime.LoadChain(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	a.Chain = ch
+	return nil
+}
+
+// A Report describes a verified attestation. Its Latest field is the time the
+// data existed at the latest.
+type Report = roughtime.Report
+
+// Options configures Attest.
+type Options struct {
+	// Servers is the list of servers to query. If nil, the built-in list
+	// of the roughtime package is used.
+	Servers *config.ServersJSON
+	// HashAlgorithm is used to hash the data. If empty, roughtime.SHA512 is
+	// used.
+	HashAlgorithm string
+	// Client queries the servers. If nil, a zero roughtime.Client is used.
+	Client *roughtime.Client
+}
+
+// Policy configures Verify.
+type Policy struct {
+	// Servers is the list of trusted servers. If nil, the built-in list of
+	// the roughtime package is used.
+	Servers *config.ServersJSON
+	// Requirements, if set, are additional requirements the attestation
+	// must satisfy, like a minimum number of links.
+	Requirements *roughtime.Policy
+	// Client verifies the attestation. If nil, a zero roughtime.Client is
+	// used.
+	Client *roughtime.Client
+}
+
+// Attest hashes the data read from r and obtains an attestation for it from
+// the servers. If ctx is done before the servers responded, Attest returns
+// ctx.Err(); queries in flight are abandoned, ending after the timeout of the
+// Client.
+func Attest(ctx context.Context, r io.Reader, o Options) (*Attestation, error) {
+	alg := o.HashAlgorithm
+	if alg == "" {
+		alg = roughtime.SHA512
+	}
+	nonce, err := roughtime.HashNonce(alg, ctxReader{ctx, r})
+	if err != nil {
+		return nil, err
+	}
+	c, servers := client(o.Client), serverList(o.Servers)
+	ch, err := await.Call(ctx, func() (*roughtime.Chain, error) {
+		ch, _, err := c.BuildChain(servers, alg, nonce)
+		return ch, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Attestation{Chain: ch}, nil
+}
+
+// Verify hashes the data read from r and checks that a is a valid attestation
+// for it, signed by trusted servers. If a is valid, but for different data, it
+// returns ErrMismatch. Invalid attestations fail with a *roughtime.VerifyError.
+// Like Attest, Verify returns ctx.Err() if ctx is done before the chain is
+// verified.
+func Verify(ctx context.Context, a *Attestation, r io.Reader, p Policy) (*Report, error) {
+	if a == nil || a.Chain == nil || len(a.Chain.Links) == 0 {
+		return nil, ErrMismatch
+	}
+	nonce, err := roughtime.HashNonce(a.Chain.HashAlgorithm, ctxReader{ctx, r})
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(a.Chain.Nonce(), nonce) {
+		return nil, ErrMismatch
+	}
+	c, servers := client(p.Client), serverList(p.Servers)
+	rep, err := await.Call(ctx, func() (*Report, error) {
+		return c.VerifyChain(a.Chain, servers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Requirements != nil {
+		if err := p.Requirements.Check(a.Chain, rep); err != nil {
+			return nil, &roughtime.VerifyError{Err: err}
+		}
+	}
+	return rep, nil
+}
+
+func client(c *roughtime.Client) *roughtime.Client {
+	if c == nil {
+		return new(roughtime.Client)
+	}
+	return c
+}
+
+func serverList(s *config.ServersJSON) *config.ServersJSON {
+	if s == nil {
+		return roughtime.DefaultServers()
+	}
+	return s
+}
+
+// ctxReader is an io.Reader that fails once ctx is done, so hashing large
+// inputs can be cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
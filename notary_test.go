@@ -0,0 +1,115 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestAttest(t *testing.T) {
+	// A server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	o := Options{
+		Servers: &config.ServersJSON{Servers: []*config.Server{{
+			Name:          "dead",
+			PublicKeyType: "ed25519",
+			PublicKey:     make([]byte, 32),
+			Addresses:     []*config.ServerAddress{{Protocol: "udp", Address: conn.LocalAddr().String()}},
+		}}},
+		Client: &roughtime.Client{Timeout: 100 * time.Millisecond},
+	}
+
+	var nerr *roughtime.NetError
+	if _, err := Attest(context.Background(), strings.NewReader("hello"), o); !errors.As(err, &nerr) {
+		t.Errorf("Attest(dead server) = %v, want *roughtime.NetError", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Attest(ctx, strings.NewReader("hello"), o); !errors.Is(err, context.Canceled) {
+		t.Errorf("Attest(cancelled) = %v, want %v", err, context.Canceled)
+	}
+	o.HashAlgorithm = "md5"
+	if _, err := Attest(context.Background(), strings.NewReader("hello"), o); err == nil {
+		t.Error("Attest(unknown hash algorithm) succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	nonce, err := roughtime.HashNonce(roughtime.SHA256, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := roughtime.NewChain(roughtime.SHA256, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Links = []*config.Link{{PublicKeyType: "ed25519", ServerPublicKey: make([]byte, 32), NonceOrBlind: nonce, Reply: []byte("not a reply")}}
+
+	b, err := json.Marshal(&Attestation{Chain: ch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := new(Attestation)
+	if err := json.Unmarshal(b, a); err != nil {
+		t.Fatalf("Unmarshal(%s) = %v", b, err)
+	}
+	if a.Chain.HashAlgorithm != roughtime.SHA256 || len(a.Chain.Links) != 1 {
+		t.Errorf("Unmarshal(%s) = %+v", b, a.Chain)
+	}
+
+	ctx := context.Background()
+	if _, err := Verify(ctx, a, strings.NewReader("goodbye"), Policy{}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify(other data) = %v, want %v", err, ErrMismatch)
+	}
+	if _, err := Verify(ctx, &Attestation{}, strings.NewReader("hello"), Policy{}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify(empty attestation) = %v, want %v", err, ErrMismatch)
+	}
+	var verr *roughtime.VerifyError
+	if _, err := Verify(ctx, a, strings.NewReader("hello"), Policy{}); !errors.As(err, &verr) {
+		t.Errorf("Verify(invalid attestation) = %v, want *roughtime.VerifyError", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tcs := []struct {
+		err  error
+		want int
+	}{
+		{nil, StatusOK},
+		{errors.New("oops"), StatusFailure},
+		{&roughtime.NetError{Address: "a:2002", Err: errors.New("timeout")}, StatusNetwork},
+		{fmt.Errorf("chain: %w", &roughtime.VerifyError{Err: errors.New("bad signature")}), StatusInvalid},
+		{fmt.Errorf("file: %w", ErrMismatch), StatusMismatch},
+	}
+	for _, tc := range tcs {
+		if got := Status(tc.err); got != tc.want {
+			t.Errorf("Status(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rekor submits roughtime chains to a Rekor transparency log.
+//
+// A chain is logged as a hashedrekord entry for the SHA-256 digest of the reply
+// of its last link. As every link depends on the previous replies, this commits
+// to the whole chain. Rekor requires entries to be signed, so an ephemeral key
+// is used, which carries no meaning.
+//
+// Entries are verified by fetching them from the log and comparing their
+// digest. Inclusion proofs and signed entry timestamps are not checked, so the
+// log server is trusted to answer honestly.
+package rekor // import "github.com/Merovius/notary/rekor"
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// DefaultURL is the URL of the public Sigstore Rekor instance.
+const DefaultURL = "https://rekor.sigstore.dev"
+
+// Client talks to a Rekor server. The zero value uses DefaultURL.
+type Client struct {
+	// URL is the base URL of the Rekor server.
+	URL string
+	// HTTPClient is used to make requests. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+}
+
+func (c *Client) url() string {
+	if c.URL == "" {
+		return DefaultURL
+	}
+	return strings.TrimSuffix(c.URL, "/")
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+type proposedEntry struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Spec       hashedRekord `json:"spec"`
+}
+
+type hashedRekord struct {
+	Data struct {
+		Hash struct {
+			Algorithm string `json:"algorithm"`
+			Value     string `json:"value"`
+		} `json:"hash"`
+	} `json:"data"`
+	Signature struct {
+		Content   []byte `json:"content"`
+		PublicKey struct {
+			Content []byte `json:"content"`
+		} `json:"publicKey"`
+	} `json:"signature"`
+}
+
+type logEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// Digest returns the digest logged for the first n links of ch.
+func Digest(ch *roughtime.Chain, n int) ([]byte, error) {
+	if n < 1 || n > len(ch.Links) {
+		return nil, fmt.Errorf("chain has %d links, can not log %d", len(ch.Links), n)
+	}
+	d := sha256.Sum256(ch.Links[n-1].Reply)
+	return d[:], nil
+}
+
+// Upload submits ch to the log and returns the created entry. It does not
+// modify ch.
+func (c *Client) Upload(ctx context.Context, ch *roughtime.Chain) (*config.TransparencyEntry, error) {
+	digest, err := Digest(ch, len(ch.Links))
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	e := proposedEntry{APIVersion: "0.0.1", Kind: "hashedrekord"}
+	e.Spec.Data.Hash.Algorithm = "sha256"
+	e.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	e.Spec.Signature.Content = sig
+	e.Spec.Signature.PublicKey.Content = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url()+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	uuid, le, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBody(le, digest); err != nil {
+		return nil, err
+	}
+	return &config.TransparencyEntry{
+		URL:            c.url(),
+		UUID:           uuid,
+		LogIndex:       le.LogIndex,
+		IntegratedTime: le.IntegratedTime,
+		Links:          len(ch.Links),
+	}, nil
+}
+
+// Verify checks that e is an entry in the log for ch.
+func (c *Client) Verify(ctx context.Context, ch *roughtime.Chain, e *config.TransparencyEntry) error {
+	digest, err := Digest(ch, e.Links)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url()+"/api/v1/log/entries/"+url.PathEscape(e.UUID), nil)
+	if err != nil {
+		return err
+	}
+	_, le, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if le.LogIndex != e.LogIndex || le.IntegratedTime != e.IntegratedTime {
+		return fmt.Errorf("rekor: entry %s has index %d and time %d, chain records %d and %d", e.UUID, le.LogIndex, le.IntegratedTime, e.LogIndex, e.IntegratedTime)
+	}
+	return checkBody(le, digest)
+}
+
+// do sends req and decodes the single log entry returned.
+func (c *Client) do(req *http.Request, want int) (string, *logEntry, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode != want {
+		return "", nil, fmt.Errorf("rekor: %s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(b))
+	}
+	var entries map[string]*logEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return "", nil, fmt.Errorf("rekor: invalid response: %w", err)
+	}
+	if len(entries) != 1 {
+		return "", nil, fmt.Errorf("rekor: response contains %d entries, want 1", len(entries))
+	}
+	for uuid, e := range entries {
+		if e == nil {
+			break
+		}
+		return uuid, e, nil
+	}
+	return "", nil, errors.New("rekor: invalid response")
+}
+
+// checkBody checks that the body of le logs digest.
+func checkBody(le *logEntry, digest []byte) error {
+	b, err := base64.StdEncoding.DecodeString(le.Body)
+	if err != nil {
+		return fmt.Errorf("rekor: invalid entry body: %w", err)
+	}
+	var e proposedEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return fmt.Errorf("rekor: invalid entry body: %w", err)
+	}
+	if e.Kind != "hashedrekord" || e.Spec.Data.Hash.Algorithm != "sha256" || e.Spec.Data.Hash.Value != hex.EncodeToString(digest) {
+		return errors.New("rekor: entry does not match chain")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rekor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// fakeRekor implements the parts of the Rekor API used by Client.
+type fakeRekor struct {
+	mu      sync.Mutex
+	entries map[string]*logEntry
+}
+
+func (f *fakeRekor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/v1/log/entries":
+		body, _ := io.ReadAll(r.Body)
+		var e proposedEntry
+		if err := json.Unmarshal(body, &e); err != nil || e.Kind != "hashedrekord" {
+			http.Error(w, "invalid entry", http.StatusBadRequest)
+			return
+		}
+		p, _ := pem.Decode(e.Spec.Signature.PublicKey.Content)
+		if p == nil {
+			http.Error(w, "invalid public key", http.StatusBadRequest)
+			return
+		}
+		pub, err := x509.ParsePKIXPublicKey(p.Bytes)
+		if err != nil {
+			http.Error(w, "invalid public key", http.StatusBadRequest)
+			return
+		}
+		digest, _ := hex.DecodeString(e.Spec.Data.Hash.Value)
+		if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest, e.Spec.Signature.Content) {
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+		uuid := fmt.Sprintf("%064x", len(f.entries))
+		le := &logEntry{Body: base64.StdEncoding.EncodeToString(body), IntegratedTime: 1538395200, LogIndex: int64(len(f.entries))}
+		f.entries[uuid] = le
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]*logEntry{uuid: le})
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/v1/log/entries/"):
+		uuid := strings.TrimPrefix(r.URL.Path, "/api/v1/log/entries/")
+		le := f.entries[uuid]
+		if le == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]*logEntry{uuid: le})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRekor(t *testing.T) {
+	srv := httptest.NewServer(&fakeRekor{entries: make(map[string]*logEntry)})
+	defer srv.Close()
+	c := &Client{URL: srv.URL}
+	ctx := context.Background()
+
+	ch := &roughtime.Chain{Chain: config.Chain{Links: []*config.Link{{Reply: []byte("first")}, {Reply: []byte("second")}}}}
+	e, err := c.Upload(ctx, ch)
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	if e.URL != srv.URL || e.UUID == "" || e.Links != 2 || e.IntegratedTime == 0 {
+		t.Errorf("Upload() = %+v, want entry for 2 links", e)
+	}
+	if err := c.Verify(ctx, ch, e); err != nil {
+		t.Errorf("Verify() = %v, want <nil>", err)
+	}
+
+	// Extending the chain does not invalidate the entry.
+	ch.Links = append(ch.Links, &config.Link{Reply: []byte("third")})
+	if err := c.Verify(ctx, ch, e); err != nil {
+		t.Errorf("Verify(extended chain) = %v, want <nil>", err)
+	}
+
+	ch.Links[1].Reply = []byte("tampered")
+	if err := c.Verify(ctx, ch, e); err == nil {
+		t.Error("Verify(tampered chain) succeeded")
+	}
+	if err := c.Verify(ctx, ch, &config.TransparencyEntry{UUID: "missing", Links: 1}); err == nil {
+		t.Error("Verify(missing entry) succeeded")
+	}
+	if _, err := c.Upload(ctx, &roughtime.Chain{}); err == nil {
+		t.Error("Upload(empty chain) succeeded")
+	}
+}
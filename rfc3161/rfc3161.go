@@ -0,0 +1,499 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rfc3161 creates RFC 3161 timestamp tokens from roughtime chains.
+//
+// Unlike a token of a timestamping authority, the signature proves nothing
+// beyond the possession of the key, which is usually local. The time is proven
+// by the roughtime chain the token was created from, which is carried in an
+// extension of the TSTInfo and can be verified independently.
+package rfc3161 // import "github.com/Merovius/notary/rfc3161"
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/Merovius/notary/internal/evidence"
+	"github.com/Merovius/notary/roughtime"
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidEd25519              = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+var (
+	// DefaultPolicy is the TSA policy used if none is given.
+	DefaultPolicy = mustParseOID("2.25.202692887228316084226864067751289410152")
+	// ChainExtension identifies the TSTInfo extension containing the
+	// roughtime chain, in the binary chain format.
+	ChainExtension = mustParseOID("2.25.261836655384616754447200627589526740302")
+)
+
+func mustParseOID(s string) x509.OID {
+	oid, err := x509.ParseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return oid
+}
+
+// A Token is the content of a timestamp token.
+type Token struct {
+	// HashAlgorithm is the algorithm Digest was calculated with. Only
+	// roughtime.SHA256 and roughtime.SHA512 are supported.
+	HashAlgorithm string
+	Digest        []byte
+	SerialNumber  *big.Int
+	// GenTime is the time the digest was timestamped, with the given
+	// accuracy. It is encoded with a precision of one second.
+	GenTime  time.Time
+	Accuracy time.Duration
+	Policy   x509.OID
+	// Chain is the roughtime chain the token was created from, in the
+	// binary chain format.
+	Chain []byte
+	// Certificate is the certificate of the signer. It is set by Parse.
+	Certificate *x509.Certificate
+}
+
+// NewToken returns a token for digest, created from a verified chain. The
+// digest must match the nonce of ch. GenTime is the middle of the time bounds
+// proven by the chain according to rep, rounded to the second, and Accuracy is
+// large enough to cover the bounds.
+func NewToken(ch *roughtime.Chain, rep *roughtime.Report, digest []byte) (*Token, error) {
+	ev, err := evidence.New(ch, rep, digest)
+	if err != nil {
+		return nil, err
+	}
+	mid := ev.Earliest.Add(ev.Latest.Sub(ev.Earliest) / 2)
+	t := mid.Round(time.Second)
+	acc := ev.Latest.Sub(mid)
+	if d := mid.Sub(t).Abs(); d > 0 {
+		acc += d
+	}
+	return &Token{
+		HashAlgorithm: ev.HashAlgorithm,
+		Digest:        ev.Digest,
+		GenTime:       t,
+		Accuracy:      acc,
+		Chain:         ev.Chain,
+	}, nil
+}
+
+// A Signer creates timestamp tokens.
+type Signer struct {
+	// Key is used to sign tokens. It must be an ECDSA, RSA or Ed25519 key.
+	Key crypto.Signer
+	// Certificate is the certificate of Key. It should have the
+	// timeStamping extended key usage.
+	Certificate *x509.Certificate
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type messageImprint struct {
+	HashAlgorithm algorithmIdentifier
+	HashedMessage []byte
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type extension struct {
+	ID       asn1.RawValue
+	Critical bool `asn1:"optional"`
+	Value    []byte
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.RawValue
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     []extension   `asn1:"optional,tag:1"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+// Sign returns a DER-encoded TimeStampToken for t, signed by s. If
+// t.SerialNumber is nil, a random serial number is used. If t.Policy is the
+// zero value, DefaultPolicy is used.
+func (s *Signer) Sign(t *Token) ([]byte, error) {
+	imprintAlg, err := hashOID(t.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	serial := t.SerialNumber
+	if serial == nil {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		serial = new(big.Int).SetBytes(b)
+	}
+	policy := t.Policy
+	if policy.Equal(x509.OID{}) {
+		policy = DefaultPolicy
+	}
+	info := tstInfo{
+		Version:        1,
+		Policy:         oidValue(policy),
+		MessageImprint: messageImprint{algorithmIdentifier{Algorithm: imprintAlg}, t.Digest},
+		SerialNumber:   serial,
+		GenTime:        t.GenTime.UTC(),
+		Accuracy:       encodeAccuracy(t.Accuracy),
+	}
+	if t.Chain != nil {
+		info.Extensions = []extension{{ID: oidValue(ChainExtension), Value: t.Chain}}
+	}
+	content, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlg, sigAlg, hash, err := s.algorithms()
+	if err != nil {
+		return nil, err
+	}
+	certHash := sha256.Sum256(s.Certificate.Raw)
+	signingCert, err := asn1.Marshal(struct{ Certs []essCertIDv2 }{[]essCertIDv2{{certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+	contentDigest := digest(hash, content)
+	attrs, err := marshalAttributes([]attribute{
+		{oidContentType, set(mustMarshal(oidTSTInfo))},
+		{oidMessageDigest, set(mustMarshal(contentDigest))},
+		{oidSigningCertificateV2, set(signingCert)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed := mustMarshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	var sig []byte
+	if _, ok := s.Key.Public().(ed25519.PublicKey); ok {
+		sig, err = s.Key.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		sig, err = s.Key.Sign(rand.Reader, digest(hash, signed), hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []algorithmIdentifier{digestAlg},
+		EncapContentInfo: encapContentInfo{oidTSTInfo, content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.Certificate.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                issuerAndSerial{asn1.RawValue{FullBytes: s.Certificate.RawIssuer}, s.Certificate.SerialNumber},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: sigAlg,
+			Signature:          sig,
+		}},
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// algorithms returns the digest and signature algorithms used for the key of s.
+func (s *Signer) algorithms() (digestAlg, sigAlg algorithmIdentifier, hash crypto.Hash, err error) {
+	switch s.Key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidSHA256}, algorithmIdentifier{Algorithm: oidECDSAWithSHA256}, crypto.SHA256, nil
+	case *rsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidSHA256}, algorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, crypto.SHA256, nil
+	case ed25519.PublicKey:
+		// RFC 8419 requires SHA-512 for the message digest.
+		return algorithmIdentifier{Algorithm: oidSHA512}, algorithmIdentifier{Algorithm: oidEd25519}, crypto.SHA512, nil
+	default:
+		return digestAlg, sigAlg, 0, fmt.Errorf("unsupported key type %T", s.Key.Public())
+	}
+}
+
+// Parse parses a DER-encoded TimeStampToken and verifies its signature, using
+// the certificate contained in it. The caller is responsible for deciding
+// whether to trust that certificate.
+func Parse(der []byte) (*Token, error) {
+	var ci contentInfo
+	if err := unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("token is not signed data")
+	}
+	var sd signedData
+	if err := unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		return nil, errors.New("token is not a TSTInfo with a single signer")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	si := sd.SignerInfos[0]
+	var cert *x509.Certificate
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.Serial) == 0 {
+			cert = c
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("token does not contain the signer certificate")
+	}
+	if err := verifySignerInfo(si, cert, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+
+	var info tstInfo
+	if err := unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, err
+	}
+	t := &Token{
+		Digest:       info.MessageImprint.HashedMessage,
+		SerialNumber: info.SerialNumber,
+		GenTime:      info.GenTime,
+		Accuracy:     decodeAccuracy(info.Accuracy),
+		Certificate:  cert,
+	}
+	switch alg := info.MessageImprint.HashAlgorithm.Algorithm; {
+	case alg.Equal(oidSHA256):
+		t.HashAlgorithm = roughtime.SHA256
+	case alg.Equal(oidSHA512):
+		t.HashAlgorithm = roughtime.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %v", alg)
+	}
+	if info.Policy.Class != asn1.ClassUniversal || info.Policy.Tag != asn1.TagOID {
+		return nil, errors.New("invalid TSA policy")
+	}
+	if err := t.Policy.UnmarshalBinary(info.Policy.Bytes); err != nil {
+		return nil, err
+	}
+	chainID := oidValue(ChainExtension)
+	for _, e := range info.Extensions {
+		if bytes.Equal(e.ID.Bytes, chainID.Bytes) {
+			t.Chain = e.Value
+		} else if e.Critical {
+			return nil, errors.New("unknown critical extension")
+		}
+	}
+	return t, nil
+}
+
+// verifySignerInfo verifies that si is a valid signature of content by cert.
+func verifySignerInfo(si signerInfo, cert *x509.Certificate, content []byte) error {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attrs, "set,tag:0"); err != nil {
+		return err
+	}
+	var hash crypto.Hash
+	switch alg := si.DigestAlgorithm.Algorithm; {
+	case alg.Equal(oidSHA256):
+		hash = crypto.SHA256
+	case alg.Equal(oidSHA512):
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported digest algorithm %v", alg)
+	}
+	var found bool
+	for _, a := range attrs {
+		if !a.Type.Equal(oidMessageDigest) {
+			continue
+		}
+		var d []byte
+		if err := unmarshal(a.Values.Bytes, &d); err != nil {
+			return err
+		}
+		if !bytes.Equal(d, digest(hash, content)) {
+			return errors.New("message digest does not match TSTInfo")
+		}
+		found = true
+	}
+	if !found {
+		return errors.New("missing message digest attribute")
+	}
+	var algo x509.SignatureAlgorithm
+	switch alg := si.SignatureAlgorithm.Algorithm; {
+	case alg.Equal(oidECDSAWithSHA256):
+		algo = x509.ECDSAWithSHA256
+	case alg.Equal(oidSHA256WithRSA):
+		algo = x509.SHA256WithRSA
+	case alg.Equal(oidEd25519):
+		algo = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported signature algorithm %v", alg)
+	}
+	signed := mustMarshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	return cert.CheckSignature(algo, signed, si.Signature)
+}
+
+func hashOID(alg string) (asn1.ObjectIdentifier, error) {
+	switch alg {
+	case "", roughtime.SHA512:
+		return oidSHA512, nil
+	case roughtime.SHA256:
+		return oidSHA256, nil
+	default:
+		return nil, fmt.Errorf("hash algorithm %q is not supported in timestamp tokens", alg)
+	}
+}
+
+func encodeAccuracy(d time.Duration) accuracy {
+	// Round up, to not claim more accuracy than we have.
+	d = (d + time.Microsecond - 1).Truncate(time.Microsecond)
+	return accuracy{
+		Seconds: int(d / time.Second),
+		Millis:  int(d % time.Second / time.Millisecond),
+		Micros:  int(d % time.Millisecond / time.Microsecond),
+	}
+}
+
+func decodeAccuracy(a accuracy) time.Duration {
+	return time.Duration(a.Seconds)*time.Second + time.Duration(a.Millis)*time.Millisecond + time.Duration(a.Micros)*time.Microsecond
+}
+
+// marshalAttributes returns the contents of a DER-encoded SET OF attributes,
+// which must be sorted by their encoding.
+func marshalAttributes(attrs []attribute) ([]byte, error) {
+	var enc [][]byte
+	for _, a := range attrs {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, b)
+	}
+	slices.SortFunc(enc, bytes.Compare)
+	return bytes.Join(enc, nil), nil
+}
+
+// set returns a SET containing the DER-encoded value b.
+func set(b []byte) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b}
+}
+
+// oidValue encodes an OID, which may have arcs that do not fit into an
+// asn1.ObjectIdentifier.
+func oidValue(oid x509.OID) asn1.RawValue {
+	b, _ := oid.MarshalBinary()
+	return asn1.RawValue{Tag: asn1.TagOID, Bytes: b}
+}
+
+func mustMarshal(v any) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func digest(h crypto.Hash, b []byte) []byte {
+	d := h.New()
+	d.Write(b)
+	return d.Sum(nil)
+}
+
+// unmarshal is like asn1.Unmarshal, but fails on trailing data.
+func unmarshal(b []byte, v any) error {
+	rest, err := asn1.Unmarshal(b, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing data after ASN.1 value")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rfc3161
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func testSigner(t *testing.T, key crypto.Signer) *Signer {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "notary test TSA"},
+		NotBefore:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2038, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Signer{Key: key, Certificate: cert}
+}
+
+func TestSign(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	tok := &Token{
+		HashAlgorithm: roughtime.SHA256,
+		Digest:        digest[:],
+		SerialNumber:  big.NewInt(1234),
+		GenTime:       time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+		Accuracy:      1500*time.Millisecond + 3*time.Microsecond,
+		Chain:         []byte("notary\x00\x01chain"),
+	}
+	for _, key := range []crypto.Signer{ecKey, rsaKey, edKey} {
+		s := testSigner(t, key)
+		der, err := s.Sign(tok)
+		if err != nil {
+			t.Fatalf("Sign(%T) = %v", key, err)
+		}
+		got, err := Parse(der)
+		if err != nil {
+			t.Fatalf("Parse(Sign(%T)) = %v", key, err)
+		}
+		if got.HashAlgorithm != tok.HashAlgorithm || !bytes.Equal(got.Digest, tok.Digest) || got.SerialNumber.Cmp(tok.SerialNumber) != 0 || !got.GenTime.Equal(tok.GenTime) || got.Accuracy != tok.Accuracy || !got.Policy.Equal(DefaultPolicy) || !bytes.Equal(got.Chain, tok.Chain) || !got.Certificate.Equal(s.Certificate) {
+			t.Errorf("Parse(Sign(%T)) = %+v, want %+v", key, got, tok)
+		}
+
+		i := bytes.Index(der, tok.Digest)
+		der[i] ^= 1
+		if _, err := Parse(der); err == nil {
+			t.Errorf("Parse(tampered token signed by %T) succeeded", key)
+		}
+	}
+
+	if _, err := testSigner(t, ecKey).Sign(&Token{HashAlgorithm: roughtime.BLAKE2b, Digest: make([]byte, 64)}); err == nil {
+		t.Error("Sign(blake2b token) succeeded")
+	}
+}
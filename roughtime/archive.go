@@ -0,0 +1,65 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// LoadKeyArchive loads a key archive from the file name and validates it.
+func LoadKeyArchive(name string) (*config.KeyArchive, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	a := new(config.KeyArchive)
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := a.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return a, nil
+}
+
+// archivedKeys returns the entries of c.KeyArchive for key.
+func (c *Client) archivedKeys(key []byte) []*config.ArchivedKey {
+	if c.KeyArchive == nil {
+		return nil
+	}
+	var keys []*config.ArchivedKey
+	for _, k := range c.KeyArchive.Keys {
+		if k != nil && string(k.PublicKey) == string(key) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// checkArchived returns an error, unless one of keys was in use at t.
+func checkArchived(keys []*config.ArchivedKey, t time.Time) error {
+	for _, k := range keys {
+		from, until := k.Period()
+		if (from.IsZero() || !t.Before(from)) && !t.After(until) {
+			return nil
+		}
+	}
+	return fmt.Errorf("archived key of %s was not in use at %v", keys[0].Name, t)
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// Attest requests a single response for nonce, without building a chain. The
+// usable servers in s are tried in order and the verified response of the
+// first one that succeeds is returned. alg and nonce are as for NewChain.
+//
+// An attestation only proves what a single server claims, so it should only
+// be used if that server is trusted.
+func Attest(s *config.ServersJSON, alg string, nonce []byte) (*config.Attestation, LinkResult, error) {
+	return defaultClient.Attest(s, alg, nonce)
+}
+
+// Attest is like the package-level Attest, but uses c.
+func (c *Client) Attest(s *config.ServersJSON, alg string, nonce []byte) (*config.Attestation, LinkResult, error) {
+	nonce, err := ensureNonce(nonce)
+	if err != nil {
+		return nil, LinkResult{}, err
+	}
+	servers := c.usableServers(s.Servers, time.Now())
+	if len(servers) == 0 {
+		return nil, LinkResult{}, errors.New("no usable servers")
+	}
+	a := &config.Attestation{Nonce: nonce}
+	if alg != SHA512 {
+		a.HashAlgorithm = alg
+	}
+	for _, s := range servers {
+		if len(s.Addresses) == 0 {
+			err = fmt.Errorf("server %q has no addresses", s.Name)
+			continue
+		}
+		var res *Result
+		res, err = c.queryServer(s, nonce)
+		if err != nil {
+			c.logger().Warn("server failed", "server", s.Name, "error", err)
+			c.progress(Event{Type: EventSkipped, Server: s.Name, Err: err})
+			continue
+		}
+		a.PublicKeyType, a.ServerPublicKey, a.Reply = s.PublicKeyType, s.PublicKey, res.Reply
+		return a, res.linkResult(), nil
+	}
+	return nil, LinkResult{}, err
+}
+
+// VerifyAttestation verifies a against the list of servers. The server must be
+// in the list or the KeyArchive of the Client, unless the Client has
+// AllowUnknownKeys set.
+func VerifyAttestation(a *config.Attestation, s *config.ServersJSON) (LinkResult, error) {
+	return defaultClient.VerifyAttestation(a, s)
+}
+
+// VerifyAttestation is like the package-level VerifyAttestation, but uses c.
+func (c *Client) VerifyAttestation(a *config.Attestation, s *config.ServersJSON) (LinkResult, error) {
+	var (
+		res      LinkResult
+		known    bool
+		archived []*config.ArchivedKey
+	)
+	for _, s := range s.Servers {
+		if string(s.PublicKey) == string(a.ServerPublicKey) {
+			res.Server, known = s.Name, true
+		}
+	}
+	if !known {
+		archived = c.archivedKeys(a.ServerPublicKey)
+	}
+	switch {
+	case known:
+	case archived != nil:
+		res.Server = archived[0].Name
+	case c.TrustUnknownKey != nil:
+	case !c.AllowUnknownKeys:
+		return res, &VerifyError{fmt.Errorf("unknown server key %x", a.ServerPublicKey)}
+	default:
+		c.logger().Warn("attestation relies on unknown server", "publicKey", fmt.Sprintf("%x", a.ServerPublicKey))
+	}
+	if len(a.Nonce) != 64 {
+		return res, &VerifyError{errors.New("invalid nonce length")}
+	}
+	var err error
+	res.Interval, err = c.ParseResponse(a.Reply, a.Nonce, a.ServerPublicKey)
+	if err != nil {
+		return LinkResult{}, err
+	}
+	if archived != nil {
+		if err := checkArchived(archived, res.Midpoint); err != nil {
+			return LinkResult{}, &VerifyError{err}
+		}
+	}
+	if !known && archived == nil && c.TrustUnknownKey != nil {
+		if err := c.TrustUnknownKey("", a.ServerPublicKey); err != nil {
+			return LinkResult{}, &VerifyError{err}
+		}
+	}
+	return res, nil
+}
+
+// SaveAttestation writes a to w, in the format read by LoadAttestation.
+func SaveAttestation(w io.Writer, a *config.Attestation) error {
+	return json.NewEncoder(w).Encode(a)
+}
+
+// LoadAttestation loads a serialized attestation from r.
+func LoadAttestation(r io.Reader) (*config.Attestation, error) {
+	a := new(config.Attestation)
+	if err := json.NewDecoder(r).Decode(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
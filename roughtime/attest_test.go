@@ -0,0 +1,61 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestAttest(t *testing.T) {
+	a := newTestServer("a")
+	dead, cfg := newTestServer("dead").config(), a.config()
+	dead.Addresses[0].Address = serveUDP(t, nil)
+	cfg.Addresses[0].Address = serveUDP(t, a)
+	list := &config.ServersJSON{Servers: []*config.Server{dead, cfg}}
+	nonce := bytes.Repeat([]byte{1}, 64)
+
+	c := &Client{Timeout: 100 * time.Millisecond}
+	att, res, err := c.Attest(list, SHA256, nonce)
+	if err != nil || res.Server != "a" || !res.Midpoint.Equal(a.midpoint) {
+		t.Fatalf("Attest() = %+v, %v, want result for a", res, err)
+	}
+	buf := new(bytes.Buffer)
+	if err := SaveAttestation(buf, att); err != nil {
+		t.Fatal(err)
+	}
+	if att, err = LoadAttestation(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(att.Nonce, nonce) || att.HashAlgorithm != SHA256 {
+		t.Errorf("LoadAttestation(SaveAttestation()) = %x, %q, want %x, %q", att.Nonce, att.HashAlgorithm, nonce, SHA256)
+	}
+	if res, err := VerifyAttestation(att, list); err != nil || res.Server != "a" || res.Radius != a.radius {
+		t.Errorf("VerifyAttestation() = %+v, %v, want result for a", res, err)
+	}
+
+	var verr *VerifyError
+	if _, err := VerifyAttestation(att, &config.ServersJSON{Servers: []*config.Server{dead}}); !errors.As(err, &verr) {
+		t.Errorf("VerifyAttestation(unknown server) = %v, want *VerifyError", err)
+	}
+	att.Nonce = bytes.Repeat([]byte{2}, 64)
+	if _, err := VerifyAttestation(att, list); !errors.As(err, &verr) {
+		t.Errorf("VerifyAttestation(wrong nonce) = %v, want *VerifyError", err)
+	}
+}
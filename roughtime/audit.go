@@ -0,0 +1,92 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Merovius/notary/wire"
+)
+
+// A LinkAudit contains the values used to verify the response of a link, so
+// that they can be checked by hand.
+type LinkAudit struct {
+	// Nonce is the nonce of the request, derived from the previous link or,
+	// for the first link, from the notarized data.
+	Nonce []byte
+	// Leaf is the hash of Nonce, the leaf of the Merkle tree.
+	Leaf []byte
+	// Index is the position of Leaf in the Merkle tree and PathLength the
+	// number of hashes in the path from it to the root.
+	Index      uint32
+	PathLength int
+	// Root is the Merkle root reconstructed from Leaf and the path and
+	// SignedRoot the root signed by the server. They must be equal.
+	Root       []byte
+	SignedRoot []byte
+	// Delegation is the validity period of DelegatedKey, which is signed by
+	// ServerKey and signs the response.
+	Delegation
+	ServerKey    ed25519.PublicKey
+	DelegatedKey ed25519.PublicKey
+	// Version is the protocol version announced by the server, or 0.
+	Version uint32
+}
+
+// RootMatches returns whether the reconstructed root equals the signed root.
+func (a *LinkAudit) RootMatches() bool {
+	return string(a.Root) == string(a.SignedRoot)
+}
+
+// AuditChain returns the values used to verify each link of c. It only decodes
+// the links; it does not check signatures or the Merkle roots, which is left
+// to VerifyChain.
+func AuditChain(c *Chain) ([]*LinkAudit, error) {
+	audits := make([]*LinkAudit, len(c.Links))
+	for i, l := range c.Links {
+		var res response
+		if err := wire.Decode(l.Reply, res.decode); err != nil {
+			return nil, fmt.Errorf("link %d: %w", i, err)
+		}
+		nonce := l.NonceOrBlind
+		if i > 0 {
+			nonce = hash512(hash512(c.Links[i-1].Reply), l.NonceOrBlind)
+		}
+		leaf, root := hashLeaf(nonce), res.merkleRoot(nonce)
+		audits[i] = &LinkAudit{
+			Nonce:        nonce,
+			Leaf:         leaf[:],
+			Index:        res.index,
+			PathLength:   len(res.path) / 64,
+			Root:         root[:],
+			SignedRoot:   res.root[:],
+			Delegation:   Delegation{res.certificate.min, res.certificate.max},
+			ServerKey:    l.ServerPublicKey,
+			DelegatedKey: res.certificate.delegation.publicKey[:],
+			Version:      res.version,
+		}
+	}
+	return audits, nil
+}
+
+// Fingerprint returns the fingerprint of a public key, as used in audit
+// output: the hex-encoded SHA-256 hash of the key, prefixed with "sha256:".
+func Fingerprint(key ed25519.PublicKey) string {
+	h := sha256.Sum256(key)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestAuditChain(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{a, b} {
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		list.Servers = append(list.Servers, cfg)
+	}
+	ch, _, err := BuildChain(list, SHA512, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audits, err := AuditChain(ch)
+	if err != nil {
+		t.Fatalf("AuditChain() = %v", err)
+	}
+	if len(audits) != 2 {
+		t.Fatalf("AuditChain() returned %d audits, want 2", len(audits))
+	}
+	for i, a := range audits {
+		if !a.RootMatches() {
+			t.Errorf("link %d: root %x does not match signed root %x", i, a.Root, a.SignedRoot)
+		}
+		if !bytes.Equal(a.ServerKey, list.Servers[i].PublicKey) {
+			t.Errorf("link %d: ServerKey = %x, want %x", i, a.ServerKey, list.Servers[i].PublicKey)
+		}
+		if len(a.DelegatedKey) != 32 || !a.NotBefore.Before(a.NotAfter) {
+			t.Errorf("link %d: invalid delegation %x from %v to %v", i, a.DelegatedKey, a.NotBefore, a.NotAfter)
+		}
+	}
+	if !bytes.Equal(audits[0].Nonce, ch.Nonce()) {
+		t.Errorf("first nonce = %x, want %x", audits[0].Nonce, ch.Nonce())
+	}
+
+	ch.Links[1].NonceOrBlind = make([]byte, 64)
+	if audits, err = AuditChain(ch); err != nil {
+		t.Fatalf("AuditChain(modified blind) = %v", err)
+	}
+	if !audits[0].RootMatches() || audits[1].RootMatches() {
+		t.Errorf("AuditChain(modified blind): roots match = %v, %v, want true, false", audits[0].RootMatches(), audits[1].RootMatches())
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	const want = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := Fingerprint(nil); got != want {
+		t.Errorf("Fingerprint(nil) = %q, want %q", got, want)
+	}
+}
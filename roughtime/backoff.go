@@ -0,0 +1,135 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultBackoffBase and DefaultBackoffMax are the cool-downs used by a
+// Backoff with no Base or Max set.
+const (
+	DefaultBackoffBase = 10 * time.Second
+	DefaultBackoffMax  = time.Hour
+)
+
+// ErrBackoff is returned, wrapped in a *NetError, for servers that are not
+// queried because they are cooling down, see Backoff.
+var ErrBackoff = errors.New("server is cooling down after failed queries")
+
+// A Backoff makes clients pause querying servers that did not respond. Public
+// servers silently drop requests of clients they rate-limit, so every query
+// that timed out starts a cool-down for the address of the server, which
+// doubles with every further consecutive timeout, up to Max. A response ends
+// the cool-down. Queries during a cool-down fail with ErrBackoff, without
+// sending anything.
+//
+// A Backoff can be shared by all clients of a process, so that none of them
+// hammers a struggling server. Its methods are safe for concurrent use.
+type Backoff struct {
+	// Base is the cool-down after the first timeout. If zero,
+	// DefaultBackoffBase is used.
+	Base time.Duration
+	// Max is the longest cool-down. If zero, DefaultBackoffMax is used.
+	Max time.Duration
+
+	mu      sync.Mutex
+	servers map[string]*BackoffState
+}
+
+// BackoffState is the state of a server tracked by a Backoff.
+type BackoffState struct {
+	Address string
+	// Failures is the number of consecutive queries that timed out.
+	Failures int
+	// Until is the end of the cool-down.
+	Until time.Time
+}
+
+// State returns the servers that are cooling down or did so recently, ordered
+// by address.
+func (b *Backoff) State() []BackoffState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var st []BackoffState
+	for _, s := range b.servers {
+		st = append(st, *s)
+	}
+	slices.SortFunc(st, func(a, b BackoffState) int { return cmp.Compare(a.Address, b.Address) })
+	return st
+}
+
+// check returns an error wrapping ErrBackoff if address is cooling down.
+func (b *Backoff) check(address string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.servers[address]; s != nil && time.Now().Before(s.Until) {
+		return fmt.Errorf("%w until %v", ErrBackoff, s.Until.Format(time.TimeOnly))
+	}
+	return nil
+}
+
+// record updates the state of address after a query that failed with err. It
+// returns the end of a new cool-down, if one was started.
+func (b *Backoff) record(address string, err error) (until time.Time, ok bool) {
+	if errors.Is(err, ErrBackoff) {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !isLost(err) {
+		// Any response, even an invalid one, means the server is not
+		// rate-limiting us.
+		delete(b.servers, address)
+		return time.Time{}, false
+	}
+	if b.servers == nil {
+		b.servers = make(map[string]*BackoffState)
+	}
+	s := b.servers[address]
+	if s == nil {
+		s = &BackoffState{Address: address}
+		b.servers[address] = s
+	}
+	s.Failures++
+	s.Until = time.Now().Add(b.cooldown(s.Failures))
+	return s.Until, true
+}
+
+// cooldown returns the cool-down after n consecutive failures.
+func (b *Backoff) cooldown(n int) time.Duration {
+	d, limit := cmp.Or(b.Base, DefaultBackoffBase), cmp.Or(b.Max, DefaultBackoffMax)
+	for ; n > 1 && d < limit; n-- {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// checkBackoff returns a *NetError if s is cooling down in c.Backoff.
+func (c *Client) checkBackoff(s *Server) error {
+	if c.Backoff == nil {
+		return nil
+	}
+	if err := c.Backoff.check(s.Address); err != nil {
+		c.logger().Debug("not querying server", "address", s.Address, "error", err)
+		return &NetError{s.Address, err}
+	}
+	return nil
+}
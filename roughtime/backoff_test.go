@@ -0,0 +1,57 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	ts := newTestServer("test")
+	dead := &Server{Name: "dead", Address: serveUDP(t, nil), PublicKey: ts.publicKey()}
+	alive := &Server{Name: "alive", Address: serveUDP(t, ts), PublicKey: ts.publicKey()}
+	b := &Backoff{Base: time.Minute}
+	c := &Client{Timeout: 50 * time.Millisecond, MaxRadius: -1, Backoff: b}
+
+	if _, err := c.FetchRoughtime(dead, nil); err == nil || errors.Is(err, ErrBackoff) {
+		t.Fatalf("FetchRoughtime(dead) = %v, want timeout", err)
+	}
+	var nerr *NetError
+	if _, err := c.FetchRoughtime(dead, nil); !errors.Is(err, ErrBackoff) || !errors.As(err, &nerr) {
+		t.Fatalf("FetchRoughtime(dead) during cool-down = %v, want *NetError wrapping ErrBackoff", err)
+	}
+	res := c.Query([]*Server{dead, alive})
+	if !errors.Is(res[0].Err, ErrBackoff) || res[1].Err != nil {
+		t.Errorf("Query(dead, alive) = %v, %v, want ErrBackoff, nil", res[0].Err, res[1].Err)
+	}
+	st := b.State()
+	if len(st) != 1 || st[0].Address != dead.Address || st[0].Failures != 1 || time.Until(st[0].Until) < 50*time.Second {
+		t.Errorf("State() = %+v, want one failure of %s with a one minute cool-down", st, dead.Address)
+	}
+
+	// A response ends the cool-down.
+	b.record(dead.Address, nil)
+	if st := b.State(); len(st) != 0 {
+		t.Errorf("State() after response = %+v, want none", st)
+	}
+
+	for n, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 10: DefaultBackoffMax, 100: DefaultBackoffMax} {
+		if got := b.cooldown(n); got != want {
+			t.Errorf("cooldown(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package batchverify provides a reference implementation of
+// roughtime.BatchVerifier.
+//
+// Verifier checks every signature of a batch with crypto/ed25519, so it is no
+// faster than letting roughtime.Client verify links one by one. It defines the
+// result a batch verifier must give and can be used to test faster
+// implementations, like one combining the signatures into a single multi-scalar
+// multiplication, against it.
+package batchverify // import "github.com/Merovius/notary/roughtime/batchverify"
+
+import (
+	"crypto/ed25519"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// Verifier is a roughtime.BatchVerifier checking signatures individually, on
+// up to GOMAXPROCS goroutines. The zero value is ready to use.
+type Verifier struct{}
+
+var _ roughtime.BatchVerifier = Verifier{}
+
+// VerifyBatch implements roughtime.BatchVerifier. An empty batch is valid.
+func (Verifier) VerifyBatch(sigs []roughtime.SignatureCheck) bool {
+	var (
+		wg     sync.WaitGroup
+		next   atomic.Int64
+		failed atomic.Bool
+	)
+	for range min(runtime.GOMAXPROCS(0), len(sigs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(sigs) && !failed.Load(); i = int(next.Add(1) - 1) {
+				if !Verify(sigs[i]) {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return !failed.Load()
+}
+
+// Verify reports whether the single signature s is valid. Malformed public
+// keys make it invalid, instead of panicking like ed25519.Verify.
+func Verify(s roughtime.SignatureCheck) bool {
+	return len(s.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(s.PublicKey, s.Message, s.Signature)
+}
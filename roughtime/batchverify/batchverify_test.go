@@ -0,0 +1,95 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batchverify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// batch returns n valid signatures of different messages by two keys.
+func batch(t *testing.T, n int) []roughtime.SignatureCheck {
+	t.Helper()
+	var keys []ed25519.PrivateKey
+	for range 2 {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, priv)
+	}
+	var sigs []roughtime.SignatureCheck
+	for i := range n {
+		k := keys[i%len(keys)]
+		msg := fmt.Appendf(nil, "message %d", i)
+		sigs = append(sigs, roughtime.SignatureCheck{
+			PublicKey: k.Public().(ed25519.PublicKey),
+			Message:   msg,
+			Signature: ed25519.Sign(k, msg),
+		})
+	}
+	return sigs
+}
+
+func TestVerifyBatch(t *testing.T) {
+	var v Verifier
+	if !v.VerifyBatch(nil) {
+		t.Error("VerifyBatch(empty) = false, want true")
+	}
+	if sigs := batch(t, 10); !v.VerifyBatch(sigs) {
+		t.Error("VerifyBatch(valid) = false, want true")
+	}
+
+	tcs := []struct {
+		name   string
+		modify func(s *roughtime.SignatureCheck)
+	}{
+		{"tampered signature", func(s *roughtime.SignatureCheck) {
+			s.Signature = bytes.Clone(s.Signature)
+			s.Signature[0] ^= 1
+		}},
+		{"tampered message", func(s *roughtime.SignatureCheck) {
+			s.Message = append(bytes.Clone(s.Message), 0)
+		}},
+		{"short signature", func(s *roughtime.SignatureCheck) {
+			s.Signature = s.Signature[:ed25519.SignatureSize-1]
+		}},
+		{"short key", func(s *roughtime.SignatureCheck) {
+			s.PublicKey = s.PublicKey[:ed25519.PublicKeySize-1]
+		}},
+	}
+	for _, tc := range tcs {
+		// An invalid signature fails the batch at any position.
+		for i := range 10 {
+			sigs := batch(t, 10)
+			tc.modify(&sigs[i])
+			if v.VerifyBatch(sigs) {
+				t.Errorf("VerifyBatch(%s at %d) = true, want false", tc.name, i)
+			}
+		}
+	}
+
+	// Signatures of one key are not valid for the other.
+	sigs := batch(t, 2)
+	sigs[0].PublicKey, sigs[1].PublicKey = sigs[1].PublicKey, sigs[0].PublicKey
+	if v.VerifyBatch(sigs) {
+		t.Error("VerifyBatch(swapped keys) = true, want false")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/Merovius/notary/config"
+)
+
+// The binary chain format is a compact alternative to JSON. It consists of
+// binaryMagic, followed by the fields of the chain. Integers are encoded as
+// uvarints and strings and byte slices are prefixed by their length:
+//
+//	chain        = hashAlgorithm count *link count *skipped [count *transparency]
+//	link         = publicKeyType serverPublicKey nonceOrBlind reply metadata
+//	metadata     = 0x00 / 0x01 serverName address sendTime receiveTime rttMicros
+//	skipped      = name publicKey error
+//	transparency = url uuid logIndex integratedTime links
+//
+// The transparency entries are omitted if there are none, so older chains
+// remain valid.
+var binaryMagic = []byte("notary\x00\x01")
+
+var errInvalidBinaryChain = errors.New("invalid binary chain")
+
+// IsBinaryChain reports whether b starts like a chain in the binary format.
+func IsBinaryChain(b []byte) bool {
+	return bytes.HasPrefix(b, binaryMagic)
+}
+
+// MarshalChainBinary serializes c in a compact binary format, which is read by
+// LoadChain. It is about half the size of the JSON format.
+func MarshalChainBinary(c *Chain) ([]byte, error) {
+	b := append([]byte(nil), binaryMagic...)
+	b = appendString(b, c.HashAlgorithm)
+	b = binary.AppendUvarint(b, uint64(len(c.Links)))
+	for _, l := range c.Links {
+		b = appendString(b, l.PublicKeyType)
+		b = appendString(b, string(l.ServerPublicKey))
+		b = appendString(b, string(l.NonceOrBlind))
+		b = appendString(b, string(l.Reply))
+		if md := l.Metadata; md == nil {
+			b = append(b, 0)
+		} else {
+			b = append(b, 1)
+			b = appendString(b, md.ServerName)
+			b = appendString(b, md.Address)
+			b = appendString(b, md.SendTime)
+			b = appendString(b, md.ReceiveTime)
+			b = binary.AppendVarint(b, md.RTTMicros)
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(c.Skipped)))
+	for _, s := range c.Skipped {
+		b = appendString(b, s.Name)
+		b = appendString(b, string(s.PublicKey))
+		b = appendString(b, s.Error)
+	}
+	if len(c.Transparency) > 0 {
+		b = binary.AppendUvarint(b, uint64(len(c.Transparency)))
+		for _, e := range c.Transparency {
+			b = appendString(b, e.URL)
+			b = appendString(b, e.UUID)
+			b = binary.AppendVarint(b, e.LogIndex)
+			b = binary.AppendVarint(b, e.IntegratedTime)
+			b = binary.AppendUvarint(b, uint64(e.Links))
+		}
+	}
+	return b, nil
+}
+
+// SaveChainBinary writes c to w, in the binary format read by LoadChain.
+func SaveChainBinary(w io.Writer, c *Chain) error {
+	b, err := MarshalChainBinary(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// unmarshalChainBinary decodes a chain in the binary format.
+func unmarshalChainBinary(b []byte) (*Chain, error) {
+	if !IsBinaryChain(b) {
+		return nil, errInvalidBinaryChain
+	}
+	d := &binaryDecoder{b: b[len(binaryMagic):]}
+	c := new(Chain)
+	c.HashAlgorithm = d.string()
+	for n := d.count(); n > 0; n-- {
+		l := &config.Link{
+			PublicKeyType:   d.string(),
+			ServerPublicKey: d.bytes(),
+			NonceOrBlind:    d.bytes(),
+			Reply:           d.bytes(),
+		}
+		switch d.byte() {
+		case 0:
+		case 1:
+			l.Metadata = &config.LinkMetadata{
+				ServerName:  d.string(),
+				Address:     d.string(),
+				SendTime:    d.string(),
+				ReceiveTime: d.string(),
+				RTTMicros:   d.varint(),
+			}
+		default:
+			d.err = errInvalidBinaryChain
+		}
+		c.Links = append(c.Links, l)
+	}
+	for n := d.count(); n > 0; n-- {
+		c.Skipped = append(c.Skipped, &config.SkippedServer{
+			Name:      d.string(),
+			PublicKey: d.bytes(),
+			Error:     d.string(),
+		})
+	}
+	if d.err == nil && len(d.b) > 0 {
+		for n := d.count(); n > 0; n-- {
+			c.Transparency = append(c.Transparency, &config.TransparencyEntry{
+				URL:            d.string(),
+				UUID:           d.string(),
+				LogIndex:       d.varint(),
+				IntegratedTime: d.varint(),
+				Links:          int(d.uvarint()),
+			})
+		}
+		for _, e := range c.Transparency {
+			if e.Links < 1 || e.Links > len(c.Links) {
+				d.err = errInvalidBinaryChain
+			}
+		}
+	}
+	if d.err == nil && len(d.b) > 0 {
+		d.err = errInvalidBinaryChain
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return c, nil
+}
+
+// binaryDecoder decodes the binary chain format. After an error, all methods
+// return zero values and the error is stored in err.
+type binaryDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errInvalidBinaryChain
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errInvalidBinaryChain
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads the number of elements of a list. As every element takes at
+// least one byte, it can not exceed the remaining input.
+func (d *binaryDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = errInvalidBinaryChain
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 {
+		d.err = errInvalidBinaryChain
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *binaryDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.b)) {
+		d.err = errInvalidBinaryChain
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	v := append([]byte(nil), d.b[:n]...)
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.bytes())
+}
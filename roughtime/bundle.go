@@ -0,0 +1,106 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// NewBundle returns a bundle of ch and the entries of the servers in s that
+// signed its links. Links signed by servers not in s have no entry.
+func NewBundle(ch *Chain, s *config.ServersJSON) *config.Bundle {
+	b := &config.Bundle{
+		HashAlgorithm: ch.HashAlgorithm,
+		Chain:         &ch.Chain,
+		Servers:       []*config.Server{},
+		Created:       time.Now().UTC().Format(time.RFC3339),
+	}
+	seen := make(map[string]bool)
+	for _, l := range ch.Links {
+		if seen[string(l.ServerPublicKey)] {
+			continue
+		}
+		for _, srv := range s.Servers {
+			if string(srv.PublicKey) == string(l.ServerPublicKey) {
+				b.Servers = append(b.Servers, srv)
+				seen[string(l.ServerPublicKey)] = true
+				break
+			}
+		}
+	}
+	return b
+}
+
+// VerifyBundle is like VerifyChain, but verifies the chain of a bundle. If s is
+// nil, the chain is verified against the servers in the bundle instead of a
+// current server list. As the bundle is not signed, this only proves anything
+// if the bundle is from a trusted source. The chain of the bundle is returned,
+// to check its nonce.
+func VerifyBundle(b *config.Bundle, s *config.ServersJSON) (*Chain, *Report, error) {
+	return defaultClient.VerifyBundle(b, s)
+}
+
+// VerifyBundle is like the package-level VerifyBundle, but uses c.
+func (c *Client) VerifyBundle(b *config.Bundle, s *config.ServersJSON) (*Chain, *Report, error) {
+	if b.Chain == nil {
+		return nil, nil, errors.New("bundle has no chain")
+	}
+	if b.Chain.HashAlgorithm != b.HashAlgorithm {
+		return nil, nil, &VerifyError{errors.New("hash algorithms of bundle and chain differ")}
+	}
+	if s == nil {
+		s = &config.ServersJSON{Servers: b.Servers}
+	}
+	ch := &Chain{Chain: *b.Chain}
+	rep, err := c.VerifyChain(ch, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, rep, nil
+}
+
+// SaveBundle writes b to w, in the format read by LoadBundle.
+func SaveBundle(w io.Writer, b *config.Bundle) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(b)
+}
+
+// LoadBundle loads a serialized bundle from r.
+func LoadBundle(r io.Reader) (*config.Bundle, error) {
+	b := new(config.Bundle)
+	if err := json.NewDecoder(r).Decode(b); err != nil {
+		return nil, err
+	}
+	if b.Chain == nil {
+		return nil, errors.New("bundle has no chain")
+	}
+	return b, nil
+}
+
+// IsBundle reports whether b looks like a serialized bundle, as opposed to a
+// chain.
+func IsBundle(b []byte) bool {
+	var fields struct {
+		Chain   json.RawMessage `json:"chain"`
+		Servers json.RawMessage `json:"servers"`
+	}
+	return json.Unmarshal(b, &fields) == nil && fields.Chain != nil && fields.Servers != nil
+}
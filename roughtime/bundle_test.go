@@ -0,0 +1,79 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestBundle(t *testing.T) {
+	a, b, c := newTestServer("a"), newTestServer("b"), newTestServer("c")
+	list := &config.ServersJSON{Servers: []*config.Server{c.config(), b.config(), a.config()}}
+	ch := testChain(make([]byte, 64), a, b, a)
+	ch.HashAlgorithm = SHA256
+
+	bundle := NewBundle(ch, list)
+	if len(bundle.Servers) != 2 || bundle.Servers[0].Name != "a" || bundle.Servers[1].Name != "b" || bundle.HashAlgorithm != SHA256 {
+		t.Fatalf("NewBundle() = %+v, want servers a and b", bundle)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := SaveBundle(buf, bundle); err != nil {
+		t.Fatal(err)
+	}
+	if !IsBundle(buf.Bytes()) {
+		t.Errorf("IsBundle(%s) = false, want true", buf)
+	}
+	js, err := MarshalChain(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsBundle(js) {
+		t.Errorf("IsBundle(%s) = true, want false", js)
+	}
+	loaded, err := LoadBundle(buf)
+	if err != nil {
+		t.Fatalf("LoadBundle() = %v", err)
+	}
+
+	got, rep, err := VerifyBundle(loaded, nil)
+	if err != nil {
+		t.Fatalf("VerifyBundle(standalone) = %v, want <nil>", err)
+	}
+	if len(rep.Links) != 3 || !bytes.Equal(got.Nonce(), ch.Nonce()) || got.HashAlgorithm != SHA256 {
+		t.Errorf("VerifyBundle(standalone) = %+v, %+v", got, rep)
+	}
+	if _, _, err := VerifyBundle(loaded, list); err != nil {
+		t.Errorf("VerifyBundle(current list) = %v, want <nil>", err)
+	}
+
+	var verr *VerifyError
+	current := &config.ServersJSON{Servers: []*config.Server{a.config(), c.config()}}
+	if _, _, err := VerifyBundle(loaded, current); !errors.As(err, &verr) {
+		t.Errorf("VerifyBundle(list without b) = %v, want *VerifyError", err)
+	}
+	loaded.Servers[1] = c.config()
+	if _, _, err := VerifyBundle(loaded, nil); !errors.As(err, &verr) {
+		t.Errorf("VerifyBundle(modified snapshot) = %v, want *VerifyError", err)
+	}
+	loaded.HashAlgorithm = SHA512
+	if _, _, err := VerifyBundle(loaded, list); !errors.As(err, &verr) {
+		t.Errorf("VerifyBundle(modified hash algorithm) = %v, want *VerifyError", err)
+	}
+}
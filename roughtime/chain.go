@@ -0,0 +1,674 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// A Chain is a sequence of roughtime responses, each of which provably
+// follows the previous one. The nonce of the first response is derived from
+// the notarized data, so the chain proves that the data existed before the
+// responses were created.
+//
+// The embedded config.Chain contains the serialized links.
+type Chain struct {
+	config.Chain
+
+	// nonce is the nonce of the first link, before any link is appended.
+	nonce []byte
+	// cons is used to check the consistency of appended links. It is nil
+	// for loaded chains, until the first Append.
+	cons *consistency
+}
+
+// NewChain creates an empty chain for the given nonce, which has to be 64
+// bytes long or nil, in which case a random nonce is generated. alg is
+// recorded in the chain and should name the hash algorithm nonce was derived
+// with (see HashNonce).
+func NewChain(alg string, nonce []byte) (*Chain, error) {
+	nonce, err := ensureNonce(nonce)
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{nonce: nonce, cons: new(consistency)}
+	if alg != SHA512 {
+		c.HashAlgorithm = alg
+	}
+	return c, nil
+}
+
+// Nonce returns the nonce of the first link of c, which is derived from the
+// notarized data.
+func (c *Chain) Nonce() []byte {
+	if len(c.Links) > 0 {
+		return c.Links[0].NonceOrBlind
+	}
+	return c.nonce
+}
+
+// Append queries s and appends its response to c.
+func (c *Chain) Append(s *config.Server) (LinkResult, error) {
+	return defaultClient.Append(c, s)
+}
+
+// Verify verifies c against the list of servers. See VerifyChain.
+func (c *Chain) Verify(s *config.ServersJSON) (*Report, error) {
+	return defaultClient.VerifyChain(c, s)
+}
+
+// TimeBounds returns the intersection of the intervals of all links of c (see
+// Report). The servers of the links are not checked against a list of trusted
+// servers, use Verify for that.
+func (c *Chain) TimeBounds() (earliest, latest time.Time, err error) {
+	cl := &Client{AllowUnknownKeys: true, MaxRadius: -1}
+	rep, err := cl.VerifyChain(c, nil)
+	if err != nil {
+		return earliest, latest, err
+	}
+	return rep.Earliest, rep.Latest, nil
+}
+
+// LinkResult describes a verified link of a chain.
+type LinkResult struct {
+	// Server is the name of the server, if known.
+	Server string
+	// Address is the address the server was queried at. For links loaded
+	// from a chain, it is taken from the link metadata, if present.
+	Address string
+	// Interval is the time claimed by the server.
+	Interval
+	// Sent is the local time the request was sent and RTT is the round-trip
+	// time of the query. For links loaded from a chain, they are taken from
+	// the link metadata, if present.
+	Sent time.Time
+	RTT  time.Duration
+}
+
+// Append is like Chain.Append, but uses c. If appending fails, ch is left
+// unmodified.
+func (c *Client) Append(ch *Chain, s *config.Server) (LinkResult, error) {
+	if len(s.Addresses) == 0 {
+		return LinkResult{}, fmt.Errorf("server %q has no addresses", s.Name)
+	}
+	if ch.cons == nil {
+		cons, err := chainConsistency(ch)
+		if err != nil {
+			return LinkResult{}, err
+		}
+		ch.cons = cons
+	}
+
+	i := len(ch.Links)
+	l := &config.Link{
+		PublicKeyType:   s.PublicKeyType,
+		ServerPublicKey: s.PublicKey,
+		NonceOrBlind:    ch.nonce,
+	}
+	nonce := ch.nonce
+	if i > 0 {
+		blind, err := c.blind(ch.Nonce(), i)
+		if err != nil {
+			return LinkResult{}, err
+		}
+		l.NonceOrBlind = blind
+		nonce = hash512(hash512(ch.Links[i-1].Reply), l.NonceOrBlind)
+	} else if len(nonce) != 64 {
+		return LinkResult{}, errors.New("chain has no nonce")
+	}
+
+	log := c.logger().With("server", s.Name, "link", i)
+	r, err := c.queryServer(s, nonce)
+	if err != nil {
+		return LinkResult{}, err
+	}
+	res := r.linkResult()
+	if err := ch.cons.add(s.Name, res.Interval); err != nil {
+		log.Debug("verification failed", "error", err)
+		return LinkResult{}, &VerifyError{err}
+	}
+	log.Debug("verified link", "midpoint", res.Midpoint, "radius", res.Radius)
+	l.Reply = r.Reply
+	l.Metadata = &config.LinkMetadata{
+		ServerName:  s.Name,
+		Address:     res.Address,
+		SendTime:    res.Sent.Format(time.RFC3339Nano),
+		ReceiveTime: res.Sent.Add(res.RTT).Format(time.RFC3339Nano),
+		RTTMicros:   res.RTT.Microseconds(),
+	}
+	ch.Links = append(ch.Links, l)
+	return res, nil
+}
+
+// queryServer is like query, but tries the addresses of s in order, until one
+// of them responds.
+func (c *Client) queryServer(s *config.Server, nonce []byte) (res *Result, err error) {
+	var srv *Server
+	for i, a := range s.Addresses {
+		if i > 0 {
+			c.progress(Event{Type: EventRetry, Server: s.Name, Address: a.Address, Err: err})
+		}
+		srv = &Server{Name: s.Name, Address: a.Address, PublicKey: s.PublicKey}
+		res, err = c.query(srv, nonce)
+		var nerr *NetError
+		if !errors.As(err, &nerr) {
+			break
+		}
+	}
+	if err != nil || !c.DoubleCheck {
+		return res, err
+	}
+	return res, c.doubleCheck(srv, res)
+}
+
+// doubleCheck queries s again with a random nonce and checks that the answer
+// is consistent with res.
+func (c *Client) doubleCheck(s *Server, res *Result) error {
+	nonce, err := ensureNonce(nil)
+	if err != nil {
+		return err
+	}
+	again, err := c.query(s, nonce)
+	if err != nil {
+		return err
+	}
+	if !consistentResults(res, again) {
+		err := &InconsistentServerError{Server: s.Name, First: res.Interval, Second: again.Interval}
+		c.logger().Warn("server gave inconsistent answers", "server", s.Name, "address", s.Address, "first", res.Interval, "second", again.Interval)
+		return &VerifyError{err}
+	}
+	return nil
+}
+
+// consistentResults reports whether b, queried after a from the same server,
+// is consistent with it. The server must have answered b no earlier than a
+// and no later than a plus the local time elapsed from sending a to receiving
+// b.
+func consistentResults(a, b *Result) bool {
+	lo := a.Earliest()
+	hi := a.Latest().Add(b.Sent.Add(b.RTT).Sub(a.Sent))
+	return !b.Latest().Before(lo) && !b.Earliest().After(hi)
+}
+
+// An InconsistentServerError is returned (wrapped in a *VerifyError) if a
+// server gives inconsistent answers to two queries made with
+// Client.DoubleCheck.
+type InconsistentServerError struct {
+	// Server is the name of the server.
+	Server string
+	// First and Second are the intervals claimed in the two answers.
+	First, Second Interval
+}
+
+func (e *InconsistentServerError) Error() string {
+	return fmt.Sprintf("%s gave inconsistent answers %v and %v", serverName(e.Server), e.First, e.Second)
+}
+
+// blind returns the blind for link i of the chain with the given nonce.
+func (c *Client) blind(nonce []byte, i int) ([]byte, error) {
+	if c.BlindSeed != nil {
+		return deriveBlind(c.BlindSeed, nonce, i)
+	}
+	b := make([]byte, 64)
+	_, err := io.ReadFull(rand.Reader, b)
+	return b, err
+}
+
+// deriveBlind derives the blind for link i of a chain with the given nonce
+// from seed, using HKDF-SHA512.
+func deriveBlind(seed, nonce []byte, i int) ([]byte, error) {
+	return hkdf.Key(sha512.New, seed, nonce, fmt.Sprintf("notary blind %d", i), 64)
+}
+
+// RestoreChain reconstructs a chain created with a Client using BlindSeed
+// from the seed, the nonce of the chain and the replies of its links. The
+// server of each reply is looked up in s. alg is as for NewChain. The restored
+// chain is verified.
+func RestoreChain(s *config.ServersJSON, alg string, nonce, seed []byte, replies [][]byte) (*Chain, error) {
+	return defaultClient.RestoreChain(s, alg, nonce, seed, replies)
+}
+
+// RestoreChain is like the package-level RestoreChain, but uses c.
+func (c *Client) RestoreChain(s *config.ServersJSON, alg string, nonce, seed []byte, replies [][]byte) (*Chain, error) {
+	ch, err := NewChain(alg, nonce)
+	if err != nil {
+		return nil, err
+	}
+	n := ch.nonce
+	for i, r := range replies {
+		l := &config.Link{NonceOrBlind: ch.nonce, Reply: r}
+		if i > 0 {
+			if l.NonceOrBlind, err = deriveBlind(seed, ch.nonce, i); err != nil {
+				return nil, err
+			}
+			n = hash512(hash512(replies[i-1]), l.NonceOrBlind)
+		}
+		for _, s := range s.Servers {
+			if _, _, _, err := parseResponse(r, n, s.PublicKey, -1); err == nil {
+				l.PublicKeyType, l.ServerPublicKey = s.PublicKeyType, s.PublicKey
+				break
+			}
+		}
+		if l.ServerPublicKey == nil {
+			return nil, &VerifyError{fmt.Errorf("reply %d: no matching server", i)}
+		}
+		ch.Links = append(ch.Links, l)
+	}
+	if _, err := c.VerifyChain(ch, s); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// chainConsistency returns the consistency state of the links in c.
+func chainConsistency(c *Chain) (*consistency, error) {
+	cl := &Client{AllowUnknownKeys: true, MaxRadius: -1}
+	rep, err := cl.VerifyChain(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	cons := new(consistency)
+	for _, l := range rep.Links {
+		cons.add(l.Server, l.Interval)
+	}
+	return cons, nil
+}
+
+// BuildChain runs a chain of request against a list of servers and returns the
+// resulting chain and the results of the individual links. alg and nonce are
+// as for NewChain. Use SaveChain to serialize the chain.
+func BuildChain(s *config.ServersJSON, alg string, nonce []byte) (*Chain, []LinkResult, error) {
+	return defaultClient.BuildChain(s, alg, nonce)
+}
+
+// BuildChain is like the package-level BuildChain, but uses c.
+func (c *Client) BuildChain(s *config.ServersJSON, alg string, nonce []byte) (*Chain, []LinkResult, error) {
+	ch, err := NewChain(alg, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := c.ExtendChain(ch, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, res, nil
+}
+
+// ExtendChain appends a link for each usable server in s to ch and returns the
+// results of the new links. It can be used to add new timestamps to an
+// existing chain, e.g. to renew it before its servers expire.
+//
+// If the Client has MinLinks set, failing servers are skipped and recorded in
+// ch, as long as at least MinLinks new links are created. On error, ch might
+// already contain some of the new links.
+func ExtendChain(ch *Chain, s *config.ServersJSON) ([]LinkResult, error) {
+	return defaultClient.ExtendChain(ch, s)
+}
+
+// ExtendChain is like the package-level ExtendChain, but uses c.
+func (c *Client) ExtendChain(ch *Chain, s *config.ServersJSON) ([]LinkResult, error) {
+	servers := c.usableServers(s.Servers, time.Now())
+	if len(servers) == 0 {
+		return nil, errors.New("no usable servers")
+	}
+
+	var (
+		lastErr error
+		results []LinkResult
+	)
+	for _, s := range servers {
+		res, err := c.Append(ch, s)
+		if err != nil {
+			var cerr *ConsistencyError
+			if c.MinLinks <= 0 || errors.As(err, &cerr) {
+				return nil, err
+			}
+			lastErr = err
+			c.logger().Warn("skipping server", "server", s.Name, "error", err)
+			c.progress(Event{Type: EventSkipped, Server: s.Name, Err: err})
+			ch.Skipped = append(ch.Skipped, &config.SkippedServer{Name: s.Name, PublicKey: s.PublicKey, Error: err.Error()})
+			continue
+		}
+		results = append(results, res)
+	}
+	if len(results) < c.MinLinks {
+		if lastErr != nil {
+			return nil, fmt.Errorf("only %d of %d servers could be used, need at least %d (last error: %w)", len(results), len(servers), c.MinLinks, lastErr)
+		}
+		return nil, fmt.Errorf("only %d servers available, need at least %d", len(servers), c.MinLinks)
+	}
+	return results, nil
+}
+
+// deprecationWarning is how long before a server's ValidUntil time a warning
+// is logged when using it.
+const deprecationWarning = 30 * 24 * time.Hour
+
+// usableServers returns the servers that are not expired at now, logging
+// warnings for skipped and deprecated servers.
+func (c *Client) usableServers(servers []*config.Server, now time.Time) []*config.Server {
+	var usable []*config.Server
+	for _, s := range servers {
+		log := c.logger().With("server", s.Name)
+		exp := s.Expiry()
+		switch {
+		case !exp.IsZero() && now.After(exp):
+			log.Warn("skipping expired server", "validUntil", exp)
+			continue
+		case !exp.IsZero() && exp.Sub(now) < deprecationWarning:
+			log.Warn("server expires soon", "validUntil", exp)
+		case s.Deprecated:
+			log.Warn("server is deprecated")
+		}
+		usable = append(usable, s)
+	}
+	if c.Order != nil {
+		usable = c.Order(usable)
+	}
+	return usable
+}
+
+// A Report describes a verified chain.
+type Report struct {
+	Links []LinkResult
+	// Earliest and Latest are the intersection of the intervals of all
+	// links, i.e. the time at which the chain was created. As every link
+	// depends on the notarized data, it existed no later than Latest. If the
+	// links were created further apart than their radii, the intersection
+	// is empty and Earliest is after Latest.
+	Earliest, Latest time.Time
+}
+
+// Interval returns the interval from Earliest to Latest. It is empty if the
+// intersection of the links is.
+func (r *Report) Interval() Interval {
+	return Bounds(r.Earliest, r.Latest)
+}
+
+// VerifyChain verifies the given chain against the list of servers and returns
+// a report about it, or any validation error. Every link must be signed by a
+// server in the list, or with a key in the KeyArchive of the Client. If the
+// Client has a Policy, the chain must also satisfy it.
+func VerifyChain(c *Chain, s *config.ServersJSON) (*Report, error) {
+	return defaultClient.VerifyChain(c, s)
+}
+
+// VerifyChain is like the package-level VerifyChain, but uses cl.
+func (cl *Client) VerifyChain(c *Chain, s *config.ServersJSON) (*Report, error) {
+	byKey := make(map[string]*config.Server)
+	if s != nil {
+		for _, s := range s.Servers {
+			byKey[string(s.PublicKey)] = s
+		}
+	}
+
+	// Deriving the nonces is cheap, but sequential. Verifying the responses
+	// is expensive, so it is done in parallel afterwards.
+	now := time.Now()
+	var (
+		names    = make([]string, len(c.Links))
+		logs     = make([]*slog.Logger, len(c.Links))
+		nonces   = make([][]byte, len(c.Links))
+		archived = make([][]*config.ArchivedKey, len(c.Links))
+		unknown  = make([]bool, len(c.Links))
+	)
+	for i, l := range c.Links {
+		log := cl.logger().With("link", i)
+		if s := byKey[string(l.ServerPublicKey)]; s != nil {
+			names[i] = s.Name
+			log = log.With("server", s.Name)
+			if exp := s.Expiry(); s.Deprecated || (!exp.IsZero() && now.After(exp)) {
+				log.Warn("chain relies on deprecated server")
+			}
+		} else if keys := cl.archivedKeys(l.ServerPublicKey); keys != nil {
+			names[i], archived[i] = keys[0].Name, keys
+			log = log.With("server", keys[0].Name)
+			log.Debug("link uses archived key")
+		} else if cl.TrustUnknownKey != nil {
+			unknown[i] = true
+		} else if cl.AllowUnknownKeys {
+			log.Warn("chain relies on unknown server", "publicKey", fmt.Sprintf("%x", l.ServerPublicKey))
+		} else {
+			return nil, &VerifyError{fmt.Errorf("link %d: unknown server key %x", i, l.ServerPublicKey)}
+		}
+		if len(l.NonceOrBlind) != 64 {
+			return nil, &VerifyError{errors.New("invalid nonce length")}
+		}
+		logs[i] = log
+		nonces[i] = l.NonceOrBlind
+		if i > 0 {
+			nonces[i] = hash512(hash512(c.Links[i-1].Reply), l.NonceOrBlind)
+		}
+	}
+
+	results := cl.parseLinks(c.Links, nonces)
+
+	var (
+		cons consistency
+		rep  Report
+	)
+	for i, l := range c.Links {
+		res, log := results[i], logs[i]
+		if res.err != nil {
+			log.Debug("link verification failed", "error", res.err)
+			return nil, res.err
+		}
+		if unknown[i] {
+			if err := cl.trustUnknownKey(l.Metadata, l.ServerPublicKey); err != nil {
+				log.Debug("link verification failed", "error", err)
+				return nil, &VerifyError{fmt.Errorf("link %d: %w", i, err)}
+			}
+		}
+		iv := res.iv
+		if keys := archived[i]; keys != nil {
+			if err := checkArchived(keys, iv.Midpoint); err != nil {
+				log.Debug("link verification failed", "error", err)
+				return nil, &VerifyError{fmt.Errorf("link %d: %w", i, err)}
+			}
+		}
+		log.Debug("verified link", "midpoint", iv.Midpoint, "radius", iv.Radius)
+		if err := cons.add(names[i], iv); err != nil {
+			log.Debug("link verification failed", "error", err)
+			return nil, &VerifyError{err}
+		}
+		lr := LinkResult{Server: names[i], Interval: iv}
+		if md := l.Metadata; md != nil {
+			lr.Address = md.Address
+			lr.Sent, _ = time.Parse(time.RFC3339Nano, md.SendTime)
+			lr.RTT = time.Duration(md.RTTMicros) * time.Microsecond
+		}
+		if cl.VerifyLink != nil {
+			if err := cl.VerifyLink(lr); err != nil {
+				log.Debug("link rejected", "error", err)
+				return nil, &VerifyError{fmt.Errorf("link %d: %w", i, err)}
+			}
+		}
+		rep.Links = append(rep.Links, lr)
+		if lo := iv.Earliest(); i == 0 || lo.After(rep.Earliest) {
+			rep.Earliest = lo
+		}
+		if hi := iv.Latest(); i == 0 || hi.Before(rep.Latest) {
+			rep.Latest = hi
+		}
+	}
+	if cl.Policy != nil {
+		if err := cl.Policy.check(c, &rep, now); err != nil {
+			return nil, &VerifyError{err}
+		}
+	}
+	return &rep, nil
+}
+
+// trustUnknownKey calls cl.TrustUnknownKey with the address in md, if any.
+func (cl *Client) trustUnknownKey(md *config.LinkMetadata, key []byte) error {
+	var address string
+	if md != nil {
+		address = md.Address
+	}
+	return cl.TrustUnknownKey(address, key)
+}
+
+type parseResult struct {
+	iv  Interval
+	err error
+}
+
+// parseLinks parses the replies of links, using cl.BatchVerifier or up to
+// GOMAXPROCS goroutines.
+func (cl *Client) parseLinks(links []*config.Link, nonces [][]byte) []parseResult {
+	if cl.BatchVerifier != nil {
+		if results, ok := cl.parseLinksBatch(links, nonces); ok {
+			return results
+		}
+		cl.logger().Debug("batch verification failed, verifying links one by one")
+	}
+	results := make([]parseResult, len(links))
+	var (
+		wg   sync.WaitGroup
+		next atomic.Int64
+	)
+	for range min(runtime.GOMAXPROCS(0), len(links)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(links); i = int(next.Add(1) - 1) {
+				res := &results[i]
+				res.iv, res.err = cl.ParseResponse(links[i].Reply, nonces[i], links[i].ServerPublicKey)
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// parseLinksBatch parses the replies of links, checking all their signatures
+// with a single call to cl.BatchVerifier. It reports false if the batch
+// failed. Delegations are only cached once the batch verified.
+func (cl *Client) parseLinksBatch(links []*config.Link, nonces [][]byte) ([]parseResult, bool) {
+	cache := cl.delegations.pending()
+	results := make([]parseResult, len(links))
+	sigs := make([]SignatureCheck, 0, 2*len(links))
+	collect := func(pub ed25519.PublicKey, msg, sig []byte) bool {
+		sigs = append(sigs, SignatureCheck{PublicKey: pub, Message: bytes.Clone(msg), Signature: sig})
+		return true
+	}
+	for i, l := range links {
+		iv, _, _, err := parseResponseWith(l.Reply, nonces[i], l.ServerPublicKey, cl.maxRadius(), cache, collect)
+		if err != nil {
+			err = &VerifyError{err}
+		}
+		results[i] = parseResult{iv, err}
+	}
+	if !cl.BatchVerifier.VerifyBatch(sigs) {
+		return nil, false
+	}
+	cache.commit()
+	return results, true
+}
+
+// A ConsistencyError is returned (wrapped in a *VerifyError) if a link of a
+// chain claims a time that is entirely before that of an earlier link. As every
+// request in a chain depends on the previous reply, this means that at least
+// one of the two servers is wrong about the time.
+type ConsistencyError struct {
+	// Earlier and Later are the indices of the inconsistent links.
+	Earlier, Later int
+	// EarlierServer and LaterServer are the names of the servers of the
+	// inconsistent links, if known.
+	EarlierServer, LaterServer string
+}
+
+func (e *ConsistencyError) Error() string {
+	return fmt.Sprintf("link %d (%s) is inconsistent with link %d (%s)", e.Later, serverName(e.LaterServer), e.Earlier, serverName(e.EarlierServer))
+}
+
+func serverName(s string) string {
+	if s == "" {
+		return "unknown server"
+	}
+	return s
+}
+
+// consistency checks that the intervals of a chain are causally ordered.
+type consistency struct {
+	// latest is the index of the link with the latest lower bound so far.
+	latest int
+	lower  time.Time
+	names  []string
+}
+
+// add records the interval of the next link with the given server name. It
+// returns a *ConsistencyError and does not record the link, if the interval
+// ends before the lower bound of an earlier link.
+func (c *consistency) add(name string, iv Interval) error {
+	i := len(c.names)
+	if i > 0 && iv.Latest().Before(c.lower) {
+		return &ConsistencyError{c.latest, i, c.names[c.latest], name}
+	}
+	c.names = append(c.names, name)
+	if lower := iv.Earliest(); i == 0 || lower.After(c.lower) {
+		c.latest, c.lower = i, lower
+	}
+	return nil
+}
+
+// MarshalChain serializes c as JSON, in the format read by LoadChain.
+func MarshalChain(c *Chain) ([]byte, error) {
+	return json.Marshal(&c.Chain)
+}
+
+// SaveChain writes c to w, in the format read by LoadChain.
+func SaveChain(w io.Writer, c *Chain) error {
+	b, err := MarshalChain(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// LoadChain loads a serialized chain from r. It accepts the JSON format written
+// by SaveChain and the binary format written by SaveChainBinary.
+func LoadChain(r io.Reader) (*Chain, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(binaryMagic)); IsBinaryChain(magic) {
+		b, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		return unmarshalChainBinary(b)
+	}
+	c := new(Chain)
+	if err := json.NewDecoder(br).Decode(&c.Chain); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
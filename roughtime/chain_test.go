@@ -0,0 +1,380 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestChain(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	b.midpoint = testEpoch.Add(time.Second)
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{a, b} {
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		list.Servers = append(list.Servers, cfg)
+	}
+	nonce := bytes.Repeat([]byte{42}, 64)
+
+	ch, err := NewChain(SHA256, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ch.Nonce(), nonce) {
+		t.Errorf("Nonce() = %x, want %x", ch.Nonce(), nonce)
+	}
+	if _, err := ch.Append(list.Servers[0]); err != nil {
+		t.Fatalf("Append(a) = %v, want <nil>", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := SaveChain(buf, ch); err != nil {
+		t.Fatal(err)
+	}
+	ch, err = LoadChain(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.HashAlgorithm != SHA256 || !bytes.Equal(ch.Nonce(), nonce) {
+		t.Errorf("LoadChain(SaveChain()) = %q, %x, want %q, %x", ch.HashAlgorithm, ch.Nonce(), SHA256, nonce)
+	}
+	res, err := ch.Append(list.Servers[1])
+	if err != nil || res.Server != "b" || !res.Midpoint.Equal(b.midpoint) {
+		t.Fatalf("Append(b) = %+v, %v, want result for b", res, err)
+	}
+
+	rep, err := ch.Verify(list)
+	if err != nil {
+		t.Fatalf("Verify() = %v, want <nil>", err)
+	}
+	for i, l := range rep.Links {
+		if want := list.Servers[i].Addresses[0].Address; l.Address != want || l.Sent.IsZero() || l.RTT <= 0 {
+			t.Errorf("Verify().Links[%d] = %+v, want metadata for %s", i, l, want)
+		}
+	}
+	lo, hi, err := ch.TimeBounds()
+	if wantLo, wantHi := testEpoch, testEpoch.Add(time.Second); err != nil || !lo.Equal(wantLo) || !hi.Equal(wantHi) {
+		t.Errorf("TimeBounds() = %v, %v, %v, want %v, %v, <nil>", lo, hi, err, wantLo, wantHi)
+	}
+
+	if _, err := new(Chain).Append(list.Servers[0]); err == nil {
+		t.Error("Append() to chain without nonce succeeded")
+	}
+}
+
+func TestExtendChain(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{a, b} {
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		list.Servers = append(list.Servers, cfg)
+	}
+	ch, _, err := BuildChain(list, SHA512, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := ch.Nonce()
+
+	a.setMidpoint(testEpoch.Add(12 * time.Hour))
+	b.setMidpoint(testEpoch.Add(12 * time.Hour))
+	res, err := ExtendChain(ch, list)
+	if err != nil || len(res) != 2 {
+		t.Fatalf("ExtendChain() = %v, %v, want 2 results", res, err)
+	}
+	rep, err := ch.Verify(list)
+	if err != nil {
+		t.Fatalf("Verify(extended chain) = %v, want <nil>", err)
+	}
+	if len(rep.Links) != 4 || !bytes.Equal(ch.Nonce(), nonce) {
+		t.Errorf("extended chain has %d links and nonce %x, want 4 links and nonce %x", len(rep.Links), ch.Nonce(), nonce)
+	}
+}
+
+func TestExtendChainOtherAddresses(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{a, b} {
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		list.Servers = append(list.Servers, cfg)
+	}
+	ch, _, err := BuildChain(list, SHA512, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same servers, answering later at other addresses.
+	later := &config.ServersJSON{}
+	for _, s := range []*testServer{newTestServer("a"), newTestServer("b")} {
+		s.midpoint = testEpoch.Add(12 * time.Hour)
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		later.Servers = append(later.Servers, cfg)
+	}
+	if res, err := ExtendChain(ch, later); err != nil || len(res) != 2 {
+		t.Fatalf("ExtendChain() = %v, %v, want 2 results", res, err)
+	}
+	for _, l := range []*config.ServersJSON{list, later} {
+		if rep, err := ch.Verify(l); err != nil || len(rep.Links) != 4 {
+			t.Errorf("Verify(extended chain) = %v, want 4 links", err)
+		}
+	}
+}
+
+func TestBlindSeed(t *testing.T) {
+	a, b, c := newTestServer("a"), newTestServer("b"), newTestServer("c")
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{a, b, c} {
+		cfg := s.config()
+		cfg.Addresses[0].Address = serveUDP(t, s)
+		list.Servers = append(list.Servers, cfg)
+	}
+	nonce := make([]byte, 64)
+	seed := []byte("super secret seed, chosen by fair dice roll")
+
+	cl := &Client{BlindSeed: seed}
+	ch1, _, err := cl.BuildChain(list, SHA512, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch2, _, err := cl.BuildChain(list, SHA512, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies [][]byte
+	for i := range ch1.Links {
+		if !bytes.Equal(ch1.Links[i].NonceOrBlind, ch2.Links[i].NonceOrBlind) {
+			t.Errorf("link %d has blinds %x and %x, want equal", i, ch1.Links[i].NonceOrBlind, ch2.Links[i].NonceOrBlind)
+		}
+		replies = append(replies, ch1.Links[i].Reply)
+	}
+
+	ch, err := RestoreChain(list, SHA512, nonce, seed, replies)
+	if err != nil {
+		t.Fatalf("RestoreChain() = %v, want <nil>", err)
+	}
+	for i, l := range ch.Links {
+		if want := ch1.Links[i]; !bytes.Equal(l.NonceOrBlind, want.NonceOrBlind) || !bytes.Equal(l.ServerPublicKey, want.ServerPublicKey) {
+			t.Errorf("RestoreChain().Links[%d] = %x, %x, want %x, %x", i, l.ServerPublicKey, l.NonceOrBlind, want.ServerPublicKey, want.NonceOrBlind)
+		}
+	}
+	if _, err := RestoreChain(list, SHA512, nonce, []byte("wrong seed"), replies); err == nil {
+		t.Error("RestoreChain(wrong seed) succeeded")
+	}
+}
+
+func TestBinaryChain(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	ch := testChain(make([]byte, 64), a, b)
+	ch.HashAlgorithm = SHA256
+	ch.Links[1].Metadata = &config.LinkMetadata{ServerName: "b", Address: "b:2002", SendTime: testEpoch.Format(time.RFC3339Nano), RTTMicros: 1234}
+	ch.Skipped = []*config.SkippedServer{{Name: "c", PublicKey: newTestServer("c").publicKey(), Error: "timeout"}}
+
+	bin := new(bytes.Buffer)
+	if err := SaveChainBinary(bin, ch); err != nil {
+		t.Fatal(err)
+	}
+	js, err := MarshalChain(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bin.Len() > len(js)*2/3 {
+		t.Errorf("binary chain has %d bytes, JSON chain %d", bin.Len(), len(js))
+	}
+	got, err := LoadChain(bytes.NewReader(bin.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadChain(binary) = %v, want <nil>", err)
+	}
+	gotJS, err := MarshalChain(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotJS, js) {
+		t.Errorf("LoadChain(binary) = %s, want %s", gotJS, js)
+	}
+
+	data := bin.Bytes()
+	for i := len(binaryMagic); i < len(data); i++ {
+		if _, err := LoadChain(bytes.NewReader(data[:i])); err == nil {
+			t.Fatalf("LoadChain(truncated to %d bytes) succeeded", i)
+		}
+	}
+
+	ch.Transparency = []*config.TransparencyEntry{{URL: "https://rekor.example.com", UUID: "abcd", LogIndex: 42, IntegratedTime: testEpoch.Unix(), Links: 2}}
+	bin.Reset()
+	if err := SaveChainBinary(bin, ch); err != nil {
+		t.Fatal(err)
+	}
+	if js, err = MarshalChain(ch); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = LoadChain(bin); err != nil {
+		t.Fatalf("LoadChain(binary with transparency entries) = %v, want <nil>", err)
+	}
+	if gotJS, _ := MarshalChain(got); !bytes.Equal(gotJS, js) {
+		t.Errorf("LoadChain(binary with transparency entries) = %s, want %s", gotJS, js)
+	}
+}
+
+func TestGoogleChain(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	ch := testChain(make([]byte, 64), a, b)
+	ch.Links[1].Metadata = &config.LinkMetadata{ServerName: "b", Address: "b:2002"}
+	ch.Skipped = []*config.SkippedServer{{Name: "c", Error: "timeout"}}
+
+	b1, err := MarshalChainGoogle(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string][]map[string]any
+	if err := json.Unmarshal(b1, &fields); err != nil {
+		t.Fatalf("MarshalChainGoogle() = %s, which is not a JSON object of link lists: %v", b1, err)
+	}
+	if len(fields) != 1 || len(fields["links"]) != 2 {
+		t.Fatalf("MarshalChainGoogle() = %s, want only two links", b1)
+	}
+	for i, l := range fields["links"] {
+		if len(l) != 4 || l["publicKeyType"] != "ed25519" {
+			t.Errorf("link %d = %v, want the four fields of the reference format", i, l)
+		}
+	}
+
+	got, err := LoadChain(bytes.NewReader(b1))
+	if err != nil {
+		t.Fatalf("LoadChain(google format) = %v, want <nil>", err)
+	}
+	list := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config()}}
+	if _, err := got.Verify(list); err != nil {
+		t.Errorf("Verify(converted chain) = %v, want <nil>", err)
+	}
+	if b2, _ := MarshalChainGoogle(got); !bytes.Equal(b1, b2) {
+		t.Errorf("MarshalChainGoogle(LoadChain(%s)) = %s", b1, b2)
+	}
+}
+
+func TestVerifyLongChain(t *testing.T) {
+	var servers []*testServer
+	list := &config.ServersJSON{}
+	for i := range 50 {
+		s := newTestServer(fmt.Sprint("server", i))
+		servers = append(servers, s)
+		list.Servers = append(list.Servers, s.config())
+	}
+	ch := testChain(make([]byte, 64), servers...)
+	if rep, err := VerifyChain(ch, list); err != nil || len(rep.Links) != len(servers) {
+		t.Fatalf("VerifyChain(long chain) = %v, want <nil>", err)
+	}
+	// Errors are reported for the first invalid link.
+	ch.Links[40].Reply = ch.Links[10].Reply
+	ch.Links[20].NonceOrBlind = ch.Links[19].NonceOrBlind
+	if _, err := VerifyChain(ch, list); err == nil {
+		t.Fatal("VerifyChain(invalid chain) succeeded")
+	}
+	c := &Client{Logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	if _, err := c.VerifyChain(ch, list); err == nil {
+		t.Fatal("VerifyChain(invalid chain) succeeded")
+	}
+}
+
+// testBatchVerifier checks signatures one by one, counting the batches and
+// signatures. If fail is set, every batch fails.
+type testBatchVerifier struct {
+	batches, sigs int
+	fail          bool
+}
+
+func (v *testBatchVerifier) VerifyBatch(sigs []SignatureCheck) bool {
+	v.batches++
+	v.sigs += len(sigs)
+	for _, s := range sigs {
+		if !ed25519.Verify(s.PublicKey, s.Message, s.Signature) {
+			return false
+		}
+	}
+	return !v.fail
+}
+
+func TestVerifyChainBatch(t *testing.T) {
+	var servers []*testServer
+	list := &config.ServersJSON{}
+	for i := range 5 {
+		s := newTestServer(fmt.Sprint("server", i))
+		// Only delegations that did not expire yet are cached.
+		s.max = time.Now().Add(time.Hour)
+		servers = append(servers, s)
+		list.Servers = append(list.Servers, s.config())
+	}
+	ch := testChain(make([]byte, 64), servers...)
+	v := new(testBatchVerifier)
+	c := &Client{BatchVerifier: v}
+	if rep, err := c.VerifyChain(ch, list); err != nil || len(rep.Links) != len(servers) {
+		t.Fatalf("VerifyChain() = %v, want <nil>", err)
+	}
+	if v.batches != 1 || v.sigs != 2*len(servers) {
+		t.Errorf("verified %d batches with %d signatures, want 1 with %d", v.batches, v.sigs, 2*len(servers))
+	}
+
+	// The delegations of a valid batch are cached.
+	v.sigs = 0
+	if _, err := c.VerifyChain(ch, list); err != nil {
+		t.Fatalf("VerifyChain() = %v, want <nil>", err)
+	}
+	if v.sigs != len(servers) {
+		t.Errorf("verified %d signatures with cached delegations, want %d", v.sigs, len(servers))
+	}
+
+	// If the batch fails, the links are checked one by one.
+	v.fail = true
+	if _, err := c.VerifyChain(ch, list); err != nil {
+		t.Errorf("VerifyChain() with failing batch = %v, want <nil>", err)
+	}
+
+	// The signature is the first field of a response, after a header of
+	// 40 bytes.
+	ch.Links[2].Reply = bytes.Clone(ch.Links[2].Reply)
+	ch.Links[2].Reply[40] ^= 1
+	v.fail = false
+	_, want := VerifyChain(ch, list)
+	if _, err := c.VerifyChain(ch, list); err == nil || want == nil || err.Error() != want.Error() {
+		t.Errorf("VerifyChain(invalid signature) = %v, want %v", err, want)
+	}
+}
+
+func BenchmarkVerifyChain(b *testing.B) {
+	var servers []*testServer
+	list := &config.ServersJSON{}
+	for i := range 100 {
+		s := newTestServer(fmt.Sprint("server", i))
+		servers = append(servers, s)
+		list.Servers = append(list.Servers, s.config())
+	}
+	ch := testChain(make([]byte, 64), servers...)
+	for b.Loop() {
+		if _, err := VerifyChain(ch, list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
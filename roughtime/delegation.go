@@ -0,0 +1,108 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"crypto/ed25519"
+	"sync"
+	"time"
+)
+
+// maxCachedDelegations is the number of delegations a delegationCache holds.
+// Servers rotate their online key rarely, so this is far more than needed for
+// any realistic server list.
+const maxCachedDelegations = 1024
+
+// delegationCache remembers delegations whose signature was verified, until
+// their MAXT. Servers sign every response with the same delegation, so this
+// halves the signature checks when verifying many responses of a server.
+// Looking up a delegation after its MAXT is a miss and evicts it, so
+// long-running clients, like monitors, verify delegations again once they
+// expired and do not accumulate them. A full cache drops expired delegations,
+// or else all of them. A nil *delegationCache caches nothing.
+type delegationCache struct {
+	mu sync.Mutex
+	m  map[delegationCacheKey]time.Time
+	// parent is the cache a pending cache was created from.
+	parent *delegationCache
+}
+
+// delegationCacheKey identifies a DELE message signed by a long-term key.
+type delegationCacheKey struct {
+	root string
+	dele string
+}
+
+func newDelegationCacheKey(root ed25519.PublicKey, dele []byte) delegationCacheKey {
+	return delegationCacheKey{string(root), string(dele)}
+}
+
+// contains reports whether the DELE message dele was verified against root and
+// did not expire yet.
+func (dc *delegationCache) contains(root ed25519.PublicKey, dele []byte) bool {
+	if dc == nil {
+		return false
+	}
+	k := newDelegationCacheKey(root, dele)
+	dc.mu.Lock()
+	exp, ok := dc.m[k]
+	if ok && !time.Now().Before(exp) {
+		delete(dc.m, k)
+		ok = false
+	}
+	dc.mu.Unlock()
+	return ok || dc.parent.contains(root, dele)
+}
+
+// pending returns a cache containing the delegations of dc, which records new
+// ones only in itself. It is used while signatures are collected for a
+// BatchVerifier: once the batch verified, commit adds them to dc.
+func (dc *delegationCache) pending() *delegationCache {
+	return &delegationCache{parent: dc}
+}
+
+// commit adds the delegations recorded in a cache returned by pending to its
+// parent.
+func (dc *delegationCache) commit() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for k, exp := range dc.m {
+		dc.parent.add(ed25519.PublicKey(k.root), []byte(k.dele), exp)
+	}
+}
+
+// add records that dele was verified against root. It is remembered until exp.
+func (dc *delegationCache) add(root ed25519.PublicKey, dele []byte, exp time.Time) {
+	now := time.Now()
+	if dc == nil || !now.Before(exp) {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.m == nil {
+		dc.m = make(map[delegationCacheKey]time.Time)
+	}
+	if len(dc.m) >= maxCachedDelegations {
+		for k, e := range dc.m {
+			if !now.Before(e) {
+				delete(dc.m, k)
+			}
+		}
+	}
+	if len(dc.m) >= maxCachedDelegations {
+		clear(dc.m)
+	}
+	dc.m[newDelegationCacheKey(root, dele)] = exp
+}
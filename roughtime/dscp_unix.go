@@ -0,0 +1,35 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package roughtime
+
+import "syscall"
+
+// setDSCP marks the packets sent from fd with dscp.
+func setDSCP(network string, fd uintptr, dscp int) error {
+	tos := dscp << 2
+	if network == "udp6" {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos); err != nil {
+			return err
+		}
+		// IPv6 sockets are usually dual-stack, so IPv4 packets need to be
+		// marked as well. Some systems do not allow this, in which case
+		// there are no IPv4 packets to mark.
+		syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+		return nil
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/internal/pcap"
+	"github.com/Merovius/notary/wire"
+)
+
+// An Exchange is a request sent to a server and its response, as recorded with
+// UDPTransport.Capture or by other tools. Exchanges can be verified again
+// later, without network access, with VerifyExchange.
+type Exchange struct {
+	// Server is the address of the server, if known.
+	Server string `json:"server,omitempty"`
+	// Sent and Received are the times the request was sent and the response
+	// was received, if known.
+	Sent     time.Time `json:"sent,omitzero"`
+	Received time.Time `json:"received,omitzero"`
+	Request  []byte    `json:"request"`
+	Response []byte    `json:"response"`
+}
+
+// ReadPCAP reads the exchanges in a pcap file from r, for example one written
+// by notary -capture or by tcpdump. Responses are matched to requests by their
+// nonce. Other datagrams and responses without a matching request are
+// ignored.
+func ReadPCAP(r io.Reader) ([]*Exchange, error) {
+	pr, err := pcap.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		exchanges []*Exchange
+		requests  []*Exchange
+		nonces    [][]byte
+	)
+	for {
+		d, err := pr.ReadUDP()
+		if err == io.EOF {
+			return exchanges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Responses are decoded first, as IETF responses contain the
+		// nonce like requests.
+		var res response
+		if wire.Decode(d.Payload, res.decode) != nil {
+			if nonce, err := requestNonce(d.Payload); err == nil {
+				requests = append(requests, &Exchange{Server: d.Dst.String(), Sent: d.Time, Request: d.Payload})
+				nonces = append(nonces, nonce)
+			}
+			continue
+		}
+		// Search backwards, so the latest of retransmitted requests is
+		// used.
+		for i := len(requests) - 1; i >= 0; i-- {
+			if res.matches(nonces[i]) && requests[i].Response == nil {
+				e := requests[i]
+				e.Server, e.Received, e.Response = d.Src.String(), d.Time, d.Payload
+				exchanges = append(exchanges, e)
+				break
+			}
+		}
+	}
+}
+
+// LoadExchanges reads exchanges in the JSON format written by SaveExchanges
+// from r.
+func LoadExchanges(r io.Reader) ([]*Exchange, error) {
+	var exchanges []*Exchange
+	if err := json.NewDecoder(r).Decode(&exchanges); err != nil {
+		return nil, err
+	}
+	return exchanges, nil
+}
+
+// SaveExchanges writes exchanges to w, as a JSON array.
+func SaveExchanges(w io.Writer, exchanges []*Exchange) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(exchanges)
+}
+
+// requestNonce returns the nonce of a roughtime request.
+func requestNonce(b []byte) ([]byte, error) {
+	var req request
+	if err := wire.Decode(b, req.decode); err != nil {
+		return nil, err
+	}
+	return req.nonce[:], nil
+}
+
+// VerifyExchange verifies the response of e against the nonce of its request,
+// as ParseResponse does. The server is identified by the key that signed the
+// delegation of the response, which must be in the list of servers or in the
+// KeyArchive of c. Verification errors are returned as a *VerifyError.
+func VerifyExchange(e *Exchange, s *config.ServersJSON) (LinkResult, error) {
+	return defaultClient.VerifyExchange(e, s)
+}
+
+// VerifyExchange is like the package-level VerifyExchange, but uses c.
+func (c *Client) VerifyExchange(e *Exchange, s *config.ServersJSON) (LinkResult, error) {
+	res := LinkResult{Address: e.Server, Sent: e.Sent}
+	if !e.Sent.IsZero() && !e.Received.IsZero() {
+		res.RTT = e.Received.Sub(e.Sent)
+	}
+	nonce, err := requestNonce(e.Request)
+	if err != nil {
+		return res, &VerifyError{fmt.Errorf("invalid request: %w", err)}
+	}
+	var resp response
+	if err := wire.Decode(e.Response, resp.decode); err != nil {
+		return res, &VerifyError{fmt.Errorf("invalid response: %w", err)}
+	}
+	var (
+		key      ed25519.PublicKey
+		archived bool
+	)
+	for _, k := range c.candidateKeys(s) {
+		if ed25519.Verify(k.key, append(append([]byte(nil), contextCertificate...), resp.certificate.delegation.raw...), resp.certificate.signature[:]) {
+			res.Server, key, archived = k.name, k.key, k.archived
+			break
+		}
+	}
+	if key == nil {
+		return res, &VerifyError{errors.New("response is not signed by a known server")}
+	}
+	if res.Interval, err = c.ParseResponse(e.Response, nonce, key); err != nil {
+		return res, err
+	}
+	if archived {
+		if err := checkArchived(c.archivedKeys(key), res.Midpoint); err != nil {
+			return res, &VerifyError{err}
+		}
+	}
+	return res, nil
+}
+
+// namedKey is a public key of a server.
+type namedKey struct {
+	name string
+	key  ed25519.PublicKey
+	// archived is set for keys from the KeyArchive.
+	archived bool
+}
+
+// candidateKeys returns the keys of the servers in s and c.KeyArchive.
+func (c *Client) candidateKeys(s *config.ServersJSON) []namedKey {
+	var keys []namedKey
+	if s != nil {
+		for _, srv := range s.Servers {
+			if len(srv.PublicKey) == ed25519.PublicKeySize {
+				keys = append(keys, namedKey{srv.Name, srv.PublicKey, false})
+			}
+		}
+	}
+	if c.KeyArchive != nil {
+		for _, k := range c.KeyArchive.Keys {
+			if k != nil && len(k.PublicKey) == ed25519.PublicKeySize {
+				keys = append(keys, namedKey{k.Name, k.PublicKey, true})
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/internal/pcap"
+)
+
+func TestVerifyExchange(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config()}}
+
+	var capture bytes.Buffer
+	w, err := pcap.NewWriter(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{Transport: UDPTransport{Capture: func(t time.Time, src, dst netip.AddrPort, b []byte) {
+		w.WriteUDP(t, src, dst, b)
+	}}}
+	for _, s := range []*testServer{a, b} {
+		if _, err := c.FetchRoughtime(&Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exchanges, err := ReadPCAP(&capture)
+	if err != nil {
+		t.Fatalf("ReadPCAP() = %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("ReadPCAP() returned %d exchanges, want 2", len(exchanges))
+	}
+	var buf bytes.Buffer
+	if err := SaveExchanges(&buf, exchanges); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadExchanges(&buf)
+	if err != nil {
+		t.Fatalf("LoadExchanges() = %v", err)
+	}
+	for i, e := range loaded {
+		res, err := VerifyExchange(e, servers)
+		if err != nil {
+			t.Errorf("VerifyExchange(%d) = %v", i, err)
+			continue
+		}
+		if want := []string{"a", "b"}[i]; res.Server != want || res.Address != e.Server || !res.Midpoint.Equal(testEpoch) || res.RTT <= 0 {
+			t.Errorf("VerifyExchange(%d) = %+v, want server %s at %v", i, res, want, testEpoch)
+		}
+	}
+
+	var verr *VerifyError
+	if _, err := VerifyExchange(loaded[0], &config.ServersJSON{Servers: []*config.Server{b.config()}}); !errors.As(err, &verr) {
+		t.Errorf("VerifyExchange(unknown server) = %v, want *VerifyError", err)
+	}
+	swapped := &Exchange{Request: loaded[1].Request, Response: loaded[0].Response}
+	if _, err := VerifyExchange(swapped, servers); !errors.As(err, &verr) {
+		t.Errorf("VerifyExchange(response to other request) = %v, want *VerifyError", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/wire"
+)
+
+func FuzzParseResponse(f *testing.F) {
+	s := newTestServer("fuzz")
+	nonces := [][]byte{make([]byte, 64), bytes.Repeat([]byte{1}, 64)}
+	for i, resp := range s.respond(nonces...) {
+		f.Add(resp, nonces[i], []byte(s.publicKey()))
+	}
+	f.Fuzz(func(t *testing.T, resp, nonce, key []byte) {
+		if len(nonce) != 64 {
+			return
+		}
+		iv, err := ParseResponse(resp, nonce, key)
+		if err != nil {
+			return
+		}
+		if iv.Empty() {
+			t.Errorf("ParseResponse(%x) returned negative radius %v", resp, iv.Radius)
+		}
+		if _, err := ParseResponse(resp, nonce, key); err != nil {
+			t.Errorf("ParseResponse(%x) = %v, <nil> and then %v", resp, iv, err)
+		}
+	})
+}
+
+func FuzzVerifyChain(f *testing.F) {
+	servers := []*testServer{newTestServer("a"), newTestServer("b"), newTestServer("c")}
+	list := &config.ServersJSON{}
+	for _, s := range servers {
+		list.Servers = append(list.Servers, s.config())
+	}
+	for i := 1; i <= len(servers); i++ {
+		b, err := json.Marshal(testChain(make([]byte, 64), servers[:i]...))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+		if b, err = MarshalChainBinary(testChain(make([]byte, 64), servers[:i]...)); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c, err := LoadChain(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		VerifyChain(c, list)
+	})
+}
+
+func FuzzReadServersJSON(f *testing.F) {
+	f.Add([]byte(defaultServers))
+	f.Add([]byte(`{"servers": [{"name": "hex", "publicKeyType": "ed25519", "publicKey": "7ad3da688c5c04c635a14786a70bcf30224cc25455371bf9d4a2bfb64b682534", "addresses": [{"protocol": "udp", "address": "localhost:2002"}]}], "bad": []}`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		s, err := ReadServersJSON(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		if err := s.Validate(); err != nil {
+			t.Errorf("ReadServersJSON(%q) returned invalid list: %v", b, err)
+		}
+		for _, srv := range s.Servers {
+			if len(srv.PublicKey) != 32 || len(srv.Addresses) == 0 {
+				t.Errorf("ReadServersJSON(%q) returned unusable server %+v", b, srv)
+			}
+		}
+	})
+}
+
+// testRequest returns a request for nonce, padded to packetSize, with a VER
+// tag if ver is not nil.
+func testRequest(t testing.TB, nonce, ver []byte) []byte {
+	m := map[wire.Tag][]byte{tNONC: nonce}
+	// Each tag takes 4 bytes, and each but the first an offset.
+	hdr := 16
+	if ver != nil {
+		m[tVER] = ver
+		hdr += 8
+	}
+	m[tPAD] = make([]byte, packetSize-hdr-len(nonce)-len(ver))
+	b, err := wire.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testIETFRequest returns an IETF request for nonce, listing versions,
+// framed and padded to packetSize.
+func testIETFRequest(t testing.TB, nonce []byte, versions ...uint32) []byte {
+	var ver []byte
+	for _, v := range versions {
+		ver = binary.LittleEndian.AppendUint32(ver, v)
+	}
+	// 12 bytes of framing and 24 bytes of header for three tags.
+	pad := make([]byte, packetSize-12-24-len(nonce)-len(ver))
+	b, err := wire.Marshal(map[wire.Tag][]byte{tVER: ver, tNONC: nonce, tPAD: pad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame(b)
+}
+
+// splitDatagrams splits fuzz input into datagrams, each prefixed with its
+// length as a little-endian uint16.
+func splitDatagrams(data []byte) [][]byte {
+	var ds [][]byte
+	for len(data) >= 2 {
+		n := min(int(binary.LittleEndian.Uint16(data)), len(data)-2)
+		ds = append(ds, data[2:2+n])
+		data = data[2+n:]
+	}
+	return ds
+}
+
+// joinDatagrams is the inverse of splitDatagrams.
+func joinDatagrams(ds ...[]byte) []byte {
+	var b []byte
+	for _, d := range ds {
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(d)))
+		b = append(b, d...)
+	}
+	return b
+}
+
+func FuzzParseRequest(f *testing.F) {
+	nonce := bytes.Repeat([]byte{1}, 64)
+	f.Add(testRequest(f, nonce, nil))
+	f.Add(testRequest(f, nonce, []byte{1, 0, 0, 0, 2, 0, 0, 0}))
+	f.Add(testRequest(f, nonce, []byte{2, 0, 0, 0, 1, 0, 0, 0}))
+	f.Add(testRequest(f, nonce, []byte{}))
+	f.Add(testRequest(f, nonce[:32], nil))
+	f.Add(testRequest(f, nonce, nil)[:packetSize-1])
+	f.Add(testIETFRequest(f, nonce[:32], VersionIETF))
+	f.Add(testIETFRequest(f, nonce[:32], 1, VersionIETF))
+	f.Add(testIETFRequest(f, nonce[:32], 1))
+	f.Add(testIETFRequest(f, nonce, VersionIETF))
+	f.Add(testIETFRequest(f, nonce[:32], VersionIETF)[:packetSize-1])
+	f.Fuzz(func(t *testing.T, b []byte) {
+		nonce, version, err := ParseRequest(b)
+		var (
+			want     []byte
+			versions []uint32
+			derr     error
+		)
+		framed := bytes.HasPrefix(b, []byte(frameMagic))
+		if framed {
+			req := new(ietfRequest)
+			msg, ferr := unframe(b)
+			derr = cmp.Or(ferr, wire.Decode(msg, req.decode))
+			if derr == nil && !slices.Contains(req.versions, VersionIETF) {
+				derr = errors.New("unsupported version")
+			}
+			want, versions = req.nonce[:], req.versions
+		} else {
+			req := new(request)
+			derr = wire.Decode(b, req.decode)
+			want, versions = req.nonce[:], req.versions
+		}
+		if err != nil {
+			if derr == nil && len(b) >= packetSize {
+				t.Errorf("ParseRequest(%x) = %v, but decoding succeeds", b, err)
+			}
+			return
+		}
+		if len(b) < packetSize {
+			t.Errorf("ParseRequest accepted request of %d bytes", len(b))
+		}
+		if derr != nil || !bytes.Equal(nonce, want) {
+			t.Errorf("ParseRequest(%x) = %x, but decoding gives %x, %v", b, nonce, want, derr)
+		}
+		wantVersion := uint32(0)
+		if framed {
+			wantVersion = VersionIETF
+		}
+		if version != wantVersion {
+			t.Errorf("ParseRequest(%x) = version %#x, want %#x", b, version, wantVersion)
+		}
+		if len(versions) > maxVersions {
+			t.Errorf("ParseRequest(%x) accepted %d versions", b, len(versions))
+		}
+		for i := 1; i < len(versions); i++ {
+			if versions[i] <= versions[i-1] {
+				t.Errorf("ParseRequest(%x) accepted versions %v", b, versions)
+			}
+		}
+	})
+}
+
+func FuzzRespond(f *testing.F) {
+	s := newTestServer("fuzz")
+	k, err := NewOnlineKey(s.root, s.min, s.max)
+	if err != nil {
+		f.Fatal(err)
+	}
+	iv := Interval{Midpoint: s.midpoint, Radius: s.radius}
+	valid := testRequest(f, bytes.Repeat([]byte{1}, 64), nil)
+	ietf := testIETFRequest(f, bytes.Repeat([]byte{2}, 32), VersionIETF)
+	f.Add(joinDatagrams(valid))
+	f.Add(joinDatagrams(valid, valid, []byte("invalid"), valid))
+	f.Add(joinDatagrams(valid[:100], make([]byte, packetSize)))
+	f.Add(joinDatagrams(ietf, valid, ietf[:100], ietf))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reqs := splitDatagrams(data)
+		resps, err := k.Respond(reqs, iv)
+		if err != nil {
+			t.Fatalf("Respond() = %v", err)
+		}
+		if len(resps) != len(reqs) {
+			t.Fatalf("Respond(%d requests) returned %d responses", len(reqs), len(resps))
+		}
+		for i, resp := range resps {
+			nonce, version, err := ParseRequest(reqs[i])
+			if err != nil {
+				if resp != nil {
+					t.Errorf("Respond() answered invalid request %x", reqs[i])
+				}
+				continue
+			}
+			if len(resp) > len(reqs[i]) {
+				t.Errorf("response of %d bytes to request of %d bytes", len(resp), len(reqs[i]))
+			}
+			if version == VersionIETF {
+				_, err = parseIETFResponse(resp, nonce, s.publicKey())
+			} else {
+				_, err = ParseResponse(resp, nonce, s.publicKey())
+			}
+			if err != nil {
+				t.Errorf("parsing Respond()[%d] = %v", i, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// googleChain is the chain format of the reference implementation of
+// roughtime at roughtime.googlesource.com, maintained by the Chromium project.
+// The JSON format of this package is a superset of it, so LoadChain reads it.
+type googleChain struct {
+	Links []googleLink `json:"links"`
+}
+
+type googleLink struct {
+	PublicKeyType   string `json:"publicKeyType"`
+	ServerPublicKey []byte `json:"serverPublicKey"`
+	NonceOrBlind    []byte `json:"nonceOrBlind"`
+	Reply           []byte `json:"reply"`
+}
+
+// MarshalChainGoogle serializes c in the chain format of the reference
+// implementation, which can be verified by its tools and read by LoadChain.
+// The format has no room for the hash algorithm, skipped servers,
+// transparency entries or link metadata, so they are dropped. As the reference
+// implementation requires the key type, links without one are marked as
+// ed25519.
+func MarshalChainGoogle(c *Chain) ([]byte, error) {
+	gc := googleChain{Links: make([]googleLink, len(c.Links))}
+	for i, l := range c.Links {
+		gc.Links[i] = googleLink{l.PublicKeyType, l.ServerPublicKey, l.NonceOrBlind, l.Reply}
+		if gc.Links[i].PublicKeyType == "" {
+			gc.Links[i].PublicKeyType = "ed25519"
+		}
+	}
+	return json.MarshalIndent(gc, "", "  ")
+}
+
+// SaveChainGoogle writes c to w, in the format of MarshalChainGoogle.
+func SaveChainGoogle(w io.Writer, c *Chain) error {
+	b, err := MarshalChainGoogle(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/Merovius/notary/wire"
+)
+
+// VersionIETF is the version of the IETF roughtime draft answered by
+// OnlineKey.Respond, draft-ietf-ntp-roughtime-08. Unlike Google roughtime, its
+// packets are framed like messages over TCP, nonces are 32 bytes long, the
+// Merkle tree uses SHA-512 truncated to 32 bytes and times are encoded in
+// seconds since the Unix epoch.
+const VersionIETF uint32 = 0x80000008
+
+// frame returns msg, prefixed with frameMagic and its length.
+func frame(msg []byte) []byte {
+	b := make([]byte, 0, len(frameMagic)+4+len(msg))
+	b = append(b, frameMagic...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// unframe returns the message in the framed packet b.
+func unframe(b []byte) ([]byte, error) {
+	if len(b) < len(frameMagic)+4 || string(b[:len(frameMagic)]) != frameMagic {
+		return nil, errors.New("invalid framing")
+	}
+	n, msg := binary.LittleEndian.Uint32(b[len(frameMagic):]), b[len(frameMagic)+4:]
+	if int64(n) != int64(len(msg)) {
+		return nil, errors.New("invalid frame length")
+	}
+	return msg, nil
+}
+
+type ietfRequest struct {
+	versions []uint32
+	nonce    [32]byte
+}
+
+func (r *ietfRequest) decode(st *wire.DecodeState) {
+	var ver []byte
+	st.Bytes(tVER, &ver)
+	r.versions = decodeVersions(st, ver)
+	st.Bytes32(tNONC, &r.nonce)
+}
+
+type ietfResponse struct {
+	signature [64]byte
+	version   uint32
+	nonce     [32]byte
+	// path contains the concatenated 32 byte hashes of the Merkle path.
+	// After decoding, it aliases the message buffer.
+	path  []byte
+	srep  ietfSignedResponse
+	cert  ietfCertificate
+	index uint32
+}
+
+func (r *ietfResponse) decode(st *wire.DecodeState) {
+	st.Bytes64(tSIG, &r.signature)
+	st.Uint32(tVER, &r.version)
+	st.Bytes32(tNONC, &r.nonce)
+	st.Bytes(tPATH, &r.path)
+	if len(r.path)%32 != 0 || len(r.path)/32 > maxPathDepth {
+		st.Abort(errors.New("invalid PATH"))
+	}
+	st.Message(tSREP, &r.srep.raw, r.srep.decode)
+	st.Message(tCERT, &r.cert.raw, r.cert.decode)
+	st.Uint32(tINDX, &r.index)
+}
+
+func (r *ietfResponse) encode(st *wire.EncodeState) {
+	st.NTags(7)
+	st.Bytes64(tSIG, r.signature)
+	st.Uint32(tVER, r.version)
+	st.Bytes32(tNONC, r.nonce)
+	copy(st.Bytes(tPATH, len(r.path)), r.path)
+	st.Message(tSREP, r.srep.encode)
+	st.Message(tCERT, r.cert.encode)
+	st.Uint32(tINDX, r.index)
+}
+
+type ietfSignedResponse struct {
+	raw []byte
+
+	root     [32]byte
+	midpoint time.Time
+	radius   time.Duration
+}
+
+func (r *ietfSignedResponse) decode(st *wire.DecodeState) {
+	var radius uint32
+	st.Uint32(tRADI, &radius)
+	r.radius = time.Duration(radius) * time.Second
+	r.midpoint = decodeSeconds(st, tMIDP)
+	st.Bytes32(tROOT, &r.root)
+}
+
+func (r *ietfSignedResponse) encode(st *wire.EncodeState) {
+	st.NTags(3)
+	st.Uint32(tRADI, uint32(r.radius/time.Second))
+	st.Uint64(tMIDP, uint64(r.midpoint.Unix()))
+	st.Bytes32(tROOT, r.root)
+}
+
+type ietfCertificate struct {
+	raw []byte
+
+	signature  [64]byte
+	delegation ietfDelegation
+}
+
+func (c *ietfCertificate) decode(st *wire.DecodeState) {
+	st.Bytes64(tSIG, &c.signature)
+	st.Message(tDELE, &c.delegation.raw, c.delegation.decode)
+}
+
+func (c *ietfCertificate) encode(st *wire.EncodeState) {
+	st.NTags(2)
+	st.Bytes64(tSIG, c.signature)
+	st.Message(tDELE, c.delegation.encode)
+}
+
+type ietfDelegation struct {
+	raw []byte
+
+	min       time.Time
+	max       time.Time
+	publicKey [32]byte
+}
+
+func (d *ietfDelegation) decode(st *wire.DecodeState) {
+	st.Bytes32(tPUBK, &d.publicKey)
+	d.min = decodeSeconds(st, tMINT)
+	d.max = decodeSeconds(st, tMAXT)
+}
+
+func (d *ietfDelegation) encode(st *wire.EncodeState) {
+	st.NTags(3)
+	st.Bytes32(tPUBK, d.publicKey)
+	st.Uint64(tMINT, uint64(d.min.Unix()))
+	st.Uint64(tMAXT, uint64(d.max.Unix()))
+}
+
+// decodeSeconds decodes the field t as a time in seconds since the Unix epoch.
+func decodeSeconds(st *wire.DecodeState, t wire.Tag) time.Time {
+	var s uint64
+	st.Uint64(t, &s)
+	if s > 1<<62 {
+		st.Abort(errors.New("invalid " + t.String()))
+	}
+	return time.Unix(int64(s), 0)
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"fmt"
+	"time"
+)
+
+// Interval is a closed time interval, given by its midpoint and radius, like
+// the time claimed by a roughtime server.
+type Interval struct {
+	Midpoint time.Time
+	Radius   time.Duration
+}
+
+// Measurement is the time claimed by a server in response to a query, together
+// with when the query was made.
+type Measurement struct {
+	// Interval is the time claimed by the server.
+	Interval
+	// Sent is the local time the request was sent at and RTT the round-trip
+	// time of the query.
+	Sent time.Time
+	RTT  time.Duration
+}
+
+// Offset returns the offset of the local clock from the server: the
+// difference between the midpoint of the server and the local time in the
+// middle of the round trip.
+func (m Measurement) Offset() time.Duration {
+	return m.Midpoint.Sub(m.Sent.Add(m.RTT / 2))
+}
+
+// Uncertainty returns how far the time of the server can be from the local
+// time at the middle of the round trip: the radius plus half the round-trip
+// time.
+func (m Measurement) Uncertainty() time.Duration {
+	return m.Radius + m.RTT/2
+}
+
+// Bounds returns the interval from earliest to latest. If latest is before
+// earliest, the radius of the result is negative and it contains no time.
+func Bounds(earliest, latest time.Time) Interval {
+	d := latest.Sub(earliest)
+	return Interval{Midpoint: earliest.Add(d / 2), Radius: d - d/2}
+}
+
+// Earliest returns the start of i.
+func (i Interval) Earliest() time.Time {
+	return i.Midpoint.Add(-i.Radius)
+}
+
+// Latest returns the end of i.
+func (i Interval) Latest() time.Time {
+	return i.Midpoint.Add(i.Radius)
+}
+
+// Empty reports whether i contains no time, which is the case if its radius is
+// negative.
+func (i Interval) Empty() bool {
+	return i.Radius < 0
+}
+
+// Contains reports whether t is in i.
+func (i Interval) Contains(t time.Time) bool {
+	return !t.Before(i.Earliest()) && !t.After(i.Latest())
+}
+
+// Intersect returns the intersection of i and j. ok is false if they do not
+// overlap, in which case the result is empty.
+func (i Interval) Intersect(j Interval) (k Interval, ok bool) {
+	lo, hi := i.Earliest(), i.Latest()
+	if e := j.Earliest(); e.After(lo) {
+		lo = e
+	}
+	if l := j.Latest(); l.Before(hi) {
+		hi = l
+	}
+	k = Bounds(lo, hi)
+	return k, !k.Empty()
+}
+
+// Before reports whether i ends before j starts, i.e. all of i is earlier than
+// all of j.
+func (i Interval) Before(j Interval) bool {
+	return i.Latest().Before(j.Earliest())
+}
+
+// After reports whether i starts after j ends.
+func (i Interval) After(j Interval) bool {
+	return j.Before(i)
+}
+
+// String formats i as midpoint±radius.
+func (i Interval) String() string {
+	return fmt.Sprintf("%s±%s", i.Midpoint.Format(time.RFC3339Nano), i.Radius)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	at := func(s int) time.Time { return testEpoch.Add(time.Duration(s) * time.Second) }
+	a := Interval{at(10), 5 * time.Second} // [5, 15]
+	b := Bounds(at(12), at(20))            // [12, 20]
+	c := Interval{at(30), time.Second}     // [29, 31]
+
+	if !b.Midpoint.Equal(at(16)) || b.Radius != 4*time.Second {
+		t.Errorf("Bounds(12, 20) = %v, want 16±4s", b)
+	}
+	if !a.Contains(at(5)) || !a.Contains(at(15)) || a.Contains(at(16)) {
+		t.Errorf("%v.Contains has wrong bounds", a)
+	}
+	if k, ok := a.Intersect(b); !ok || !k.Earliest().Equal(at(12)) || !k.Latest().Equal(at(15)) {
+		t.Errorf("%v.Intersect(%v) = %v, %v, want [12, 15], true", a, b, k, ok)
+	}
+	if k, ok := a.Intersect(c); ok || !k.Empty() {
+		t.Errorf("%v.Intersect(%v) = %v, %v, want empty, false", a, c, k, ok)
+	}
+	if a.Before(b) || !a.Before(c) || !c.After(a) || c.Before(a) {
+		t.Errorf("Before/After of %v, %v, %v are wrong", a, b, c)
+	}
+	if e := Bounds(at(2), at(1)); !e.Empty() || e.Contains(at(1)) {
+		t.Errorf("Bounds(2, 1) = %v, want empty", e)
+	}
+}
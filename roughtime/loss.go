@@ -0,0 +1,74 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import "errors"
+
+// LossStats counts the queries a Client made to the address of a server and
+// how many of them were answered. A server that answers some queries is
+// reachable over a lossy network, while one that answers none is likely down.
+type LossStats struct {
+	// Sent and Received are the numbers of queries sent and answered.
+	Sent, Received int
+	// Retransmits is the number of requests that were sent to further
+	// addresses of the server, because earlier ones were not answered in
+	// time.
+	Retransmits int
+	// Streak is the number of consecutive queries that were not answered,
+	// up to the last one.
+	Streak int
+}
+
+// Lost returns the number of queries that were not answered.
+func (s LossStats) Lost() int {
+	return s.Sent - s.Received
+}
+
+// Loss returns the fraction of queries that were not answered.
+func (s LossStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost()) / float64(s.Sent)
+}
+
+// isLost reports whether err means that no response to a query was received.
+func isLost(err error) bool {
+	return isTimeout(err) || errors.Is(err, errNoResponse)
+}
+
+// trackLoss records a query of address, for which retransmits requests were
+// re-sent, and returns the updated statistics of address.
+func (c *Client) trackLoss(address string, retransmits int, answered bool) LossStats {
+	c.lossMu.Lock()
+	defer c.lossMu.Unlock()
+	if c.loss == nil {
+		c.loss = make(map[string]*LossStats)
+	}
+	s := c.loss[address]
+	if s == nil {
+		s = new(LossStats)
+		c.loss[address] = s
+	}
+	s.Sent++
+	s.Retransmits += retransmits
+	if answered {
+		s.Received++
+		s.Streak = 0
+	} else {
+		s.Streak++
+	}
+	return *s
+}
@@ -0,0 +1,318 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Hash algorithms supported by HashNonce.
+const (
+	SHA512  = "sha512"
+	SHA256  = "sha256"
+	BLAKE2b = "blake2b"
+)
+
+// HashNonce derives a 64 byte nonce from the contents of r, using the hash
+// algorithm alg. An empty alg means SHA512.
+//
+// For SHA512, the digest is used as the nonce directly. For all other
+// algorithms, the digest is expanded to 64 bytes using SHA-512, prefixed by the
+// algorithm name for domain separation.
+func HashNonce(alg string, r io.Reader) ([]byte, error) {
+	digest, err := HashDigest(alg, r)
+	if err != nil {
+		return nil, err
+	}
+	return DigestNonce(alg, digest)
+}
+
+// HashDigest calculates the digest of the contents of r, using the hash
+// algorithm alg. An empty alg means SHA512.
+func HashDigest(alg string, r io.Reader) ([]byte, error) {
+	return (&Hasher{Algorithm: alg}).Digest(r)
+}
+
+// A Hasher hashes data like HashDigest, HashNonce and CountersignNonce, with
+// additional options for large inputs.
+type Hasher struct {
+	// Algorithm is the hash algorithm to use. An empty Algorithm means
+	// SHA512.
+	Algorithm string
+
+	// Progress, if set, is called after every chunk of data, with the
+	// number of bytes hashed so far. It can be used to display progress
+	// when hashing large files.
+	Progress func(hashed int64)
+
+	// ReadAhead makes the Hasher read the next chunk of data in a separate
+	// goroutine while hashing the current one, so reading from slow storage
+	// does not stall hashing. The supported algorithms are sequential, so
+	// a single input can not be split across more cores without changing
+	// its digest.
+	ReadAhead bool
+}
+
+// hashChunkSize is the size of the chunks read by a Hasher reporting progress
+// or reading ahead.
+const hashChunkSize = 1 << 20
+
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case "", SHA512:
+		return sha512.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case BLAKE2b:
+		return blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", alg)
+	}
+}
+
+// Digest calculates the digest of the contents of r.
+func (h *Hasher) Digest(r io.Reader) ([]byte, error) {
+	hh, err := newHash(h.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.copy(hh, r, 0); err != nil {
+		return nil, err
+	}
+	return hh.Sum(nil), nil
+}
+
+// Nonce derives a 64 byte nonce from the contents of r, like HashNonce.
+func (h *Hasher) Nonce(r io.Reader) ([]byte, error) {
+	digest, err := h.Digest(r)
+	if err != nil {
+		return nil, err
+	}
+	return DigestNonce(h.Algorithm, digest)
+}
+
+// CountersignNonce derives a 64 byte nonce from an artifact and a detached
+// signature of it, like the package-level CountersignNonce. Progress counts
+// the bytes of both inputs.
+func (h *Hasher) CountersignNonce(artifact, signature io.Reader) ([]byte, error) {
+	ha, err := newHash(h.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	n, err := h.copy(ha, artifact, 0)
+	if err != nil {
+		return nil, err
+	}
+	hs, _ := newHash(h.Algorithm)
+	if _, err := h.copy(hs, signature, n); err != nil {
+		return nil, err
+	}
+	alg := h.Algorithm
+	if alg == "" {
+		alg = SHA512
+	}
+	return hash512([]byte("notary countersignature\x00"+alg+"\x00"), ha.Sum(nil), hs.Sum(nil)), nil
+}
+
+// DigestFiles calculates the digests of the named files, like Digest. Up to
+// workers files are hashed concurrently, or GOMAXPROCS if workers is not
+// positive. The digests are returned in the order of names, regardless of the
+// order hashing finished in. Progress is called with the number of bytes
+// hashed of all files; the calls are serialized. If any file can not be
+// hashed, DigestFiles stops starting new files and returns the error of the
+// first failed file.
+func (h *Hasher) DigestFiles(names []string, workers int) ([][]byte, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var (
+		digests = make([][]byte, len(names))
+		errs    = make([]error, len(names))
+		wg      sync.WaitGroup
+		next    atomic.Int64
+		failed  atomic.Bool
+		mu      sync.Mutex
+		total   int64
+	)
+	for range min(workers, len(names)) {
+		wg.Go(func() {
+			for i := int(next.Add(1) - 1); i < len(names) && !failed.Load(); i = int(next.Add(1) - 1) {
+				fh := *h
+				if h.Progress != nil {
+					var last int64
+					fh.Progress = func(n int64) {
+						mu.Lock()
+						defer mu.Unlock()
+						total += n - last
+						last = n
+						h.Progress(total)
+					}
+				}
+				if digests[i], errs[i] = fh.digestFile(names[i]); errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+func (h *Hasher) digestFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return h.Digest(f)
+}
+
+// copy writes the contents of r to the hash w. n is the number of bytes hashed
+// before, for reporting progress. It returns the number of bytes hashed
+// including n.
+func (h *Hasher) copy(w io.Writer, r io.Reader, n int64) (int64, error) {
+	if h.Progress == nil && !h.ReadAhead {
+		m, err := io.Copy(w, r)
+		return n + m, err
+	}
+	next := chunkReader(r)
+	if h.ReadAhead {
+		next = readAhead(r)
+	}
+	for {
+		b, err := next()
+		if len(b) > 0 {
+			w.Write(b)
+			n += int64(len(b))
+			if h.Progress != nil {
+				h.Progress(n)
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// readChunk reads a chunk of at most len(buf) bytes from r. At the end of r, it
+// returns io.EOF, possibly together with a final chunk.
+func readChunk(r io.Reader, buf []byte) ([]byte, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return buf[:n], err
+}
+
+// chunkReader returns a function reading the next chunk from r. The chunk is
+// only valid until the next call.
+func chunkReader(r io.Reader) func() ([]byte, error) {
+	buf := make([]byte, hashChunkSize)
+	return func() ([]byte, error) {
+		return readChunk(r, buf)
+	}
+}
+
+// readAhead is like chunkReader, but reads the next chunk in a separate
+// goroutine, while the current one is used. The goroutine exits once reading
+// failed or reached the end of r, so the returned function must be called
+// until it returns an error.
+func readAhead(r io.Reader) func() ([]byte, error) {
+	type chunk struct {
+		b   []byte
+		err error
+	}
+	var (
+		free = make(chan []byte, 1)
+		full = make(chan chunk, 1)
+		cur  []byte
+	)
+	free <- make([]byte, hashChunkSize)
+	go func() {
+		buf := make([]byte, hashChunkSize)
+		for {
+			b, err := readChunk(r, buf)
+			full <- chunk{b, err}
+			if err != nil {
+				return
+			}
+			buf = <-free
+		}
+	}()
+	return func() ([]byte, error) {
+		if cur != nil {
+			free <- cur[:cap(cur)]
+		}
+		c := <-full
+		cur = c.b
+		return c.b, c.err
+	}
+}
+
+// DigestNonce derives a 64 byte nonce from a digest calculated with the hash
+// algorithm alg, like HashNonce. It can be used if the data is hashed
+// elsewhere.
+func DigestNonce(alg string, digest []byte) ([]byte, error) {
+	if alg == "" {
+		alg = SHA512
+	}
+	var size int
+	switch alg {
+	case SHA512:
+		size = sha512.Size
+	case SHA256:
+		size = sha256.Size
+	case BLAKE2b:
+		size = blake2b.Size
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", alg)
+	}
+	if len(digest) != size {
+		return nil, fmt.Errorf("%s digest has length %d, want %d", alg, len(digest), size)
+	}
+	if alg == SHA512 {
+		return digest, nil
+	}
+	return hash512([]byte("notary nonce\x00"+alg+"\x00"), digest), nil
+}
+
+// CountersignNonce derives a 64 byte nonce from an artifact and a detached
+// signature of it, using the hash algorithm alg. A chain for this nonce proves
+// that the signature existed at the time of the chain.
+//
+// Both inputs are hashed separately and the digests are combined using
+// SHA-512, with a prefix separating the result from the nonces returned by
+// HashNonce.
+func CountersignNonce(alg string, artifact, signature io.Reader) ([]byte, error) {
+	return (&Hasher{Algorithm: alg}).CountersignNonce(artifact, signature)
+}
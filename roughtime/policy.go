@@ -0,0 +1,165 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// A Policy describes requirements a chain has to meet, beyond being valid. It
+// is enforced by VerifyChain if set as the Policy of a Client. The zero value
+// places no requirements.
+//
+// In JSON, durations are given as strings, like "10s" or "24h":
+//
+//	{
+//		"minLinks": 3,
+//		"maxRadius": "10s",
+//		"requiredServers": ["Cloudflare"],
+//		"maxAge": "24h",
+//		"keyTypes": ["ed25519"]
+//	}
+type Policy struct {
+	// MinLinks is the minimum number of links of the chain.
+	MinLinks int
+	// MaxRadius is the largest radius accepted for any link, if positive.
+	MaxRadius time.Duration
+	// RequiredServers lists names of servers in the server list (or key
+	// archive), that must each have signed a link of the chain.
+	RequiredServers []string
+	// MaxAge, if positive, is how long ago the chain may have been created
+	// at most, measured from the earliest time it could have been created.
+	MaxAge time.Duration
+	// KeyTypes, if not empty, lists the accepted public key types of links.
+	// Links without a key type are considered to be ed25519.
+	KeyTypes []string
+}
+
+// policyJSON is the JSON representation of a Policy.
+type policyJSON struct {
+	MinLinks        int      `json:"minLinks,omitempty"`
+	MaxRadius       string   `json:"maxRadius,omitempty"`
+	RequiredServers []string `json:"requiredServers,omitempty"`
+	MaxAge          string   `json:"maxAge,omitempty"`
+	KeyTypes        []string `json:"keyTypes,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p *Policy) MarshalJSON() ([]byte, error) {
+	v := policyJSON{MinLinks: p.MinLinks, RequiredServers: p.RequiredServers, KeyTypes: p.KeyTypes}
+	if p.MaxRadius != 0 {
+		v.MaxRadius = p.MaxRadius.String()
+	}
+	if p.MaxAge != 0 {
+		v.MaxAge = p.MaxAge.String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var v policyJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*p = Policy{MinLinks: v.MinLinks, RequiredServers: v.RequiredServers, KeyTypes: v.KeyTypes}
+	for _, d := range []struct {
+		field string
+		s     string
+		d     *time.Duration
+	}{{"maxRadius", v.MaxRadius, &p.MaxRadius}, {"maxAge", v.MaxAge, &p.MaxAge}} {
+		if d.s == "" {
+			continue
+		}
+		var err error
+		if *d.d, err = time.ParseDuration(d.s); err != nil {
+			return fmt.Errorf("%s: %w", d.field, err)
+		}
+	}
+	return nil
+}
+
+// LoadPolicy loads a policy from the JSON file name.
+func LoadPolicy(name string) (*Policy, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Policy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// A PolicyError is returned (wrapped in a *VerifyError) by VerifyChain if a
+// chain is valid, but violates the Policy of the Client.
+type PolicyError struct {
+	// Field is the JSON name of the violated field of the Policy.
+	Field string
+	// Msg describes the violation.
+	Msg string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("chain violates policy: %s: %s", e.Field, e.Msg)
+}
+
+// Check returns a *PolicyError if the chain c, with the report rep returned by
+// VerifyChain, violates p. It is used to enforce a policy on chains verified by
+// a Client without a Policy.
+func (p *Policy) Check(c *Chain, rep *Report) error {
+	return p.check(c, rep, time.Now())
+}
+
+// check returns a *PolicyError if the chain c with the report rep violates p
+// at the time now.
+func (p *Policy) check(c *Chain, rep *Report, now time.Time) error {
+	if len(c.Links) < p.MinLinks {
+		return &PolicyError{"minLinks", fmt.Sprintf("chain has %d links, need %d", len(c.Links), p.MinLinks)}
+	}
+	for i, l := range c.Links {
+		if len(p.KeyTypes) == 0 {
+			break
+		}
+		typ := l.PublicKeyType
+		if typ == "" {
+			typ = "ed25519"
+		}
+		if !slices.Contains(p.KeyTypes, typ) {
+			return &PolicyError{"keyTypes", fmt.Sprintf("link %d has key type %q", i, typ)}
+		}
+	}
+	for i, l := range rep.Links {
+		if p.MaxRadius > 0 && l.Radius > p.MaxRadius {
+			return &PolicyError{"maxRadius", fmt.Sprintf("link %d (%s) has radius %v, more than %v", i, serverName(l.Server), l.Radius, p.MaxRadius)}
+		}
+	}
+	for _, name := range p.RequiredServers {
+		if !slices.ContainsFunc(rep.Links, func(l LinkResult) bool { return l.Server == name }) {
+			return &PolicyError{"requiredServers", fmt.Sprintf("no link by %s", name)}
+		}
+	}
+	if p.MaxAge > 0 {
+		if age := now.Sub(rep.Earliest); age > p.MaxAge {
+			return &PolicyError{"maxAge", fmt.Sprintf("chain may be %v old, more than %v", age.Round(time.Second), p.MaxAge)}
+		}
+	}
+	return nil
+}
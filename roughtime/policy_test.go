@@ -0,0 +1,103 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "policy.json")
+	in := `{"minLinks": 3, "maxRadius": "10s", "requiredServers": ["a"], "maxAge": "24h", "keyTypes": ["ed25519"]}`
+	if err := os.WriteFile(name, []byte(in), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(name)
+	if err != nil {
+		t.Fatalf("LoadPolicy() = %v", err)
+	}
+	want := &Policy{MinLinks: 3, MaxRadius: 10 * time.Second, RequiredServers: []string{"a"}, MaxAge: 24 * time.Hour, KeyTypes: []string{"ed25519"}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("LoadPolicy() = %+v, want %+v", p, want)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q Policy
+	if err := json.Unmarshal(b, &q); err != nil || !reflect.DeepEqual(&q, want) {
+		t.Errorf("round-trip through %s = %+v, %v, want %+v", b, q, err, want)
+	}
+	if err := json.Unmarshal([]byte(`{"maxAge": "a day"}`), &q); err == nil {
+		t.Error("Unmarshal(invalid duration) succeeded")
+	}
+}
+
+func TestVerifyChainPolicy(t *testing.T) {
+	a, b, c := newTestServer("a"), newTestServer("b"), newTestServer("c")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config(), c.config()}}
+	ch := testChain(make([]byte, 64), a, b)
+	age := time.Since(testEpoch)
+
+	tests := []struct {
+		policy Policy
+		field  string
+	}{
+		{Policy{}, ""},
+		{Policy{MinLinks: 2, MaxRadius: time.Second, RequiredServers: []string{"a", "b"}, MaxAge: age + time.Hour, KeyTypes: []string{"ed25519"}}, ""},
+		{Policy{MinLinks: 3}, "minLinks"},
+		{Policy{MaxRadius: time.Second / 2}, "maxRadius"},
+		{Policy{RequiredServers: []string{"a", "c"}}, "requiredServers"},
+		{Policy{MaxAge: age - time.Hour}, "maxAge"},
+		{Policy{KeyTypes: []string{"ed448"}}, "keyTypes"},
+	}
+	for _, tc := range tests {
+		cl := &Client{Policy: &tc.policy}
+		_, err := cl.VerifyChain(ch, servers)
+		if tc.field == "" {
+			if err != nil {
+				t.Errorf("VerifyChain(%+v) = %v, want <nil>", tc.policy, err)
+			}
+			continue
+		}
+		var (
+			verr *VerifyError
+			perr *PolicyError
+		)
+		if !errors.As(err, &verr) || !errors.As(err, &perr) || perr.Field != tc.field {
+			t.Errorf("VerifyChain(%+v) = %v, want *PolicyError for %s", tc.policy, err, tc.field)
+		}
+	}
+
+	rep, err := VerifyChain(ch, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var perr *PolicyError
+	if err := (&Policy{MinLinks: 3}).Check(ch, rep); !errors.As(err, &perr) || perr.Field != "minLinks" {
+		t.Errorf("Check(too few links) = %v, want *PolicyError for minLinks", err)
+	}
+	if err := (&Policy{MinLinks: 2}).Check(ch, rep); err != nil {
+		t.Errorf("Check(enough links) = %v, want <nil>", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import "time"
+
+// An EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventQuery is sent before querying a server.
+	EventQuery EventType = "query"
+	// EventRetry is sent when a query failed and the next address of the
+	// server is tried. Err is the error of the failed query.
+	EventRetry EventType = "retry"
+	// EventVerified is sent when a response was verified. Interval is the
+	// time claimed by the server.
+	EventVerified EventType = "verified"
+	// EventFailed is sent when a query or the verification of its response
+	// failed.
+	EventFailed EventType = "failed"
+	// EventSkipped is sent when a failed server is skipped and the next one
+	// is used, by ExtendChain (with MinLinks) and Attest.
+	EventSkipped EventType = "skipped"
+)
+
+// An Event describes a step of an operation of a Client, for reporting
+// progress. See Client.Progress.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Server and Address identify the server and the address it is queried
+	// at. Address is empty for EventSkipped.
+	Server  string
+	Address string
+	// Interval is set for EventVerified.
+	Interval
+	// RTT is the round-trip time of the query, for EventVerified and
+	// EventFailed.
+	RTT time.Duration
+	// Err is set for EventRetry, EventFailed and EventSkipped.
+	Err error
+}
+
+// progress sends e to c.Progress, if set.
+func (c *Client) progress(e Event) {
+	if c.Progress == nil {
+		return
+	}
+	e.Time = time.Now()
+	c.Progress(e)
+}
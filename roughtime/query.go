@@ -0,0 +1,263 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Merovius/notary/wire"
+)
+
+// QueryResult is the result of querying a single server with Query.
+type QueryResult struct {
+	Server *Server
+	// Measurement is the time claimed by the server and when it was
+	// queried. It is only meaningful if Err is nil.
+	Measurement
+	// Delegation is the validity window of the key the response was signed
+	// with.
+	Delegation Delegation
+	// Err is the error querying or verifying the server, if any.
+	Err error
+	// Retransmits is the number of requests sent to further addresses of
+	// the server, because earlier ones were not answered in time.
+	Retransmits int
+	// Loss contains the statistics of all queries the client made to the
+	// address of the server with Query, including this one. It is zero if
+	// no request was sent.
+	Loss LossStats
+}
+
+var errNoResponse = errors.New("no response")
+
+// Query fetches the time from all given servers concurrently, each with a
+// fresh random nonce. All requests are sent from a single socket, so the total
+// time taken is that of the slowest server. The results are in the same order
+// as servers.
+//
+// If the client has a Transport other than UDPTransport, each server is
+// instead queried with a separate request.
+func Query(servers []*Server) []QueryResult {
+	return defaultClient.Query(servers)
+}
+
+// Query is like the package-level Query, but uses c.
+func (c *Client) Query(servers []*Server) []QueryResult {
+	results := make([]QueryResult, len(servers))
+	for i, s := range servers {
+		results[i].Server = s
+	}
+	t, ok := c.udpTransport()
+	if !ok {
+		c.queryEach(results)
+		return results
+	}
+	fail := func(err error) []QueryResult {
+		for i, s := range servers {
+			if results[i].Err == nil {
+				results[i].Err = &NetError{s.Address, err}
+			}
+		}
+		return results
+	}
+
+	deadline := time.Now().Add(c.timeout())
+	conn, err := t.listen()
+	if err != nil {
+		return fail(err)
+	}
+	defer conn.Close()
+
+	// pending contains the indices of servers we are waiting for.
+	pending := make(map[int]bool)
+	nonces := make([][]byte, len(servers))
+	msgs := make([][]byte, len(servers))
+	addrs := make([]udpAddrs, len(servers))
+	// sentTo contains the addresses requests were sent to, so oversized
+	// responses, which can not be decoded, can be attributed to a server.
+	sentTo := make([][]netip.AddrPort, len(servers))
+	sent := make([]time.Time, len(servers))
+	// answered contains the servers that sent a response, even an invalid
+	// one.
+	answered := make([]bool, len(servers))
+	defer func() {
+		for i, s := range servers {
+			if n := len(sentTo[i]); n > 0 {
+				results[i].Retransmits = n - 1
+				results[i].Loss = c.trackLoss(s.Address, n-1, answered[i])
+			}
+		}
+	}()
+	buf := getResponseBuffer()
+	defer responsePool.Put(buf)
+	for i, s := range servers {
+		if results[i].Err = c.checkBackoff(s); results[i].Err != nil {
+			continue
+		}
+		addrs[i], err = t.resolve(s.Address)
+		if err == nil {
+			nonces[i], err = ensureNonce(nil)
+		}
+		if err == nil {
+			msgs[i] = make([]byte, packetSize)
+			_, err = encodeRequest((*[packetSize]byte)(msgs[i]), nonces[i])
+		}
+		if err == nil {
+			c.progress(Event{Type: EventQuery, Server: s.Name, Address: s.Address})
+			sent[i] = time.Now()
+			var to netip.AddrPort
+			to, err = addrs[i].send(conn, msgs[i])
+			if err == nil {
+				sentTo[i] = append(sentTo[i], to)
+				t.capture(conn, to, true, msgs[i])
+			}
+		}
+		if err != nil {
+			results[i].Err = &NetError{s.Address, err}
+			continue
+		}
+		pending[i] = true
+	}
+
+	for len(pending) > 0 {
+		// Wake up to send requests to the next address of servers that
+		// did not respond yet, as long as there are any.
+		d := deadline
+		for i := range pending {
+			if len(addrs[i]) > 0 {
+				if f := time.Now().Add(t.fallbackDelay()); f.Before(d) {
+					d = f
+				}
+				break
+			}
+		}
+		if err := conn.SetReadDeadline(d); err != nil {
+			return fail(err)
+		}
+		n, from, err := conn.ReadFromUDPAddrPort(buf[:])
+		if isTimeout(err) && time.Now().Before(deadline) {
+			for i := range pending {
+				if to, err := addrs[i].send(conn, msgs[i]); err == nil {
+					sentTo[i] = append(sentTo[i], to)
+					t.capture(conn, to, true, msgs[i])
+				}
+			}
+			continue
+		}
+		if err != nil {
+			if isTimeout(err) {
+				err = errNoResponse
+			}
+			for i := range pending {
+				results[i].Err = &NetError{servers[i].Address, err}
+				c.record(servers[i], sent[i], time.Since(sent[i]), Interval{}, results[i].Err)
+			}
+			return results
+		}
+		now := time.Now()
+		t.capture(conn, from, false, buf[:n])
+		if n > MaxResponseSize {
+			c.logger().Debug("ignoring oversized response", "from", from, "size", n)
+			for i := range pending {
+				if slices.Contains(sentTo[i], unmapAddrPort(from)) {
+					delete(pending, i)
+					answered[i] = true
+					results[i].Err = &NetError{servers[i].Address, ErrResponseTooLarge}
+					c.record(servers[i], sent[i], now.Sub(sent[i]), Interval{}, results[i].Err)
+					break
+				}
+			}
+			continue
+		}
+		var res response
+		if wire.Decode(buf[:n], res.decode) != nil {
+			c.logger().Debug("ignoring invalid response", "size", n)
+			continue
+		}
+		// Responses are demultiplexed by checking which nonce they
+		// are for.
+		for i := range pending {
+			if !res.matches(nonces[i]) {
+				continue
+			}
+			delete(pending, i)
+			answered[i] = true
+			r := &results[i]
+			r.Sent, r.RTT = sent[i], now.Sub(sent[i])
+			r.Interval, r.Delegation, r.Err = c.verify(buf[:n], nonces[i], servers[i].PublicKey)
+			if r.Err == nil {
+				c.checkDelegation(servers[i].Address, r.Delegation)
+				r.Err = c.checkRTT(servers[i].Address, r.RTT)
+			}
+			c.record(servers[i], sent[i], r.RTT, r.Interval, r.Err)
+			c.logger().Debug("received response", "address", servers[i].Address, "duration", r.RTT, "error", r.Err)
+			break
+		}
+	}
+	return results
+}
+
+// unmapAddrPort returns a with an IPv4-mapped IPv6 address unmapped, as
+// received on dual-stack sockets.
+func unmapAddrPort(a netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(a.Addr().Unmap(), a.Port())
+}
+
+// udpTransport returns the transport of c, if it uses UDP.
+func (c *Client) udpTransport() (UDPTransport, bool) {
+	switch t := c.transport().(type) {
+	case UDPTransport:
+		return t, true
+	case *UDPTransport:
+		return *t, true
+	}
+	return UDPTransport{}, false
+}
+
+// queryEach queries the servers of results concurrently, using the transport
+// of c.
+func (c *Client) queryEach(results []QueryResult) {
+	var wg sync.WaitGroup
+	for i := range results {
+		r := &results[i]
+		wg.Go(func() {
+			if r.Err = c.checkBackoff(r.Server); r.Err != nil {
+				return
+			}
+			nonce, err := ensureNonce(nil)
+			if err != nil {
+				r.Err = &NetError{r.Server.Address, err}
+				return
+			}
+			c.progress(Event{Type: EventQuery, Server: r.Server.Name, Address: r.Server.Address})
+			r.Sent = time.Now()
+			var resp []byte
+			resp, r.RTT, r.Err = c.fetchRoughtime(r.Server, nonce)
+			r.Loss = c.trackLoss(r.Server.Address, 0, !isLost(r.Err))
+			if r.Err == nil {
+				r.Interval, r.Delegation, r.Err = c.verify(resp, nonce, r.Server.PublicKey)
+			}
+			if r.Err == nil {
+				c.checkDelegation(r.Server.Address, r.Delegation)
+			}
+			c.record(r.Server, r.Sent, r.RTT, r.Interval, r.Err)
+		})
+	}
+	wg.Wait()
+}
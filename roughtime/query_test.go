@@ -0,0 +1,95 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	var servers []*Server
+	for i := range 10 {
+		s := newTestServer(fmt.Sprint("server", i))
+		s.midpoint = testEpoch.Add(time.Duration(i) * time.Second)
+		servers = append(servers, &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()})
+	}
+	// A server with the wrong key and one that does not respond.
+	servers[3].PublicKey = newTestServer("other").publicKey()
+	servers = append(servers, &Server{Address: serveUDP(t, nil), PublicKey: newTestServer("dead").publicKey()})
+
+	c := &Client{Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	results := c.Query(servers)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Query() took %v", d)
+	}
+	var (
+		verr *VerifyError
+		nerr *NetError
+	)
+	for i, r := range results {
+		switch i {
+		case 3:
+			if !errors.As(r.Err, &verr) {
+				t.Errorf("results[%d].Err = %v, want *VerifyError", i, r.Err)
+			}
+		case 10:
+			if !errors.As(r.Err, &nerr) {
+				t.Errorf("results[%d].Err = %v, want *NetError", i, r.Err)
+			}
+		default:
+			if want := testEpoch.Add(time.Duration(i) * time.Second); r.Err != nil || !r.Midpoint.Equal(want) || r.RTT <= 0 {
+				t.Errorf("results[%d] = %v, %v, %v, want %v, <nil>", i, r.Midpoint, r.RTT, r.Err, want)
+			}
+			if want := r.Midpoint.Sub(start); (r.Offset() - want).Abs() > time.Second {
+				t.Errorf("results[%d].Offset() = %v, want about %v", i, r.Offset(), want)
+			}
+			if d := r.Delegation; !d.NotBefore.Equal(testEpoch.Add(-24*time.Hour)) || !d.NotAfter.Equal(testEpoch.Add(24*time.Hour)) {
+				t.Errorf("results[%d].Delegation = %v, want 24h around %v", i, d, testEpoch)
+			}
+		}
+	}
+}
+
+func TestQueryLoss(t *testing.T) {
+	ts := newTestServer("test")
+	servers := []*Server{
+		{Address: serveUDP(t, ts), PublicKey: ts.publicKey()},
+		{Address: serveUDP(t, nil), PublicKey: ts.publicKey()},
+		// A wrong key still means the server answered.
+		{Address: serveUDP(t, ts), PublicKey: newTestServer("other").publicKey()},
+	}
+	c := &Client{Timeout: 50 * time.Millisecond, MaxRadius: -1}
+	var results []QueryResult
+	for range 3 {
+		results = c.Query(servers)
+	}
+	want := []LossStats{
+		{Sent: 3, Received: 3},
+		{Sent: 3, Received: 0, Streak: 3},
+		{Sent: 3, Received: 3},
+	}
+	for i, r := range results {
+		if r.Loss != want[i] || r.Retransmits != 0 {
+			t.Errorf("results[%d] = %+v, %d retransmits, want %+v, 0 retransmits", i, r.Loss, r.Retransmits, want[i])
+		}
+	}
+	if l := results[1].Loss.Loss(); l != 1 {
+		t.Errorf("Loss() of dead server = %v, want 1", l)
+	}
+}
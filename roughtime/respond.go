@@ -0,0 +1,258 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"time"
+
+	"github.com/Merovius/notary/wire"
+)
+
+// An OnlineKey is the key a server signs responses with. It is certified by
+// the long-term key of the server for a limited time, so that the long-term
+// key can be kept offline.
+type OnlineKey struct {
+	// Delegation is the validity window of the key. Only responses
+	// claiming a time in it are accepted by clients.
+	Delegation Delegation
+
+	key      ed25519.PrivateKey
+	cert     certificate
+	ietfCert ietfCertificate
+}
+
+// NewOnlineKey generates an online key and certifies it for the given validity
+// window, by signing it with root. root must be an Ed25519 key, but it can be
+// held by a hardware token or key management service. It is asked for two
+// signatures, as the delegation is encoded differently for IETF clients.
+func NewOnlineKey(root crypto.Signer, notBefore, notAfter time.Time) (*OnlineKey, error) {
+	if pub, ok := root.Public().(ed25519.PublicKey); !ok || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("long-term key must be an Ed25519 key, not %T", root.Public())
+	}
+	if !notBefore.Before(notAfter) {
+		return nil, errors.New("empty validity window")
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k := &OnlineKey{Delegation: Delegation{notBefore, notAfter}, key: priv}
+	copy(k.cert.delegation.publicKey[:], pub)
+	k.cert.delegation.min, k.cert.delegation.max = notBefore, notAfter
+	dele := wire.Encode(k.cert.delegation.encode)
+	sig, err := root.Sign(rand.Reader, slices.Concat(contextCertificate, dele), crypto.Hash(0))
+	if err != nil {
+		return nil, fmt.Errorf("signing delegation: %w", err)
+	}
+	copy(k.cert.signature[:], sig)
+
+	// IETF delegations are in whole seconds, so the window is rounded
+	// inwards.
+	k.ietfCert.delegation = ietfDelegation{
+		min:       notBefore.Add(time.Second - 1).Truncate(time.Second),
+		max:       notAfter.Truncate(time.Second),
+		publicKey: k.cert.delegation.publicKey,
+	}
+	dele = wire.Encode(k.ietfCert.delegation.encode)
+	sig, err = root.Sign(rand.Reader, slices.Concat(contextCertificate, dele), crypto.Hash(0))
+	if err != nil {
+		return nil, fmt.Errorf("signing IETF delegation: %w", err)
+	}
+	copy(k.ietfCert.signature[:], sig)
+	return k, nil
+}
+
+// PublicKey returns the public part of k.
+func (k *OnlineKey) PublicKey() ed25519.PublicKey {
+	return k.key.Public().(ed25519.PublicKey)
+}
+
+// Respond returns the responses to a batch of requests, claiming the time iv.
+// The responses share a single signature over the root of a Merkle tree of the
+// nonces, so the cost of signing is amortized over the batch. The response to
+// an invalid request is nil. Respond fails if the midpoint of iv is outside the
+// validity window of k or the radius can not be encoded.
+//
+// Requests framed as in the IETF roughtime draft are answered in that dialect,
+// if they list its version, so clients of both protocols can be served from
+// the same socket. As the dialects hash and encode differently, a batch
+// containing both is signed twice.
+func (k *OnlineKey) Respond(requests [][]byte, iv Interval) ([][]byte, error) {
+	if iv.Midpoint.Before(k.Delegation.NotBefore) || iv.Midpoint.After(k.Delegation.NotAfter) {
+		return nil, errors.New("midpoint outside of delegation")
+	}
+	if iv.Radius < 0 || iv.Radius/time.Microsecond > math.MaxUint32 {
+		return nil, fmt.Errorf("radius %v out of range", iv.Radius)
+	}
+	resps := make([][]byte, len(requests))
+	var google, ietf pending
+	for i, b := range requests {
+		nonce, version, err := ParseRequest(b)
+		if err != nil {
+			continue
+		}
+		if version == VersionIETF {
+			ietf.add(i, nonce)
+		} else {
+			google.add(i, nonce)
+		}
+	}
+	if len(google.nonces) > 0 {
+		k.respondGoogle(resps, &google, iv)
+	}
+	if len(ietf.nonces) > 0 {
+		k.respondIETF(resps, &ietf, iv)
+	}
+	return resps, nil
+}
+
+// pending collects the valid requests of a batch in one dialect.
+type pending struct {
+	// idx are the indices of the requests in the batch.
+	idx    []int
+	nonces [][]byte
+}
+
+func (p *pending) add(i int, nonce []byte) {
+	p.idx = append(p.idx, i)
+	p.nonces = append(p.nonces, nonce)
+}
+
+// respondGoogle stores the Google roughtime responses to p in resps.
+func (k *OnlineKey) respondGoogle(resps [][]byte, p *pending, iv Interval) {
+	levels := merkleTree(p.nonces, 64)
+	sr := signedResponse{root: levels[len(levels)-1][0], midpoint: iv.Midpoint, radius: iv.Radius}
+	var sig [64]byte
+	copy(sig[:], ed25519.Sign(k.key, slices.Concat(contextSignedResponse, wire.Encode(sr.encode))))
+
+	for j, i := range p.idx {
+		r := response{signedResponse: sr, signature: sig, index: uint32(j), certificate: k.cert}
+		r.path = merklePath(levels, j, 64)
+		resps[i] = wire.Encode(r.encode)
+	}
+}
+
+// respondIETF stores the IETF responses to p in resps. As the IETF dialect
+// encodes times in seconds, the midpoint is rounded and the radius increased
+// to still cover iv. If the rounded midpoint is outside of the IETF
+// delegation, which is rounded as well, the requests are not answered.
+func (k *OnlineKey) respondIETF(resps [][]byte, p *pending, iv Interval) {
+	mid := iv.Midpoint.Round(time.Second)
+	rad := (iv.Radius + iv.Midpoint.Sub(mid).Abs() + time.Second - 1).Truncate(time.Second)
+	if mid.Before(k.ietfCert.delegation.min) || mid.After(k.ietfCert.delegation.max) {
+		return
+	}
+	levels := merkleTree(p.nonces, 32)
+	sr := ietfSignedResponse{midpoint: mid, radius: rad}
+	copy(sr.root[:], levels[len(levels)-1][0][:32])
+	var sig [64]byte
+	copy(sig[:], ed25519.Sign(k.key, slices.Concat(contextSignedResponse, wire.Encode(sr.encode))))
+
+	for j, i := range p.idx {
+		r := ietfResponse{signature: sig, version: VersionIETF, srep: sr, cert: k.ietfCert, index: uint32(j)}
+		copy(r.nonce[:], p.nonces[j])
+		r.path = merklePath(levels, j, 32)
+		resps[i] = frame(wire.Encode(r.encode))
+	}
+}
+
+// merkleTree returns the levels of the Merkle tree of nonces, from the leaves
+// to the root. The leaves are padded with zero hashes to a power of two. Hashes
+// are truncated to size bytes and zero-padded.
+func merkleTree(nonces [][]byte, size int) [][][64]byte {
+	n := 1 << bits.Len(uint(len(nonces)-1))
+	leaves := make([][64]byte, n)
+	for i, nonce := range nonces {
+		leaves[i] = hashLeaf(nonce)
+		clear(leaves[i][size:])
+	}
+	levels := [][][64]byte{leaves}
+	for l := leaves; len(l) > 1; l = levels[len(levels)-1] {
+		next := make([][64]byte, len(l)/2)
+		for i := range next {
+			next[i] = hashNode(l[2*i][:size], l[2*i+1][:size])
+			clear(next[i][size:])
+		}
+		levels = append(levels, next)
+	}
+	return levels
+}
+
+// merklePath returns the concatenated hashes of size bytes leading from leaf j
+// of the tree with the given levels to its root.
+func merklePath(levels [][][64]byte, j, size int) []byte {
+	path := make([]byte, 0, size*(len(levels)-1))
+	for l := 0; l < len(levels)-1; l++ {
+		path = append(path, levels[l][(j>>l)^1][:size]...)
+	}
+	return path
+}
+
+var (
+	// ErrRequestTooSmall is returned by ParseRequest for requests that are
+	// not padded to 1024 bytes.
+	ErrRequestTooSmall = errors.New("request too small")
+	// ErrUnsupportedVersion is returned by ParseRequest for IETF requests
+	// that do not list VersionIETF.
+	ErrUnsupportedVersion = errors.New("no supported version")
+)
+
+// ParseRequest parses a request received by a server and returns its nonce and
+// the protocol version to answer it with: VersionIETF for requests framed as
+// in the IETF draft and 0 for Google roughtime. The dialects can not be
+// confused, as the framing would be an impossible number of tags for an
+// unframed message.
+//
+// Requests must be padded to 1024 bytes, so that responses are not larger than
+// requests, or ErrRequestTooSmall is returned. ErrUnsupportedVersion is
+// returned for IETF requests not listing VersionIETF. Other errors describe
+// malformed requests, like a missing or invalid NONC or a VER tag that is not
+// a sorted list of at most 32 versions.
+//
+// OnlineKey.Respond uses ParseRequest to validate requests, so it can be used
+// by servers and middleboxes to reject requests before queueing them.
+func ParseRequest(b []byte) (nonce []byte, version uint32, err error) {
+	if len(b) < packetSize {
+		return nil, 0, fmt.Errorf("%w: %d bytes", ErrRequestTooSmall, len(b))
+	}
+	if !bytes.HasPrefix(b, []byte(frameMagic)) {
+		req := new(request)
+		if err := wire.Decode(b, req.decode); err != nil {
+			return nil, 0, err
+		}
+		return req.nonce[:], 0, nil
+	}
+	msg, err := unframe(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	req := new(ietfRequest)
+	if err := wire.Decode(msg, req.decode); err != nil {
+		return nil, 0, err
+	}
+	if !slices.Contains(req.versions, VersionIETF) {
+		return nil, 0, fmt.Errorf("%w in %#x", ErrUnsupportedVersion, req.versions)
+	}
+	return req.nonce[:], VersionIETF, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/wire"
+)
+
+func TestRespond(t *testing.T) {
+	s := newTestServer("test")
+	k, err := NewOnlineKey(s.root, s.min, s.max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := Interval{Midpoint: s.midpoint, Radius: s.radius}
+	if _, err := k.Respond(nil, Interval{Midpoint: s.max.Add(time.Second)}); err == nil {
+		t.Error("Respond() outside of delegation succeeded")
+	}
+	if _, err := k.Respond(nil, Interval{Midpoint: s.midpoint, Radius: 2 * time.Hour}); err == nil {
+		t.Error("Respond() with a radius of two hours succeeded")
+	}
+	for _, n := range []int{1, 2, 3, 5, 8, 13} {
+		var (
+			buf    [packetSize]byte
+			nonces [][]byte
+			reqs   [][]byte
+		)
+		for i := range n {
+			nonce := bytes.Repeat([]byte{byte(i)}, 64)
+			req, err := encodeRequest(&buf, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonces = append(nonces, nonce)
+			reqs = append(reqs, bytes.Clone(req))
+		}
+		// An invalid request in the middle of the batch.
+		reqs = append(reqs[:n/2], append([][]byte{[]byte("invalid")}, reqs[n/2:]...)...)
+		nonces = append(nonces[:n/2], append([][]byte{nil}, nonces[n/2:]...)...)
+
+		resps, err := k.Respond(reqs, iv)
+		if err != nil {
+			t.Fatalf("Respond(%d requests) = %v", n, err)
+		}
+		for i, resp := range resps {
+			if nonces[i] == nil {
+				if resp != nil {
+					t.Errorf("Respond(%d requests)[%d] = %x, want nil", n, i, resp)
+				}
+				continue
+			}
+			got, err := ParseResponse(resp, nonces[i], s.publicKey())
+			if err != nil || !got.Midpoint.Equal(iv.Midpoint) || got.Radius != iv.Radius {
+				t.Errorf("ParseResponse(Respond(%d requests)[%d]) = %v, %v, want %v, <nil>", n, i, got, err, iv)
+			}
+		}
+	}
+}
+
+// parseIETFResponse verifies an IETF response, like ParseResponse does for
+// Google roughtime.
+func parseIETFResponse(resp, nonce []byte, root ed25519.PublicKey) (Interval, error) {
+	msg, err := unframe(resp)
+	if err != nil {
+		return Interval{}, err
+	}
+	var res ietfResponse
+	if err := wire.Decode(msg, res.decode); err != nil {
+		return Interval{}, err
+	}
+	if res.version != VersionIETF {
+		return Interval{}, errors.New("wrong version")
+	}
+	if !bytes.Equal(res.nonce[:], nonce) {
+		return Interval{}, errors.New("wrong NONC")
+	}
+	if !ed25519.Verify(root, slices.Concat(contextCertificate, res.cert.delegation.raw), res.cert.signature[:]) {
+		return Interval{}, errors.New("bad delegation")
+	}
+	if !ed25519.Verify(res.cert.delegation.publicKey[:], slices.Concat(contextSignedResponse, res.srep.raw), res.signature[:]) {
+		return Interval{}, errors.New("bad signature")
+	}
+	hash := hashLeaf(nonce)
+	idx := res.index
+	for path := res.path; len(path) > 0; path = path[32:] {
+		if idx&1 == 0 {
+			hash = hashNode(hash[:32], path[:32])
+		} else {
+			hash = hashNode(path[:32], hash[:32])
+		}
+		idx >>= 1
+	}
+	if idx != 0 || [32]byte(hash[:32]) != res.srep.root {
+		return Interval{}, errors.New("nonce does not match")
+	}
+	if res.srep.midpoint.Before(res.cert.delegation.min) || res.srep.midpoint.After(res.cert.delegation.max) {
+		return Interval{}, errors.New("invalid midpoint")
+	}
+	return Interval{res.srep.midpoint, res.srep.radius}, nil
+}
+
+func TestRespondIETF(t *testing.T) {
+	s := newTestServer("test")
+	k, err := NewOnlineKey(s.root, s.min, s.max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := Interval{Midpoint: s.midpoint.Add(300 * time.Millisecond), Radius: 1500 * time.Millisecond}
+
+	google := bytes.Repeat([]byte{1}, 64)
+	var buf [packetSize]byte
+	greq, err := encodeRequest(&buf, google)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonces [][]byte
+	for i := range 3 {
+		nonces = append(nonces, bytes.Repeat([]byte{byte(i)}, 32))
+	}
+	reqs := [][]byte{
+		testIETFRequest(t, nonces[0], VersionIETF),
+		greq,
+		testIETFRequest(t, nonces[1], 1, VersionIETF),
+		testIETFRequest(t, nonces[2], 1),
+	}
+	resps, err := k.Respond(reqs, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(resps[1], google, s.publicKey()); err != nil {
+		t.Errorf("ParseResponse(Google response) = %v", err)
+	}
+	for i, resp := range [][]byte{resps[0], resps[2]} {
+		got, err := parseIETFResponse(resp, nonces[i], s.publicKey())
+		if err != nil {
+			t.Errorf("parseIETFResponse(Respond()[%d]) = %v", 2*i, err)
+			continue
+		}
+		if got.Midpoint.Add(-got.Radius).After(iv.Midpoint.Add(-iv.Radius)) || got.Midpoint.Add(got.Radius).Before(iv.Midpoint.Add(iv.Radius)) {
+			t.Errorf("parseIETFResponse(Respond()[%d]) = %v, does not cover %v", 2*i, got, iv)
+		}
+		if len(resp) > len(reqs[2*i]) {
+			t.Errorf("response of %d bytes to request of %d bytes", len(resp), len(reqs[2*i]))
+		}
+	}
+	if resps[3] != nil {
+		t.Errorf("Respond() answered request without a supported version")
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	nonce := bytes.Repeat([]byte{1}, 64)
+	var buf [packetSize]byte
+	greq, err := encodeRequest(&buf, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		req     []byte
+		nonce   []byte
+		version uint32
+		err     error
+	}{
+		{greq, nonce, 0, nil},
+		{testIETFRequest(t, nonce[:32], 1, VersionIETF), nonce[:32], VersionIETF, nil},
+		{greq[:packetSize-1], nil, 0, ErrRequestTooSmall},
+		{testIETFRequest(t, nonce[:32], 1), nil, 0, ErrUnsupportedVersion},
+	}
+	for i, tc := range tcs {
+		gotNonce, gotVersion, err := ParseRequest(tc.req)
+		if !bytes.Equal(gotNonce, tc.nonce) || gotVersion != tc.version || !errors.Is(err, tc.err) {
+			t.Errorf("%d: ParseRequest() = %x, %#x, %v, want %x, %#x, %v", i, gotNonce, gotVersion, err, tc.nonce, tc.version, tc.err)
+		}
+	}
+	for _, req := range [][]byte{testIETFRequest(t, nonce, VersionIETF), testRequest(t, nonce[:32], nil), make([]byte, packetSize)} {
+		if _, _, err := ParseRequest(req); err == nil {
+			t.Errorf("ParseRequest(%x) succeeded", req[:32])
+		}
+	}
+}
@@ -15,18 +15,19 @@
 package roughtime // import "github.com/Merovius/notary/roughtime"
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha512"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
-	"net"
+	"log/slog"
+	"sync"
 	"time"
 
-	config "github.com/Merovius/notary/internal/config"
-	"github.com/Merovius/notary/internal/wire"
-	"github.com/golang/protobuf/jsonpb"
-
-	"golang.org/x/crypto/ed25519"
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/wire"
 )
 
 var (
@@ -36,6 +37,7 @@ var (
 
 const (
 	tSIG  wire.Tag = 0x00474953
+	tVER           = 0x00524556
 	tNONC          = 0x434e4f4e
 	tDELE          = 0x454c4544
 	tPATH          = 0x48544150
@@ -53,12 +55,37 @@ const (
 
 type request struct {
 	nonce [64]byte
+	// versions are the protocol versions supported by the client, in
+	// ascending order, or nil if the request does not contain a VER tag.
+	versions []uint32
 }
 
+// maxVersions is the maximum number of versions accepted in a request.
+const maxVersions = 32
+
 func (r *request) decode(st *wire.DecodeState) {
+	var ver []byte
+	if st.BytesOptional(tVER, &ver) {
+		r.versions = decodeVersions(st, ver)
+	}
 	st.Bytes64(tNONC, &r.nonce)
 }
 
+// decodeVersions decodes the value of the VER tag of a request.
+func decodeVersions(st *wire.DecodeState, ver []byte) []uint32 {
+	if len(ver) == 0 || len(ver)%4 != 0 || len(ver) > 4*maxVersions {
+		st.Abort(errors.New("invalid VER"))
+	}
+	versions := make([]uint32, len(ver)/4)
+	for i := range versions {
+		versions[i] = binary.LittleEndian.Uint32(ver[4*i:])
+		if i > 0 && versions[i] <= versions[i-1] {
+			st.Abort(errors.New("VER not in ascending order"))
+		}
+	}
+	return versions
+}
+
 func (r *request) encode(st *wire.EncodeState) {
 	st.NTags(2)
 	st.Bytes64(tNONC, r.nonce)
@@ -69,25 +96,34 @@ func (r *request) encode(st *wire.EncodeState) {
 type response struct {
 	signedResponse
 	signature [64]byte
-	index     uint32
-	path      [][64]byte
+	// version is the protocol version announced by the server, or 0 if the
+	// response does not contain one.
+	version uint32
+	index   uint32
+	// path contains the concatenated 64 byte hashes of the Merkle path.
+	// After decoding, it aliases the message buffer.
+	path []byte
 	certificate
 }
 
+// maxPathDepth is the maximum number of PATH entries accepted in a response.
+// It corresponds to a batch of 2^32 requests, which is the most INDX can
+// address.
+const maxPathDepth = 32
+
 func (r *response) decodePath(st *wire.DecodeState) {
-	var path []byte
-	st.Bytes(tPATH, &path)
-	if len(path)%64 != 0 {
+	st.Bytes(tPATH, &r.path)
+	if len(r.path)%64 != 0 {
 		st.Abort(errors.New("invalid PATH"))
 	}
-	r.path = make([][64]byte, len(path)/64)
-	for i, j := 0, 0; i < len(path); i, j = i+64, j+1 {
-		copy(r.path[j][:], path[i:])
+	if len(r.path)/64 > maxPathDepth {
+		st.Abort(errors.New("PATH too long"))
 	}
 }
 
 func (r *response) decode(st *wire.DecodeState) {
 	st.Bytes64(tSIG, &r.signature)
+	st.Uint32Optional(tVER, &r.version)
 	r.decodePath(st)
 	st.Message(tSREP, &r.signedResponse.raw, r.signedResponse.decode)
 	st.Message(tCERT, &r.certificate.raw, r.certificate.decode)
@@ -95,13 +131,36 @@ func (r *response) decode(st *wire.DecodeState) {
 }
 
 func (r *response) encode(st *wire.EncodeState) {
-	st.NTags(4)
+	st.NTags(5)
 	st.Bytes64(tSIG, r.signature)
+	copy(st.Bytes(tPATH, len(r.path)), r.path)
 	st.Message(tSREP, r.signedResponse.encode)
 	st.Message(tCERT, r.certificate.encode)
 	st.Uint32(tINDX, r.index)
 }
 
+// matches reports whether the Merkle path of r leads from nonce to the signed
+// root.
+func (r *response) matches(nonce []byte) bool {
+	return r.merkleRoot(nonce) == r.root
+}
+
+// merkleRoot returns the root of the Merkle tree reconstructed from nonce and
+// the index and path of r.
+func (r *response) merkleRoot(nonce []byte) [64]byte {
+	idx, path := r.index, r.path
+	hash := hashLeaf(nonce)
+	for ; len(path) >= 64; path = path[64:] {
+		if idx&1 == 0 {
+			hash = hashNode(hash[:], path[:64])
+		} else {
+			hash = hashNode(path[:64], hash[:])
+		}
+		idx >>= 1
+	}
+	return hash
+}
+
 type signedResponse struct {
 	raw []byte
 
@@ -118,9 +177,9 @@ func (r *signedResponse) decode(st *wire.DecodeState) {
 
 func (r *signedResponse) encode(st *wire.EncodeState) {
 	st.NTags(3)
-	st.Bytes64(tROOT, r.root)
-	st.Time(tMIDP, r.midpoint)
 	st.Duration(tRADI, r.radius)
+	st.Time(tMIDP, r.midpoint)
+	st.Bytes64(tROOT, r.root)
 }
 
 type certificate struct {
@@ -157,9 +216,9 @@ func (d *delegation) decode(st *wire.DecodeState) {
 
 func (d *delegation) encode(st *wire.EncodeState) {
 	st.NTags(3)
+	st.Bytes32(tPUBK, d.publicKey)
 	st.Time(tMINT, d.min)
 	st.Time(tMAXT, d.max)
-	st.Bytes32(tPUBK, d.publicKey)
 }
 
 func hashLeaf(b []byte) [64]byte {
@@ -171,12 +230,12 @@ func hashLeaf(b []byte) [64]byte {
 	return res
 }
 
-func hashNode(l, r [64]byte) [64]byte {
+func hashNode(l, r []byte) [64]byte {
 	var res [64]byte
 	h := sha512.New()
 	h.Write([]byte{1})
-	h.Write(l[:])
-	h.Write(r[:])
+	h.Write(l)
+	h.Write(r)
 	h.Sum(res[:0])
 	return res
 }
@@ -193,173 +252,487 @@ func ensureNonce(nonce []byte) ([]byte, error) {
 	return nonce, err
 }
 
+// A NetError is returned if a server could not be queried.
+type NetError struct {
+	Address string
+	Err     error
+}
+
+func (e *NetError) Error() string {
+	return "querying " + e.Address + ": " + e.Err.Error()
+}
+
+func (e *NetError) Unwrap() error {
+	return e.Err
+}
+
+// A VerifyError is returned if a server response is malformed or fails
+// cryptographic verification.
+type VerifyError struct {
+	Err error
+}
+
+func (e *VerifyError) Error() string {
+	return "verification failed: " + e.Err.Error()
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
 // Server configures a server to connect to.
 type Server struct {
+	// Name is the name of the server. It is optional and only used to
+	// describe the server in results and logs.
+	Name      string
 	Address   string
 	PublicKey ed25519.PublicKey
 }
 
-func fetchRoughtime(s *Server, nonce []byte) ([]byte, error) {
-	a, err := net.ResolveUDPAddr("udp", s.Address)
-	if err != nil {
-		return nil, err
+// Result describes a verified response of a server.
+type Result struct {
+	// Measurement is the time claimed by the server and when it was
+	// queried.
+	Measurement
+	// Server is the name of the server, if known.
+	Server string
+	// PublicKey is the long-term key of the server, which the response was
+	// verified with.
+	PublicKey ed25519.PublicKey
+	// Address is the address the server was queried at.
+	Address string
+	// Version is the protocol version announced by the server, or 0 if the
+	// response does not contain one, as in the original Google protocol.
+	Version uint32
+	// Delegation is the validity window of the key the response was signed
+	// with.
+	Delegation Delegation
+	// Nonce is the nonce sent to the server and Reply its raw response.
+	Nonce []byte
+	Reply []byte
+}
+
+// Delegation is the validity window of the online key of a server, as
+// certified by its long-term key (MINT and MAXT). Servers rotate their online
+// key before it expires; a server still using an expired key gives responses
+// that fail verification.
+type Delegation struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// linkResult returns the parts of r describing a link of a chain.
+func (r *Result) linkResult() LinkResult {
+	return LinkResult{Server: r.Server, Address: r.Address, Interval: r.Interval, Sent: r.Sent, RTT: r.RTT}
+}
+
+// Client queries roughtime servers. The zero value is ready to use. The
+// package-level functions use a zero Client.
+type Client struct {
+	// Logger receives debug information about queries and verification
+	// steps. If nil, nothing is logged.
+	Logger *slog.Logger
+
+	// MaxRadius is the largest uncertainty radius accepted in a response.
+	// Responses claiming a larger radius fail verification. If zero,
+	// DefaultMaxRadius is used. If negative, the radius is not checked.
+	MaxRadius time.Duration
+
+	// AllowUnknownKeys makes VerifyChain accept links signed by servers that
+	// are not in the given server list. This is useful to audit chains
+	// created by others, but means that the chain only proves what the
+	// (unknown) servers claim.
+	AllowUnknownKeys bool
+
+	// KeyArchive lists former keys of servers. Chains and attestations
+	// signed with a key that is not in the server list are accepted if it
+	// is in the archive and the time claimed by the response is in the
+	// period the key was in use.
+	KeyArchive *config.KeyArchive
+
+	// Policy, if set, is enforced by VerifyChain. See Policy for details.
+	Policy *Policy
+
+	// VerifyLink, if set, is called by VerifyChain for every link, in
+	// order, after it was verified. If it returns an error, verification
+	// fails with it. It can be used to implement custom policies, like
+	// allowing only certain servers, or to log links.
+	VerifyLink func(LinkResult) error
+
+	// BatchVerifier, if set, is used by VerifyChain to check the signatures
+	// of all links at once. If the batch fails, the links are verified one
+	// by one, to report the first invalid one.
+	BatchVerifier BatchVerifier
+
+	// TrustUnknownKey, if set, decides whether VerifyChain and
+	// VerifyAttestation accept a key that is neither in the server list nor
+	// in KeyArchive, instead of AllowUnknownKeys. It is called after the
+	// response signed by key was verified, with the address the server was
+	// queried at, if known. For chains, the address is taken from the link
+	// metadata and is not authenticated. If it returns an error,
+	// verification fails with it. This can be used to trust servers on
+	// first use.
+	TrustUnknownKey func(address string, key ed25519.PublicKey) error
+
+	// Timeout is how long to wait for the response of a server. If zero,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+
+	// MaxRTT is the longest round-trip time accepted for a query. The
+	// uncertainty of a measurement is its radius plus half the round-trip
+	// time, so high-accuracy uses can reject slow responses. Rejected
+	// responses fail with a *NetError. If zero, any response received
+	// before Timeout is accepted.
+	MaxRTT time.Duration
+
+	// DelegationWarning, if positive, makes the client log a warning when
+	// the delegation of a response expires within this duration. Servers
+	// still using an expired delegation give responses that fail
+	// verification, so this predicts failures. Each delegation is only
+	// warned about once.
+	DelegationWarning time.Duration
+
+	// MinLinks makes Chain skip servers that can not be queried or return
+	// invalid responses, as long as at least MinLinks links are created.
+	// Skipped servers are recorded in the chain. If zero, Chain fails if
+	// any server fails.
+	MinLinks int
+
+	// DoubleCheck makes Append and Attest query every server a second time,
+	// with an independent random nonce, and reject the server if its two
+	// answers are inconsistent. This catches servers that flap or that lie
+	// selectively, at the cost of twice the queries.
+	DoubleCheck bool
+
+	// BlindSeed makes Append derive the blinds of new links from the seed,
+	// the nonce of the chain and the index of the link, instead of using
+	// random blinds. This makes chains reproducible: a lost chain can be
+	// restored from the seed and the server replies with RestoreChain. The
+	// seed must be kept secret and should be at least 32 random bytes.
+	BlindSeed []byte
+
+	// Recorder, if set, is informed about all queries made by the client.
+	// It can be used to collect metrics.
+	Recorder Recorder
+
+	// Progress, if set, is called for every step of long operations, like
+	// querying a server, so progress can be displayed. It is called
+	// concurrently by Query and must be safe for concurrent use.
+	Progress func(Event)
+
+	// Order, if set, is called with the usable servers of ExtendChain and
+	// Attest and returns them in the order they should be queried. It can
+	// be used to prefer servers that were reliable in the past.
+	Order func([]*config.Server) []*config.Server
+
+	// Transport is used to send requests to servers. If nil, requests are
+	// sent directly over UDP.
+	Transport Transport
+
+	// Backoff, if set, makes the client pause querying servers that did
+	// not respond, as they might be rate-limiting it. See Backoff for
+	// details.
+	Backoff *Backoff
+
+	// warned contains the delegationKeys warned about.
+	warned sync.Map
+
+	// delegations caches verified delegations.
+	delegations delegationCache
+
+	// loss contains the LossStats of addresses queried with Query.
+	lossMu sync.Mutex
+	loss   map[string]*LossStats
+}
+
+// A Recorder is informed about queries made by a Client. Its methods must be
+// safe for concurrent use.
+type Recorder interface {
+	// RecordQuery is called after each query of the server at address. err
+	// is the error querying or verifying the response, if any.
+	RecordQuery(address string, rtt time.Duration, err error)
+	// RecordOffset is called for each verified response, with the
+	// difference between the midpoint of the server and the local clock at
+	// the middle of the round trip.
+	RecordOffset(address string, offset time.Duration)
+}
+
+// DefaultTimeout is the timeout used by a Client with no Timeout set.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxRadius is the largest radius accepted by a Client with no
+// MaxRadius set. Well-behaved servers report radii of about a second.
+const DefaultMaxRadius = 10 * time.Second
+
+var defaultClient Client
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return c.Logger
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) transport() Transport {
+	if c.Transport == nil {
+		return defaultTransport
+	}
+	return c.Transport
+}
+
+func (c *Client) maxRadius() time.Duration {
+	if c.MaxRadius == 0 {
+		return DefaultMaxRadius
+	}
+	return c.MaxRadius
+}
+
+// fetchRoughtime queries s and returns the response and the round-trip time.
+func (c *Client) fetchRoughtime(s *Server, nonce []byte) ([]byte, time.Duration, error) {
+	log := c.logger().With("address", s.Address)
+	log.Debug("querying server")
+	start := time.Now()
+	resp, err := c.roundTrip(s, nonce)
+	rtt := time.Since(start)
+	if err == nil {
+		err = c.checkRTT(s.Address, rtt)
 	}
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
 	if err != nil {
-		return nil, err
+		log.Debug("query failed", "duration", rtt, "error", err)
+		return nil, rtt, err
 	}
-	defer conn.Close()
+	log.Debug("received response", "duration", rtt, "size", len(resp))
+	return resp, rtt, nil
+}
 
+// checkRTT returns a *NetError if rtt exceeds c.MaxRTT.
+func (c *Client) checkRTT(address string, rtt time.Duration) error {
+	if c.MaxRTT > 0 && rtt > c.MaxRTT {
+		return &NetError{address, fmt.Errorf("round-trip time %v exceeds maximum of %v", rtt, c.MaxRTT)}
+	}
+	return nil
+}
+
+// delegationKey identifies a delegation of a server.
+type delegationKey struct {
+	address  string
+	notAfter int64
+}
+
+// checkDelegation warns if the delegation of a response from address expires
+// within c.DelegationWarning.
+func (c *Client) checkDelegation(address string, d Delegation) {
+	if c.DelegationWarning <= 0 || time.Until(d.NotAfter) > c.DelegationWarning {
+		return
+	}
+	if _, loaded := c.warned.LoadOrStore(delegationKey{address, d.NotAfter.UnixNano()}, true); loaded {
+		return
+	}
+	c.logger().Warn("server delegation expires soon", "address", address, "notAfter", d.NotAfter)
+}
+
+func (c *Client) roundTrip(s *Server, nonce []byte) ([]byte, error) {
 	if len(nonce) != 64 {
 		panic("nonce has wrong length")
 	}
+	buf := getPacket()
+	defer packetPool.Put(buf)
+	msg, err := encodeRequest(buf, nonce)
+	if err != nil {
+		return nil, &NetError{s.Address, err}
+	}
+	resp, err := c.transport().RoundTrip(s.Address, msg, c.timeout())
+	if err != nil {
+		return nil, &NetError{s.Address, err}
+	}
+	return resp, nil
+}
+
+// packetSize is the size of requests.
+const packetSize = 1024
+
+// MaxResponseSize is the size of the largest response accepted. Responses must
+// not be larger than requests, so that servers can not be abused to amplify
+// traffic. Larger responses fail with ErrResponseTooLarge.
+const MaxResponseSize = packetSize
+
+// ErrResponseTooLarge is returned, wrapped in a *NetError, if a response is
+// larger than MaxResponseSize.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// packetPool contains buffers for request packets, so that frequent queries do
+// not churn the garbage collector.
+var packetPool = sync.Pool{New: func() any { return new([packetSize]byte) }}
+
+func getPacket() *[packetSize]byte {
+	return packetPool.Get().(*[packetSize]byte)
+}
 
+// responsePool contains buffers to receive responses into. They have room for
+// one byte more than the largest acceptable response, so that larger responses
+// are detected instead of silently truncated.
+var responsePool = sync.Pool{New: func() any { return new([MaxResponseSize + 1]byte) }}
+
+func getResponseBuffer() *[MaxResponseSize + 1]byte {
+	return responsePool.Get().(*[MaxResponseSize + 1]byte)
+}
+
+// encodeRequest encodes a request for nonce into buf.
+func encodeRequest(buf *[packetSize]byte, nonce []byte) ([]byte, error) {
 	var req request
 	copy(req.nonce[:], nonce)
-	msg := wire.Encode(req.encode)
-	if len(msg) != 1024 {
-		panic("message too short")
-	}
-	_, err = conn.WriteTo(msg, a)
+	msg, err := wire.Append(buf[:0], req.encode)
 	if err != nil {
 		return nil, err
 	}
-	msg = msg[:1024]
-	n, _, err := conn.ReadFromUDP(msg)
-	if err != nil {
-		return nil, err
+	if len(msg) != packetSize {
+		panic("message too short")
 	}
-	return msg[:n], nil
+	return msg, nil
 }
 
 // FetchRoughtime fetches the current time from the given server, using the
 // given nonce. Nonce has to be 64 bytes long or nil, in which case a random
 // nonce is generated. The server response is verified and any verification
 // error is returned.
-func FetchRoughtime(s *Server, nonce []byte) (m time.Time, r time.Duration, err error) {
-	nonce, err = ensureNonce(nonce)
-	if err != nil {
-		return m, r, err
-	}
-	msg, err := fetchRoughtime(s, nonce)
+func FetchRoughtime(s *Server, nonce []byte) (*Result, error) {
+	return defaultClient.FetchRoughtime(s, nonce)
+}
+
+// FetchRoughtime is like the package-level FetchRoughtime, but uses c.
+func (c *Client) FetchRoughtime(s *Server, nonce []byte) (*Result, error) {
+	nonce, err := ensureNonce(nonce)
 	if err != nil {
-		return m, r, err
+		return nil, err
 	}
-	return ParseResponse(msg, nonce, s.PublicKey)
+	return c.query(s, nonce)
 }
 
-// ParseResponse parses a roughtime response and validates it against the given
-// nonce and root key. Any validation error is returned.
-func ParseResponse(resp, nonce []byte, root ed25519.PublicKey) (m time.Time, r time.Duration, err error) {
-	var res response
-	if err := wire.Decode(resp, res.decode); err != nil {
-		return time.Time{}, 0, err
-	}
-	if len(nonce) != 64 {
-		panic("nonce needs to have 64 bytes")
+// query fetches and verifies a response from s and informs c.Recorder.
+func (c *Client) query(s *Server, nonce []byte) (*Result, error) {
+	if err := c.checkBackoff(s); err != nil {
+		return nil, err
 	}
-	if !ed25519.Verify(root, append(contextCertificate, res.certificate.delegation.raw...), res.certificate.signature[:]) {
-		return time.Time{}, 0, errors.New("bad delegation")
+	c.progress(Event{Type: EventQuery, Server: s.Name, Address: s.Address})
+	res := &Result{Server: s.Name, PublicKey: s.PublicKey, Address: s.Address, Measurement: Measurement{Sent: time.Now()}, Nonce: nonce}
+	var err error
+	res.Reply, res.RTT, err = c.fetchRoughtime(s, nonce)
+	if err == nil {
+		res.Interval, res.Version, res.Delegation, err = parseResponseWith(res.Reply, nonce, s.PublicKey, c.maxRadius(), &c.delegations, ed25519.Verify)
+		if err != nil {
+			err = &VerifyError{err}
+			c.logger().Debug("verification failed", "address", s.Address, "error", err)
+		} else {
+			c.logger().Debug("verified response", "address", s.Address, "midpoint", res.Midpoint, "radius", res.Radius)
+			c.checkDelegation(s.Address, res.Delegation)
+		}
 	}
-	if !ed25519.Verify(res.certificate.delegation.publicKey[:], append(contextSignedResponse, res.signedResponse.raw...), res.signature[:]) {
-		return time.Time{}, 0, errors.New("bad signature")
+	c.record(s, res.Sent, res.RTT, res.Interval, err)
+	if err != nil {
+		return nil, err
 	}
+	return res, nil
+}
 
-	idx := res.index
-	path := res.path
-	hash := hashLeaf(nonce)
-	for len(path) > 0 {
-		if idx&1 == 0 {
-			hash = hashNode(hash, path[0])
-		} else {
-			hash = hashNode(path[0], hash)
+// record informs c.Recorder, c.Progress and c.Backoff about a query of s sent
+// at the given time.
+func (c *Client) record(s *Server, sent time.Time, rtt time.Duration, iv Interval, err error) {
+	if c.Backoff != nil {
+		if until, ok := c.Backoff.record(s.Address, err); ok {
+			c.logger().Debug("server did not respond, cooling down", "address", s.Address, "until", until)
 		}
-		idx >>= 1
-		path = path[1:]
 	}
-	if hash != res.root {
-		return time.Time{}, 0, errors.New("nonce does not match")
+	if err != nil {
+		c.progress(Event{Type: EventFailed, Server: s.Name, Address: s.Address, RTT: rtt, Err: err})
+	} else {
+		c.progress(Event{Type: EventVerified, Server: s.Name, Address: s.Address, Interval: iv, RTT: rtt})
 	}
-
-	mp := res.midpoint
-	if mp.Before(res.min) || mp.After(res.max) {
-		return time.Time{}, 0, errors.New("invalid midpoint")
+	if c.Recorder == nil {
+		return
+	}
+	c.Recorder.RecordQuery(s.Address, rtt, err)
+	if err == nil {
+		c.Recorder.RecordOffset(s.Address, iv.Midpoint.Sub(sent.Add(rtt/2)))
 	}
-	return res.midpoint, res.radius, nil
 }
 
-// Chain runs a chain of request against a list of servers and stores the
-// result as JSON in w.
-func Chain(w io.Writer, s *config.ServersJSON, nonce []byte) error {
-	nonce, err := ensureNonce(nonce)
-	if err != nil {
-		return err
-	}
+// ParseResponse parses a roughtime response and validates it against the given
+// nonce and root key. Responses with a radius larger than DefaultMaxRadius are
+// rejected. Any validation error is returned as a *VerifyError.
+func ParseResponse(resp, nonce []byte, root ed25519.PublicKey) (Interval, error) {
+	return defaultClient.ParseResponse(resp, nonce, root)
+}
 
-	c := new(config.Chain)
-	c.Links = make([]*config.Link, len(s.Servers))
-	for i, s := range s.Servers {
-		l := &config.Link{
-			PublicKeyType:   s.PublicKeyType,
-			ServerPublicKey: s.PublicKey,
-		}
-		l.NonceOrBlind = nonce
-		if i > 0 {
-			l.NonceOrBlind = make([]byte, 64)
-			_, err = io.ReadFull(rand.Reader, l.NonceOrBlind)
-			if err != nil {
-				return err
-			}
-			nonce = hash512(hash512(c.Links[i-1].Reply), l.NonceOrBlind)
-		}
-		resp, err := fetchRoughtime(&Server{Address: s.Addresses[0].Address, PublicKey: s.PublicKey}, nonce)
-		if err != nil {
-			return err
-		}
-		l.Reply = resp
-		c.Links[i] = l
-		if _, _, err = ParseResponse(resp, nonce, s.PublicKey); err != nil {
-			return err
-		}
+// ParseResponse is like the package-level ParseResponse, but uses the
+// MaxRadius of c.
+func (c *Client) ParseResponse(resp, nonce []byte, root ed25519.PublicKey) (Interval, error) {
+	iv, _, err := c.verify(resp, nonce, root)
+	return iv, err
+}
+
+// verify is like ParseResponse, but also returns the delegation of the
+// response.
+func (c *Client) verify(resp, nonce []byte, root ed25519.PublicKey) (Interval, Delegation, error) {
+	iv, _, dele, err := parseResponseWith(resp, nonce, root, c.maxRadius(), &c.delegations, ed25519.Verify)
+	if err != nil {
+		return Interval{}, Delegation{}, &VerifyError{err}
 	}
-	return new(jsonpb.Marshaler).Marshal(w, c)
+	return iv, dele, nil
 }
 
-// ReadServersJSON reads a servers.json from r.
-func ReadServersJSON(r io.Reader) (*config.ServersJSON, error) {
-	servers := new(config.ServersJSON)
-	return servers, jsonpb.Unmarshal(r, servers)
+func parseResponse(resp, nonce []byte, root ed25519.PublicKey, maxRadius time.Duration) (iv Interval, version uint32, dele Delegation, err error) {
+	return parseResponseWith(resp, nonce, root, maxRadius, nil, ed25519.Verify)
 }
 
-// VerifyChain verifies the given chain against the list of servers and outputs
-// any validation errors.
-func VerifyChain(c *config.Chain, s *config.ServersJSON) error {
-	byKey := make(map[string]string)
-	for _, s := range s.Servers {
-		byKey[string(s.PublicKey)] = s.Name
+// parseResponseWith is like parseResponse, but checks signatures with verify
+// and skips checking delegations in cache. The message passed to verify is
+// only valid during the call.
+func parseResponseWith(resp, nonce []byte, root ed25519.PublicKey, maxRadius time.Duration, cache *delegationCache, verify func(pub ed25519.PublicKey, msg, sig []byte) bool) (iv Interval, version uint32, dele Delegation, err error) {
+	var res response
+	if err := wire.Decode(resp, res.decode); err != nil {
+		return Interval{}, 0, Delegation{}, err
 	}
-	var prevHash []byte
-	for i, l := range c.Links {
-		nonce := l.NonceOrBlind
-		if i > 0 {
-			nonce = hash512(prevHash, l.NonceOrBlind)
-		}
-		_, _, err := ParseResponse(l.Reply, nonce, l.ServerPublicKey)
-		if err != nil {
-			return err
+	if len(nonce) != 64 {
+		panic("nonce needs to have 64 bytes")
+	}
+	if len(root) != ed25519.PublicKeySize {
+		return Interval{}, 0, Delegation{}, errors.New("invalid public key")
+	}
+	// The signed messages are small, so assembling them in buf avoids
+	// allocations.
+	var buf [256]byte
+	if d := &res.certificate.delegation; !cache.contains(root, d.raw) {
+		if !verify(root, append(append(buf[:0], contextCertificate...), d.raw...), res.certificate.signature[:]) {
+			return Interval{}, 0, Delegation{}, errors.New("bad delegation")
 		}
-		prevHash = hash512(l.Reply)
+		cache.add(root, d.raw, d.max)
+	}
+	if !verify(res.certificate.delegation.publicKey[:], append(append(buf[:0], contextSignedResponse...), res.signedResponse.raw...), res.signature[:]) {
+		return Interval{}, 0, Delegation{}, errors.New("bad signature")
 	}
-	return nil
-}
 
-// LoadChain loads a serialized chain from r.
-func LoadChain(r io.Reader) (*config.Chain, error) {
-	c := new(config.Chain)
-	if err := jsonpb.Unmarshal(r, c); err != nil {
-		return nil, err
+	if uint64(res.index)>>(len(res.path)/64) != 0 {
+		return Interval{}, 0, Delegation{}, errors.New("INDX out of range for PATH")
+	}
+	if !res.matches(nonce) {
+		return Interval{}, 0, Delegation{}, errors.New("nonce does not match")
+	}
+
+	mp := res.midpoint
+	if mp.Before(res.min) || mp.After(res.max) {
+		return Interval{}, 0, Delegation{}, errors.New("invalid midpoint")
+	}
+	if maxRadius >= 0 && res.radius > maxRadius {
+		return Interval{}, 0, Delegation{}, fmt.Errorf("radius %v exceeds maximum of %v", res.radius, maxRadius)
 	}
-	return c, nil
+	return Interval{res.midpoint, res.radius}, res.version, Delegation{res.certificate.min, res.certificate.max}, nil
 }
 
 func hash512(b ...[]byte) []byte {
@@ -0,0 +1,867 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/wire"
+)
+
+// testServer creates responses like a roughtime server would.
+type testServer struct {
+	name     string
+	root     ed25519.PrivateKey
+	online   ed25519.PrivateKey
+	min, max time.Time
+	radius   time.Duration
+
+	// mu guards midpoint, which tests may change while the server is served.
+	mu       sync.Mutex
+	midpoint time.Time
+}
+
+var testEpoch = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestServer(name string) *testServer {
+	seed := sha512.Sum512([]byte(name))
+	return &testServer{
+		name:     name,
+		root:     ed25519.NewKeyFromSeed(seed[:32]),
+		online:   ed25519.NewKeyFromSeed(seed[32:]),
+		min:      testEpoch.Add(-24 * time.Hour),
+		max:      testEpoch.Add(24 * time.Hour),
+		midpoint: testEpoch,
+		radius:   time.Second,
+	}
+}
+
+func (s *testServer) publicKey() ed25519.PublicKey {
+	return s.root.Public().(ed25519.PublicKey)
+}
+
+// setMidpoint changes the midpoint of responses created later.
+func (s *testServer) setMidpoint(t time.Time) {
+	s.mu.Lock()
+	s.midpoint = t
+	s.mu.Unlock()
+}
+
+func (s *testServer) config() *config.Server {
+	return &config.Server{
+		Name:          s.name,
+		PublicKeyType: "ed25519",
+		PublicKey:     s.publicKey(),
+		Addresses:     []*config.ServerAddress{{Protocol: "udp", Address: s.name + ":2002"}},
+	}
+}
+
+// respond creates responses for a batch of nonces. The number of nonces must
+// be a power of two.
+func (s *testServer) respond(nonces ...[]byte) [][]byte {
+	var c certificate
+	copy(c.delegation.publicKey[:], s.online.Public().(ed25519.PublicKey))
+	c.delegation.min, c.delegation.max = s.min, s.max
+	dele := wire.Encode(c.delegation.encode)
+	copy(c.signature[:], ed25519.Sign(s.root, concat(contextCertificate, dele)))
+
+	levels := [][][64]byte{make([][64]byte, len(nonces))}
+	for i, n := range nonces {
+		levels[0][i] = hashLeaf(n)
+	}
+	for l := levels[0]; len(l) > 1; l = levels[len(levels)-1] {
+		next := make([][64]byte, len(l)/2)
+		for i := range next {
+			next[i] = hashNode(l[2*i][:], l[2*i+1][:])
+		}
+		levels = append(levels, next)
+	}
+
+	s.mu.Lock()
+	sr := signedResponse{root: levels[len(levels)-1][0], midpoint: s.midpoint, radius: s.radius}
+	s.mu.Unlock()
+	var sig [64]byte
+	copy(sig[:], ed25519.Sign(s.online, concat(contextSignedResponse, wire.Encode(sr.encode))))
+
+	resps := make([][]byte, len(nonces))
+	for i := range nonces {
+		r := response{signedResponse: sr, signature: sig, index: uint32(i), certificate: c}
+		for l := 0; l < len(levels)-1; l++ {
+			r.path = append(r.path, levels[l][(i>>l)^1][:]...)
+		}
+		resps[i] = wire.Encode(r.encode)
+	}
+	return resps
+}
+
+// testChain creates a chain for nonce, using the given servers.
+func testChain(nonce []byte, servers ...*testServer) *Chain {
+	c := new(Chain)
+	for i, s := range servers {
+		l := &config.Link{
+			PublicKeyType:   "ed25519",
+			ServerPublicKey: s.publicKey(),
+			NonceOrBlind:    nonce,
+		}
+		n := nonce
+		if i > 0 {
+			l.NonceOrBlind = bytes.Repeat([]byte{byte(i)}, 64)
+			n = hash512(hash512(c.Links[i-1].Reply), l.NonceOrBlind)
+		}
+		l.Reply = s.respond(n)[0]
+		c.Links = append(c.Links, l)
+	}
+	return c
+}
+
+func concat(b ...[]byte) []byte {
+	return bytes.Join(b, nil)
+}
+
+func TestParseResponse(t *testing.T) {
+	s := newTestServer("test")
+	nonces := make([][]byte, 4)
+	for i := range nonces {
+		nonces[i] = bytes.Repeat([]byte{byte(i)}, 64)
+	}
+	for i, resp := range s.respond(nonces...) {
+		iv, err := ParseResponse(resp, nonces[i], s.publicKey())
+		if err != nil || !iv.Midpoint.Equal(s.midpoint) || iv.Radius != s.radius {
+			t.Errorf("ParseResponse(batch[%d]) = %v, %v, want %v, <nil>", i, iv, err, Interval{s.midpoint, s.radius})
+		}
+	}
+
+	nonce := nonces[0]
+	resp := s.respond(nonce)[0]
+	tampered := concat(resp)
+	tampered[len(tampered)/2] ^= 1
+	expired := newTestServer("test")
+	expired.midpoint = expired.max.Add(time.Second)
+	imprecise := newTestServer("test")
+	imprecise.radius = time.Hour
+	var badIndex, longPath response
+	if err := wire.Decode(resp, badIndex.decode); err != nil {
+		t.Fatal(err)
+	}
+	badIndex.index = 1
+	longPath = badIndex
+	longPath.index = 0
+	longPath.path = make([]byte, 64*(maxPathDepth+1))
+	tcs := []struct {
+		name  string
+		resp  []byte
+		nonce []byte
+		key   ed25519.PublicKey
+	}{
+		{"wrong nonce", resp, nonces[1], s.publicKey()},
+		{"wrong key", resp, nonce, newTestServer("other").publicKey()},
+		{"short key", resp, nonce, s.publicKey()[:16]},
+		{"truncated", resp[:len(resp)-4], nonce, s.publicKey()},
+		{"tampered", tampered, nonce, s.publicKey()},
+		{"invalid midpoint", expired.respond(nonce)[0], nonce, s.publicKey()},
+		{"large radius", imprecise.respond(nonce)[0], nonce, s.publicKey()},
+		{"invalid index", wire.Encode(badIndex.encode), nonce, s.publicKey()},
+		{"long path", wire.Encode(longPath.encode), nonce, s.publicKey()},
+	}
+	for _, tc := range tcs {
+		_, err := ParseResponse(tc.resp, tc.nonce, tc.key)
+		var verr *VerifyError
+		if !errors.As(err, &verr) {
+			t.Errorf("ParseResponse(%s) = %v, want *VerifyError", tc.name, err)
+		}
+	}
+}
+
+func TestCountersignNonce(t *testing.T) {
+	nonce := func(artifact, sig string) []byte {
+		t.Helper()
+		n, err := CountersignNonce(SHA256, strings.NewReader(artifact), strings.NewReader(sig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	n := nonce("artifact", "signature")
+	if len(n) != 64 {
+		t.Fatalf("CountersignNonce() has length %d, want 64", len(n))
+	}
+	if bytes.Equal(n, nonce("artifact", "other signature")) || bytes.Equal(n, nonce("other artifact", "signature")) || bytes.Equal(n, nonce("signature", "artifact")) {
+		t.Error("CountersignNonce() does not depend on both inputs")
+	}
+	if plain, _ := HashNonce(SHA256, strings.NewReader("artifactsignature")); bytes.Equal(n, plain) {
+		t.Error("CountersignNonce() = HashNonce() of the concatenation")
+	}
+}
+
+func TestHasher(t *testing.T) {
+	data := bytes.Repeat([]byte("notary"), 3*hashChunkSize/5)
+	want, err := HashNonce(BLAKE2b, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSig, err := CountersignNonce(BLAKE2b, bytes.NewReader(data), strings.NewReader("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, readAhead := range []bool{false, true} {
+		var got []int64
+		h := &Hasher{Algorithm: BLAKE2b, ReadAhead: readAhead, Progress: func(n int64) { got = append(got, n) }}
+		// HalfReader makes sure that short reads are combined into full
+		// chunks.
+		n, err := h.Nonce(iotest.HalfReader(bytes.NewReader(data)))
+		if err != nil || !bytes.Equal(n, want) {
+			t.Errorf("Hasher{ReadAhead: %v}.Nonce() = %x, %v, want %x, <nil>", readAhead, n, err, want)
+		}
+		if want := []int64{hashChunkSize, 2 * hashChunkSize, 3 * hashChunkSize, int64(len(data))}; !slices.Equal(got, want) {
+			t.Errorf("Hasher{ReadAhead: %v} reported progress %v, want %v", readAhead, got, want)
+		}
+
+		got = nil
+		n, err = h.CountersignNonce(bytes.NewReader(data), strings.NewReader("signature"))
+		if err != nil || !bytes.Equal(n, wantSig) {
+			t.Errorf("Hasher{ReadAhead: %v}.CountersignNonce() = %x, %v, want %x, <nil>", readAhead, n, err, wantSig)
+		}
+		if last := got[len(got)-1]; last != int64(len(data)+len("signature")) {
+			t.Errorf("Hasher{ReadAhead: %v}.CountersignNonce() reported %d bytes, want %d", readAhead, last, len(data)+len("signature"))
+		}
+
+		errRead := errors.New("read failed")
+		r := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errRead))
+		if _, err := h.Digest(r); !errors.Is(err, errRead) {
+			t.Errorf("Hasher{ReadAhead: %v}.Digest(failing reader) = %v, want %v", readAhead, err, errRead)
+		}
+	}
+}
+
+func TestDigestFiles(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		names []string
+		want  [][]byte
+		size  int64
+	)
+	for i := range 20 {
+		data := bytes.Repeat([]byte{byte(i)}, i*hashChunkSize/4)
+		name := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		d, err := HashDigest(SHA256, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, want, size = append(names, name), append(want, d), size+int64(len(data))
+	}
+
+	var hashed int64
+	h := &Hasher{Algorithm: SHA256, Progress: func(n int64) {
+		if n < hashed {
+			t.Errorf("progress went back from %d to %d", hashed, n)
+		}
+		hashed = n
+	}}
+	got, err := h.DigestFiles(names, 4)
+	if err != nil {
+		t.Fatalf("DigestFiles() = %v", err)
+	}
+	if !slices.EqualFunc(got, want, bytes.Equal) {
+		t.Error("DigestFiles() returned wrong digests")
+	}
+	if hashed != size {
+		t.Errorf("DigestFiles() reported %d bytes hashed, want %d", hashed, size)
+	}
+
+	names[3], hashed = filepath.Join(dir, "missing"), 0
+	if _, err := h.DigestFiles(names, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("DigestFiles(missing file) = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestMaxRadius(t *testing.T) {
+	s := newTestServer("test")
+	s.radius = time.Minute
+	nonce := make([]byte, 64)
+	resp := s.respond(nonce)[0]
+	ch := testChain(nonce, s)
+
+	tcs := []struct {
+		max  time.Duration
+		fail bool
+	}{
+		{0, true},
+		{time.Second, true},
+		{time.Minute, false},
+		{-1, false},
+	}
+	for _, tc := range tcs {
+		c := &Client{MaxRadius: tc.max}
+		iv, err := c.ParseResponse(resp, nonce, s.publicKey())
+		if (err != nil) != tc.fail {
+			t.Errorf("ParseResponse(MaxRadius=%v) = %v, %v, want failure: %v", tc.max, iv.Radius, err, tc.fail)
+		}
+		_, err = c.VerifyChain(ch, &config.ServersJSON{Servers: []*config.Server{s.config()}})
+		if (err != nil) != tc.fail {
+			t.Errorf("VerifyChain(MaxRadius=%v) = %v, want failure: %v", tc.max, err, tc.fail)
+		}
+	}
+}
+
+func TestMaxRTT(t *testing.T) {
+	s := newTestServer("test")
+	srv := &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	var nerr *NetError
+
+	c := &Client{MaxRTT: time.Nanosecond}
+	if _, err := c.FetchRoughtime(srv, nil); !errors.As(err, &nerr) {
+		t.Errorf("FetchRoughtime(MaxRTT=1ns) = %v, want *NetError", err)
+	}
+	if r := c.Query([]*Server{srv})[0]; !errors.As(r.Err, &nerr) {
+		t.Errorf("Query(MaxRTT=1ns) = %v, want *NetError", r.Err)
+	}
+
+	c.MaxRTT = time.Minute
+	res, err := c.FetchRoughtime(srv, nil)
+	if err != nil {
+		t.Fatalf("FetchRoughtime(MaxRTT=1m) = %v, want <nil>", err)
+	}
+	if u := res.Uncertainty(); u != res.Radius+res.RTT/2 || u <= s.radius {
+		t.Errorf("Uncertainty() = %v, want radius %v plus half of RTT %v", u, res.Radius, res.RTT)
+	}
+}
+
+func TestDelegationWarning(t *testing.T) {
+	s := newTestServer("test")
+	s.max = time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	var buf bytes.Buffer
+	c := &Client{Logger: slog.New(slog.NewTextHandler(&buf, nil)), DelegationWarning: time.Minute}
+
+	res, err := c.FetchRoughtime(srv, nil)
+	if err != nil {
+		t.Fatalf("FetchRoughtime() = %v", err)
+	}
+	if !res.Delegation.NotBefore.Equal(s.min) || !res.Delegation.NotAfter.Equal(s.max) {
+		t.Errorf("Delegation = %v, want %v to %v", res.Delegation, s.min, s.max)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("delegation expiring in 1h logged %q with DelegationWarning=1m", buf.String())
+	}
+
+	c.DelegationWarning = 24 * time.Hour
+	for range 2 {
+		if _, err := c.FetchRoughtime(srv, nil); err != nil {
+			t.Fatalf("FetchRoughtime() = %v", err)
+		}
+		if r := c.Query([]*Server{srv})[0]; r.Err != nil {
+			t.Fatalf("Query() = %v", r.Err)
+		}
+	}
+	if n := strings.Count(buf.String(), "delegation expires soon"); n != 1 {
+		t.Errorf("delegation expiring in 1h logged %d warnings with DelegationWarning=24h, want 1:\n%s", n, buf.String())
+	}
+}
+
+func TestDelegationCache(t *testing.T) {
+	s, expired := newTestServer("test"), newTestServer("expired")
+	s.max = time.Now().Add(time.Hour)
+	nonce := make([]byte, 64)
+	resp, old := s.respond(nonce)[0], expired.respond(nonce)[0]
+
+	var (
+		cache delegationCache
+		n     int
+	)
+	verify := func(pub ed25519.PublicKey, msg, sig []byte) bool {
+		n++
+		return ed25519.Verify(pub, msg, sig)
+	}
+	parse := func(resp []byte, root ed25519.PublicKey) (checks int, err error) {
+		n = 0
+		_, _, _, err = parseResponseWith(resp, nonce, root, -1, &cache, verify)
+		return n, err
+	}
+
+	if n, err := parse(resp, s.publicKey()); err != nil || n != 2 {
+		t.Fatalf("first parse checked %d signatures, err = %v, want 2, <nil>", n, err)
+	}
+	if n, err := parse(resp, s.publicKey()); err != nil || n != 1 {
+		t.Errorf("second parse checked %d signatures, err = %v, want 1, <nil>", n, err)
+	}
+	// The delegation is only cached for the key it was verified with.
+	if _, err := parse(resp, expired.publicKey()); err == nil {
+		t.Error("parse with wrong key succeeded")
+	}
+	// Expired delegations are not cached.
+	for range 2 {
+		if n, err := parse(old, expired.publicKey()); err != nil || n != 2 {
+			t.Errorf("parse of expired delegation checked %d signatures, err = %v, want 2, <nil>", n, err)
+		}
+	}
+
+	// Delegations expiring while cached are evicted on lookup.
+	k := newDelegationCacheKey(s.publicKey(), []byte("dele"))
+	cache.m[k] = time.Now().Add(-time.Second)
+	if cache.contains(s.publicKey(), []byte("dele")) {
+		t.Error("cache contains expired delegation")
+	}
+	if _, ok := cache.m[k]; ok {
+		t.Error("expired delegation was not evicted")
+	}
+}
+
+func TestVerifyChainConsistency(t *testing.T) {
+	a, b, c := newTestServer("a"), newTestServer("b"), newTestServer("c")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config(), c.config()}}
+	nonce := make([]byte, 64)
+
+	b.midpoint = testEpoch.Add(-2 * time.Second)
+	if _, err := VerifyChain(testChain(nonce, a, b, c), servers); err != nil {
+		t.Errorf("VerifyChain(overlapping intervals) = %v, want <nil>", err)
+	}
+
+	b.midpoint = testEpoch.Add(-time.Hour)
+	_, err := VerifyChain(testChain(nonce, a, b, c), servers)
+	var cerr *ConsistencyError
+	if !errors.As(err, &cerr) || cerr.Earlier != 0 || cerr.Later != 1 || cerr.EarlierServer != "a" || cerr.LaterServer != "b" {
+		t.Errorf("VerifyChain(b before a) = %v, want inconsistency between a and b", err)
+	}
+
+	b.midpoint = testEpoch.Add(time.Hour)
+	_, err = VerifyChain(testChain(nonce, a, b, c), servers)
+	if !errors.As(err, &cerr) || cerr.Earlier != 1 || cerr.Later != 2 {
+		t.Errorf("VerifyChain(c before b) = %v, want inconsistency between b and c", err)
+	}
+	var verr *VerifyError
+	if !errors.As(err, &verr) {
+		t.Errorf("VerifyChain(c before b) = %v, want *VerifyError", err)
+	}
+}
+
+func TestVerifyChainUnknownKey(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config()}}
+	ch := testChain(make([]byte, 64), a, b)
+
+	_, err := VerifyChain(ch, servers)
+	var verr *VerifyError
+	if !errors.As(err, &verr) {
+		t.Errorf("VerifyChain(unknown server) = %v, want *VerifyError", err)
+	}
+	c := &Client{AllowUnknownKeys: true}
+	if _, err := c.VerifyChain(ch, servers); err != nil {
+		t.Errorf("VerifyChain(unknown server) with AllowUnknownKeys = %v, want <nil>", err)
+	}
+	if _, err := c.VerifyChain(ch, &config.ServersJSON{}); err != nil {
+		t.Errorf("VerifyChain(empty list) with AllowUnknownKeys = %v, want <nil>", err)
+	}
+
+	var trusted []ed25519.PublicKey
+	errUntrusted := errors.New("untrusted")
+	c = &Client{TrustUnknownKey: func(address string, key ed25519.PublicKey) error {
+		trusted = append(trusted, key)
+		return nil
+	}}
+	if _, err := c.VerifyChain(ch, servers); err != nil {
+		t.Errorf("VerifyChain(unknown server) with TrustUnknownKey = %v, want <nil>", err)
+	}
+	if len(trusted) != 1 || string(trusted[0]) != string(b.publicKey()) {
+		t.Errorf("TrustUnknownKey called with %x, want only key of b", trusted)
+	}
+	c.TrustUnknownKey = func(string, ed25519.PublicKey) error { return errUntrusted }
+	if _, err := c.VerifyChain(ch, servers); !errors.As(err, &verr) || !errors.Is(err, errUntrusted) {
+		t.Errorf("VerifyChain(unknown server) with failing TrustUnknownKey = %v, want *VerifyError wrapping it", err)
+	}
+}
+
+func TestVerifyLink(t *testing.T) {
+	a, b, c := newTestServer("a"), newTestServer("b"), newTestServer("c")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config(), c.config()}}
+	ch := testChain(make([]byte, 64), a, b, c)
+
+	var seen []string
+	errDenied := errors.New("denied")
+	cl := &Client{VerifyLink: func(l LinkResult) error {
+		seen = append(seen, l.Server)
+		if l.Server == "b" {
+			return errDenied
+		}
+		return nil
+	}}
+	_, err := cl.VerifyChain(ch, servers)
+	var verr *VerifyError
+	if !errors.As(err, &verr) || !errors.Is(err, errDenied) {
+		t.Errorf("VerifyChain() = %v, want *VerifyError wrapping hook error", err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(seen, want) {
+		t.Errorf("VerifyLink called for %v, want %v", seen, want)
+	}
+
+	seen = nil
+	cl.VerifyLink = func(l LinkResult) error {
+		seen = append(seen, l.Server)
+		if !l.Midpoint.Equal(testEpoch) {
+			t.Errorf("VerifyLink(%s) got midpoint %v, want %v", l.Server, l.Midpoint, testEpoch)
+		}
+		return nil
+	}
+	if _, err := cl.VerifyChain(ch, servers); err != nil {
+		t.Errorf("VerifyChain() = %v, want <nil>", err)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(seen, want) {
+		t.Errorf("VerifyLink called for %v, want %v", seen, want)
+	}
+}
+
+func TestVerifyChainKeyArchive(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config()}}
+	ch := testChain(make([]byte, 64), a, b)
+	archived := &config.ArchivedKey{
+		Name:          "old b",
+		PublicKeyType: "ed25519",
+		PublicKey:     b.publicKey(),
+		ValidFrom:     testEpoch.Add(-time.Hour).Format(time.RFC3339),
+		ValidUntil:    testEpoch.Add(time.Hour).Format(time.RFC3339),
+	}
+	c := &Client{KeyArchive: &config.KeyArchive{Keys: []*config.ArchivedKey{archived}}}
+
+	rep, err := c.VerifyChain(ch, servers)
+	if err != nil {
+		t.Fatalf("VerifyChain(archived key) = %v, want <nil>", err)
+	}
+	if rep.Links[1].Server != "old b" {
+		t.Errorf("VerifyChain(archived key) reports server %q, want %q", rep.Links[1].Server, "old b")
+	}
+
+	var verr *VerifyError
+	archived.ValidUntil = testEpoch.Add(-time.Minute).Format(time.RFC3339)
+	if _, err := c.VerifyChain(ch, servers); !errors.As(err, &verr) {
+		t.Errorf("VerifyChain(archived key used after it expired) = %v, want *VerifyError", err)
+	}
+	archived.ValidFrom, archived.ValidUntil = testEpoch.Add(time.Minute).Format(time.RFC3339), testEpoch.Add(time.Hour).Format(time.RFC3339)
+	if _, err := c.VerifyChain(ch, servers); !errors.As(err, &verr) {
+		t.Errorf("VerifyChain(archived key used before it was valid) = %v, want *VerifyError", err)
+	}
+
+	att := &config.Attestation{PublicKeyType: "ed25519", ServerPublicKey: b.publicKey(), Reply: ch.Links[1].Reply}
+	att.Nonce = hash512(hash512(ch.Links[0].Reply), ch.Links[1].NonceOrBlind)
+	if _, err := c.VerifyAttestation(att, servers); !errors.As(err, &verr) {
+		t.Errorf("VerifyAttestation(archived key used before it was valid) = %v, want *VerifyError", err)
+	}
+	archived.ValidFrom = ""
+	if res, err := c.VerifyAttestation(att, servers); err != nil || res.Server != "old b" {
+		t.Errorf("VerifyAttestation(archived key) = %v, %v, want old b, <nil>", res.Server, err)
+	}
+}
+
+// serveUDP answers requests on a local UDP socket using s, until the test ends,
+// and returns its address. If s is nil, requests are never answered.
+func serveUDP(t testing.TB, s *testServer) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req request
+			if s == nil || wire.Decode(buf[:n], req.decode) != nil {
+				continue
+			}
+			conn.WriteTo(s.respond(req.nonce[:])[0], addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// serveFlapping serves responses alternating between the given servers, which
+// should share their keys.
+func serveFlapping(t testing.TB, servers ...*testServer) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for i := 0; ; i++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req request
+			if wire.Decode(buf[:n], req.decode) != nil {
+				continue
+			}
+			conn.WriteTo(servers[i%len(servers)].respond(req.nonce[:])[0], addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDoubleCheck(t *testing.T) {
+	good := newTestServer("flap")
+	bad := newTestServer("flap")
+	bad.midpoint = testEpoch.Add(time.Hour)
+
+	nonce := make([]byte, 64)
+	for _, tc := range []struct {
+		name    string
+		servers []*testServer
+		fail    bool
+	}{
+		{"consistent", []*testServer{good}, false},
+		{"flapping", []*testServer{good, bad}, true},
+		{"going back", []*testServer{bad, good}, true},
+	} {
+		cfg := good.config()
+		cfg.Addresses[0].Address = serveFlapping(t, tc.servers...)
+		list := &config.ServersJSON{Servers: []*config.Server{cfg}}
+
+		c := &Client{DoubleCheck: true, Timeout: time.Second}
+		_, _, err := c.BuildChain(list, SHA512, nonce)
+		var ierr *InconsistentServerError
+		if tc.fail != errors.As(err, &ierr) || (!tc.fail && err != nil) {
+			t.Errorf("%s: BuildChain() = %v, want *InconsistentServerError: %v", tc.name, err, tc.fail)
+		}
+		if _, _, err := c.Attest(list, SHA512, nonce); tc.fail != (err != nil) {
+			t.Errorf("%s: Attest() = %v, want failure: %v", tc.name, err, tc.fail)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	a, dead := newTestServer("a"), newTestServer("dead")
+	deadCfg := dead.config()
+	deadCfg.Addresses = []*config.ServerAddress{{Protocol: "udp", Address: serveUDP(t, nil)}, {Protocol: "udp", Address: serveUDP(t, nil)}}
+	aCfg := a.config()
+	aCfg.Addresses[0].Address = serveUDP(t, a)
+	list := &config.ServersJSON{Servers: []*config.Server{deadCfg, aCfg}}
+
+	var events []Event
+	c := &Client{Timeout: 100 * time.Millisecond, MinLinks: 1, Progress: func(e Event) { events = append(events, e) }}
+	if _, _, err := c.BuildChain(list, SHA512, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ     EventType
+		server  string
+		address string
+	}{
+		{EventQuery, "dead", deadCfg.Addresses[0].Address},
+		{EventFailed, "dead", deadCfg.Addresses[0].Address},
+		{EventRetry, "dead", deadCfg.Addresses[1].Address},
+		{EventQuery, "dead", deadCfg.Addresses[1].Address},
+		{EventFailed, "dead", deadCfg.Addresses[1].Address},
+		{EventSkipped, "dead", ""},
+		{EventQuery, "a", aCfg.Addresses[0].Address},
+		{EventVerified, "a", aCfg.Addresses[0].Address},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, e := range events {
+		w := want[i]
+		if e.Type != w.typ || e.Server != w.server || e.Address != w.address || e.Time.IsZero() {
+			t.Errorf("event %d = %+v, want %s for %s at %q", i, e, w.typ, w.server, w.address)
+		}
+		if (e.Err != nil) != (e.Type == EventFailed || e.Type == EventRetry || e.Type == EventSkipped) {
+			t.Errorf("event %d has error %v", i, e.Err)
+		}
+	}
+	if v := events[len(events)-1]; !v.Midpoint.Equal(testEpoch) || v.RTT <= 0 {
+		t.Errorf("verified event = %+v, want midpoint %v", v, testEpoch)
+	}
+}
+
+func TestChainSkip(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	dead := newTestServer("dead")
+	list := &config.ServersJSON{}
+	for _, s := range []*testServer{dead, a, b} {
+		cfg := s.config()
+		if s == dead {
+			cfg.Addresses[0].Address = serveUDP(t, nil)
+		} else {
+			cfg.Addresses[0].Address = serveUDP(t, s)
+		}
+		list.Servers = append(list.Servers, cfg)
+	}
+	nonce := make([]byte, 64)
+
+	c := &Client{Timeout: 100 * time.Millisecond}
+	var netErr *NetError
+	if _, _, err := c.BuildChain(list, SHA512, nonce); !errors.As(err, &netErr) {
+		t.Errorf("Chain(dead server) = %v, want *NetError", err)
+	}
+
+	c.MinLinks = 2
+	ch, res, err := c.BuildChain(list, SHA512, nonce)
+	if err != nil {
+		t.Fatalf("Chain(dead server) with MinLinks = %v, want <nil>", err)
+	}
+	if len(ch.Links) != 2 || len(ch.Skipped) != 1 || ch.Skipped[0].Name != "dead" {
+		t.Errorf("Chain(dead server) has %d links and skipped %v, want 2 links and dead skipped", len(ch.Links), ch.Skipped)
+	}
+	for i, want := range []string{"a", "b"} {
+		if i >= len(res) || res[i].Server != want || !res[i].Midpoint.Equal(testEpoch) || res[i].Radius != time.Second || res[i].RTT <= 0 {
+			t.Errorf("Chain(dead server) results = %+v, want results for a and b", res)
+			break
+		}
+	}
+	if !bytes.Equal(ch.Links[0].NonceOrBlind, nonce) {
+		t.Errorf("first link has nonce %x, want %x", ch.Links[0].NonceOrBlind, nonce)
+	}
+	if _, err := VerifyChain(ch, list); err != nil {
+		t.Errorf("VerifyChain(skipping chain) = %v, want <nil>", err)
+	}
+
+	c.MinLinks = 3
+	if _, _, err := c.BuildChain(list, SHA512, nonce); !errors.As(err, &netErr) {
+		t.Errorf("Chain(dead server) with too few links = %v, want wrapped *NetError", err)
+	}
+}
+
+type testRecorder struct {
+	mu      sync.Mutex
+	queries map[string]error
+	offsets map[string]time.Duration
+}
+
+func (r *testRecorder) RecordQuery(address string, rtt time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries[address] = err
+}
+
+func (r *testRecorder) RecordOffset(address string, offset time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.offsets[address] = offset
+}
+
+func TestRecorder(t *testing.T) {
+	a, dead := newTestServer("a"), newTestServer("dead")
+	list := &config.ServersJSON{Servers: []*config.Server{dead.config(), a.config()}}
+	list.Servers[0].Addresses[0].Address = serveUDP(t, nil)
+	list.Servers[1].Addresses[0].Address = serveUDP(t, a)
+
+	rec := &testRecorder{queries: make(map[string]error), offsets: make(map[string]time.Duration)}
+	c := &Client{Timeout: 100 * time.Millisecond, MinLinks: 1, Recorder: rec}
+	if _, _, err := c.BuildChain(list, SHA512, nil); err != nil {
+		t.Fatal(err)
+	}
+	deadAddr, aAddr := list.Servers[0].Addresses[0].Address, list.Servers[1].Addresses[0].Address
+	var netErr *NetError
+	if err, ok := rec.queries[deadAddr]; !ok || !errors.As(err, &netErr) {
+		t.Errorf("recorded query of dead server = %v, %v, want *NetError", err, ok)
+	}
+	if _, ok := rec.offsets[deadAddr]; ok {
+		t.Error("recorded offset for dead server")
+	}
+	if err, ok := rec.queries[aAddr]; !ok || err != nil {
+		t.Errorf("recorded query of a = %v, %v, want <nil>", err, ok)
+	}
+	// The test server claims a time in 2018.
+	if off := rec.offsets[aAddr]; off > -time.Since(testEpoch)+time.Minute || off < -time.Since(testEpoch)-time.Minute {
+		t.Errorf("recorded offset of a = %v, want about %v", off, -time.Since(testEpoch))
+	}
+}
+
+func TestVerifyChainReport(t *testing.T) {
+	a, b := newTestServer("a"), newTestServer("b")
+	b.midpoint = testEpoch.Add(500 * time.Millisecond)
+	b.radius = 2 * time.Second
+	servers := &config.ServersJSON{Servers: []*config.Server{a.config(), b.config()}}
+	rep, err := VerifyChain(testChain(make([]byte, 64), a, b), servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range []*testServer{a, b} {
+		if l := rep.Links[i]; l.Server != s.name || !l.Midpoint.Equal(s.midpoint) || l.Radius != s.radius {
+			t.Errorf("VerifyChain().Links[%d] = %+v, want %s, %v, %v", i, l, s.name, s.midpoint, s.radius)
+		}
+	}
+	if lo, hi := testEpoch.Add(-time.Second), testEpoch.Add(time.Second); !rep.Earliest.Equal(lo) || !rep.Latest.Equal(hi) {
+		t.Errorf("VerifyChain() = [%v, %v], want [%v, %v]", rep.Earliest, rep.Latest, lo, hi)
+	}
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	s := newTestServer("test")
+	nonces := make([][]byte, 8)
+	for i := range nonces {
+		nonces[i] = bytes.Repeat([]byte{byte(i)}, 64)
+	}
+	resp, key := s.respond(nonces...)[5], s.publicKey()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := ParseResponse(resp, nonces[5], key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFetchRoughtime(t *testing.T) {
+	s := newTestServer("test")
+	srv := &Server{Name: "test", Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	nonce := bytes.Repeat([]byte{42}, 64)
+	res, err := FetchRoughtime(srv, nonce)
+	if err != nil {
+		t.Fatalf("FetchRoughtime() = %v, want <nil>", err)
+	}
+	if res.Server != "test" || res.Address != srv.Address || !bytes.Equal(res.PublicKey, srv.PublicKey) || !bytes.Equal(res.Nonce, nonce) {
+		t.Errorf("FetchRoughtime() = %+v, want result for %+v", res, srv)
+	}
+	if !res.Midpoint.Equal(s.midpoint) || res.Radius != s.radius || res.RTT <= 0 || res.Sent.IsZero() {
+		t.Errorf("FetchRoughtime() = %v, RTT %v, want %v", res.Interval, res.RTT, Interval{s.midpoint, s.radius})
+	}
+	if iv, err := ParseResponse(res.Reply, nonce, srv.PublicKey); err != nil || iv != res.Interval {
+		t.Errorf("ParseResponse(Reply) = %v, %v, want %v, <nil>", iv, err, res.Interval)
+	}
+}
+
+func BenchmarkFetchRoughtime(b *testing.B) {
+	s := newTestServer("test")
+	srv := &Server{Address: serveUDP(b, s), PublicKey: s.publicKey()}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := FetchRoughtime(srv, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// ReadServersJSON reads a servers.json from r and validates it. If the list is
+// invalid, the returned error is a config.ValidationError.
+//
+// The ecosystem.json of the roughtime project is accepted as well. Servers
+// listed as bad in it are removed.
+func ReadServersJSON(r io.Reader) (*config.ServersJSON, error) {
+	servers, err := decodeServers(r)
+	if err != nil {
+		return nil, err
+	}
+	return finishServers(servers)
+}
+
+//go:embed servers.json
+var defaultServers string
+
+// DefaultServers returns the built-in server list. Every call returns a new
+// copy, which may be modified by the caller.
+func DefaultServers() *config.ServersJSON {
+	s, err := ReadServersJSON(strings.NewReader(defaultServers))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// LoadServers loads a server list from the file name. If name is a directory,
+// all *.json files in it are read and merged into a single list. It is an
+// error for the same public key to appear in more than one entry.
+//
+// If name starts with http:// or https://, the list is downloaded instead.
+func LoadServers(name string) (*config.ServersJSON, error) {
+	return loadServers(name, nil)
+}
+
+// LoadSignedServers is like LoadServers, but every file (or URL) read must
+// have a detached signature by key, in a file (or at a URL) with the same name
+// and ".sig" appended. This prevents whoever controls the download path of a
+// server list from swapping it. Bad signatures are reported as a
+// *VerifyError. See VerifyServersSignature for the accepted formats.
+func LoadSignedServers(name string, key *ListKey) (*config.ServersJSON, error) {
+	if key == nil {
+		return nil, errors.New("no server list key given")
+	}
+	return loadServers(name, key)
+}
+
+// loadServers loads a server list, verifying signatures if key is not nil.
+func loadServers(name string, key *ListKey) (*config.ServersJSON, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		return fetchServers(name, key)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		s, err := readServersFile(name, key)
+		if err != nil {
+			return nil, err
+		}
+		return finishServers(s)
+	}
+
+	files, err := filepath.Glob(filepath.Join(name, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	merged := new(config.ServersJSON)
+	seen := make(map[string]string)
+	for _, file := range files {
+		s, err := readServersFile(file, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range s.Servers {
+			if srv == nil {
+				continue
+			}
+			if prev, ok := seen[string(srv.PublicKey)]; ok {
+				return nil, fmt.Errorf("%s: server %q has the same public key as a server in %s", file, srv.Name, prev)
+			}
+			seen[string(srv.PublicKey)] = file
+		}
+		merged.Servers = append(merged.Servers, s.Servers...)
+		merged.Bad = append(merged.Bad, s.Bad...)
+	}
+	return finishServers(merged)
+}
+
+// maxServersSize is the maximum size of a downloaded server list or signature.
+const maxServersSize = 1 << 20
+
+func fetchServers(url string, key *ListKey) (*config.ServersJSON, error) {
+	c := &http.Client{Timeout: 30 * time.Second}
+	b, err := fetch(c, url)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		sig, err := fetch(c, url+".sig")
+		if err != nil {
+			return nil, err
+		}
+		if err := VerifyServersSignature(b, sig, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+	}
+	s, err := ReadServersJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return s, nil
+}
+
+func fetch(c *http.Client, url string) ([]byte, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxServersSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if len(b) > maxServersSize {
+		return nil, fmt.Errorf("fetching %s: response too large", url)
+	}
+	return b, nil
+}
+
+func readServersFile(name string, key *ListKey) (*config.ServersJSON, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		sig, err := os.ReadFile(name + ".sig")
+		if err != nil {
+			return nil, err
+		}
+		if err := VerifyServersSignature(b, sig, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	s, err := decodeServers(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+func decodeServers(r io.Reader) (*config.ServersJSON, error) {
+	servers := new(config.ServersJSON)
+	if err := json.NewDecoder(r).Decode(servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+func finishServers(servers *config.ServersJSON) (*config.ServersJSON, error) {
+	servers.RemoveBad()
+	if err := servers.Validate(); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
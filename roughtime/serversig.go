@@ -0,0 +1,140 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A ListKey is the public key of the publisher of a server list. See
+// LoadSignedServers.
+type ListKey struct {
+	key ed25519.PublicKey
+	// id is the key ID, if the key is in minisign format.
+	id []byte
+}
+
+// ParseListKey parses a public key of a server list publisher. It accepts a
+// base64 encoded ed25519 public key or a minisign public key, optionally
+// preceded by its untrusted comment line, as in minisign.pub.
+func ParseListKey(s string) (*ListKey, error) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) == 2 && strings.HasPrefix(lines[0], "untrusted comment:") {
+		lines = lines[1:]
+	}
+	if len(lines) != 1 {
+		return nil, errors.New("invalid server list key")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server list key: %w", err)
+	}
+	switch {
+	case len(b) == ed25519.PublicKeySize:
+		return &ListKey{key: b}, nil
+	case len(b) == 2+8+ed25519.PublicKeySize && string(b[:2]) == "Ed":
+		return &ListKey{key: b[10:], id: b[2:10]}, nil
+	default:
+		return nil, errors.New("invalid server list key: unknown format")
+	}
+}
+
+// VerifyServersSignature verifies that sig is a signature of the server list
+// list by key. sig is either an ed25519 signature, in binary or base64, or a
+// minisign signature file. A minisign signature is also accepted for a key
+// which is not in minisign format, as long as the signature matches.
+// Verification errors are returned as a *VerifyError.
+func VerifyServersSignature(list, sig []byte, key *ListKey) error {
+	var err error
+	if bytes.HasPrefix(sig, []byte("untrusted comment:")) {
+		err = verifyMinisign(list, sig, key)
+	} else {
+		err = verifyEd25519(list, sig, key)
+	}
+	if err != nil {
+		return &VerifyError{err}
+	}
+	return nil
+}
+
+func verifyEd25519(list, sig []byte, key *ListKey) error {
+	if len(sig) != ed25519.SignatureSize {
+		b, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil || len(b) != ed25519.SignatureSize {
+			return errors.New("invalid server list signature")
+		}
+		sig = b
+	}
+	if !ed25519.Verify(key.key, list, sig) {
+		return errors.New("bad server list signature")
+	}
+	return nil
+}
+
+// verifyMinisign verifies a minisign signature file, consisting of an
+// untrusted comment, the signature, a trusted comment and a signature of the
+// signature and the trusted comment.
+func verifyMinisign(list, sig []byte, key *ListKey) error {
+	lines := strings.Split(strings.TrimRight(string(sig), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(s) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	alg, id, s := string(s[:2]), s[2:10], s[10:]
+	if key.id != nil && !bytes.Equal(id, key.id) {
+		return fmt.Errorf("server list is signed by key %X, not by %X", reverse(id), reverse(key.id))
+	}
+	msg := list
+	switch alg {
+	case "Ed":
+	case "ED":
+		h := blake2b.Sum512(list)
+		msg = h[:]
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", alg)
+	}
+	if !ed25519.Verify(key.key, msg, s) {
+		return errors.New("bad server list signature")
+	}
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(key.key, append(s[:len(s):len(s)], trusted...), global) {
+		return errors.New("bad trusted comment signature")
+	}
+	return nil
+}
+
+// reverse returns a reversed copy of b. minisign displays key IDs, which are
+// stored in little endian, as big endian hexadecimal numbers.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
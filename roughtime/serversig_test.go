@@ -0,0 +1,175 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const testServersJSON = `{"servers": [{"name": "test", "publicKeyType": "ed25519", "publicKey": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", "addresses": [{"protocol": "udp", "address": "example.com:2002"}]}]}`
+
+// minisign returns a minisign public key and a signature of msg, using the
+// given algorithm ("Ed" or "ED") and trusted comment.
+func minisign(priv ed25519.PrivateKey, id []byte, alg string, msg []byte, trusted string) (pub string, sig []byte) {
+	pk := append(append([]byte("Ed"), id...), priv.Public().(ed25519.PublicKey)...)
+	pub = "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(pk) + "\n"
+	if alg == "ED" {
+		h := blake2b.Sum512(msg)
+		msg = h[:]
+	}
+	s := ed25519.Sign(priv, msg)
+	global := ed25519.Sign(priv, append(append([]byte(nil), s...), trusted...))
+	sig = fmt.Appendf(nil, "untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(alg), id...), s...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global))
+	return pub, sig
+}
+
+func TestVerifyServersSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []byte(testServersJSON)
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	rawKey := base64.StdEncoding.EncodeToString(pub)
+	minisignKey, sigEd := minisign(priv, id, "Ed", list, "timestamp:1")
+	_, sigED := minisign(priv, id, "ED", list, "timestamp:1")
+	_, sigOther := minisign(other, id, "ED", list, "timestamp:1")
+	_, sigID := minisign(priv, []byte{8, 7, 6, 5, 4, 3, 2, 1}, "ED", list, "timestamp:1")
+	raw := ed25519.Sign(priv, list)
+
+	tests := []struct {
+		name string
+		key  string
+		list []byte
+		sig  []byte
+		ok   bool
+	}{
+		{"raw", rawKey, list, raw, true},
+		{"base64", rawKey, list, []byte(base64.StdEncoding.EncodeToString(raw) + "\n"), true},
+		{"minisign", minisignKey, list, sigEd, true},
+		{"minisign prehashed", minisignKey, list, sigED, true},
+		{"minisign with raw key", rawKey, list, sigED, true},
+		{"raw with minisign key", minisignKey, list, raw, true},
+		{"modified list", rawKey, append(list, ' '), raw, false},
+		{"modified list minisign", minisignKey, append(list, ' '), sigED, false},
+		{"wrong key", minisignKey, list, sigOther, false},
+		{"wrong key ID", minisignKey, list, sigID, false},
+		{"modified trusted comment", minisignKey, list, bytes.Replace(sigED, []byte("timestamp:1"), []byte("timestamp:2"), 1), false},
+		{"truncated", rawKey, list, raw[:32], false},
+		{"garbage", rawKey, list, []byte("untrusted comment: nope\n"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParseListKey(tc.key)
+			if err != nil {
+				t.Fatalf("ParseListKey(%q) = %v", tc.key, err)
+			}
+			err = VerifyServersSignature(tc.list, tc.sig, key)
+			var verr *VerifyError
+			if tc.ok && err != nil {
+				t.Errorf("VerifyServersSignature() = %v, want <nil>", err)
+			}
+			if !tc.ok && !errors.As(err, &verr) {
+				t.Errorf("VerifyServersSignature() = %v, want *VerifyError", err)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "AAAA", "untrusted comment: x\n", rawKey + "\n" + rawKey} {
+		if _, err := ParseListKey(s); err == nil {
+			t.Errorf("ParseListKey(%q) = <nil>, want error", s)
+		}
+	}
+}
+
+func TestLoadSignedServers(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseListKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []byte(testServersJSON)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "servers.json")
+	if err := os.WriteFile(name, list, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSignedServers(name, key); err == nil {
+		t.Error("LoadSignedServers() without signature succeeded")
+	}
+	if err := os.WriteFile(name+".sig", ed25519.Sign(priv, list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{name, dir} {
+		s, err := LoadSignedServers(n, key)
+		if err != nil {
+			t.Fatalf("LoadSignedServers(%q) = %v", n, err)
+		}
+		if len(s.Servers) != 1 || s.Servers[0].Name != "test" {
+			t.Errorf("LoadSignedServers(%q) = %+v, want server test", n, s.Servers)
+		}
+	}
+
+	swapped := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/servers.json":
+			if swapped {
+				w.Write(bytes.Replace(list, []byte("example.com"), []byte("evil.example"), 1))
+			} else {
+				w.Write(list)
+			}
+		case "/servers.json.sig":
+			w.Write(ed25519.Sign(priv, list))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	var verr *VerifyError
+	if _, err := LoadSignedServers(srv.URL+"/servers.json", key); !errors.As(err, &verr) {
+		t.Errorf("LoadSignedServers(swapped URL) = %v, want *VerifyError", err)
+	}
+	swapped = false
+	if _, err := LoadSignedServers(srv.URL+"/servers.json", key); err != nil {
+		t.Errorf("LoadSignedServers(URL) = %v, want <nil>", err)
+	}
+	if _, err := LoadServers(srv.URL + "/servers.json"); err != nil {
+		t.Errorf("LoadServers(URL) = %v, want <nil>", err)
+	}
+}
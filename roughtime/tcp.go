@@ -0,0 +1,102 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// frameMagic starts every message sent over TCP and every IETF request and
+// response sent over UDP.
+const frameMagic = "ROUGHTIM"
+
+// TCPTransport sends requests over TCP. As TCP is a stream, every message is
+// prefixed with the string "ROUGHTIM" and its length as a little-endian
+// uint32, as in the IETF roughtime draft. Servers must support this framing
+// on the same address they serve UDP on.
+type TCPTransport struct {
+	// Dial is used to connect to servers. If nil, a net.Dialer is used.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// RoundTrip implements Transport.
+func (t *TCPTransport) RoundTrip(address string, req []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	dial := t.Dial
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if d, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(d); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := conn.Write(frame(req)); err != nil {
+		return nil, err
+	}
+
+	var hdr [len(frameMagic) + 4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return nil, err
+	}
+	if string(hdr[:len(frameMagic)]) != frameMagic {
+		return nil, errors.New("invalid response framing")
+	}
+	n := binary.LittleEndian.Uint32(hdr[len(frameMagic):])
+	if n > MaxResponseSize {
+		return nil, ErrResponseTooLarge
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// TorTransport returns a transport sending requests over TCP through the Tor
+// SOCKS proxy at proxyAddr, like "127.0.0.1:9050".
+//
+// Every request is made with fresh random SOCKS credentials. With Tor's
+// default of IsolateSOCKSAuth, this puts every query on a separate circuit, so
+// an exit node can neither link the queries of a chain to each other nor to
+// the queries for other documents.
+func TorTransport(proxyAddr string) *TCPTransport {
+	return &TCPTransport{Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		b := make([]byte, 16)
+		rand.Read(b)
+		auth := &proxy.Auth{User: hex.EncodeToString(b[:8]), Password: hex.EncodeToString(b[8:])}
+		d, err := proxy.SOCKS5("tcp", proxyAddr, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		return d.(proxy.ContextDialer).DialContext(ctx, network, address)
+	}}
+}
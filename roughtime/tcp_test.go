@@ -0,0 +1,158 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/wire"
+)
+
+// serveTCP serves s over TCP, with the framing used by TCPTransport.
+func serveTCP(t testing.TB, s *testServer) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var hdr [12]byte
+				if _, err := io.ReadFull(conn, hdr[:]); err != nil || string(hdr[:8]) != frameMagic {
+					return
+				}
+				buf := make([]byte, binary.LittleEndian.Uint32(hdr[8:]))
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					return
+				}
+				var req request
+				if wire.Decode(buf, req.decode) != nil {
+					return
+				}
+				resp := s.respond(req.nonce[:])[0]
+				conn.Write(binary.LittleEndian.AppendUint32([]byte(frameMagic), uint32(len(resp))))
+				conn.Write(resp)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// socksProxy is a minimal SOCKS5 proxy recording the credentials it is used
+// with.
+type socksProxy struct {
+	mu    sync.Mutex
+	users []string
+}
+
+func (p *socksProxy) serve(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.handle(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (p *socksProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		io.ReadFull(conn, b)
+		return b
+	}
+	// Greeting: only username/password authentication is accepted.
+	read(int(read(2)[1]))
+	conn.Write([]byte{5, 2})
+	user := string(read(int(read(2)[1])))
+	read(int(read(1)[0]))
+	conn.Write([]byte{1, 0})
+	p.mu.Lock()
+	p.users = append(p.users, user)
+	p.mu.Unlock()
+
+	hdr := read(4)
+	var host string
+	switch hdr[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		host = string(read(int(read(1)[0])))
+	default:
+		return
+	}
+	port := binary.BigEndian.Uint16(read(2))
+	up, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer up.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(up, conn)
+	io.Copy(conn, up)
+}
+
+func TestTorTransport(t *testing.T) {
+	var servers []*Server
+	for i := range 3 {
+		s := newTestServer(fmt.Sprint("server", i))
+		s.midpoint = testEpoch.Add(time.Duration(i) * time.Second)
+		servers = append(servers, &Server{Address: serveTCP(t, s), PublicKey: s.publicKey()})
+	}
+	p := new(socksProxy)
+	c := &Client{Transport: TorTransport(p.serve(t)), Timeout: time.Second}
+	for i, r := range c.Query(servers) {
+		if want := testEpoch.Add(time.Duration(i) * time.Second); r.Err != nil || !r.Midpoint.Equal(want) {
+			t.Errorf("results[%d] = %v, %v, want %v, <nil>", i, r.Midpoint, r.Err, want)
+		}
+	}
+	if _, err := c.FetchRoughtime(servers[0], nil); err != nil {
+		t.Errorf("FetchRoughtime() = %v, want <nil>", err)
+	}
+
+	// Every query must be isolated.
+	seen := make(map[string]bool)
+	for _, u := range p.users {
+		if seen[u] {
+			t.Errorf("SOCKS username %q used for multiple queries", u)
+		}
+		seen[u] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("got %d SOCKS connections, want 4", len(seen))
+	}
+}
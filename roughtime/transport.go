@@ -0,0 +1,142 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+// A Transport sends requests to roughtime servers. Implementations must be
+// safe for concurrent use.
+type Transport interface {
+	// RoundTrip sends req to the server at address and returns its
+	// response. It must give up after timeout.
+	RoundTrip(address string, req []byte, timeout time.Duration) ([]byte, error)
+}
+
+// HTTPTransport sends requests to a relay, which forwards them to the server.
+// This makes it possible to use roughtime where UDP is not available, like in
+// browsers. The request is POSTed to URL, with the address of the server in
+// the address query parameter, and the response is the body of the reply. A
+// relay is served by NewRelay.
+type HTTPTransport struct {
+	URL string
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// RoundTrip implements Transport.
+func (t *HTTPTransport) RoundTrip(address string, req []byte, timeout time.Duration) ([]byte, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("address", address)
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/octet-stream")
+	c := t.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay returned %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MaxResponseSize {
+		return nil, ErrResponseTooLarge
+	}
+	return b, nil
+}
+
+// NewRelay returns an HTTP handler relaying requests sent by HTTPTransport to
+// the servers in s, using t. Requests for other addresses are rejected, so the
+// relay can not be used to send traffic to arbitrary hosts. If t is nil,
+// UDPTransport is used.
+//
+// As the relay is meant to be used from browsers, it allows cross-origin
+// requests.
+func NewRelay(s *config.ServersJSON, t Transport, timeout time.Duration) http.Handler {
+	if t == nil {
+		t = UDPTransport{}
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	var addrs []string
+	for _, srv := range s.Servers {
+		for _, a := range srv.Addresses {
+			addrs = append(addrs, a.Address)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		switch r.Method {
+		case "OPTIONS":
+			w.Header().Set("Access-Control-Allow-Methods", "POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			return
+		case "POST":
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		address := r.URL.Query().Get("address")
+		if !slices.Contains(addrs, address) {
+			http.Error(w, "unknown server", http.StatusForbidden)
+			return
+		}
+		req, err := io.ReadAll(io.LimitReader(r.Body, packetSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req) != packetSize {
+			http.Error(w, "invalid request size", http.StatusBadRequest)
+			return
+		}
+		resp, err := t.RoundTrip(address, req, timeout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(resp)
+	})
+}
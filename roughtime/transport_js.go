@@ -0,0 +1,32 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js
+
+package roughtime
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultTransport is used by clients without a Transport. There is no UDP in
+// js/wasm, so clients have to be configured with an HTTPTransport.
+var defaultTransport Transport = noTransport{}
+
+type noTransport struct{}
+
+func (noTransport) RoundTrip(string, []byte, time.Duration) ([]byte, error) {
+	return nil, errors.New("UDP is not available on js, Client.Transport must be set")
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	var (
+		servers []*Server
+		list    config.ServersJSON
+	)
+	for i := range 3 {
+		s := newTestServer(fmt.Sprint("server", i))
+		s.midpoint = testEpoch.Add(time.Duration(i) * time.Second)
+		servers = append(servers, &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()})
+		list.Servers = append(list.Servers, &config.Server{
+			Name:      s.name,
+			PublicKey: s.publicKey(),
+			Addresses: []*config.ServerAddress{{Protocol: "udp", Address: servers[i].Address}},
+		})
+	}
+	relay := httptest.NewServer(NewRelay(&list, nil, time.Second))
+	defer relay.Close()
+	// A server the relay does not know about.
+	servers = append(servers, &Server{Address: serveUDP(t, newTestServer("other")), PublicKey: newTestServer("other").publicKey()})
+
+	c := &Client{Transport: &HTTPTransport{URL: relay.URL}, Timeout: time.Second}
+	var nerr *NetError
+	for i, r := range c.Query(servers) {
+		if i == 3 {
+			if !errors.As(r.Err, &nerr) {
+				t.Errorf("results[%d].Err = %v, want *NetError", i, r.Err)
+			}
+			continue
+		}
+		if want := testEpoch.Add(time.Duration(i) * time.Second); r.Err != nil || !r.Midpoint.Equal(want) {
+			t.Errorf("results[%d] = %v, %v, want %v, <nil>", i, r.Midpoint, r.Err, want)
+		}
+	}
+	if _, err := c.FetchRoughtime(servers[0], nil); err != nil {
+		t.Errorf("FetchRoughtime() = %v, want <nil>", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// DefaultFallbackDelay is the FallbackDelay used by a UDPTransport with no
+// FallbackDelay set. It is the same as that of net.Dialer.
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// UDPTransport sends requests directly to servers over UDP. It is the default
+// transport, except on js/wasm, where UDP is not available.
+//
+// If the name of a server resolves to multiple addresses, they are tried in
+// the manner of Happy Eyeballs (RFC 8305): the request is sent to the first
+// address and, if there is no response after FallbackDelay, to the next, while
+// still waiting for the first. The address families alternate, so a broken
+// IPv6 network only delays queries instead of failing them.
+type UDPTransport struct {
+	// PreferIPv4 makes IPv4 addresses be tried first. By default, IPv6
+	// addresses are.
+	PreferIPv4 bool
+	// FallbackDelay is how long to wait for a response before also trying
+	// the next address of a server. If zero, DefaultFallbackDelay is used.
+	// If negative, only the first address is tried.
+	FallbackDelay time.Duration
+	// LocalAddr is the local address to send requests from, as an IP
+	// address or host:port. If empty, the system chooses one.
+	LocalAddr string
+	// Device is the name of the network interface or VRF to send requests
+	// through, using SO_BINDTODEVICE. It is only supported on Linux and
+	// usually requires CAP_NET_RAW.
+	Device string
+	// DSCP is the Differentiated Services Code Point to mark requests with,
+	// for networks that prioritize time synchronization traffic. It must be
+	// between 0 and 63 and is not supported on Windows.
+	DSCP int
+	// Capture, if set, is called with every datagram sent to or received
+	// from a server, with the time and its source and destination. It can
+	// be used to record the exchange for debugging.
+	Capture func(t time.Time, src, dst netip.AddrPort, b []byte)
+}
+
+func (t UDPTransport) fallbackDelay() time.Duration {
+	if t.FallbackDelay == 0 {
+		return DefaultFallbackDelay
+	}
+	return t.FallbackDelay
+}
+
+// RoundTrip implements Transport.
+func (t UDPTransport) RoundTrip(address string, req []byte, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	addrs, err := t.resolve(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.listen()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	to, err := addrs.send(conn, req)
+	if err != nil {
+		return nil, err
+	}
+	t.capture(conn, to, true, req)
+	buf := getResponseBuffer()
+	defer responsePool.Put(buf)
+	for {
+		d := deadline
+		if len(addrs) > 0 {
+			if f := time.Now().Add(t.fallbackDelay()); f.Before(d) {
+				d = f
+			}
+		}
+		if err := conn.SetReadDeadline(d); err != nil {
+			return nil, err
+		}
+		n, from, err := conn.ReadFromUDPAddrPort(buf[:])
+		if err == nil {
+			t.capture(conn, from, false, buf[:n])
+			if n > MaxResponseSize {
+				return nil, ErrResponseTooLarge
+			}
+			return bytes.Clone(buf[:n]), nil
+		}
+		if !isTimeout(err) || len(addrs) == 0 || !time.Now().Before(deadline) {
+			return nil, err
+		}
+		// Earlier requests might still be answered, so failing to send
+		// to the next address is not fatal.
+		if to, err := addrs.send(conn, req); err == nil {
+			t.capture(conn, to, true, req)
+		}
+	}
+}
+
+// listen opens the socket to send requests from.
+// capture calls t.Capture, if set, with a datagram sent to or received from
+// peer on conn.
+func (t UDPTransport) capture(conn *net.UDPConn, peer netip.AddrPort, sent bool, b []byte) {
+	if t.Capture == nil {
+		return
+	}
+	now := time.Now()
+	peer = unmapAddrPort(peer)
+	local := unmapAddrPort(conn.LocalAddr().(*net.UDPAddr).AddrPort())
+	if local.Addr().IsUnspecified() && peer.Addr().Is4() {
+		local = netip.AddrPortFrom(netip.IPv4Unspecified(), local.Port())
+	}
+	if sent {
+		t.Capture(now, local, peer, b)
+	} else {
+		t.Capture(now, peer, local, b)
+	}
+}
+
+func (t UDPTransport) listen() (*net.UDPConn, error) {
+	laddr := t.LocalAddr
+	if _, _, err := net.SplitHostPort(laddr); err != nil {
+		laddr = net.JoinHostPort(laddr, "0")
+	}
+	lc := net.ListenConfig{Control: t.control}
+	c, err := lc.ListenPacket(context.Background(), "udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.UDPConn), nil
+}
+
+// control sets the socket options configured in t on a new socket.
+func (t UDPTransport) control(network, address string, c syscall.RawConn) error {
+	if t.DSCP < 0 || t.DSCP > 63 {
+		return fmt.Errorf("invalid DSCP %d", t.DSCP)
+	}
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		if t.Device != "" {
+			err = bindToDevice(fd, t.Device)
+		}
+		if err == nil && t.DSCP != 0 {
+			err = setDSCP(network, fd, t.DSCP)
+		}
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// udpAddrs is a list of addresses of a server still to be tried.
+type udpAddrs []*net.UDPAddr
+
+// send sends req to the next address in a that it can be sent to and returns
+// that address.
+func (a *udpAddrs) send(conn *net.UDPConn, req []byte) (netip.AddrPort, error) {
+	err := errors.New("no addresses")
+	for len(*a) > 0 {
+		addr := (*a)[0]
+		*a = (*a)[1:]
+		if _, err = conn.WriteTo(req, addr); err == nil {
+			return addr.AddrPort(), nil
+		}
+	}
+	return netip.AddrPort{}, err
+}
+
+// resolve returns the addresses of the server at address, in the order they
+// should be tried.
+func (t UDPTransport) resolve(address string) (udpAddrs, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	p, err := net.LookupPort("udp", port)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := lookupNetIP(context.Background(), "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	var v4, v6 []*net.UDPAddr
+	for _, ip := range ips {
+		ip = ip.Unmap()
+		a := net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(p)))
+		if ip.Is4() {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+	first, second := v6, v4
+	if t.PreferIPv4 {
+		first, second = v4, v6
+	}
+	var addrs udpAddrs
+	for len(first) > 0 || len(second) > 0 {
+		if len(first) > 0 {
+			addrs, first = append(addrs, first[0]), first[1:]
+		}
+		if len(second) > 0 {
+			addrs, second = append(addrs, second[0]), second[1:]
+		}
+	}
+	if t.FallbackDelay < 0 && len(addrs) > 1 {
+		addrs = addrs[:1]
+	}
+	return addrs, nil
+}
+
+// lookupNetIP is used to resolve host names. It is replaced in tests.
+var lookupNetIP = net.DefaultResolver.LookupNetIP
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roughtime
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/wire"
+)
+
+// fakeLookup makes the name "dual.test" resolve to the given addresses.
+func fakeLookup(t *testing.T, ips ...string) {
+	orig := lookupNetIP
+	t.Cleanup(func() { lookupNetIP = orig })
+	lookupNetIP = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		if host != "dual.test" {
+			return orig(ctx, network, host)
+		}
+		var addrs []netip.Addr
+		for _, ip := range ips {
+			addrs = append(addrs, netip.MustParseAddr(ip))
+		}
+		return addrs, nil
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	fakeLookup(t, "192.0.2.1", "192.0.2.2", "2001:db8::1", "2001:db8::2")
+	tcs := []struct {
+		t    UDPTransport
+		want []string
+	}{
+		{UDPTransport{}, []string{"[2001:db8::1]:2002", "192.0.2.1:2002", "[2001:db8::2]:2002", "192.0.2.2:2002"}},
+		{UDPTransport{PreferIPv4: true}, []string{"192.0.2.1:2002", "[2001:db8::1]:2002", "192.0.2.2:2002", "[2001:db8::2]:2002"}},
+		{UDPTransport{FallbackDelay: -1}, []string{"[2001:db8::1]:2002"}},
+	}
+	for _, tc := range tcs {
+		addrs, err := tc.t.resolve("dual.test:2002")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range addrs {
+			got = append(got, a.String())
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%+v.resolve() = %q, want %q", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	s := newTestServer("server")
+	addr := serveUDP(t, s)
+	_, port, _ := net.SplitHostPort(addr)
+	// Nothing answers on the IPv6 address, so the request has to fall back
+	// to IPv4 after the head start.
+	dead, err := net.ListenPacket("udp", net.JoinHostPort("::1", port))
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	defer dead.Close()
+	fakeLookup(t, "::1", "127.0.0.1")
+	srv := &Server{Address: net.JoinHostPort("dual.test", port), PublicKey: s.publicKey()}
+
+	c := &Client{Transport: UDPTransport{FallbackDelay: 50 * time.Millisecond}, Timeout: time.Second}
+	start := time.Now()
+	if _, err := c.FetchRoughtime(srv, nil); err != nil {
+		t.Errorf("FetchRoughtime() = %v, want <nil>", err)
+	}
+	if r := c.Query([]*Server{srv})[0]; r.Err != nil {
+		t.Errorf("Query() = %v, want <nil>", r.Err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("queries took %v, want about 100ms", d)
+	}
+
+	c.Transport = UDPTransport{FallbackDelay: -1}
+	c.Timeout = 200 * time.Millisecond
+	if _, err := c.FetchRoughtime(srv, nil); err == nil {
+		t.Error("FetchRoughtime() without fallback succeeded")
+	}
+}
+
+func TestAddressFallback(t *testing.T) {
+	s := newTestServer("server")
+	cfg := s.config()
+	cfg.Addresses = []*config.ServerAddress{
+		{Protocol: "udp", Address: serveUDP(t, nil)},
+		{Protocol: "udp", Address: serveUDP(t, s)},
+	}
+	c := &Client{Timeout: 100 * time.Millisecond}
+	ch, err := NewChain(SHA512, make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Append(ch, cfg)
+	if err != nil {
+		t.Fatalf("Append() = %v, want <nil>", err)
+	}
+	if res.Address != cfg.Addresses[1].Address {
+		t.Errorf("Append() used address %q, want %q", res.Address, cfg.Addresses[1].Address)
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	s := newTestServer("server")
+	srv := &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	var nerr *NetError
+	for _, tc := range []struct {
+		t    UDPTransport
+		fail bool
+	}{
+		{UDPTransport{LocalAddr: "127.0.0.1"}, false},
+		{UDPTransport{LocalAddr: "127.0.0.1:0"}, false},
+		// Not an address of this host.
+		{UDPTransport{LocalAddr: "192.0.2.1"}, true},
+		{UDPTransport{Device: "notary-test0"}, true},
+		{UDPTransport{DSCP: 64}, true},
+	} {
+		c := &Client{Transport: tc.t, Timeout: time.Second}
+		if _, err := c.FetchRoughtime(srv, nil); (err != nil) != tc.fail || (tc.fail && !errors.As(err, &nerr)) {
+			t.Errorf("FetchRoughtime(%+v) = %v, want failure: %v", tc.t, err, tc.fail)
+		}
+		if r := c.Query([]*Server{srv})[0]; (r.Err != nil) != tc.fail {
+			t.Errorf("Query(%+v) = %v, want failure: %v", tc.t, r.Err, tc.fail)
+		}
+	}
+}
+
+func TestDSCP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("DSCP is not supported on Windows")
+	}
+	s := newTestServer("server")
+	srv := &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	// Expedited Forwarding, on an IPv4 and a dual-stack socket.
+	for _, laddr := range []string{"127.0.0.1", ""} {
+		c := &Client{Transport: UDPTransport{LocalAddr: laddr, DSCP: 46}, Timeout: time.Second}
+		if _, err := c.FetchRoughtime(srv, nil); err != nil {
+			t.Errorf("FetchRoughtime(LocalAddr=%q, DSCP=46) = %v, want <nil>", laddr, err)
+		}
+	}
+}
+
+func TestResponseTooLarge(t *testing.T) {
+	s := newTestServer("server")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req request
+			if wire.Decode(buf[:n], req.decode) != nil {
+				continue
+			}
+			// A valid response, followed by garbage.
+			resp := append(s.respond(req.nonce[:])[0], make([]byte, 1500)...)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	srv := &Server{Address: conn.LocalAddr().String(), PublicKey: s.publicKey()}
+
+	c := &Client{Timeout: time.Second}
+	var nerr *NetError
+	if _, err := c.FetchRoughtime(srv, nil); !errors.Is(err, ErrResponseTooLarge) || !errors.As(err, &nerr) {
+		t.Errorf("FetchRoughtime() = %v, want *NetError wrapping ErrResponseTooLarge", err)
+	}
+	start := time.Now()
+	if r := c.Query([]*Server{srv})[0]; !errors.Is(r.Err, ErrResponseTooLarge) {
+		t.Errorf("Query() = %v, want ErrResponseTooLarge", r.Err)
+	}
+	if d := time.Since(start); d >= c.Timeout {
+		t.Errorf("Query() took %v, want it to fail before the timeout", d)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	s := newTestServer("test")
+	srv := &Server{Address: serveUDP(t, s), PublicKey: s.publicKey()}
+	addr := netip.MustParseAddrPort(srv.Address)
+
+	type datagram struct {
+		src, dst netip.AddrPort
+		size     int
+	}
+	var got []datagram
+	tr := UDPTransport{Capture: func(_ time.Time, src, dst netip.AddrPort, b []byte) {
+		got = append(got, datagram{src, dst, len(b)})
+	}}
+	c := &Client{Transport: tr}
+	check := func(name string) {
+		t.Helper()
+		if len(got) != 2 {
+			t.Fatalf("%s captured %d datagrams, want 2", name, len(got))
+		}
+		req, resp := got[0], got[1]
+		if req.dst != addr || req.size != packetSize || !req.src.Addr().Is4() {
+			t.Errorf("%s captured request %+v, want %d bytes to %v", name, req, packetSize, addr)
+		}
+		if resp.src != addr || resp.dst.Port() != req.src.Port() || resp.size == 0 {
+			t.Errorf("%s captured response %+v, want response from %v", name, resp, addr)
+		}
+		got = nil
+	}
+	if _, err := c.FetchRoughtime(srv, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("FetchRoughtime")
+	if r := c.Query([]*Server{srv})[0]; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	check("Query")
+}
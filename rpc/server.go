@@ -0,0 +1,176 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpc implements a gRPC service to create and verify roughtime chains.
+//
+// The service is defined in notary.proto. After changing it, the generated
+// code is updated with go generate.
+package rpc // import "github.com/Merovius/notary/rpc"
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative notary.proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/internal/await"
+	"github.com/Merovius/notary/roughtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements NotaryServer using a roughtime.Client.
+type Server struct {
+	UnimplementedNotaryServer
+
+	// Client is used to query servers and verify chains. If nil, a zero
+	// Client is used.
+	Client *roughtime.Client
+	// Servers is the list of servers to use.
+	Servers *config.ServersJSON
+}
+
+func (s *Server) client() *roughtime.Client {
+	if s.Client == nil {
+		return new(roughtime.Client)
+	}
+	return s.Client
+}
+
+// Attest implements NotaryServer.
+func (s *Server) Attest(ctx context.Context, req *AttestRequest) (*AttestResponse, error) {
+	alg := req.GetHashAlgorithm()
+	if alg == "" {
+		alg = roughtime.SHA512
+	}
+	nonce, err := roughtime.DigestNonce(alg, req.GetDigest())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	type built struct {
+		ch  *roughtime.Chain
+		res []roughtime.LinkResult
+	}
+	r, err := await.Call(ctx, func() (built, error) {
+		ch, res, err := s.client().BuildChain(s.Servers, alg, nonce)
+		return built{ch, res}, err
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	b, err := roughtime.MarshalChainBinary(r.ch)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &AttestResponse{Chain: b, Links: links(r.res)}, nil
+}
+
+// Verify implements NotaryServer.
+func (s *Server) Verify(ctx context.Context, req *VerifyRequest) (*VerifyResponse, error) {
+	ch, err := roughtime.LoadChain(bytes.NewReader(req.GetChain()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	nonce, err := roughtime.DigestNonce(ch.HashAlgorithm, req.GetDigest())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rep, err := await.Call(ctx, func() (*roughtime.Report, error) {
+		return s.client().VerifyChain(ch, s.Servers)
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if len(ch.Links) == 0 || !bytes.Equal(ch.Nonce(), nonce) {
+		return nil, status.Error(codes.FailedPrecondition, "chain nonce does not match digest")
+	}
+	return &VerifyResponse{
+		Links:    links(rep.Links),
+		Earliest: timestamppb.New(rep.Earliest),
+		Latest:   timestamppb.New(rep.Latest),
+	}, nil
+}
+
+// GetTime implements NotaryServer.
+func (s *Server) GetTime(ctx context.Context, req *GetTimeRequest) (*GetTimeResponse, error) {
+	var (
+		names   []string
+		servers []*roughtime.Server
+	)
+	for _, srv := range s.Servers.Servers {
+		if len(srv.Addresses) == 0 {
+			continue
+		}
+		names = append(names, srv.Name)
+		servers = append(servers, &roughtime.Server{Address: srv.Addresses[0].Address, PublicKey: srv.PublicKey})
+	}
+	results, err := await.Call(ctx, func() ([]roughtime.QueryResult, error) {
+		return s.client().Query(servers), nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := new(GetTimeResponse)
+	for i, r := range results {
+		t := &ServerTime{Server: names[i], Address: r.Server.Address}
+		if r.Err != nil {
+			t.Error = r.Err.Error()
+		} else {
+			t.Midpoint = timestamppb.New(r.Midpoint)
+			t.Radius = durationpb.New(r.Radius)
+			t.Rtt = durationpb.New(r.RTT)
+		}
+		resp.Servers = append(resp.Servers, t)
+	}
+	return resp, nil
+}
+
+func links(res []roughtime.LinkResult) []*Link {
+	var l []*Link
+	for _, r := range res {
+		l = append(l, &Link{
+			Server:   r.Server,
+			Midpoint: timestamppb.New(r.Midpoint),
+			Radius:   durationpb.New(r.Radius),
+		})
+	}
+	return l
+}
+
+// statusError converts an error returned by the roughtime package into a gRPC
+// status.
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	var (
+		netErr    *roughtime.NetError
+		verifyErr *roughtime.VerifyError
+	)
+	switch {
+	case errors.As(err, &verifyErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &netErr):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial registers s with a gRPC server listening in memory and returns a client
+// connected to it.
+func dial(t *testing.T, s *Server) NotaryClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	RegisterNotaryServer(srv, s)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewNotaryClient(cc)
+}
+
+// serveRoughtime starts a roughtime server with a new long-term key on a local
+// socket and returns its entry for a server list.
+func serveRoughtime(t *testing.T, name string) *config.Server {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go (&server.Server{Root: priv}).Serve(conn)
+	return &config.Server{
+		Name:          name,
+		PublicKeyType: "ed25519",
+		PublicKey:     pub,
+		Addresses:     []*config.ServerAddress{{Protocol: "udp", Address: conn.LocalAddr().String()}},
+	}
+}
+
+func TestServer(t *testing.T) {
+	// A server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	servers := &config.ServersJSON{Servers: []*config.Server{{
+		Name:          "dead",
+		PublicKeyType: "ed25519",
+		PublicKey:     make([]byte, 32),
+		Addresses:     []*config.ServerAddress{{Protocol: "udp", Address: conn.LocalAddr().String()}},
+	}}}
+
+	c := dial(t, &Server{
+		Client:  &roughtime.Client{Timeout: 100 * time.Millisecond},
+		Servers: servers,
+	})
+	ctx := context.Background()
+
+	digest := sha256.Sum256([]byte("hello"))
+	tcs := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"Attest(short digest)", func() error {
+			_, err := c.Attest(ctx, &AttestRequest{HashAlgorithm: roughtime.SHA256, Digest: digest[:16]})
+			return err
+		}, codes.InvalidArgument},
+		{"Attest(dead server)", func() error {
+			_, err := c.Attest(ctx, &AttestRequest{HashAlgorithm: roughtime.SHA256, Digest: digest[:]})
+			return err
+		}, codes.Unavailable},
+		{"Verify(invalid chain)", func() error {
+			_, err := c.Verify(ctx, &VerifyRequest{Digest: digest[:], Chain: []byte("not a chain")})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, tc := range tcs {
+		if err := tc.call(); status.Code(err) != tc.want {
+			t.Errorf("%s = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	resp, err := c.GetTime(ctx, &GetTimeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Servers) != 1 || resp.Servers[0].Server != "dead" || resp.Servers[0].Error == "" || resp.Servers[0].Midpoint != nil {
+		t.Errorf("GetTime() = %v, want error for dead server", resp)
+	}
+}
+
+func TestAttestVerify(t *testing.T) {
+	servers := new(config.ServersJSON)
+	for i := range 2 {
+		servers.Servers = append(servers.Servers, serveRoughtime(t, fmt.Sprintf("test%d", i)))
+	}
+	c := dial(t, &Server{
+		Client:  &roughtime.Client{Timeout: time.Second},
+		Servers: servers,
+	})
+	ctx := context.Background()
+
+	digest := sha256.Sum256([]byte("hello"))
+	before := time.Now()
+	att, err := c.Attest(ctx, &AttestRequest{HashAlgorithm: roughtime.SHA256, Digest: digest[:]})
+	if err != nil {
+		t.Fatalf("Attest() = %v", err)
+	}
+	after := time.Now()
+	if len(att.Links) != len(servers.Servers) {
+		t.Fatalf("Attest() returned %d links, want %d", len(att.Links), len(servers.Servers))
+	}
+	for i, l := range att.Links {
+		if l.Server != servers.Servers[i].Name {
+			t.Errorf("link %d is from %q, want %q", i, l.Server, servers.Servers[i].Name)
+		}
+	}
+
+	ver, err := c.Verify(ctx, &VerifyRequest{Digest: digest[:], Chain: att.Chain})
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if len(ver.Links) != len(att.Links) {
+		t.Errorf("Verify() returned %d links, want %d", len(ver.Links), len(att.Links))
+	}
+	// The test servers claim server.DefaultRadius.
+	earliest, latest := ver.Earliest.AsTime(), ver.Latest.AsTime()
+	if earliest.After(latest) || earliest.After(after) || latest.Before(before) || latest.Sub(earliest) > 2*server.DefaultRadius {
+		t.Errorf("Verify() = [%v, %v], want interval around [%v, %v]", earliest, latest, before, after)
+	}
+
+	other := sha256.Sum256([]byte("world"))
+	if _, err := c.Verify(ctx, &VerifyRequest{Digest: other[:], Chain: att.Chain}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Verify(other digest) = %v, want %v", err, codes.FailedPrecondition)
+	}
+
+	resp, err := c.GetTime(ctx, &GetTimeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range resp.Servers {
+		if st.Error != "" || st.Midpoint == nil {
+			t.Errorf("GetTime(%s) = %v, want time", st.Server, st)
+		}
+	}
+
+	// An expired deadline fails the attestation.
+	ctx, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	if _, err := c.Attest(ctx, &AttestRequest{HashAlgorithm: roughtime.SHA256, Digest: digest[:]}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Attest(expired context) = %v, want %v", err, codes.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batcher is implemented by ipv4.PacketConn and ipv6.PacketConn, which use
+// recvmmsg and sendmmsg on Linux.
+type batcher interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+type mmsgConn struct {
+	pc batcher
+	ms []ipv4.Message
+}
+
+func newBatchConn(conn *net.UDPConn, n int) batchConn {
+	c := &mmsgConn{ms: make([]ipv4.Message, n)}
+	for i := range c.ms {
+		c.ms[i].Buffers = make([][]byte, 1)
+	}
+	if a, ok := conn.LocalAddr().(*net.UDPAddr); ok && a.IP.To4() == nil {
+		c.pc = ipv6.NewPacketConn(conn)
+	} else {
+		c.pc = ipv4.NewPacketConn(conn)
+	}
+	return c
+}
+
+func (c *mmsgConn) readBatch(ms []message) (int, error) {
+	bs := c.ms[:len(ms)]
+	for i := range bs {
+		bs[i].Buffers[0] = ms[i].buf
+		bs[i].Addr = nil
+	}
+	n, err := c.pc.ReadBatch(bs, 0)
+	if err != nil {
+		return 0, err
+	}
+	for i := range n {
+		ms[i].n, ms[i].addr = bs[i].N, bs[i].Addr
+	}
+	return n, nil
+}
+
+func (c *mmsgConn) writeBatch(ms []message) error {
+	for len(ms) > 0 {
+		bs := c.ms[:min(len(ms), len(c.ms))]
+		for i := range bs {
+			bs[i].Buffers[0] = ms[i].buf[:ms[i].n]
+			bs[i].Addr = ms[i].addr
+		}
+		n, err := c.pc.WriteBatch(bs, 0)
+		if err != nil {
+			return err
+		}
+		ms = ms[n:]
+	}
+	return nil
+}
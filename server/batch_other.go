@@ -0,0 +1,46 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package server
+
+import "net"
+
+// udpConn reads and writes one datagram at a time.
+type udpConn struct {
+	conn *net.UDPConn
+}
+
+func newBatchConn(conn *net.UDPConn, n int) batchConn {
+	return udpConn{conn}
+}
+
+func (c udpConn) readBatch(ms []message) (int, error) {
+	n, addr, err := c.conn.ReadFromUDP(ms[0].buf)
+	if err != nil {
+		return 0, err
+	}
+	ms[0].n, ms[0].addr = n, addr
+	return 1, nil
+}
+
+func (c udpConn) writeBatch(ms []message) error {
+	for _, m := range ms {
+		if _, err := c.conn.WriteTo(m.buf[:m.n], m.addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+	"github.com/Merovius/notary/wire"
+)
+
+// FuzzHandle checks that the server does not panic or amplify traffic, no
+// matter which datagrams it receives. The fuzz input is a sequence of
+// datagrams, each prefixed with its length as a little-endian uint16.
+func FuzzHandle(f *testing.F) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		f.Fatal(err)
+	}
+	now := time.Now()
+	k, err := roughtime.NewOnlineKey(root, now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		f.Fatal(err)
+	}
+	s := &Server{Key: k, Limiter: &RateLimiter{Rate: 1, Burst: 4}}
+	s.key.Store(k)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2002}
+
+	// NONC and PAD tags, as the roughtime package does not export them.
+	const (
+		tNONC wire.Tag = 0x434e4f4e
+		tPAD  wire.Tag = 0xff444150
+	)
+	req, err := wire.Marshal(map[wire.Tag][]byte{tNONC: make([]byte, 64), tPAD: make([]byte, MinRequestSize-16-64)})
+	if err != nil {
+		f.Fatal(err)
+	}
+	datagram := func(b []byte) []byte {
+		return append(binary.LittleEndian.AppendUint16(nil, uint16(len(b))), b...)
+	}
+	f.Add([]byte{})
+	f.Add(datagram(req))
+	f.Add(slices.Concat(datagram(req), datagram([]byte("short")), datagram(make([]byte, MinRequestSize)), datagram(req)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var in []message
+		for len(data) >= 2 {
+			n := min(int(binary.LittleEndian.Uint16(data)), len(data)-2)
+			in = append(in, message{buf: data[2 : 2+n], n: n, addr: addr})
+			data = data[2+n:]
+		}
+		largest := 0
+		for _, m := range in {
+			largest = max(largest, m.n)
+		}
+		out := s.handle(in, make([][]byte, len(in)), nil)
+		if len(out) > len(in) {
+			t.Fatalf("%d responses to %d requests", len(out), len(in))
+		}
+		for _, m := range out {
+			if m.n > largest {
+				t.Errorf("response of %d bytes to requests of at most %d", m.n, largest)
+			}
+			if m.addr != addr {
+				t.Errorf("response sent to %v, want %v", m.addr, addr)
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health returns an error if s can not answer requests right now: if the time
+// source fails, there is no online key yet, the online key expired and can not
+// be replaced, or minting a new online key failed recently.
+func (s *Server) Health() error {
+	s.mu.RLock()
+	ts, root := s.timeSource(), s.Root
+	s.mu.RUnlock()
+	iv, err := ts.Now()
+	if err != nil {
+		return fmt.Errorf("reading time: %w", err)
+	}
+	k := s.OnlineKey()
+	switch {
+	case k == nil:
+		return errors.New("no online key")
+	case root == nil && !iv.Midpoint.Before(k.Delegation.NotAfter):
+		return fmt.Errorf("online key expired at %v", k.Delegation.NotAfter)
+	case time.Now().UnixNano() < s.retry.Load():
+		return errors.New("minting online key failed")
+	}
+	return nil
+}
+
+// HealthHandler returns a handler for health checks by load balancers and
+// orchestrators. It responds with status 200 if s is healthy and 503 with the
+// reason otherwise, see Health.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Health(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
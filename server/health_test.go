@@ -0,0 +1,65 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestHealth(t *testing.T) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	k, err := roughtime.NewOnlineKey(root, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := roughtime.NewOnlineKey(root, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsynchronized := TimeSourceFunc(func() (roughtime.Interval, error) {
+		return roughtime.Interval{}, ErrUnsynchronized
+	})
+
+	tcs := []struct {
+		name string
+		s    *Server
+		want int
+	}{
+		{"ok", &Server{Key: k}, http.StatusOK},
+		{"no key", &Server{Root: root}, http.StatusServiceUnavailable},
+		{"expired", &Server{Key: expired}, http.StatusServiceUnavailable},
+		{"unsynchronized", &Server{Key: k, TimeSource: unsynchronized}, http.StatusServiceUnavailable},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.s.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+			if w.Code != tc.want {
+				t.Errorf("GET /healthz = %d %q, want %d", w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
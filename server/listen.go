@@ -0,0 +1,159 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ListenAndServe listens on the UDP addresses addrs and serves requests on all
+// of them, see ServeConns. If more than one address is given, IPv6 addresses
+// only accept IPv6 traffic, so that for example 0.0.0.0:2002 and [::]:2002 can
+// be combined.
+func (s *Server) ListenAndServe(addrs ...string) error {
+	conns, err := Listen(addrs...)
+	if err != nil {
+		return err
+	}
+	return s.ServeConns(conns...)
+}
+
+// Listen listens on the UDP addresses addrs, like ListenAndServe, and returns
+// the sockets to be passed to ServeConns. Closing them stops the server.
+func Listen(addrs ...string) ([]*net.UDPConn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to listen on")
+	}
+	var conns []*net.UDPConn
+	for _, addr := range addrs {
+		conn, err := listen(addr, len(addrs) > 1)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// listen listens on the UDP address addr. If split is set, IP literals are
+// listened on with their own address family only.
+func listen(addr string, split bool) (*net.UDPConn, error) {
+	network := "udp"
+	if host, _, err := net.SplitHostPort(addr); err == nil && split {
+		if ip, err := netip.ParseAddr(host); err == nil && ip.Is4() {
+			network = "udp4"
+		} else if err == nil {
+			network = "udp6"
+		}
+	}
+	ua, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenUDP(network, ua)
+}
+
+// ServeConns serves requests on all of conns concurrently, sharing the online
+// key, rate limits and metrics. When serving one of them fails, the others are
+// closed as well and the first error is returned. If the connections are
+// closed, ServeConns returns net.ErrClosed.
+func (s *Server) ServeConns(conns ...*net.UDPConn) error {
+	if len(conns) == 0 {
+		return errors.New("no connections to serve")
+	}
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	for _, c := range conns {
+		wg.Go(func() {
+			e := s.Serve(c)
+			once.Do(func() {
+				err = e
+				for _, c := range conns {
+					c.Close()
+				}
+			})
+		})
+	}
+	wg.Wait()
+	return err
+}
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// SystemdConns returns the UDP sockets passed by systemd socket activation,
+// using the LISTEN_PID and LISTEN_FDS environment variables. With socket
+// activation, systemd can bind privileged ports like 2002 below 1024 on behalf
+// of a server that does not run as root. If the process was not
+// socket-activated, SystemdConns returns no sockets and no error. The
+// environment variables are unset, so child processes do not inherit them.
+func SystemdConns() ([]*net.UDPConn, error) {
+	return systemdConns(listenFDsStart)
+}
+
+func systemdConns(start int) ([]*net.UDPConn, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// Meant for another process.
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	nameList := strings.Split(names, ":")
+	var conns []*net.UDPConn
+	for i := range n {
+		name := fmt.Sprintf("LISTEN_FD_%d", start+i)
+		if i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		c, err := net.FilePacketConn(f)
+		f.Close()
+		if err == nil {
+			if uc, ok := c.(*net.UDPConn); ok {
+				conns = append(conns, uc)
+				continue
+			}
+			c.Close()
+			err = errors.New("not a UDP socket")
+		}
+		for _, c := range conns {
+			c.Close()
+		}
+		return nil, fmt.Errorf("socket %s: %w", name, err)
+	}
+	return conns, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestServeConns(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []*net.UDPConn
+	for _, addr := range []string{"127.0.0.1:0", "[::1]:0"} {
+		conn, err := listen(addr, true)
+		if err != nil {
+			t.Logf("listen(%q) = %v", addr, err)
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	if len(conns) == 0 {
+		t.Skip("no loopback addresses")
+	}
+	s := &Server{Root: priv}
+	done := make(chan error, 1)
+	go func() { done <- s.ServeConns(conns...) }()
+
+	c := &roughtime.Client{Timeout: time.Second}
+	for _, conn := range conns {
+		srv := &roughtime.Server{Address: conn.LocalAddr().String(), PublicKey: pub}
+		if _, err := c.FetchRoughtime(srv, nil); err != nil {
+			t.Errorf("FetchRoughtime(%s) = %v", srv.Address, err)
+		}
+	}
+
+	// Closing one connection stops serving all of them.
+	conns[0].Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("ServeConns() = %v, want %v", err, net.ErrClosed)
+	}
+	if _, err := conns[len(conns)-1].WriteTo(nil, conns[0].LocalAddr()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("connection still open after ServeConns returned")
+	}
+}
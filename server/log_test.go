@@ -0,0 +1,99 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func TestRequestLog(t *testing.T) {
+	buf := new(syncBuffer)
+	log := slog.New(slog.NewJSONHandler(buf, nil))
+	srv, stop := serve(t, &Server{RequestLog: log})
+
+	conn, err := net.Dial("udp", srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("short")); err != nil {
+		t.Fatal(err)
+	}
+	c := &roughtime.Client{Timeout: time.Second}
+	if _, err := c.FetchRoughtime(srv, nil); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	verdicts := make(map[string]int)
+	dec := json.NewDecoder(&buf.Buffer)
+	for dec.More() {
+		var rec struct {
+			Msg     string
+			Source  string
+			Size    int
+			Batch   uint64
+			Verdict string
+		}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Msg != "request" || rec.Source == "" || rec.Batch == 0 {
+			t.Errorf("unexpected log record %+v", rec)
+		}
+		if rec.Verdict == DropTooSmall && (rec.Source != conn.LocalAddr().String() || rec.Size != len("short")) {
+			t.Errorf("log record %+v, want source %s and size 5", rec, conn.LocalAddr())
+		}
+		verdicts[rec.Verdict]++
+	}
+	if verdicts[DropTooSmall] != 1 || verdicts["answered"] == 0 {
+		t.Errorf("logged verdicts %v, want one %s and at least one answered", verdicts, DropTooSmall)
+	}
+}
+
+func TestRequestLogSampling(t *testing.T) {
+	buf := new(syncBuffer)
+	srv, stop := serve(t, &Server{RequestLog: slog.New(slog.NewJSONHandler(buf, nil)), RequestLogSampling: 1e-9})
+	c := &roughtime.Client{Timeout: time.Second}
+	for range 10 {
+		if _, err := c.FetchRoughtime(srv, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop()
+	if buf.Len() != 0 {
+		t.Errorf("logged %q with a sampling probability of 1e-9", buf.String())
+	}
+}
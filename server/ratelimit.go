@@ -0,0 +1,115 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"cmp"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Defaults used by a RateLimiter with no corresponding field set.
+const (
+	DefaultRate       = 10
+	DefaultBurst      = 20
+	DefaultIPv4Prefix = 32
+	DefaultIPv6Prefix = 64
+)
+
+// A RateLimiter limits the rate of requests from each source network with a
+// token bucket. Sources are grouped by prefix, so that a client with a large
+// IPv6 allocation can not evade the limit by changing its address.
+//
+// Requests over the limit are dropped silently, as clients can not tell a
+// rate-limited request from a lost one anyway. Its methods are safe for
+// concurrent use.
+type RateLimiter struct {
+	// Rate is the number of requests per second allowed from each prefix.
+	// If zero, DefaultRate is used.
+	Rate float64
+	// Burst is the number of requests allowed from a prefix at once. If
+	// zero, DefaultBurst is used.
+	Burst int
+	// IPv4Prefix and IPv6Prefix are the lengths of the prefixes sources are
+	// grouped by. If zero, DefaultIPv4Prefix and DefaultIPv6Prefix are used.
+	IPv4Prefix int
+	IPv6Prefix int
+
+	mu      sync.Mutex
+	buckets map[netip.Prefix]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow reports whether a request from addr is within the limit, and takes a
+// token from its bucket if so.
+func (l *RateLimiter) Allow(addr netip.Addr) bool {
+	return l.allow(addr, time.Now())
+}
+
+func (l *RateLimiter) allow(addr netip.Addr, now time.Time) bool {
+	rate, burst := cmp.Or(l.Rate, DefaultRate), float64(cmp.Or(l.Burst, DefaultBurst))
+	p := l.prefix(addr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[netip.Prefix]*bucket)
+		l.swept = now
+	}
+	// A bucket that refilled completely is the same as none, so forget
+	// those once in a while to bound memory.
+	if refill := time.Duration(burst / rate * float64(time.Second)); now.Sub(l.swept) > refill {
+		for p, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, p)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[p]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[p] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prefix returns the prefix addr is accounted to.
+func (l *RateLimiter) prefix(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	bits := cmp.Or(l.IPv6Prefix, DefaultIPv6Prefix)
+	if addr.Is4() {
+		bits = cmp.Or(l.IPv4Prefix, DefaultIPv4Prefix)
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		// bits is out of range; treat the whole address family as one
+		// source rather than none.
+		p, _ = addr.Prefix(0)
+	}
+	return p
+}
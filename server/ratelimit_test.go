@@ -0,0 +1,54 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &RateLimiter{Rate: 1, Burst: 2}
+	now := time.Now()
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("2001:db8::1")
+	// Same /64 as b.
+	c := netip.MustParseAddr("2001:db8::2")
+
+	for i, want := range []bool{true, true, false} {
+		if got := l.allow(a, now); got != want {
+			t.Errorf("allow(a) #%d = %v, want %v", i, got, want)
+		}
+	}
+	if !l.allow(b, now) || !l.allow(c, now) || l.allow(c, now) {
+		t.Error("addresses in the same /64 do not share a bucket")
+	}
+	if !l.allow(netip.MustParseAddr("::ffff:192.0.2.2"), now) {
+		t.Error("a different IPv4 address is limited")
+	}
+
+	now = now.Add(time.Second)
+	if !l.allow(a, now) || l.allow(a, now) {
+		t.Error("bucket did not refill at Rate")
+	}
+
+	// Buckets that refilled completely are forgotten.
+	now = now.Add(time.Minute)
+	l.allow(a, now)
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("%d buckets after sweep, want 1", n)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"cmp"
+	"errors"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// DefaultKeyLifetime and DefaultKeyOverlap are used by a Server with no
+// KeyLifetime or KeyOverlap set.
+const (
+	DefaultKeyLifetime = 48 * time.Hour
+	DefaultKeyOverlap  = 6 * time.Hour
+)
+
+// rotateRetry is how long to wait before trying again to mint a key, after
+// signing with the long-term key failed.
+const rotateRetry = time.Minute
+
+// OnlineKey returns the key responses are currently signed with. It is nil if
+// Key is not set and Serve did not mint a key yet.
+func (s *Server) OnlineKey() *roughtime.OnlineKey {
+	if k := s.key.Load(); k != nil {
+		return k
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Key
+}
+
+// onlineKey returns the key to sign responses at now with. s.mu must be
+// read-locked. If the key is about
+// to expire, a new one is minted in the background, so the switch does not
+// delay any requests. Only if the key already expired, for example because the
+// server was idle, onlineKey blocks until a new one is minted.
+func (s *Server) onlineKey(now time.Time) (*roughtime.OnlineKey, error) {
+	k := s.key.Load()
+	if s.Root == nil {
+		if k == nil {
+			return nil, errors.New("no online key")
+		}
+		return k, nil
+	}
+	if k == nil || !now.Before(k.Delegation.NotAfter) {
+		s.mintMu.Lock()
+		defer s.mintMu.Unlock()
+		if k = s.key.Load(); k != nil && now.Before(k.Delegation.NotAfter) {
+			return k, nil
+		}
+		k, err := s.mint(now)
+		if err != nil {
+			s.retry.Store(time.Now().Add(rotateRetry).UnixNano())
+			return nil, err
+		}
+		s.key.Store(k)
+		s.retry.Store(0)
+		return k, nil
+	}
+	overlap := cmp.Or(s.KeyOverlap, DefaultKeyOverlap)
+	if now.Before(k.Delegation.NotAfter.Add(-overlap)) || time.Now().UnixNano() < s.retry.Load() {
+		return k, nil
+	}
+	if s.rotating.CompareAndSwap(false, true) {
+		go s.rotate(k)
+	}
+	return k, nil
+}
+
+// rotate replaces old with a new key.
+func (s *Server) rotate(old *roughtime.OnlineKey) {
+	defer s.rotating.Store(false)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.mintMu.Lock()
+	defer s.mintMu.Unlock()
+	if s.key.Load() != old {
+		return
+	}
+	now := time.Now()
+	k, err := s.mint(now)
+	if err != nil {
+		s.logger().Error("rotating online key failed", "error", err, "expiry", old.Delegation.NotAfter)
+		s.retry.Store(now.Add(rotateRetry).UnixNano())
+		return
+	}
+	s.key.Store(k)
+	s.retry.Store(0)
+}
+
+// mint creates a new online key, valid from now for KeyLifetime.
+func (s *Server) mint(now time.Time) (*roughtime.OnlineKey, error) {
+	k, err := roughtime.NewOnlineKey(s.Root, now, now.Add(cmp.Or(s.KeyLifetime, DefaultKeyLifetime)))
+	if err != nil {
+		return nil, err
+	}
+	s.logger().Info("minted online key", "public_key", k.PublicKey(), "not_after", k.Delegation.NotAfter)
+	return k, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// waitRotation waits for a background rotation of s to finish.
+func waitRotation(t *testing.T, s *Server) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); s.rotating.Load(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("rotation did not finish")
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Root: root, KeyLifetime: time.Hour, KeyOverlap: 10 * time.Minute}
+	now := time.Now()
+
+	k1, err := s.onlineKey(now)
+	if err != nil || !k1.Delegation.NotAfter.Equal(now.Add(time.Hour)) {
+		t.Fatalf("onlineKey() = %v, %v, want a key valid for an hour", k1, err)
+	}
+	if k, _ := s.onlineKey(now.Add(30 * time.Minute)); k != k1 || s.rotating.Load() {
+		t.Error("onlineKey() rotated before the overlap")
+	}
+
+	// In the overlap, the old key is used until the new one is minted.
+	if k, _ := s.onlineKey(now.Add(55 * time.Minute)); k != k1 {
+		t.Error("onlineKey() in the overlap did not return the current key")
+	}
+	waitRotation(t, s)
+	k2 := s.OnlineKey()
+	if k2 == k1 || k2.Delegation.NotAfter.Before(k1.Delegation.NotAfter) {
+		t.Errorf("OnlineKey() after rotation = %v, want a new key", k2)
+	}
+
+	// An expired key is replaced right away.
+	later := now.Add(3 * time.Hour)
+	if k, err := s.onlineKey(later); err != nil || k == k2 || !k.Delegation.NotBefore.Equal(later) {
+		t.Errorf("onlineKey() after expiry = %v, %v, want a new key", k, err)
+	}
+}
+
+type failingSigner struct {
+	ed25519.PrivateKey
+}
+
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("token removed")
+}
+
+func TestRotationFailure(t *testing.T) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An overlap longer than the lifetime makes rotation due right away.
+	s := &Server{Root: root, KeyLifetime: time.Hour, KeyOverlap: 2 * time.Hour}
+	k1, err := s.onlineKey(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing to rotate keeps the current key, and is retried later.
+	s.Root = failingSigner{root}
+	if k, err := s.onlineKey(time.Now()); k != k1 || err != nil {
+		t.Fatalf("onlineKey() = %v, %v, want current key", k, err)
+	}
+	waitRotation(t, s)
+	if s.OnlineKey() != k1 || s.retry.Load() == 0 {
+		t.Fatal("failed rotation replaced the key or is not retried")
+	}
+	s.onlineKey(time.Now())
+	if s.rotating.Load() {
+		t.Error("rotation retried too early")
+	}
+	if _, err := s.onlineKey(time.Now().Add(2 * time.Hour)); err == nil {
+		t.Error("onlineKey() after expiry succeeded without a usable root key")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	_, root, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Root: root}
+	k1, err := s.onlineKey(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Configure(func(s *Server) {
+		s.Radius = time.Minute
+		s.Root = append(ed25519.PrivateKey(nil), root...)
+	})
+	if k := s.OnlineKey(); k != k1 {
+		t.Errorf("OnlineKey() after Configure() with the same root = %v, want %v", k, k1)
+	}
+
+	_, root2, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Configure(func(s *Server) { s.Root = root2 })
+	if k := s.OnlineKey(); k != nil {
+		t.Errorf("OnlineKey() after changing the root = %v, want nil", k)
+	}
+	if k, err := s.onlineKey(time.Now()); err != nil || k == k1 {
+		t.Errorf("onlineKey() after changing the root = %v, %v, want a new key", k, err)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements a roughtime server.
+//
+// Requests are read from the socket in batches and all requests of a batch are
+// answered with a single signature. On Linux, a batch is read and written with
+// one recvmmsg and sendmmsg system call each, so the per-request overhead
+// under load is small.
+//
+// Both Google roughtime and the IETF draft are served on the same socket: each
+// request is answered in the dialect it was sent in.
+package server // import "github.com/Merovius/notary/server"
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// DefaultBatchSize is the number of requests answered with a single
+// signature, if Server.BatchSize is zero.
+const DefaultBatchSize = 64
+
+// MinRequestSize is the smallest request answered. Requests are padded to this
+// size, so that a response is never larger than the request that triggered it
+// and the server can not be used to amplify attacks with spoofed sources.
+const MinRequestSize = 1024
+
+// Reasons for dropping a request, as passed to Recorder.RecordDrop.
+// DropUnavailable is used for requests that could not be answered because the
+// time source or signing failed.
+const (
+	DropTooSmall    = "too_small"
+	DropRateLimited = "rate_limited"
+	DropInvalid     = "invalid"
+	DropAmplifying  = "amplifying"
+	DropUnavailable = "unavailable"
+)
+
+// maxRequestSize is the size of the buffer requests are read into. Requests
+// are padded to 1024 bytes and larger ones are not expected to survive
+// fragmentation anyway.
+const maxRequestSize = 1500
+
+// A Server answers roughtime requests. A Server must not be copied after
+// first use. While it is serving, its fields must only be changed with
+// Configure.
+type Server struct {
+	// Key is the online key responses are signed with. If Root is set, it
+	// is only used until it expires and can be nil.
+	Key *roughtime.OnlineKey
+
+	// Root is the long-term key of the server. If it is set, the server
+	// mints a new online key with it, KeyOverlap before the current one
+	// expires, and switches to it without dropping requests. Root must be
+	// an Ed25519 key, but can be held by a hardware token or key management
+	// service.
+	Root crypto.Signer
+	// KeyLifetime is the validity of minted online keys. If zero,
+	// DefaultKeyLifetime is used.
+	KeyLifetime time.Duration
+	// KeyOverlap is how long before the current online key expires a new
+	// one is minted. If zero, DefaultKeyOverlap is used.
+	KeyOverlap time.Duration
+
+	// BatchSize is the largest number of requests read at once and signed
+	// together. If it is zero, DefaultBatchSize is used.
+	BatchSize int
+
+	// TimeSource provides the time claimed in responses. If it is nil,
+	// SystemClock is used.
+	TimeSource TimeSource
+	// Radius is the smallest uncertainty claimed in responses. If the
+	// TimeSource reports a larger one, that is claimed instead. If zero,
+	// DefaultRadius is used. It should reflect the actual accuracy of the
+	// clock, including errors of the time source that it does not report.
+	Radius time.Duration
+
+	// Limiter limits the rate of requests from each source. If it is nil,
+	// requests are not rate-limited.
+	Limiter *RateLimiter
+
+	// Recorder, if set, is informed about handled and dropped requests. It
+	// can be used to collect metrics.
+	Recorder Recorder
+
+	// Logger is used to log errors. If it is nil, nothing is logged.
+	Logger *slog.Logger
+
+	// RequestLog, if set, receives a record for every handled request,
+	// with its source, size, the ID of the batch it was read in and the
+	// verdict: "answered" or one of the Drop* reasons.
+	RequestLog *slog.Logger
+	// RequestLogSampling is the probability of a request to be logged to
+	// RequestLog, to keep the volume manageable under load. If it is zero,
+	// all requests are logged.
+	RequestLogSampling float64
+
+	// mu guards the exported fields. It is read-locked while a batch is
+	// handled, so Configure takes effect between batches.
+	mu       sync.RWMutex
+	key      atomic.Pointer[roughtime.OnlineKey]
+	mintMu   sync.Mutex
+	rotating atomic.Bool
+	retry    atomic.Int64 // no rotation attempts before, in Unix nanoseconds
+	batches  atomic.Uint64
+}
+
+// A Recorder is informed about requests handled by a Server. Its methods must
+// be safe for concurrent use.
+type Recorder interface {
+	// RecordBatch is called for each batch of requests read from a socket,
+	// with the number of requests and of responses sent. signing is the
+	// time it took to sign the responses.
+	RecordBatch(requests, responses int, signing time.Duration)
+	// RecordDrop is called for each request that is not answered, with
+	// one of the Drop* constants as reason.
+	RecordDrop(reason string)
+}
+
+// Configure calls f to change the fields of s while it is serving, for example
+// to reload its configuration. The changes take effect with the next batch of
+// requests, except for BatchSize, which only applies to later calls to Serve.
+// If Root or Key change, the current online key is discarded, so no responses
+// are signed with a key certified by the old long-term key.
+func (s *Server) Configure(f func(s *Server)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root, key := s.Root, s.Key
+	f(s)
+	if s.Key != key || !samePublicKey(s.Root, root) {
+		s.key.Store(s.Key)
+		s.retry.Store(0)
+	}
+}
+
+// samePublicKey reports whether a and b are the same key, or both nil.
+func samePublicKey(a, b crypto.Signer) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	pub, ok := a.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(b.Public())
+}
+
+// Serve serves requests received on conn, until reading from it fails. If conn
+// is closed, Serve returns net.ErrClosed.
+func (s *Server) Serve(conn *net.UDPConn) error {
+	s.mu.RLock()
+	if s.Key == nil && s.Root == nil {
+		s.mu.RUnlock()
+		return errors.New("no online key")
+	}
+	if s.Key != nil {
+		s.key.CompareAndSwap(nil, s.Key)
+	}
+	n := s.BatchSize
+	s.mu.RUnlock()
+	if n <= 0 {
+		n = DefaultBatchSize
+	}
+	bc := newBatchConn(conn, n)
+	in := make([]message, n)
+	for i := range in {
+		in[i].buf = make([]byte, maxRequestSize)
+	}
+	out := make([]message, 0, n)
+	reqs := make([][]byte, n)
+	for {
+		m, err := bc.readBatch(in)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return net.ErrClosed
+			}
+			return err
+		}
+		out = s.handle(in[:m], reqs[:m], out[:0])
+		if err := bc.writeBatch(out); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return net.ErrClosed
+			}
+			s.mu.RLock()
+			s.logger().Warn("writing responses failed", "error", err)
+			s.mu.RUnlock()
+		}
+	}
+}
+
+func (s *Server) recordBatch(requests, responses int, signing time.Duration) {
+	if s.Recorder != nil {
+		s.Recorder.RecordBatch(requests, responses, signing)
+	}
+}
+
+// handle answers the requests in, appending the responses to out. reqs is
+// scratch space of the same length as in.
+func (s *Server) handle(in []message, reqs [][]byte, out []message) []message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	batch := s.batches.Add(1)
+	for i := range in {
+		in[i].batch = batch
+		reqs[i] = nil
+		if s.admit(&in[i]) {
+			reqs[i] = in[i].buf[:in[i].n]
+		}
+	}
+	start := time.Now()
+	resps, err := s.respond(reqs)
+	signing := time.Since(start)
+	if err != nil {
+		s.logger().Error("responding failed", "error", err)
+		for i := range in {
+			if reqs[i] != nil {
+				s.drop(&in[i], DropUnavailable)
+			}
+		}
+		s.recordBatch(len(in), 0, 0)
+		return out
+	}
+	n := len(out)
+	for i, r := range resps {
+		switch {
+		case reqs[i] == nil:
+			// Dropped by admit.
+		case r == nil:
+			s.drop(&in[i], DropInvalid)
+		case len(r) > in[i].n:
+			s.drop(&in[i], DropAmplifying)
+		default:
+			s.logRequest(&in[i], "answered")
+			out = append(out, message{buf: r, n: len(r), addr: in[i].addr})
+		}
+	}
+	s.recordBatch(len(in), len(out)-n, signing)
+	return out
+}
+
+// respond returns the responses to reqs, or an error if none can be answered.
+func (s *Server) respond(reqs [][]byte) ([][]byte, error) {
+	iv, err := s.timeSource().Now()
+	if err != nil {
+		return nil, fmt.Errorf("reading time: %w", err)
+	}
+	iv.Radius = max(iv.Radius, cmp.Or(s.Radius, DefaultRadius))
+	k, err := s.onlineKey(iv.Midpoint)
+	if err != nil {
+		return nil, err
+	}
+	return k.Respond(reqs, iv)
+}
+
+// admit reports whether m should be answered.
+func (s *Server) admit(m *message) bool {
+	if m.n < MinRequestSize {
+		s.drop(m, DropTooSmall)
+		return false
+	}
+	if s.Limiter != nil && !s.Limiter.Allow(addrOf(m.addr)) {
+		s.drop(m, DropRateLimited)
+		return false
+	}
+	return true
+}
+
+func (s *Server) drop(m *message, reason string) {
+	s.logRequest(m, reason)
+	if s.Recorder != nil {
+		s.Recorder.RecordDrop(reason)
+	}
+}
+
+// logRequest logs m to the request log, if it is sampled.
+func (s *Server) logRequest(m *message, verdict string) {
+	if s.RequestLog == nil || (s.RequestLogSampling != 0 && rand.Float64() >= s.RequestLogSampling) {
+		return
+	}
+	var source string
+	if m.addr != nil {
+		source = m.addr.String()
+	}
+	s.RequestLog.LogAttrs(context.Background(), slog.LevelInfo, "request",
+		slog.String("source", source),
+		slog.Int("size", m.n),
+		slog.Uint64("batch", m.batch),
+		slog.String("verdict", verdict),
+	)
+}
+
+// addrOf returns the IP address of a UDP source.
+func addrOf(a net.Addr) netip.Addr {
+	if ua, ok := a.(*net.UDPAddr); ok {
+		return ua.AddrPort().Addr()
+	}
+	return netip.Addr{}
+}
+
+func (s *Server) timeSource() TimeSource {
+	if s.TimeSource == nil {
+		return SystemClock{}
+	}
+	return s.TimeSource
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return s.Logger
+}
+
+// A message is a datagram read from or written to a batchConn. Its payload is
+// buf[:n].
+type message struct {
+	buf  []byte
+	n    int
+	addr net.Addr
+	// batch is the ID of the batch a request was read in, for logging.
+	batch uint64
+}
+
+// A batchConn reads and writes datagrams in batches.
+type batchConn interface {
+	// readBatch blocks until at least one datagram is available and reads
+	// as many as are queued, up to len(ms). It returns how many were read.
+	readBatch(ms []message) (int, error)
+	// writeBatch writes all of ms.
+	writeBatch(ms []message) error
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"maps"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// serve starts s with a new long-term key on a local socket and returns the server to
+// query. stop closes the socket and waits for Serve to return.
+func serve(t *testing.T, s *Server) (srv *roughtime.Server, stop func()) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Root = priv
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(conn) }()
+	stop = sync.OnceFunc(func() {
+		conn.Close()
+		if err := <-done; !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Serve() = %v, want %v", err, net.ErrClosed)
+		}
+	})
+	t.Cleanup(stop)
+	return &roughtime.Server{Address: conn.LocalAddr().String(), PublicKey: pub}, stop
+}
+
+func TestServe(t *testing.T) {
+	rec := new(testRecorder)
+	srv, stop := serve(t, &Server{BatchSize: 4, Recorder: rec})
+
+	// Garbage is ignored.
+	conn, err := net.Dial("udp", srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, b := range [][]byte{[]byte("short"), make([]byte, MinRequestSize)} {
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &roughtime.Client{Timeout: time.Second}
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Go(func() {
+			res, err := c.FetchRoughtime(srv, nil)
+			if err != nil {
+				t.Errorf("FetchRoughtime() = %v", err)
+				return
+			}
+			if d := res.Midpoint.Sub(time.Now()).Abs(); d > res.Radius+time.Second {
+				t.Errorf("FetchRoughtime() = %v, off by %v", res.Midpoint, d)
+			}
+		})
+	}
+	wg.Wait()
+
+	stop()
+	want := map[string]int{DropTooSmall: 1, DropInvalid: 1}
+	if got := rec.drops(); !maps.Equal(got, want) {
+		t.Errorf("dropped %v, want %v", got, want)
+	}
+	// Responses can be lost, and then retransmitted.
+	if rec.responses < 32 || rec.requests != rec.responses+2 {
+		t.Errorf("recorded %d requests and %d responses, want 34 and 32", rec.requests, rec.responses)
+	}
+}
+
+func TestServeRateLimit(t *testing.T) {
+	rec := new(testRecorder)
+	srv, stop := serve(t, &Server{Limiter: &RateLimiter{Rate: 1e-3, Burst: 1}, Recorder: rec})
+
+	c := &roughtime.Client{Timeout: 100 * time.Millisecond}
+	if _, err := c.FetchRoughtime(srv, nil); err != nil {
+		t.Errorf("FetchRoughtime() = %v", err)
+	}
+	if _, err := c.FetchRoughtime(srv, nil); err == nil {
+		t.Error("FetchRoughtime() over the rate limit succeeded")
+	}
+
+	stop()
+	if got := rec.drops(); got[DropRateLimited] == 0 {
+		t.Errorf("dropped %v, want %s", got, DropRateLimited)
+	}
+}
+
+type testRecorder struct {
+	mu        sync.Mutex
+	count     map[string]int
+	requests  int
+	responses int
+}
+
+func (r *testRecorder) RecordBatch(requests, responses int, signing time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests += requests
+	r.responses += responses
+}
+
+func (r *testRecorder) RecordDrop(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == nil {
+		r.count = make(map[string]int)
+	}
+	r.count[reason]++
+}
+
+func (r *testRecorder) drops() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.count)
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// DefaultRadius is the uncertainty claimed by a Server with no Radius set.
+const DefaultRadius = time.Second
+
+// ErrUnsynchronized is returned by a TimeSource that does not know the time.
+var ErrUnsynchronized = errors.New("clock is not synchronized")
+
+// A TimeSource provides the time a Server claims in its responses. Its Now
+// method returns the current time and how far the true time can be from it at
+// most. It must be safe for concurrent use.
+//
+// If Now fails, no requests are answered, as a wrong answer does more harm to
+// clients than none.
+type TimeSource interface {
+	Now() (roughtime.Interval, error)
+}
+
+// TimeSourceFunc adapts a function to a TimeSource, for example to use an
+// external oracle or a clock.Clock.
+type TimeSourceFunc func() (roughtime.Interval, error)
+
+// Now calls f.
+func (f TimeSourceFunc) Now() (roughtime.Interval, error) {
+	return f()
+}
+
+// SystemClock is a TimeSource returning the local time, with no uncertainty of
+// its own, so the radius is that configured for the Server.
+type SystemClock struct{}
+
+// Now implements TimeSource.
+func (SystemClock) Now() (roughtime.Interval, error) {
+	return roughtime.Interval{Midpoint: time.Now()}, nil
+}
+
+// KernelClock is a TimeSource returning the local time, with the maximum error
+// the kernel maintains for it. That error is set by the daemon disciplining the
+// clock, like chronyd, ntpd or phc2sys for a PTP hardware clock, and grows while
+// the clock is not disciplined. Now fails with ErrUnsynchronized if the kernel
+// considers the clock unsynchronized. It is only supported on Linux.
+type KernelClock struct{}
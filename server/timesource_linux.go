@@ -0,0 +1,42 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+// Values from <sys/timex.h>.
+const (
+	staUnsync = 0x0040
+	timeError = 5
+)
+
+// Now implements TimeSource.
+func (KernelClock) Now() (roughtime.Interval, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return roughtime.Interval{}, err
+	}
+	now := time.Now()
+	if state == timeError || tx.Status&staUnsync != 0 {
+		return roughtime.Interval{}, ErrUnsynchronized
+	}
+	return roughtime.Interval{Midpoint: now, Radius: time.Duration(tx.Maxerror) * time.Microsecond}, nil
+}
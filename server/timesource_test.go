@@ -0,0 +1,74 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/roughtime"
+)
+
+func TestServeTimeSource(t *testing.T) {
+	midpoint := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	ts := TimeSourceFunc(func() (roughtime.Interval, error) {
+		return roughtime.Interval{Midpoint: midpoint, Radius: 3 * time.Second}, nil
+	})
+	srv, _ := serve(t, &Server{TimeSource: ts, Radius: 2 * time.Second})
+	c := &roughtime.Client{Timeout: time.Second}
+	res, err := c.FetchRoughtime(srv, nil)
+	if err != nil || !res.Midpoint.Equal(midpoint) || res.Radius != 3*time.Second {
+		t.Fatalf("FetchRoughtime() = %v, %v, want %v±3s", res, err, midpoint)
+	}
+
+	ts = func() (roughtime.Interval, error) {
+		return roughtime.Interval{Midpoint: midpoint}, nil
+	}
+	srv, _ = serve(t, &Server{TimeSource: ts, Radius: 2 * time.Second})
+	if res, err := c.FetchRoughtime(srv, nil); err != nil || res.Radius != 2*time.Second {
+		t.Errorf("FetchRoughtime() = %v, %v, want radius of 2s", res, err)
+	}
+}
+
+func TestServeUnsynchronized(t *testing.T) {
+	rec := new(testRecorder)
+	ts := TimeSourceFunc(func() (roughtime.Interval, error) {
+		return roughtime.Interval{}, ErrUnsynchronized
+	})
+	srv, stop := serve(t, &Server{TimeSource: ts, Recorder: rec})
+	c := &roughtime.Client{Timeout: 100 * time.Millisecond}
+	if _, err := c.FetchRoughtime(srv, nil); err == nil {
+		t.Error("FetchRoughtime() from an unsynchronized server succeeded")
+	}
+	stop()
+	if got := rec.drops(); got[DropUnavailable] == 0 {
+		t.Errorf("dropped %v, want %s", got, DropUnavailable)
+	}
+}
+
+func TestKernelClock(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("KernelClock is only supported on Linux")
+	}
+	iv, err := KernelClock{}.Now()
+	if errors.Is(err, ErrUnsynchronized) {
+		t.Skip("clock is not synchronized")
+	}
+	if err != nil || time.Since(iv.Midpoint).Abs() > time.Second || iv.Radius < 0 {
+		t.Errorf("KernelClock.Now() = %v, %v", iv, err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats keeps persistent statistics about roughtime servers.
+//
+// Stats records the reliability and latency of every server queried by a
+// roughtime.Client and can order servers by them, so reliable and fast servers
+// are queried first and failing ones last.
+package stats // import "github.com/Merovius/notary/stats"
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Merovius/notary/config"
+	"github.com/Merovius/notary/internal/statefile"
+	"github.com/Merovius/notary/roughtime"
+)
+
+// weight is the weight of a new query in the moving averages of Server.
+const weight = 0.2
+
+// Stats contains statistics about servers, by address. It implements
+// roughtime.Recorder and is safe for concurrent use.
+type Stats struct {
+	// Timeout is how long a query of a failing server is expected to take,
+	// the timeout of the client. If zero, roughtime.DefaultTimeout is used.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	servers map[string]*Server
+}
+
+var _ roughtime.Recorder = (*Stats)(nil)
+
+// Server contains statistics about a single server address.
+type Server struct {
+	Queries  int `json:"queries"`
+	Failures int `json:"failures"`
+	// Reliability is a moving average of successful queries, between 0 and
+	// 1. As it weights recent queries more, servers recover from past
+	// failures.
+	Reliability float64 `json:"reliability"`
+	// RTT is a moving average of the round-trip time of successful queries.
+	RTT         time.Duration `json:"rtt"`
+	LastSuccess time.Time     `json:"lastSuccess,omitzero"`
+	LastFailure time.Time     `json:"lastFailure,omitzero"`
+}
+
+// New returns empty statistics.
+func New() *Stats {
+	return &Stats{servers: make(map[string]*Server)}
+}
+
+// RecordQuery implements roughtime.Recorder.
+func (s *Stats) RecordQuery(address string, rtt time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.servers[address]
+	if st == nil {
+		st = new(Server)
+		s.servers[address] = st
+	}
+	ok := 0.0
+	if err == nil {
+		ok = 1
+	}
+	if st.Queries == 0 {
+		st.Reliability = ok
+	} else {
+		st.Reliability += weight * (ok - st.Reliability)
+	}
+	st.Queries++
+	if err != nil {
+		st.Failures++
+		st.LastFailure = time.Now()
+		return
+	}
+	st.LastSuccess = time.Now()
+	if st.RTT == 0 {
+		st.RTT = rtt
+	} else {
+		st.RTT += time.Duration(weight * float64(rtt-st.RTT))
+	}
+}
+
+// RecordOffset implements roughtime.Recorder. Offsets are not recorded.
+func (s *Stats) RecordOffset(address string, offset time.Duration) {}
+
+// Get returns the statistics of the server at address, if any.
+func (s *Stats) Get(address string) (Server, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.servers[address]
+	if st == nil {
+		return Server{}, false
+	}
+	return *st, true
+}
+
+// Addresses returns the addresses with statistics, sorted.
+func (s *Stats) Addresses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]string, 0, len(s.servers))
+	for a := range s.servers {
+		addrs = append(addrs, a)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+// timeout returns s.Timeout or its default.
+func (s *Stats) timeout() time.Duration {
+	if s.Timeout == 0 {
+		return roughtime.DefaultTimeout
+	}
+	return s.Timeout
+}
+
+// cost returns the expected time it takes to get an answer from the server
+// at address: its RTT if it responds and the timeout if not. Servers without
+// statistics are assumed to be as likely to fail as to succeed.
+func (s *Stats) cost(address string) time.Duration {
+	st := s.servers[address]
+	if st == nil {
+		return s.timeout() / 2
+	}
+	return time.Duration(st.Reliability*float64(st.RTT) + (1-st.Reliability)*float64(s.timeout()))
+}
+
+// Order returns the servers sorted by their expected cost, so reliable, fast
+// servers come first. Servers are identified by their first address. It can be
+// used as roughtime.Client.Order.
+func (s *Stats) Order(servers []*config.Server) []*config.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cost := func(srv *config.Server) time.Duration {
+		if len(srv.Addresses) == 0 {
+			return s.timeout()
+		}
+		return s.cost(srv.Addresses[0].Address)
+	}
+	sorted := slices.Clone(servers)
+	slices.SortStableFunc(sorted, func(a, b *config.Server) int {
+		return cmp.Compare(cost(a), cost(b))
+	})
+	return sorted
+}
+
+// DefaultPath returns the default location of the statistics file,
+// $XDG_STATE_HOME/notary/stats.json or ~/.local/state/notary/stats.json.
+func DefaultPath() (string, error) {
+	return statefile.StatePath("stats.json")
+}
+
+// Load reads statistics from the file name. If it does not exist, empty
+// statistics are returned.
+func Load(name string) (*Stats, error) {
+	var f file
+	if err := statefile.Load(name, &f); err != nil {
+		return nil, err
+	}
+	s := New()
+	for a, st := range f.Servers {
+		if st != nil {
+			s.servers[a] = st
+		}
+	}
+	return s, nil
+}
+
+// Save writes the statistics to the file name, creating its directory if
+// needed. The file is replaced atomically.
+func (s *Stats) Save(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return statefile.Save(name, file{Servers: s.servers})
+}
+
+// file is the format of the statistics file.
+type file struct {
+	Servers map[string]*Server `json:"servers"`
+}
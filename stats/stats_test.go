@@ -0,0 +1,120 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Merovius/notary/config"
+)
+
+func TestRecordQuery(t *testing.T) {
+	s := New()
+	s.RecordQuery("a", 100*time.Millisecond, nil)
+	s.RecordQuery("a", 200*time.Millisecond, nil)
+	s.RecordQuery("a", time.Second, errors.New("timeout"))
+
+	st, ok := s.Get("a")
+	if !ok {
+		t.Fatal("no statistics for a")
+	}
+	if st.Queries != 3 || st.Failures != 1 {
+		t.Errorf("Queries, Failures = %d, %d, want 3, 1", st.Queries, st.Failures)
+	}
+	if want := 120 * time.Millisecond; st.RTT != want {
+		t.Errorf("RTT = %v, want %v", st.RTT, want)
+	}
+	if want := 0.8; st.Reliability != want {
+		t.Errorf("Reliability = %v, want %v", st.Reliability, want)
+	}
+	if st.LastSuccess.IsZero() || st.LastFailure.IsZero() {
+		t.Errorf("LastSuccess, LastFailure = %v, %v, want both set", st.LastSuccess, st.LastFailure)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Error("Get(b) succeeded, want no statistics")
+	}
+}
+
+func TestOrder(t *testing.T) {
+	s := New()
+	for range 5 {
+		s.RecordQuery("slow", 500*time.Millisecond, nil)
+		s.RecordQuery("fast", 10*time.Millisecond, nil)
+		s.RecordQuery("failing", 0, errors.New("timeout"))
+	}
+	server := func(addr string) *config.Server {
+		return &config.Server{Name: addr, Addresses: []*config.ServerAddress{{Address: addr}}}
+	}
+	servers := []*config.Server{server("failing"), server("unknown"), server("slow"), server("fast")}
+	var got []string
+	for _, srv := range s.Order(servers) {
+		got = append(got, srv.Name)
+	}
+	if want := []string{"fast", "slow", "unknown", "failing"}; !slices.Equal(got, want) {
+		t.Errorf("Order = %v, want %v", got, want)
+	}
+	if servers[0].Name != "failing" {
+		t.Error("Order modified its argument")
+	}
+
+	// With a short timeout, trying an unknown server is cheaper than a
+	// slow one.
+	s.Timeout = 600 * time.Millisecond
+	got = got[:0]
+	for _, srv := range s.Order(servers) {
+		got = append(got, srv.Name)
+	}
+	if want := []string{"fast", "unknown", "slow", "failing"}; !slices.Equal(got, want) {
+		t.Errorf("Order(Timeout=%v) = %v, want %v", s.Timeout, got, want)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state", "stats.json")
+	s, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load of missing file: %v", err)
+	}
+	if len(s.Addresses()) != 0 {
+		t.Fatalf("Load of missing file returned %v, want no statistics", s.Addresses())
+	}
+	s.RecordQuery("a", 100*time.Millisecond, nil)
+	s.RecordQuery("b", 0, errors.New("timeout"))
+	if err := s.Save(name); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	l, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got, want := l.Addresses(), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("Addresses = %v, want %v", got, want)
+	}
+	for _, a := range []string{"a", "b"} {
+		want, _ := s.Get(a)
+		got, _ := l.Get(a)
+		if !got.LastSuccess.Equal(want.LastSuccess) || !got.LastFailure.Equal(want.LastFailure) {
+			t.Errorf("loaded times of %s = %v, %v, want %v, %v", a, got.LastSuccess, got.LastFailure, want.LastSuccess, want.LastFailure)
+		}
+		got.LastSuccess, got.LastFailure = want.LastSuccess, want.LastFailure
+		if got != want {
+			t.Errorf("loaded statistics of %s = %+v, want %+v", a, got, want)
+		}
+	}
+}
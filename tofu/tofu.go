@@ -0,0 +1,134 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tofu implements trust on first use for roughtime servers.
+//
+// A Store records the keys of servers that are not in the server list the
+// first time they are seen and rejects responses if the key of a server
+// changes later. Its Trust method can be used as
+// roughtime.Client.TrustUnknownKey.
+package tofu // import "github.com/Merovius/notary/tofu"
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Merovius/notary/internal/statefile"
+)
+
+// Pin records the key seen for a server address.
+type Pin struct {
+	// Address is the address of the server, or empty if the key was seen
+	// without an address. It is not authenticated: for chains, it comes
+	// from the link metadata, which is not signed by the server.
+	Address   string            `json:"address,omitempty"`
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	FirstSeen time.Time         `json:"firstSeen"`
+}
+
+// KeyChangedError is returned by Trust if a server uses a different key than
+// the one pinned for its address. This either means the server rotated its key
+// or that someone is impersonating it.
+type KeyChangedError struct {
+	Address string
+	// Pinned is the pin of the address and Key the new key.
+	Pinned Pin
+	Key    ed25519.PublicKey
+}
+
+func (e *KeyChangedError) Error() string {
+	return fmt.Sprintf("KEY OF %s CHANGED: pinned key %x (first seen %v), got %x", e.Address, e.Pinned.PublicKey, e.Pinned.FirstSeen.Format(time.RFC3339), e.Key)
+}
+
+// Store contains pinned keys. It is safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	pins []Pin
+
+	// OnPin, if set, is called whenever a new key is pinned. It may call
+	// methods of the Store, like Save.
+	OnPin func(Pin)
+}
+
+// Trust checks key against the pins of address. If address is pinned to a
+// different key, it returns a *KeyChangedError. If key is not pinned for
+// address, it is pinned. An empty address only matches pins of the same key.
+//
+// Whoever provides address controls which pin a key is checked against. A
+// chain can name an address that was never pinned, or none, to have any key
+// pinned, so pins only detect key changes of servers the chain claims
+// truthfully to have queried.
+func (s *Store) Trust(address string, key ed25519.PublicKey) error {
+	p, pinned, err := s.pin(address, key)
+	if pinned && s.OnPin != nil {
+		s.OnPin(p)
+	}
+	return err
+}
+
+// pin implements Trust and reports whether key was pinned.
+func (s *Store) pin(address string, key ed25519.PublicKey) (Pin, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pins {
+		switch {
+		case address != "" && p.Address == address && !bytes.Equal(p.PublicKey, key):
+			return Pin{}, false, &KeyChangedError{address, p, bytes.Clone(key)}
+		case bytes.Equal(p.PublicKey, key) && (address == "" || p.Address == address):
+			return Pin{}, false, nil
+		}
+	}
+	p := Pin{Address: address, PublicKey: bytes.Clone(key), FirstSeen: time.Now()}
+	s.pins = append(s.pins, p)
+	return p, true, nil
+}
+
+// Pins returns all pins, in the order they were added.
+func (s *Store) Pins() []Pin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Pin(nil), s.pins...)
+}
+
+// DefaultPath returns the default location of the pin store,
+// $XDG_STATE_HOME/notary/pins.json or ~/.local/state/notary/pins.json.
+func DefaultPath() (string, error) {
+	return statefile.StatePath("pins.json")
+}
+
+// Load reads pins from the file name. If it does not exist, an empty Store is
+// returned.
+func Load(name string) (*Store, error) {
+	var f file
+	if err := statefile.Load(name, &f); err != nil {
+		return nil, err
+	}
+	return &Store{pins: f.Pins}, nil
+}
+
+// Save writes the pins to the file name, creating its directory if needed.
+// The file is replaced atomically.
+func (s *Store) Save(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return statefile.Save(name, file{Pins: s.pins})
+}
+
+// file is the format of the pin store.
+type file struct {
+	Pins []Pin `json:"pins"`
+}
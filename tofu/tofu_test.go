@@ -0,0 +1,79 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tofu
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrust(t *testing.T) {
+	var pinned []Pin
+	s := &Store{OnPin: func(p Pin) { pinned = append(pinned, p) }}
+	k1, k2 := []byte("key one"), []byte("key two")
+
+	if err := s.Trust("a:2002", k1); err != nil {
+		t.Fatalf("Trust(new) = %v", err)
+	}
+	if err := s.Trust("a:2002", k1); err != nil {
+		t.Fatalf("Trust(pinned) = %v", err)
+	}
+	if err := s.Trust("", k1); err != nil {
+		t.Fatalf("Trust(pinned key without address) = %v", err)
+	}
+	if len(pinned) != 1 || pinned[0].Address != "a:2002" || pinned[0].FirstSeen.IsZero() {
+		t.Errorf("pinned %+v, want a:2002 once", pinned)
+	}
+
+	err := s.Trust("a:2002", k2)
+	var kerr *KeyChangedError
+	if !errors.As(err, &kerr) || kerr.Address != "a:2002" || string(kerr.Pinned.PublicKey) != string(k1) || string(kerr.Key) != string(k2) {
+		t.Errorf("Trust(changed key) = %v, want *KeyChangedError", err)
+	}
+	if err := s.Trust("b:2002", k2); err != nil {
+		t.Errorf("Trust(other address) = %v", err)
+	}
+	if err := s.Trust("", []byte("key three")); err != nil {
+		t.Errorf("Trust(new key without address) = %v", err)
+	}
+	if len(pinned) != 3 {
+		t.Errorf("pinned %d keys, want 3", len(pinned))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state", "pins.json")
+	s, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load of missing file: %v", err)
+	}
+	s.Trust("a:2002", []byte("key one"))
+	if err := s.Save(name); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	l, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	pins := l.Pins()
+	if len(pins) != 1 || pins[0].Address != "a:2002" || !pins[0].FirstSeen.Equal(s.Pins()[0].FirstSeen) {
+		t.Fatalf("loaded pins %+v, want %+v", pins, s.Pins())
+	}
+	var kerr *KeyChangedError
+	if err := l.Trust("a:2002", []byte("key two")); !errors.As(err, &kerr) {
+		t.Errorf("Trust(changed key) after Load = %v, want *KeyChangedError", err)
+	}
+}
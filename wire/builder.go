@@ -0,0 +1,108 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MessageBuilder collects the fields of a message in arbitrary order and
+// encodes them with sorted tags. It is more convenient, but slower, than
+// Encode. The zero value is an empty message.
+type MessageBuilder struct {
+	fields []builderField
+}
+
+type builderField struct {
+	tag   Tag
+	value []byte
+	msg   *MessageBuilder
+}
+
+// Bytes adds a field with tag t and value v. The length of v must be a
+// multiple of 4. v is not copied.
+func (b *MessageBuilder) Bytes(t Tag, v []byte) {
+	b.fields = append(b.fields, builderField{tag: t, value: v})
+}
+
+// Bytes32 adds a field with tag t and value v.
+func (b *MessageBuilder) Bytes32(t Tag, v [32]byte) {
+	b.Bytes(t, v[:])
+}
+
+// Bytes64 adds a field with tag t and value v.
+func (b *MessageBuilder) Bytes64(t Tag, v [64]byte) {
+	b.Bytes(t, v[:])
+}
+
+// Uint32 adds a field with tag t and value v.
+func (b *MessageBuilder) Uint32(t Tag, v uint32) {
+	b.Bytes(t, binary.LittleEndian.AppendUint32(nil, v))
+}
+
+// Uint64 adds a field with tag t and value v.
+func (b *MessageBuilder) Uint64(t Tag, v uint64) {
+	b.Bytes(t, binary.LittleEndian.AppendUint64(nil, v))
+}
+
+// Time adds a field with tag t and value v.
+func (b *MessageBuilder) Time(t Tag, v time.Time) {
+	b.Uint64(t, uint64(v.UnixNano()/1000))
+}
+
+// Duration adds a field with tag t and value v.
+func (b *MessageBuilder) Duration(t Tag, v time.Duration) {
+	b.Uint32(t, uint32(v/time.Microsecond))
+}
+
+// Message adds a field with tag t, containing the submessage m. m is encoded
+// when b is built, so later changes to m are reflected.
+func (b *MessageBuilder) Message(t Tag, m *MessageBuilder) {
+	b.fields = append(b.fields, builderField{tag: t, msg: m})
+}
+
+// Build encodes the message. It returns an error if a tag was added more than
+// once or a field has an invalid length.
+func (b *MessageBuilder) Build() ([]byte, error) {
+	return b.Append(nil)
+}
+
+// Append is like Build, but appends the message to buf.
+func (b *MessageBuilder) Append(buf []byte) ([]byte, error) {
+	return Append(buf, b.encode)
+}
+
+func (b *MessageBuilder) encode(st *EncodeState) {
+	sort.SliceStable(b.fields, func(i, j int) bool {
+		return b.fields[i].tag < b.fields[j].tag
+	})
+	for i := 1; i < len(b.fields); i++ {
+		if b.fields[i-1].tag == b.fields[i].tag {
+			st.fail(fmt.Errorf("duplicate field %v", b.fields[i].tag))
+			return
+		}
+	}
+	st.NTags(uint32(len(b.fields)))
+	for _, f := range b.fields {
+		if f.msg != nil {
+			st.Message(f.tag, f.msg.encode)
+		} else {
+			copy(st.Bytes(f.tag, len(f.value)), f.value)
+		}
+	}
+}
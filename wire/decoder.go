@@ -0,0 +1,389 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+)
+
+var (
+	errMsgTooShort      = errors.New("message too short")
+	errTooManyFields    = errors.New("too many fields")
+	errFieldMissing     = errors.New("missing field")
+	errUnexpectedField  = errors.New("unexpected field")
+	errInvalidOffset    = errors.New("invalid offset")
+	errUnsortedTags     = errors.New("tags not sorted")
+	errInvalidMessage   = errors.New("invalid message")
+	errInvalidField     = errors.New("invalid field")
+	errInvalidTimestamp = errors.New("invalid timestamp")
+	errInvalidDuration  = errors.New("invalid duration")
+)
+
+// DecodeState holds state about the decoding process. It is not supposed to be
+// used directly - call Decode instead.
+type DecodeState struct {
+	hdr    []byte
+	body   []byte
+	dec    *decoder
+	i      uint32
+	n      uint32
+	strict bool
+}
+
+// decoder holds the state shared by a message and its submessages. To avoid
+// allocations, decoders are pooled and contain the DecodeStates for the first
+// few levels of nesting.
+type decoder struct {
+	err    error
+	depth  int
+	states [4]DecodeState
+}
+
+var decoderPool = sync.Pool{New: func() any { return new(decoder) }}
+
+// state returns a fresh DecodeState for the next level of nesting.
+func (d *decoder) state(strict bool) *DecodeState {
+	var st *DecodeState
+	if d.depth < len(d.states) {
+		st = &d.states[d.depth]
+	} else {
+		st = new(DecodeState)
+	}
+	d.depth++
+	*st = DecodeState{dec: d, strict: strict}
+	return st
+}
+
+var sentinel = new(int8)
+
+// Decode runs f to decode msg. f can use the passed DecodeState to extract the
+// wanted fields. Fields not extracted by f are ignored.
+func Decode(msg []byte, f func(st *DecodeState)) (err error) {
+	return decode(msg, f, false)
+}
+
+// DecodeStrict is like Decode, but fails if msg or any of its decoded
+// submessages contain fields that are not extracted by f.
+func DecodeStrict(msg []byte, f func(st *DecodeState)) (err error) {
+	return decode(msg, f, true)
+}
+
+func decode(msg []byte, f func(st *DecodeState), strict bool) error {
+	dec := decoderPool.Get().(*decoder)
+	dec.err, dec.depth = nil, 0
+	run(dec, msg, f, strict)
+	err := dec.err
+	// Do not retain references to the message in the pool.
+	dec.states = [len(dec.states)]DecodeState{}
+	dec.err = nil
+	decoderPool.Put(dec)
+	return err
+}
+
+func run(dec *decoder, msg []byte, f func(st *DecodeState), strict bool) {
+	defer func() {
+		if v := recover(); v != nil && v != sentinel {
+			panic(v)
+		}
+	}()
+	st := dec.state(strict)
+	st.SetMessage(msg)
+	f(st)
+	st.done()
+}
+
+// done aborts if d is strict and not all fields have been consumed.
+func (d *DecodeState) done() {
+	if d.strict && d.i < d.n {
+		tag, _ := d.field(d.i)
+		d.Abort(fmt.Errorf("%w %v", errUnexpectedField, tag))
+	}
+}
+
+// Abort aborts the coding process with the given error.
+func (d *DecodeState) Abort(e error) {
+	if e != nil {
+		d.dec.err = e
+		panic(sentinel)
+	}
+}
+
+// SetMessage validates the message header of msg and starts decoding.
+func (d *DecodeState) SetMessage(msg []byte) {
+	if len(msg) < 4 {
+		d.Abort(errMsgTooShort)
+	}
+	d.n = binary.LittleEndian.Uint32(msg)
+	if uint32(len(msg))/8 < d.n {
+		d.Abort(errMsgTooShort)
+	}
+	var (
+		t = binary.LittleEndian.Uint32(msg[4*d.n:])
+		o uint32
+		// offsets are relative to the end of the header
+		l = uint32(len(msg)) - 8*d.n
+	)
+	for i := uint32(1); i < d.n; i++ {
+		o2, t2 := binary.LittleEndian.Uint32(msg[i*4:]), binary.LittleEndian.Uint32(msg[d.n*4+i*4:])
+		if t2 <= t || o2 < o || o2 > l {
+			d.Abort(errInvalidMessage)
+		}
+		t, o = t2, o2
+	}
+	d.hdr = msg[0 : 8*d.n : 8*d.n]
+	d.body = msg[8*d.n:]
+}
+
+func (d *DecodeState) field(i uint32) (Tag, []byte) {
+	tag := Tag(binary.LittleEndian.Uint32(d.hdr[d.n*4+i*4:]))
+	start, end := uint32(0), uint32(len(d.body))
+	if i > 0 {
+		start = binary.LittleEndian.Uint32(d.hdr[i*4:])
+	}
+	if i+1 < d.n {
+		end = binary.LittleEndian.Uint32(d.hdr[(i+1)*4:])
+	}
+	if end < start || ((end-start)%4 != 0) {
+		d.Abort(errInvalidField)
+	}
+	return tag, d.body[start:end]
+}
+
+// Fields returns an iterator over the remaining fields of the message and their
+// values, in order. Iterating advances through the message, so fields yielded
+// by it can not be extracted with other methods afterwards. The values alias
+// the message buffer.
+func (d *DecodeState) Fields() iter.Seq2[Tag, []byte] {
+	return func(yield func(Tag, []byte) bool) {
+		for d.i < d.n {
+			tag, value := d.field(d.i)
+			d.i++
+			if !yield(tag, value) {
+				return
+			}
+		}
+	}
+}
+
+// lookup advances through the fields of the message until it finds t and
+// returns the corresponding value. Fields with smaller tags are skipped. If t
+// is not found, lookup aborts if required is set and otherwise returns false,
+// leaving any fields with tags larger than t to be consumed.
+func (d *DecodeState) lookup(t Tag, required bool) ([]byte, bool) {
+	for ; d.i < d.n; d.i++ {
+		tag, value := d.field(d.i)
+		if tag < t {
+			if d.strict {
+				d.Abort(fmt.Errorf("%w %v", errUnexpectedField, tag))
+			}
+			continue
+		}
+		if tag > t {
+			break
+		}
+		d.i++
+		return value, true
+	}
+	if required {
+		d.Abort(fmt.Errorf("%w %v", errFieldMissing, t))
+	}
+	return nil, false
+}
+
+// Bytes advances through the fields of the message until it finds t and stores
+// a slice to the corresponding data in p. The stored slice aliases the message
+// buffer.
+func (d *DecodeState) Bytes(t Tag, p *[]byte) {
+	*p, _ = d.lookup(t, true)
+}
+
+// BytesOptional is like Bytes, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) BytesOptional(t Tag, p *[]byte) bool {
+	buf, ok := d.lookup(t, false)
+	if ok {
+		*p = buf
+	}
+	return ok
+}
+
+// Uint32 advances through the fields of the message until it finds t and stores
+// the corresponding value as an uint32 in p.
+func (d *DecodeState) Uint32(t Tag, p *uint32) {
+	d.uint32(t, p, true)
+}
+
+// Uint32Optional is like Uint32, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) Uint32Optional(t Tag, p *uint32) bool {
+	return d.uint32(t, p, false)
+}
+
+func (d *DecodeState) uint32(t Tag, p *uint32, required bool) bool {
+	buf, ok := d.lookup(t, required)
+	if !ok {
+		return false
+	}
+	if len(buf) != 4 {
+		d.Abort(errInvalidField)
+	}
+	*p = binary.LittleEndian.Uint32(buf)
+	return true
+}
+
+// Uint64 advances through the fields of the message until it finds t and stores
+// the corresponding value as an uint64 in p.
+func (d *DecodeState) Uint64(t Tag, p *uint64) {
+	d.uint64(t, p, true)
+}
+
+// Uint64Optional is like Uint64, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) Uint64Optional(t Tag, p *uint64) bool {
+	return d.uint64(t, p, false)
+}
+
+func (d *DecodeState) uint64(t Tag, p *uint64, required bool) bool {
+	buf, ok := d.lookup(t, required)
+	if !ok {
+		return false
+	}
+	if len(buf) != 8 {
+		d.Abort(errInvalidField)
+	}
+	*p = binary.LittleEndian.Uint64(buf)
+	return true
+}
+
+// Bytes32 advances through the fields of the message until it finds t and stores
+// the corresponding value (which must be 32 bytes long) into p.
+func (d *DecodeState) Bytes32(t Tag, p *[32]byte) {
+	d.bytesN(t, p[:], true)
+}
+
+// Bytes32Optional is like Bytes32, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) Bytes32Optional(t Tag, p *[32]byte) bool {
+	return d.bytesN(t, p[:], false)
+}
+
+// Bytes64 advances through the fields of the message until it finds t and stores
+// the corresponding value (which must be 64 bytes long) into p.
+func (d *DecodeState) Bytes64(t Tag, p *[64]byte) {
+	d.bytesN(t, p[:], true)
+}
+
+// Bytes64Optional is like Bytes64, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) Bytes64Optional(t Tag, p *[64]byte) bool {
+	return d.bytesN(t, p[:], false)
+}
+
+func (d *DecodeState) bytesN(t Tag, p []byte, required bool) bool {
+	buf, ok := d.lookup(t, required)
+	if !ok {
+		return false
+	}
+	if len(buf) != len(p) {
+		d.Abort(errInvalidField)
+	}
+	copy(p, buf)
+	return true
+}
+
+// Message advances through the fields of the message until it finds t. The
+// corresponding value is then decoded using f and also stored in raw. raw
+// aliases the message buffer.
+func (d *DecodeState) Message(t Tag, raw *[]byte, f func(*DecodeState)) {
+	d.message(t, raw, f, true)
+}
+
+// MessageOptional is like Message, but reports whether t is present instead of
+// aborting if it is not. If t is not present, f is not called.
+func (d *DecodeState) MessageOptional(t Tag, raw *[]byte, f func(*DecodeState)) bool {
+	return d.message(t, raw, f, false)
+}
+
+func (d *DecodeState) message(t Tag, raw *[]byte, f func(*DecodeState), required bool) bool {
+	buf, ok := d.lookup(t, required)
+	if !ok {
+		return false
+	}
+	if len(buf) < 4 {
+		d.Abort(errInvalidMessage)
+	}
+	st := d.dec.state(d.strict)
+	st.SetMessage(buf)
+	f(st)
+	st.done()
+	d.dec.depth--
+	*raw = buf
+	return true
+}
+
+// Time advances through the fields of the message until it finds t and stores
+// the corresponding value (interpreted as an uint64 of microseconds since the
+// epoch) into p.
+func (d *DecodeState) Time(t Tag, p *time.Time) {
+	d.time(t, p, true)
+}
+
+// TimeOptional is like Time, but reports whether t is present instead of
+// aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) TimeOptional(t Tag, p *time.Time) bool {
+	return d.time(t, p, false)
+}
+
+func (d *DecodeState) time(t Tag, p *time.Time, required bool) bool {
+	var v uint64
+	if !d.uint64(t, &v, required) {
+		return false
+	}
+	if v&(1<<63) != 0 {
+		d.Abort(errInvalidTimestamp)
+	}
+	*p = time.Unix(int64(v)/1e6, (int64(v)%1e6)*1e3)
+	return true
+}
+
+// Duration advances through the fields of the message until it finds t and
+// stores the corresponding value (interpreted as an uint32 of microseconds)
+// into p.
+func (d *DecodeState) Duration(t Tag, p *time.Duration) {
+	d.duration(t, p, true)
+}
+
+// DurationOptional is like Duration, but reports whether t is present instead
+// of aborting if it is not. If t is not present, p is left unmodified.
+func (d *DecodeState) DurationOptional(t Tag, p *time.Duration) bool {
+	return d.duration(t, p, false)
+}
+
+func (d *DecodeState) duration(t Tag, p *time.Duration, required bool) bool {
+	var v uint32
+	if !d.uint32(t, &v, required) {
+		return false
+	}
+	*p = time.Duration(v) * time.Microsecond
+	if time.Duration(v) != *p/time.Microsecond {
+		d.Abort(errInvalidDuration)
+	}
+	return true
+}
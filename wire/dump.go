@@ -0,0 +1,91 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDumpBytes is the number of bytes of a value printed by Dump.
+const maxDumpBytes = 64
+
+// Dump writes a human-readable tree of the fields in msg to w. Values that
+// look like messages themselves are dumped recursively.
+func Dump(w io.Writer, msg []byte) error {
+	type field struct {
+		tag   Tag
+		value []byte
+	}
+	var fields []field
+	err := Decode(msg, func(st *DecodeState) {
+		for t, v := range st.Fields() {
+			fields = append(fields, field{t, v})
+		}
+	})
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "message (%d fields, %d bytes)\n", len(fields), len(msg))
+	var dump func(depth int, msg []byte)
+	dump = func(depth int, msg []byte) {
+		Decode(msg, func(st *DecodeState) {
+			for t, v := range st.Fields() {
+				indent := strings.Repeat("  ", depth)
+				if isMessage(v) {
+					fmt.Fprintf(bw, "%s%-6s (%d bytes):\n", indent, t, len(v))
+					dump(depth+1, v)
+					continue
+				}
+				fmt.Fprintf(bw, "%s%-6s (%d bytes): %s\n", indent, t, len(v), dumpValue(v))
+			}
+		})
+	}
+	dump(1, msg)
+	return bw.Flush()
+}
+
+func dumpValue(v []byte) string {
+	if len(v) <= maxDumpBytes {
+		return fmt.Sprintf("%x", v)
+	}
+	return fmt.Sprintf("%x... (%d more bytes)", v[:maxDumpBytes], len(v)-maxDumpBytes)
+}
+
+// isMessage guesses whether v contains a message. It reports true if v can be
+// decoded and all its tags consist of printable ASCII, NUL or 0xff bytes, as
+// used by the roughtime protocol.
+func isMessage(v []byte) bool {
+	if len(v) < 8 || binary.LittleEndian.Uint32(v) == 0 {
+		return false
+	}
+	ok := true
+	err := Decode(v, func(st *DecodeState) {
+		for t := range st.Fields() {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], uint32(t))
+			for _, c := range b {
+				if (c < ' ' || c > '~') && c != 0 && c != 0xff {
+					ok = false
+				}
+			}
+		}
+	})
+	return err == nil && ok
+}
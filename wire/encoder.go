@@ -0,0 +1,195 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// EncodeState holds state about the encoding process. It is not supposed to be
+// used directly - call Encode instead.
+type EncodeState struct {
+	msg []byte
+	err error
+
+	// start is the offset of the message in msg, hdr the length of its
+	// header.
+	start int
+	hdr   int
+
+	n uint32
+	i uint32
+	t Tag
+}
+
+var (
+	errUnsortedFields = errors.New("tags not written in ascending order")
+	errFieldLength    = errors.New("length of field not multiple of 4")
+	errFieldCount     = errors.New("number of fields does not match NTags")
+	errEncodeTooLarge = errors.New("message too large")
+)
+
+// Encode runs f to encode a message. f can use the EncodeState to emit wanted
+// fields. The message buffer grows as needed. Encode panics if f emits an
+// invalid sequence of fields.
+func Encode(f func(st *EncodeState)) []byte {
+	msg, err := Append(make([]byte, 0, 1024), f)
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
+
+// Append is like Encode, but appends the message to buf, growing it as needed.
+// Passing a buffer with sufficient capacity avoids allocations. If f emits an
+// invalid sequence of fields, an error is returned.
+func Append(buf []byte, f func(st *EncodeState)) ([]byte, error) {
+	st := &EncodeState{msg: buf, start: len(buf)}
+	f(st)
+	if st.err == nil && st.i != st.n {
+		st.err = errFieldCount
+	}
+	if st.err != nil {
+		return buf, st.err
+	}
+	return st.msg, nil
+}
+
+func (e *EncodeState) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// grow extends e.msg by n bytes and returns the new bytes.
+func (e *EncodeState) grow(n int) []byte {
+	l := len(e.msg)
+	e.msg = append(e.msg, make([]byte, n)...)
+	return e.msg[l : l+n]
+}
+
+// NTags sets the number of tags of the message. It must be called before any
+// other methods of EncodeState.
+func (e *EncodeState) NTags(n uint32) {
+	if uint64(n) > math.MaxUint32/8 {
+		e.fail(errEncodeTooLarge)
+		return
+	}
+	e.msg = e.msg[:e.start]
+	e.hdr = 4
+	if n > 0 {
+		e.hdr = 8 * int(n)
+	}
+	hdr := e.grow(e.hdr)
+	binary.LittleEndian.PutUint32(hdr, n)
+	e.n = n
+	e.i = 0
+	e.t = 0
+}
+
+// Length returns the length of the message, as far as encoded so far.
+func (e *EncodeState) Length() int {
+	return len(e.msg) - e.start
+}
+
+// Bytes emits a field with tag t and length n, which must be divisible by 4.
+// It returns a slice that the data should be written to. The slice is only
+// valid until the next call to a method of e.
+func (e *EncodeState) Bytes(t Tag, n int) []byte {
+	if !e.field(t, e.Length()-e.hdr, n) {
+		return make([]byte, max(n, 0))
+	}
+	return e.grow(n)
+}
+
+// field adds a field with tag t, starting at offset off of the body, with
+// length n to the header. It reports whether the field is valid.
+func (e *EncodeState) field(t Tag, off, n int) bool {
+	switch {
+	case e.err != nil:
+	case n < 0 || (n%4 != 0):
+		e.fail(errFieldLength)
+	case e.i >= e.n:
+		e.fail(errFieldCount)
+	case e.i > 0 && e.t >= t:
+		e.fail(errUnsortedFields)
+	case uint64(off)+uint64(n) > math.MaxUint32:
+		e.fail(errEncodeTooLarge)
+	}
+	if e.err != nil {
+		return false
+	}
+	e.t = t
+	hdr := e.msg[e.start : e.start+e.hdr]
+	if e.i > 0 {
+		binary.LittleEndian.PutUint32(hdr[4*e.i:], uint32(off))
+	}
+	binary.LittleEndian.PutUint32(hdr[4*e.n+4*e.i:], uint32(t))
+	e.i++
+	return true
+}
+
+// Bytes32 emits a field with tag t and value v.
+func (e *EncodeState) Bytes32(t Tag, v [32]byte) {
+	buf := e.Bytes(t, 32)
+	copy(buf, v[:])
+}
+
+// Bytes64 emits a field with tag t and value v.
+func (e *EncodeState) Bytes64(t Tag, v [64]byte) {
+	buf := e.Bytes(t, 64)
+	copy(buf, v[:])
+}
+
+// Uint32 emits a field with tag t and value v.
+func (e *EncodeState) Uint32(t Tag, v uint32) {
+	buf := e.Bytes(t, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+}
+
+// Uint64 emits a field with tag t and value v.
+func (e *EncodeState) Uint64(t Tag, v uint64) {
+	buf := e.Bytes(t, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+}
+
+// Message emits a field with tag t and calls f to encode a submessage.
+func (e *EncodeState) Message(t Tag, f func(*EncodeState)) {
+	if e.err != nil {
+		return
+	}
+	off := e.Length() - e.hdr
+	msg, err := Append(e.msg, f)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	n := len(msg) - len(e.msg)
+	e.msg = msg
+	e.field(t, off, n)
+}
+
+// Time emits a field with tag t and value v.
+func (e *EncodeState) Time(t Tag, v time.Time) {
+	e.Uint64(t, uint64(v.UnixNano()/1000))
+}
+
+// Duration emits a field with tag t and value v.
+func (e *EncodeState) Duration(t Tag, v time.Duration) {
+	e.Uint32(t, uint32(v/time.Microsecond))
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"unsafe"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var (
+			tags []Tag
+			vals [][]byte
+		)
+		err := Decode(data, func(st *DecodeState) {
+			for tag, val := range st.Fields() {
+				tags = append(tags, tag)
+				vals = append(vals, val)
+			}
+		})
+		if err != nil {
+			return
+		}
+		for i := 1; i < len(tags); i++ {
+			if tags[i] <= tags[i-1] {
+				t.Fatalf("tags not sorted: %v", tags)
+			}
+		}
+		checkOverlap(t, vals)
+
+		m, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal(%x) = %v, but Decode succeeded", data, err)
+		}
+		out, err := Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(Unmarshal(%x)) = %v", data, err)
+		}
+		m2, err := Unmarshal(out)
+		if err != nil {
+			t.Fatalf("Unmarshal(Marshal(Unmarshal(%x))) = %v", data, err)
+		}
+		for tag, v := range m {
+			if bytes.Compare(m2[tag], v) != 0 {
+				t.Fatalf("round trip of %x changed field %v from %x to %x", data, tag, v, m2[tag])
+			}
+		}
+	})
+}
+
+func checkOverlap(t *testing.T, vals [][]byte) {
+	sort.Slice(vals, func(i, j int) bool {
+		a, b := vals[i], vals[j]
+		if len(a) == 0 || len(b) == 0 {
+			return len(a) < len(b)
+		}
+		return uintptr(unsafe.Pointer(&a[0])) < uintptr(unsafe.Pointer(&b[0]))
+	})
+	for len(vals) > 0 && len(vals[0]) == 0 {
+		vals = vals[1:]
+	}
+	for i := 1; i < len(vals); i++ {
+		a := vals[i-1]
+		b := vals[i]
+		if uintptr(unsafe.Pointer(&a[0]))+uintptr(len(a)) > uintptr(unsafe.Pointer(&b[0])) {
+			t.Fatal("overlapping values")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+// Marshal encodes a message containing the fields in m. The length of every
+// value must be a multiple of 4.
+func Marshal(m map[Tag][]byte) ([]byte, error) {
+	var b MessageBuilder
+	for t, v := range m {
+		b.Bytes(t, v)
+	}
+	return b.Build()
+}
+
+// Unmarshal decodes msg into a map of its fields. The values alias msg.
+// Submessages are not decoded.
+func Unmarshal(msg []byte) (map[Tag][]byte, error) {
+	m := make(map[Tag][]byte)
+	err := Decode(msg, func(st *DecodeState) {
+		for t, v := range st.Fields() {
+			m[t] = v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,424 @@
+// Copyright 2018 Axel Wagner
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tcs := []struct {
+		in        string
+		wantTags  []string
+		wantBytes []string
+		wantErr   bool
+	}{
+		// No data
+		{"", nil, nil, true},
+		// Data too short
+		{"010203", nil, nil, true},
+		// No fields
+		{"00000000", nil, nil, false},
+		// Missing tags
+		{"01000000", nil, nil, true},
+		// Empty field
+		{"0100000054455354", []string{"TEST"}, []string{""}, false},
+		// Field length not multiple of 4
+		{"0100000054455354464f4f", nil, nil, true},
+		// Single field
+		{"0100000054455354464f4f0a", []string{"TEST"}, []string{"FOO\n"}, false},
+		// Wrong order of tags
+		{"0200000004000000454747535350414d464f4f0a4241520a", nil, nil, true},
+		// Two fields
+		{"02000000040000005350414d45474753464f4f0a4241520a", []string{"SPAM", "EGGS"}, []string{"FOO\n", "BAR\n"}, false},
+		// Wrong order of offsets
+		{"0300000008000000040000005350414d4547475354455354464f4f0a4241520a", nil, nil, true},
+		// Three fields
+		{"0300000004000000080000005350414d4547475354455354464f4f0a4241520a", []string{"SPAM", "EGGS", "TEST"}, []string{"FOO\n", "BAR\n", ""}, false},
+	}
+	for _, tc := range tcs {
+		check := func(st *DecodeState) {
+			for i, stag := range tc.wantTags {
+				var content []byte
+				tag := makeTag(stag)
+				st.Bytes(tag, &content)
+				if bytes.Compare(content, []byte(tc.wantBytes[i])) != 0 {
+					t.Errorf("st.Bytes(%v) = %x, want %x", tag, content, tc.wantBytes[i])
+				}
+			}
+			for tag, value := range st.Fields() {
+				t.Errorf("unused field %v with content %x in test input", tag, value)
+			}
+		}
+		err := Decode(hexBytes(tc.in), check)
+		if err != nil && !tc.wantErr {
+			t.Errorf("Decode(%q) = %v, want nil", tc.in, err)
+		}
+		if err == nil && tc.wantErr {
+			t.Errorf("Decode(%q) = <nil>, want error", tc.in)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	in := hexBytes("0300000004000000080000005350414d4547475354455354464f4f0a4241520a")
+	var got []string
+	err := Decode(in, func(st *DecodeState) {
+		var spam []byte
+		st.Bytes(makeTag("SPAM"), &spam)
+		for tag, value := range st.Fields() {
+			got = append(got, fmt.Sprintf("%v=%q", tag, value))
+		}
+	})
+	want := []string{`EGGS="BAR\n"`, `TEST=""`}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %q, %v, want %q, <nil>", got, err, want)
+	}
+}
+
+func TestDecodeOptional(t *testing.T) {
+	in := hexBytes("0300000004000000080000005350414d4547475354455354464f4f0a4241520a")
+	var (
+		found  []bool
+		spam   uint32
+		tst    []byte
+		absent = uint64(23)
+	)
+	err := Decode(in, func(st *DecodeState) {
+		found = append(found, st.Uint64Optional(makeTag("AAAA"), &absent))
+		found = append(found, st.Uint32Optional(makeTag("SPAM"), &spam))
+		found = append(found, st.Uint64Optional(makeTag("FOOB"), &absent))
+		found = append(found, st.BytesOptional(makeTag("TEST"), &tst))
+		found = append(found, st.BytesOptional(makeTag("ZZZZ"), &tst))
+	})
+	if err != nil {
+		t.Fatalf("Decode(%x) = %v, want <nil>", in, err)
+	}
+	if want := []bool{false, true, false, true, false}; !reflect.DeepEqual(found, want) {
+		t.Errorf("fields found = %v, want %v", found, want)
+	}
+	if spam != 0x0a4f4f46 || len(tst) != 0 || absent != 23 {
+		t.Errorf("decoded SPAM = %x, TEST = %q, absent field = %d, want 0a4f4f46, \"\", 23", spam, tst, absent)
+	}
+
+	// Invalid optional fields must still abort.
+	err = Decode(in, func(st *DecodeState) {
+		st.Uint64Optional(makeTag("SPAM"), &absent)
+	})
+	if err == nil {
+		t.Errorf("Decode(%x) with invalid optional field = <nil>, want error", in)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	in := Encode(func(st *EncodeState) {
+		st.NTags(3)
+		st.Uint32(makeTag("SPAM"), 42)
+		st.Uint32(makeTag("EGGS"), 23)
+		st.Message(makeTag("TEST"), func(st *EncodeState) {
+			st.NTags(2)
+			st.Uint32(makeTag("SPAM"), 42)
+			st.Uint32(makeTag("EGGS"), 23)
+		})
+	})
+	var v uint32
+	tcs := []struct {
+		name    string
+		f       func(st *DecodeState)
+		wantErr bool
+	}{
+		{"all fields", func(st *DecodeState) {
+			st.Uint32(makeTag("SPAM"), &v)
+			st.Uint32(makeTag("EGGS"), &v)
+			var raw []byte
+			st.Message(makeTag("TEST"), &raw, func(st *DecodeState) {
+				for range st.Fields() {
+				}
+			})
+		}, false},
+		{"skipped field", func(st *DecodeState) {
+			st.Uint32(makeTag("EGGS"), &v)
+			var raw []byte
+			st.Message(makeTag("TEST"), &raw, func(st *DecodeState) {
+				for range st.Fields() {
+				}
+			})
+		}, true},
+		{"trailing field", func(st *DecodeState) {
+			st.Uint32(makeTag("SPAM"), &v)
+			st.Uint32(makeTag("EGGS"), &v)
+		}, true},
+		{"trailing field in submessage", func(st *DecodeState) {
+			st.Uint32(makeTag("SPAM"), &v)
+			st.Uint32(makeTag("EGGS"), &v)
+			var raw []byte
+			st.Message(makeTag("TEST"), &raw, func(st *DecodeState) {
+				st.Uint32(makeTag("SPAM"), &v)
+			})
+		}, true},
+	}
+	for _, tc := range tcs {
+		if err := Decode(in, tc.f); err != nil {
+			t.Errorf("Decode(%s) = %v, want <nil>", tc.name, err)
+		}
+		err := DecodeStrict(in, tc.f)
+		if err != nil && !tc.wantErr {
+			t.Errorf("DecodeStrict(%s) = %v, want <nil>", tc.name, err)
+		}
+		if err == nil && tc.wantErr {
+			t.Errorf("DecodeStrict(%s) = <nil>, want error", tc.name)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tcs := []struct {
+		inTags  []string
+		inBytes []string
+		want    string
+	}{
+		{nil, nil, "00000000"},
+		{[]string{"TEST"}, []string{""}, "0100000054455354"},
+		{[]string{"TEST"}, []string{"FOO\n"}, "0100000054455354464f4f0a"},
+		{[]string{"SPAM", "EGGS"}, []string{"FOO\n", "BAR\n"}, "02000000040000005350414d45474753464f4f0a4241520a"},
+		{[]string{"SPAM", "EGGS", "TEST"}, []string{"FOO\n", "BAR\n", ""}, "0300000004000000080000005350414d4547475354455354464f4f0a4241520a"},
+	}
+	for _, tc := range tcs {
+		enc := func(st *EncodeState) {
+			st.NTags(uint32(len(tc.inTags)))
+			for i, stag := range tc.inTags {
+				tag := makeTag(stag)
+				content := st.Bytes(tag, len(tc.inBytes[i]))
+				copy(content, tc.inBytes[i])
+			}
+		}
+		msg := Encode(enc)
+		if want := hexBytes(tc.want); bytes.Compare(msg, want) != 0 {
+			t.Errorf("Encode(%v) = %x, want %x", tc.inTags, msg, want)
+		}
+	}
+}
+
+func TestEncodeNested(t *testing.T) {
+	msg := Encode(func(st *EncodeState) {
+		st.NTags(2)
+		st.Uint32(makeTag("SPAM"), 42)
+		st.Message(makeTag("EGGS"), func(st *EncodeState) {
+			st.NTags(1)
+			copy(st.Bytes(makeTag("TEST"), 4), "FOO\n")
+		})
+	})
+	want := hexBytes("02000000040000005350414d454747532a0000000100000054455354464f4f0a")
+	if bytes.Compare(msg, want) != 0 {
+		t.Errorf("Encode(nested) = %x, want %x", msg, want)
+	}
+}
+
+func TestEncodeLarge(t *testing.T) {
+	msg := Encode(func(st *EncodeState) {
+		st.NTags(2)
+		st.Bytes(makeTag("SPAM"), 2048)
+		st.Message(makeTag("EGGS"), func(st *EncodeState) {
+			st.NTags(1)
+			st.Bytes(makeTag("TEST"), 4096)
+		})
+	})
+	if want := 16 + 2048 + 8 + 4096; len(msg) != want {
+		t.Errorf("len(Encode(large)) = %d, want %d", len(msg), want)
+	}
+	var spam, eggs []byte
+	err := Decode(msg, func(st *DecodeState) {
+		st.Bytes(makeTag("SPAM"), &spam)
+		st.Message(makeTag("EGGS"), &eggs, func(st *DecodeState) {
+			var test []byte
+			st.Bytes(makeTag("TEST"), &test)
+		})
+	})
+	if err != nil || len(spam) != 2048 || len(eggs) != 4104 {
+		t.Errorf("Decode(Encode(large)) = %v, fields of length %d and %d, want nil, 2048 and 4104", err, len(spam), len(eggs))
+	}
+}
+
+func TestAppendErrors(t *testing.T) {
+	tcs := []struct {
+		name string
+		f    func(st *EncodeState)
+	}{
+		{"unsorted", func(st *EncodeState) {
+			st.NTags(2)
+			st.Bytes(makeTag("EGGS"), 0)
+			st.Bytes(makeTag("SPAM"), 0)
+		}},
+		{"too many fields", func(st *EncodeState) {
+			st.NTags(1)
+			st.Bytes(makeTag("SPAM"), 0)
+			st.Bytes(makeTag("EGGS"), 0)
+		}},
+		{"too few fields", func(st *EncodeState) {
+			st.NTags(2)
+			st.Bytes(makeTag("SPAM"), 0)
+		}},
+		{"invalid length", func(st *EncodeState) {
+			st.NTags(1)
+			st.Bytes(makeTag("SPAM"), 3)
+		}},
+		{"invalid submessage", func(st *EncodeState) {
+			st.NTags(1)
+			st.Message(makeTag("SPAM"), func(st *EncodeState) {
+				st.NTags(1)
+			})
+		}},
+	}
+	for _, tc := range tcs {
+		buf := []byte("prefix")
+		msg, err := Append(buf, tc.f)
+		if err == nil {
+			t.Errorf("Append(%s) = %x, <nil>, want error", tc.name, msg)
+		}
+		if string(msg) != "prefix" {
+			t.Errorf("Append(%s) = %q, want unmodified buffer", tc.name, msg)
+		}
+	}
+}
+
+func TestMessageBuilder(t *testing.T) {
+	var sub MessageBuilder
+	sub.Bytes(makeTag("TEST"), []byte("FOO\n"))
+	var b MessageBuilder
+	b.Message(makeTag("EGGS"), &sub)
+	b.Uint32(makeTag("SPAM"), 42)
+	msg, err := b.Build()
+	want := Encode(func(st *EncodeState) {
+		st.NTags(2)
+		st.Uint32(makeTag("SPAM"), 42)
+		st.Message(makeTag("EGGS"), func(st *EncodeState) {
+			st.NTags(1)
+			copy(st.Bytes(makeTag("TEST"), 4), "FOO\n")
+		})
+	})
+	if err != nil || bytes.Compare(msg, want) != 0 {
+		t.Errorf("Build() = %x, %v, want %x, <nil>", msg, err, want)
+	}
+
+	b.Uint32(makeTag("SPAM"), 23)
+	if msg, err := b.Build(); err == nil {
+		t.Errorf("Build() with duplicate tag = %x, <nil>, want error", msg)
+	}
+
+	b = MessageBuilder{}
+	b.Message(makeTag("EGGS"), &sub)
+	sub.Bytes(makeTag("TEST"), nil)
+	if msg, err := b.Build(); err == nil {
+		t.Errorf("Build() with invalid submessage = %x, <nil>, want error", msg)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	m := map[Tag][]byte{
+		makeTag("TEST"): []byte(""),
+		makeTag("EGGS"): []byte("BAR\n"),
+		makeTag("SPAM"): []byte("FOO\n"),
+	}
+	msg, err := Marshal(m)
+	if want := hexBytes("0300000004000000080000005350414d4547475354455354464f4f0a4241520a"); err != nil || bytes.Compare(msg, want) != 0 {
+		t.Errorf("Marshal(%q) = %x, %v, want %x, <nil>", m, msg, err, want)
+	}
+	got, err := Unmarshal(msg)
+	if err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("Unmarshal(%x) = %q, %v, want %q, <nil>", msg, got, err, m)
+	}
+	if msg, err := Marshal(map[Tag][]byte{makeTag("SPAM"): []byte("FOO")}); err == nil {
+		t.Errorf("Marshal(invalid length) = %x, <nil>, want error", msg)
+	}
+	if m, err := Unmarshal(hexBytes("01000000")); err == nil {
+		t.Errorf("Unmarshal(invalid) = %q, <nil>, want error", m)
+	}
+}
+
+func hexBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func makeTag(s string) Tag {
+	if len(s) != 4 {
+		panic("invalid tag")
+	}
+	return Tag(binary.LittleEndian.Uint32([]byte(s)))
+}
+
+func TestDump(t *testing.T) {
+	var sub MessageBuilder
+	sub.Bytes(makeTag("TEST"), []byte("FOO\n"))
+	var b MessageBuilder
+	b.Message(makeTag("EGGS"), &sub)
+	b.Uint32(makeTag("SPAM"), 42)
+	msg, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Dump(&buf, msg); err != nil {
+		t.Fatalf("Dump(%x) = %v, want <nil>", msg, err)
+	}
+	want := "message (2 fields, 32 bytes)\n" +
+		"  SPAM   (4 bytes): 2a000000\n" +
+		"  EGGS   (12 bytes):\n" +
+		"    TEST   (4 bytes): 464f4f0a\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Dump(%x) =\n%s\nwant\n%s", msg, got, want)
+	}
+	if err := Dump(&buf, hexBytes("01000000")); err == nil {
+		t.Error("Dump(invalid) = <nil>, want error")
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	var sub MessageBuilder
+	sub.Bytes(makeTag("TEST"), []byte("FOO\n"))
+	sub.Uint64(makeTag("MIDP"), 42)
+	var mb MessageBuilder
+	mb.Message(makeTag("EGGS"), &sub)
+	mb.Uint32(makeTag("SPAM"), 42)
+	msg, err := mb.Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	var (
+		v   uint32
+		raw []byte
+		buf []byte
+	)
+	f := func(st *DecodeState) {
+		st.Uint32(makeTag("SPAM"), &v)
+		st.Message(makeTag("EGGS"), &raw, func(st *DecodeState) {
+			st.Bytes(makeTag("TEST"), &buf)
+		})
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := Decode(msg, f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}